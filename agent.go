@@ -209,6 +209,11 @@ func (c *controller) agentSetup(clusterProvider cluster.Provider) error {
 		return nil
 	}
 
+	if err := c.overlaySupported(); err != nil {
+		logrus.Errorf("Cannot join the cluster: %v", err)
+		return err
+	}
+
 	bindAddr := clusterProvider.GetLocalAddress()
 	advAddr := clusterProvider.GetAdvertiseAddress()
 	dataAddr := clusterProvider.GetDataPathAddress()
@@ -283,6 +288,19 @@ func (c *controller) getPrimaryKeyTag(subsys string) ([]byte, uint64, error) {
 	return keys[1].Key, keys[1].LamportTime, nil
 }
 
+// gossipListenAddr returns the address NetworkDB listens on. The nodes
+// advertising an IPv6 address cannot be reached on the unspecified IPv4
+// address, so they listen on the unspecified IPv6 one instead.
+func gossipListenAddr(listenAddr, advertiseAddr string) string {
+	if ip := net.ParseIP(advertiseAddr); ip == nil || ip.To4() != nil {
+		return listenAddr
+	}
+	if ip := net.ParseIP(listenAddr); listenAddr == "" || ip != nil && ip.Equal(net.IPv4zero) {
+		return net.IPv6unspecified.String()
+	}
+	return listenAddr
+}
+
 func (c *controller) agentInit(listenAddr, bindAddrOrInterface, advertiseAddr, dataPathAddr string) error {
 	bindAddr, err := resolveAddr(bindAddrOrInterface)
 	if err != nil {
@@ -292,7 +310,7 @@ func (c *controller) agentInit(listenAddr, bindAddrOrInterface, advertiseAddr, d
 	keys, _ := c.getKeys(subsysGossip)
 
 	netDBConf := networkdb.DefaultConfig()
-	netDBConf.BindAddr = listenAddr
+	netDBConf.BindAddr = gossipListenAddr(listenAddr, advertiseAddr)
 	netDBConf.AdvertiseAddr = advertiseAddr
 	netDBConf.Keys = keys
 	if c.Config().Daemon.NetworkControlPlaneMTU != 0 {
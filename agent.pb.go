@@ -168,6 +168,9 @@ type PortConfig struct {
 	// system. If specified it should be within the node port
 	// range and it should be available.
 	PublishedPort uint32 `protobuf:"varint,4,opt,name=published_port,json=publishedPort,proto3" json:"published_port,omitempty"`
+	// SourceCIDRs restricts the sources the published port is
+	// reachable from. If empty, the port is reachable from anywhere.
+	SourceCIDRs []string `protobuf:"bytes,5,rep,name=source_cidrs,json=sourceCidrs" json:"source_cidrs,omitempty"`
 }
 
 func (m *PortConfig) Reset()                    { *m = PortConfig{} }
@@ -202,6 +205,13 @@ func (m *PortConfig) GetPublishedPort() uint32 {
 	return 0
 }
 
+func (m *PortConfig) GetSourceCIDRs() []string {
+	if m != nil {
+		return m.SourceCIDRs
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*EndpointRecord)(nil), "libnetwork.EndpointRecord")
 	proto.RegisterType((*PortConfig)(nil), "libnetwork.PortConfig")
@@ -231,12 +241,13 @@ func (this *PortConfig) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 8)
+	s := make([]string, 0, 9)
 	s = append(s, "&libnetwork.PortConfig{")
 	s = append(s, "Name: "+fmt.Sprintf("%#v", this.Name)+",\n")
 	s = append(s, "Protocol: "+fmt.Sprintf("%#v", this.Protocol)+",\n")
 	s = append(s, "TargetPort: "+fmt.Sprintf("%#v", this.TargetPort)+",\n")
 	s = append(s, "PublishedPort: "+fmt.Sprintf("%#v", this.PublishedPort)+",\n")
+	s = append(s, "SourceCIDRs: "+fmt.Sprintf("%#v", this.SourceCIDRs)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -384,6 +395,21 @@ func (m *PortConfig) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintAgent(dAtA, i, uint64(m.PublishedPort))
 	}
+	if len(m.SourceCIDRs) > 0 {
+		for _, s := range m.SourceCIDRs {
+			dAtA[i] = 0x2a
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				dAtA[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			dAtA[i] = uint8(l)
+			i++
+			i += copy(dAtA[i:], s)
+		}
+	}
 	return i, nil
 }
 
@@ -459,6 +485,12 @@ func (m *PortConfig) Size() (n int) {
 	if m.PublishedPort != 0 {
 		n += 1 + sovAgent(uint64(m.PublishedPort))
 	}
+	if len(m.SourceCIDRs) > 0 {
+		for _, s := range m.SourceCIDRs {
+			l = len(s)
+			n += 1 + l + sovAgent(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -502,6 +534,7 @@ func (this *PortConfig) String() string {
 		`Protocol:` + fmt.Sprintf("%v", this.Protocol) + `,`,
 		`TargetPort:` + fmt.Sprintf("%v", this.TargetPort) + `,`,
 		`PublishedPort:` + fmt.Sprintf("%v", this.PublishedPort) + `,`,
+		`SourceCIDRs:` + fmt.Sprintf("%v", this.SourceCIDRs) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -933,6 +966,35 @@ func (m *PortConfig) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SourceCIDRs", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowAgent
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthAgent
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SourceCIDRs = append(m.SourceCIDRs, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipAgent(dAtA[iNdEx:])
@@ -1062,34 +1124,36 @@ var (
 func init() { proto.RegisterFile("agent.proto", fileDescriptorAgent) }
 
 var fileDescriptorAgent = []byte{
-	// 459 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x91, 0x31, 0x6f, 0xd3, 0x4c,
-	0x18, 0xc7, 0xe3, 0xc4, 0x6f, 0x1b, 0x3f, 0x4e, 0x52, 0xeb, 0xf4, 0x0a, 0x59, 0x1e, 0x1c, 0x13,
-	0x09, 0x29, 0x48, 0x28, 0x95, 0xca, 0xd8, 0x89, 0x26, 0x0c, 0x5e, 0x90, 0x75, 0x4d, 0x59, 0x83,
-	0x13, 0x1f, 0xe6, 0x54, 0xe3, 0xb3, 0xee, 0xae, 0x65, 0x65, 0x03, 0xf5, 0x3b, 0x74, 0xe2, 0xcb,
-	0x30, 0x32, 0x32, 0x55, 0xd4, 0x9f, 0x80, 0x95, 0x0d, 0xdd, 0xf9, 0xae, 0x11, 0x52, 0xb7, 0xf3,
-	0xef, 0xff, 0x3b, 0xeb, 0xb9, 0xff, 0x03, 0x7e, 0x5e, 0x92, 0x5a, 0x2e, 0x1a, 0xce, 0x24, 0x43,
-	0x50, 0xd1, 0x6d, 0x4d, 0xe4, 0x27, 0xc6, 0x2f, 0xa3, 0xff, 0x4b, 0x56, 0x32, 0x8d, 0x8f, 0xd5,
-	0xa9, 0x33, 0x66, 0x7f, 0xfa, 0x30, 0x79, 0x5d, 0x17, 0x0d, 0xa3, 0xb5, 0xc4, 0x64, 0xc7, 0x78,
-	0x81, 0x10, 0xb8, 0x75, 0xfe, 0x91, 0x84, 0x4e, 0xe2, 0xcc, 0x3d, 0xac, 0xcf, 0xe8, 0x29, 0x8c,
-	0x04, 0xe1, 0xd7, 0x74, 0x47, 0x36, 0x3a, 0xeb, 0xeb, 0xcc, 0x37, 0xec, 0x8d, 0x52, 0x5e, 0x00,
-	0x58, 0x85, 0x16, 0xe1, 0x40, 0x09, 0x67, 0xe3, 0xf6, 0x6e, 0xea, 0x9d, 0x77, 0x34, 0x5d, 0x61,
-	0xcf, 0x08, 0x69, 0xa1, 0xec, 0x6b, 0xca, 0xe5, 0x55, 0x5e, 0x6d, 0x68, 0x13, 0xba, 0x7b, 0xfb,
-	0x6d, 0x47, 0xd3, 0x0c, 0x7b, 0x46, 0x48, 0x1b, 0x74, 0x0c, 0x3e, 0x31, 0x43, 0x2a, 0xfd, 0x3f,
-	0xad, 0x4f, 0xda, 0xbb, 0x29, 0xd8, 0xd9, 0xd3, 0x0c, 0x83, 0x55, 0xd2, 0x06, 0x9d, 0xc2, 0x98,
-	0xd6, 0x25, 0x27, 0x42, 0x6c, 0x1a, 0xc6, 0xa5, 0x08, 0x0f, 0x92, 0xc1, 0xdc, 0x3f, 0x79, 0xb2,
-	0xd8, 0x17, 0xb2, 0xc8, 0x18, 0x97, 0x4b, 0x56, 0xbf, 0xa7, 0x25, 0x1e, 0x19, 0x59, 0x21, 0x81,
-	0x42, 0x38, 0xcc, 0x2b, 0x9a, 0x0b, 0x22, 0xc2, 0xc3, 0x64, 0x30, 0xf7, 0xb0, 0xfd, 0x54, 0x35,
-	0xc8, 0x5c, 0x5c, 0x6e, 0x6c, 0x3c, 0xd4, 0xb1, 0xaf, 0xd8, 0x2b, 0xa3, 0x3c, 0x87, 0xc0, 0xd6,
-	0x50, 0x50, 0x91, 0x6f, 0x2b, 0x52, 0x84, 0x5e, 0xe2, 0xcc, 0x87, 0xf8, 0xc8, 0xf0, 0x95, 0xc1,
-	0xb3, 0x2f, 0x7d, 0x80, 0xfd, 0x10, 0x8f, 0xf6, 0x7e, 0x0a, 0x43, 0xbd, 0xa7, 0x1d, 0xab, 0x74,
-	0xe7, 0x93, 0x93, 0xe9, 0xe3, 0x4f, 0x58, 0x64, 0x46, 0xc3, 0x0f, 0x17, 0xd0, 0x14, 0x7c, 0x99,
-	0xf3, 0x92, 0x48, 0xdd, 0x81, 0x5e, 0xc9, 0x18, 0x43, 0x87, 0xd4, 0x4d, 0xf4, 0x0c, 0x26, 0xcd,
-	0xd5, 0xb6, 0xa2, 0xe2, 0x03, 0x29, 0x3a, 0xc7, 0xd5, 0xce, 0xf8, 0x81, 0x2a, 0x6d, 0xf6, 0x0e,
-	0x86, 0xf6, 0xef, 0x28, 0x84, 0xc1, 0x7a, 0x99, 0x05, 0xbd, 0xe8, 0xe8, 0xe6, 0x36, 0xf1, 0x2d,
-	0x5e, 0x2f, 0x33, 0x95, 0x5c, 0xac, 0xb2, 0xc0, 0xf9, 0x37, 0xb9, 0x58, 0x65, 0x28, 0x02, 0xf7,
-	0x7c, 0xb9, 0xce, 0x82, 0x7e, 0x14, 0xdc, 0xdc, 0x26, 0x23, 0x1b, 0x29, 0x16, 0xb9, 0x5f, 0xbf,
-	0xc5, 0xbd, 0xb3, 0xf0, 0xe7, 0x7d, 0xdc, 0xfb, 0x7d, 0x1f, 0x3b, 0x9f, 0xdb, 0xd8, 0xf9, 0xde,
-	0xc6, 0xce, 0x8f, 0x36, 0x76, 0x7e, 0xb5, 0xb1, 0xb3, 0x3d, 0xd0, 0xaf, 0x79, 0xf9, 0x37, 0x00,
-	0x00, 0xff, 0xff, 0x55, 0x29, 0x75, 0x5c, 0xd7, 0x02, 0x00, 0x00,
+	// 487 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x91, 0x3f, 0x8f, 0xd3, 0x30,
+	0x18, 0xc6, 0x2f, 0x6d, 0xef, 0xae, 0x79, 0xd3, 0x7f, 0xb2, 0x10, 0xb2, 0x3a, 0xa4, 0xa1, 0x12,
+	0x52, 0x91, 0x50, 0x4f, 0x2a, 0xe3, 0x4d, 0x34, 0x65, 0xc8, 0x82, 0x22, 0xb7, 0xc7, 0x5a, 0xd2,
+	0xc4, 0x04, 0xeb, 0x42, 0x1c, 0xd9, 0xee, 0xb1, 0x32, 0xa2, 0xfb, 0x0e, 0x37, 0xf1, 0x31, 0xf8,
+	0x02, 0x8c, 0x8c, 0x4c, 0x15, 0x97, 0x4f, 0xc0, 0xca, 0x86, 0xec, 0x24, 0x57, 0x21, 0xdd, 0x66,
+	0xff, 0x9e, 0x9f, 0xa5, 0xd7, 0xcf, 0x0b, 0x4e, 0x94, 0xd2, 0x5c, 0xcd, 0x0b, 0xc1, 0x15, 0x47,
+	0x90, 0xb1, 0x5d, 0x4e, 0xd5, 0x67, 0x2e, 0xae, 0xc7, 0x4f, 0x52, 0x9e, 0x72, 0x83, 0x2f, 0xf4,
+	0xa9, 0x32, 0xa6, 0x7f, 0x5b, 0x30, 0x78, 0x93, 0x27, 0x05, 0x67, 0xb9, 0x22, 0x34, 0xe6, 0x22,
+	0x41, 0x08, 0x3a, 0x79, 0xf4, 0x89, 0x62, 0xcb, 0xb3, 0x66, 0x36, 0x31, 0x67, 0xf4, 0x0c, 0x7a,
+	0x92, 0x8a, 0x1b, 0x16, 0xd3, 0xad, 0xc9, 0x5a, 0x26, 0x73, 0x6a, 0xf6, 0x56, 0x2b, 0x2f, 0x01,
+	0x1a, 0x85, 0x25, 0xb8, 0xad, 0x85, 0x65, 0xbf, 0x3c, 0x4c, 0xec, 0x75, 0x45, 0x83, 0x15, 0xb1,
+	0x6b, 0x21, 0x48, 0xb4, 0x7d, 0xc3, 0x84, 0xda, 0x47, 0xd9, 0x96, 0x15, 0xb8, 0x73, 0xb4, 0xdf,
+	0x55, 0x34, 0x08, 0x89, 0x5d, 0x0b, 0x41, 0x81, 0x2e, 0xc0, 0xa1, 0xf5, 0x90, 0x5a, 0x3f, 0x35,
+	0xfa, 0xa0, 0x3c, 0x4c, 0xa0, 0x99, 0x3d, 0x08, 0x09, 0x34, 0x4a, 0x50, 0xa0, 0x4b, 0xe8, 0xb3,
+	0x3c, 0x15, 0x54, 0xca, 0x6d, 0xc1, 0x85, 0x92, 0xf8, 0xcc, 0x6b, 0xcf, 0x9c, 0xc5, 0xd3, 0xf9,
+	0xb1, 0x90, 0x79, 0xc8, 0x85, 0xf2, 0x79, 0xfe, 0x81, 0xa5, 0xa4, 0x57, 0xcb, 0x1a, 0x49, 0x84,
+	0xe1, 0x3c, 0xca, 0x58, 0x24, 0xa9, 0xc4, 0xe7, 0x5e, 0x7b, 0x66, 0x93, 0xe6, 0xaa, 0x6b, 0x50,
+	0x91, 0xbc, 0xde, 0x36, 0x71, 0xd7, 0xc4, 0x8e, 0x66, 0xaf, 0x6b, 0xe5, 0x05, 0x8c, 0x9a, 0x1a,
+	0x12, 0x26, 0xa3, 0x5d, 0x46, 0x13, 0x6c, 0x7b, 0xd6, 0xac, 0x4b, 0x86, 0x35, 0x5f, 0xd5, 0x78,
+	0xfa, 0xbd, 0x05, 0x70, 0x1c, 0xe2, 0xd1, 0xde, 0x2f, 0xa1, 0x6b, 0xf6, 0x14, 0xf3, 0xcc, 0x74,
+	0x3e, 0x58, 0x4c, 0x1e, 0xff, 0xc2, 0x3c, 0xac, 0x35, 0xf2, 0xf0, 0x00, 0x4d, 0xc0, 0x51, 0x91,
+	0x48, 0xa9, 0x32, 0x1d, 0x98, 0x95, 0xf4, 0x09, 0x54, 0x48, 0xbf, 0x44, 0xcf, 0x61, 0x50, 0xec,
+	0x77, 0x19, 0x93, 0x1f, 0x69, 0x52, 0x39, 0x1d, 0xe3, 0xf4, 0x1f, 0xa8, 0xd1, 0x16, 0xd0, 0x93,
+	0x7c, 0x2f, 0x62, 0xba, 0x8d, 0x59, 0x22, 0x24, 0x3e, 0xd5, 0xbf, 0x5e, 0x0e, 0xcb, 0xc3, 0xc4,
+	0x59, 0x1b, 0xee, 0x07, 0x2b, 0x22, 0x89, 0x53, 0x49, 0xbe, 0x76, 0xa6, 0xef, 0xa1, 0xdb, 0x4c,
+	0x84, 0x30, 0xb4, 0x37, 0x7e, 0x38, 0x3a, 0x19, 0x0f, 0x6f, 0xef, 0x3c, 0xa7, 0xc1, 0x1b, 0x3f,
+	0xd4, 0xc9, 0xd5, 0x2a, 0x1c, 0x59, 0xff, 0x27, 0x57, 0xab, 0x10, 0x8d, 0xa1, 0xb3, 0xf6, 0x37,
+	0xe1, 0xa8, 0x35, 0x1e, 0xdd, 0xde, 0x79, 0xbd, 0x26, 0xd2, 0x6c, 0xdc, 0xf9, 0xfa, 0xcd, 0x3d,
+	0x59, 0xe2, 0x5f, 0xf7, 0xee, 0xc9, 0x9f, 0x7b, 0xd7, 0xfa, 0x52, 0xba, 0xd6, 0x8f, 0xd2, 0xb5,
+	0x7e, 0x96, 0xae, 0xf5, 0xbb, 0x74, 0xad, 0xdd, 0x99, 0x69, 0xe0, 0xd5, 0xbf, 0x01, 0x00, 0x29,
+	0x38, 0xf9, 0x67, 0x0b, 0x03, 0x00, 0x00,
 }
@@ -41,19 +41,21 @@ const (
 	sbPIDQr  = "{" + urlSbPID + ":" + qregx + "}"
 	cnIDQr   = "{" + urlCnID + ":" + qregx + "}"
 	cnPIDQr  = "{" + urlCnPID + ":" + qregx + "}"
+	hpQr     = "{" + urlHostPort + ":" + qregx + "}"
 
 	// Internal URL variable name.They can be anything as
 	// long as they do not collide with query fields.
-	urlNwName = "network-name"
-	urlNwID   = "network-id"
-	urlNwPID  = "network-partial-id"
-	urlEpName = "endpoint-name"
-	urlEpID   = "endpoint-id"
-	urlEpPID  = "endpoint-partial-id"
-	urlSbID   = "sandbox-id"
-	urlSbPID  = "sandbox-partial-id"
-	urlCnID   = "container-id"
-	urlCnPID  = "container-partial-id"
+	urlNwName   = "network-name"
+	urlNwID     = "network-id"
+	urlNwPID    = "network-partial-id"
+	urlEpName   = "endpoint-name"
+	urlEpID     = "endpoint-id"
+	urlEpPID    = "endpoint-partial-id"
+	urlSbID     = "sandbox-id"
+	urlSbPID    = "sandbox-partial-id"
+	urlCnID     = "container-id"
+	urlCnPID    = "container-partial-id"
+	urlHostPort = "host-port"
 )
 
 // NewHTTPHandler creates and initialize the HTTP handler to serve the requests for libnetwork
@@ -117,6 +119,8 @@ func (h *httpHandler) initRouter() {
 			{"/sandboxes", []string{"partial-id", sbPIDQr}, procGetSandboxes},
 			{"/sandboxes", nil, procGetSandboxes},
 			{"/sandboxes/" + sbID, nil, procGetSandbox},
+			{"/port-mappings", []string{"host-port", hpQr}, procGetPortMappings},
+			{"/port-mappings", nil, procGetPortMappings},
 		},
 		"POST": {
 			{"/networks", nil, procCreateNetwork},
@@ -221,6 +225,32 @@ func buildSandboxResource(sb libnetwork.Sandbox) *sandboxResource {
  Options Parsers
 *****************/
 
+func buildPortMappingResource(m types.PortMapping) *portMappingResource {
+	r := &portMappingResource{
+		Proto:         m.Proto.String(),
+		HostIP:        m.HostIP.String(),
+		HostPort:      m.HostPort,
+		ContainerIP:   m.ContainerIP.String(),
+		ContainerPort: m.ContainerPort,
+		Network:       m.NetworkID,
+		Endpoint:      m.EndpointID,
+		Sandbox:       m.SandboxID,
+		UserlandProxy: m.UserlandProxy,
+		DNAT:          m.DNAT,
+		Routed:        m.Routed,
+	}
+	if s := m.ProxyStats; s != nil {
+		r.ProxyStats = &proxyStatsResource{
+			ActiveConnections:   s.ActiveConnections,
+			TotalConnections:    s.TotalConnections,
+			RejectedConnections: s.RejectedConnections,
+			BytesIn:             s.BytesIn,
+			BytesOut:            s.BytesOut,
+		}
+	}
+	return r
+}
+
 func (sc *sandboxCreate) parseOptions() []libnetwork.SandboxOption {
 	var setFctList []libnetwork.SandboxOption
 	if sc.HostName != "" {
@@ -383,6 +413,26 @@ func procCreateSandbox(c libnetwork.NetworkController, vars map[string]string, b
 	return sb.ID(), &createdResponse
 }
 
+func procGetPortMappings(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	var port int
+	if v, ok := vars[urlHostPort]; ok && v != "" {
+		p, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return nil, &badQueryResponse
+		}
+		port = int(p)
+	}
+
+	list := []*portMappingResource{}
+	for _, m := range c.PortMappings() {
+		if port != 0 && int(m.HostPort) != port {
+			continue
+		}
+		list = append(list, buildPortMappingResource(m))
+	}
+	return list, &successResponse
+}
+
 /******************
  Network interface
 *******************/
@@ -28,6 +28,31 @@ type sandboxResource struct {
 	ContainerID string `json:"container_id"`
 }
 
+// portMappingResource is an element of the "get port mappings" http response message
+type portMappingResource struct {
+	Proto         string              `json:"proto"`
+	HostIP        string              `json:"host_ip"`
+	HostPort      uint16              `json:"host_port"`
+	ContainerIP   string              `json:"container_ip"`
+	ContainerPort uint16              `json:"container_port"`
+	Network       string              `json:"network"`
+	Endpoint      string              `json:"endpoint"`
+	Sandbox       string              `json:"sandbox,omitempty"`
+	UserlandProxy bool                `json:"userland_proxy"`
+	DNAT          bool                `json:"dnat"`
+	Routed        bool                `json:"routed"`
+	ProxyStats    *proxyStatsResource `json:"proxy_stats,omitempty"`
+}
+
+// proxyStatsResource is the counters of the userland proxy of a port mapping
+type proxyStatsResource struct {
+	ActiveConnections   uint64 `json:"active_connections"`
+	TotalConnections    uint64 `json:"total_connections"`
+	RejectedConnections uint64 `json:"rejected_connections"`
+	BytesIn             uint64 `json:"bytes_in"`
+	BytesOut            uint64 `json:"bytes_out"`
+}
+
 /***********
   Body types
   ************/
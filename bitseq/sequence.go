@@ -253,6 +253,49 @@ func (h *Handle) IsSet(ordinal uint64) bool {
 	return err != nil
 }
 
+// Selected returns the ordinals of all the bits currently set in the sequence.
+// The handle state is first refreshed from the datastore, if one is configured.
+func (h *Handle) Selected() ([]uint64, error) {
+	h.Lock()
+	store := h.store
+	h.Unlock()
+
+	if store != nil {
+		if err := store.GetObject(datastore.Key(h.Key()...), h); err != nil && err != datastore.ErrKeyNotFound {
+			return nil, err
+		}
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	var (
+		ordinals []uint64
+		blockPos uint64
+	)
+	for s := h.head; s != nil; s = s.next {
+		if s.block == 0x0 {
+			blockPos += s.count
+			continue
+		}
+		for i := uint64(0); i < s.count; i++ {
+			for b := uint32(0); b < blockLen; b++ {
+				if s.block&(blockFirstBit>>b) == 0 {
+					continue
+				}
+				ordinal := (blockPos+i)*uint64(blockLen) + uint64(b)
+				if ordinal >= h.bits {
+					break
+				}
+				ordinals = append(ordinals, ordinal)
+			}
+		}
+		blockPos += s.count
+	}
+
+	return ordinals, nil
+}
+
 func (h *Handle) runConsistencyCheck() bool {
 	corrupted := false
 	for p, c := h.head, h.head.next; c != nil; c = c.next {
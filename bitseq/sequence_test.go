@@ -878,6 +878,41 @@ func TestMethods(t *testing.T) {
 	}
 }
 
+func TestSelected(t *testing.T) {
+	hnd, err := NewHandle("path/to/data", nil, "sequence1", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sel, err := hnd.Selected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel) != 0 {
+		t.Fatalf("Unexpected selected bits on empty sequence: %v", sel)
+	}
+
+	exp := []uint64{0, 1, 31, 32, 500, 999}
+	for _, o := range exp {
+		if err := hnd.Set(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sel, err = hnd.Selected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel) != len(exp) {
+		t.Fatalf("Unexpected selected bits. Expected %v. Got %v", exp, sel)
+	}
+	for i := range exp {
+		if sel[i] != exp[i] {
+			t.Fatalf("Unexpected selected bits. Expected %v. Got %v", exp, sel)
+		}
+	}
+}
+
 func TestRandomAllocateDeallocate(t *testing.T) {
 	ds, err := randomLocalStore()
 	if err != nil {
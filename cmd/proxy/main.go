@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -8,21 +9,29 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/docker/libnetwork/proxy"
+	"github.com/docker/libnetwork/types"
 	"github.com/ishidawataru/sctp"
 )
 
 func main() {
 	f := os.NewFile(3, "signal-parent")
-	host, container := parseHostContainerAddrs()
+	host, container, opts, statsInterval := parseHostContainerAddrs()
 
-	p, err := NewProxy(host, container)
+	p, err := proxy.NewProxyWithOptions(host, container, opts)
 	if err != nil {
 		fmt.Fprintf(f, "1\n%s", err)
 		f.Close()
 		os.Exit(1)
 	}
 	go handleStopSignals(p)
+	if statsInterval > 0 {
+		if r, ok := p.(proxy.StatsReporter); ok {
+			go reportStats(r, os.NewFile(4, "stats"), statsInterval)
+		}
+	}
 	fmt.Fprint(f, "0\n")
 	f.Close()
 
@@ -31,14 +40,19 @@ func main() {
 }
 
 // parseHostContainerAddrs parses the flags passed on reexec to create the TCP/UDP/SCTP
-// net.Addrs to map the host and container ports
-func parseHostContainerAddrs() (host net.Addr, container net.Addr) {
+// net.Addrs to map the host and container ports, the options of the proxy and
+// the interval at which its counters are reported to the parent
+func parseHostContainerAddrs() (host net.Addr, container net.Addr, opts proxy.Options, statsInterval time.Duration) {
 	var (
 		proto         = flag.String("proto", "tcp", "proxy protocol")
 		hostIP        = flag.String("host-ip", "", "host ip")
 		hostPort      = flag.Int("host-port", -1, "host port")
 		containerIP   = flag.String("container-ip", "", "container ip")
 		containerPort = flag.Int("container-port", -1, "container port")
+		proxyProtocol = flag.String("proxy-protocol", "", "PROXY protocol version (v1 or v2) to announce tcp clients to the container with")
+		maxConns      = flag.Int("max-connections", 0, "maximum number of concurrent connections, unbounded if 0")
+		idleTimeout   = flag.Duration("idle-timeout", 0, "duration after which an idle connection is closed")
+		interval      = flag.Duration("stats-interval", 0, "interval at which the counters are written to the stats pipe, never if 0")
 	)
 
 	flag.Parse()
@@ -57,10 +71,31 @@ func parseHostContainerAddrs() (host net.Addr, container net.Addr) {
 		log.Fatalf("unsupported protocol %s", *proto)
 	}
 
-	return host, container
+	opts.ProxyProtocol = *proxyProtocol
+	opts.MaxConnections = *maxConns
+	opts.IdleTimeout = *idleTimeout
+
+	return host, container, opts, *interval
+}
+
+// reportStats writes the counters of the proxy to the stats pipe, as one
+// JSON object per line, whenever they changed since the last interval.
+func reportStats(r proxy.StatsReporter, f *os.File, interval time.Duration) {
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	var last types.ProxyStats
+	for first := true; ; first = false {
+		if stats := r.Stats(); first || stats != last {
+			if err := enc.Encode(stats); err != nil {
+				return
+			}
+			last = stats
+		}
+		time.Sleep(interval)
+	}
 }
 
-func handleStopSignals(p Proxy) {
+func handleStopSignals(p proxy.Proxy) {
 	s := make(chan os.Signal, 10)
 	signal.Notify(s, os.Interrupt, syscall.SIGTERM)
 
@@ -10,6 +10,7 @@ import (
 	"github.com/docker/libkv/store"
 	"github.com/docker/libnetwork/cluster"
 	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/flowlog"
 	"github.com/docker/libnetwork/ipamutils"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/osl"
@@ -43,6 +44,9 @@ type DaemonCfg struct {
 	ClusterProvider        cluster.Provider
 	NetworkControlPlaneMTU int
 	DefaultAddressPool     []*ipamutils.NetworkToSplit
+	NamedAddressPools      map[string][]*ipamutils.NetworkToSplit
+	IPAMAuditRelease       bool
+	FlowLogSink            flowlog.Sink
 }
 
 // ClusterCfg represents cluster configuration
@@ -120,6 +124,31 @@ func OptionDefaultAddressPoolConfig(addressPool []*ipamutils.NetworkToSplit) Opt
 	}
 }
 
+// OptionNamedAddressPools function returns an option setter for the named default
+// address pools networks can select through the ipam pool option or label
+func OptionNamedAddressPools(addressPools map[string][]*ipamutils.NetworkToSplit) Option {
+	return func(c *Config) {
+		c.Daemon.NamedAddressPools = addressPools
+	}
+}
+
+// OptionIPAMAuditRelease function returns an option setter to make the startup
+// IPAM audit release the addresses which are allocated but not in use
+func OptionIPAMAuditRelease(release bool) Option {
+	return func(c *Config) {
+		logrus.Debugf("Option IPAMAuditRelease: %v", release)
+		c.Daemon.IPAMAuditRelease = release
+	}
+}
+
+// OptionFlowLogSink function returns an option setter for the sink of the
+// flow records of the networks logging their flows
+func OptionFlowLogSink(sink flowlog.Sink) Option {
+	return func(c *Config) {
+		c.Daemon.FlowLogSink = sink
+	}
+}
+
 // OptionDriverConfig returns an option setter for driver configuration.
 func OptionDriverConfig(networkType string, config map[string]interface{}) Option {
 	return func(c *Config) {
@@ -68,6 +68,7 @@ import (
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/options"
 	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/portallocator"
 	"github.com/docker/libnetwork/types"
 	"github.com/moby/locker"
 	"github.com/pkg/errors"
@@ -143,6 +144,36 @@ type NetworkController interface {
 	StopDiagnostic()
 	// IsDiagnosticEnabled returns true if the diagnostic is enabled
 	IsDiagnosticEnabled() bool
+
+	// ReservePortRange reserves a range of host ports for use outside of
+	// the containers, the ports are no longer published
+	ReservePortRange(ip net.IP, proto string, portStart, portEnd int) error
+
+	// ReleasePortRange releases a range of host ports reserved with
+	// ReservePortRange
+	ReleasePortRange(ip net.IP, proto string, portStart, portEnd int) error
+
+	// ReservedPortRanges returns the reserved ranges of host ports
+	ReservedPortRanges() []portallocator.PortRange
+
+	// ReleasePortLeases releases the host ports leased to the container,
+	// which keeps them across its sandboxes until it is removed
+	ReleasePortLeases(containerID string)
+
+	// PortMappings returns the host ports currently mapped to the endpoints
+	PortMappings() []types.PortMapping
+
+	// EncryptionState returns the datapath encryption state of the drivers,
+	// by driver name
+	EncryptionState() map[string]types.EncryptionState
+
+	// RekeyEncryption programs again the datapath encryption with the
+	// remote node, or with all the remote nodes if node is empty
+	RekeyEncryption(node string) error
+
+	// SetStaticPeers replaces the static peers of the networks of the
+	// driver for the network type
+	SetStaticPeers(networkType string, peers []types.StaticPeer) error
 }
 
 // NetworkWalker is a client provided function which will be used to walk the Networks.
@@ -178,6 +209,7 @@ type controller struct {
 	keys                   []*types.EncryptionKey
 	clusterConfigAvailable bool
 	DiagnosticServer       *diagnostic.Server
+	flows                  flowIndex
 	sync.Mutex
 }
 
@@ -199,11 +231,24 @@ func New(cfgOptions ...config.Option) (NetworkController, error) {
 		DiagnosticServer: diagnostic.New(),
 	}
 	c.DiagnosticServer.Init()
+	c.DiagnosticServer.RegisterHandler(c, ipamAuditPaths2Func)
+	c.DiagnosticServer.RegisterHandler(c, portMappingsPaths2Func)
+	c.DiagnosticServer.RegisterHandler(c, encryptionPaths2Func)
 
 	if err := c.initStores(); err != nil {
 		return nil, err
 	}
 
+	if err := c.initPortAllocator(); err != nil {
+		return nil, err
+	}
+
+	if c.cfg.Cluster.Watcher != nil || c.cfg.Daemon.ClusterProvider != nil || c.getStore(datastore.GlobalScope) != nil {
+		if err := c.overlaySupported(); err != nil {
+			return nil, err
+		}
+	}
+
 	drvRegistry, err := drvregistry.New(c.getStore(datastore.LocalScope), c.getStore(datastore.GlobalScope), c.RegisterDriver, nil, c.cfg.PluginGetter)
 	if err != nil {
 		return nil, err
@@ -218,12 +263,18 @@ func New(cfgOptions ...config.Option) (NetworkController, error) {
 			dcfg = c.makeDriverConfig(i.ntype)
 		}
 
+		// The overlay filter, encryption and egress rules are only
+		// programmed with iptables, see overlaySupported
+		if i.ntype == "overlay" && c.overlaySupported() != nil {
+			continue
+		}
+
 		if err := drvRegistry.AddDriver(i.ntype, i.fn, dcfg); err != nil {
 			return nil, err
 		}
 	}
 
-	if err = initIPAMDrivers(drvRegistry, nil, c.getStore(datastore.GlobalScope), c.cfg.Daemon.DefaultAddressPool); err != nil {
+	if err = initIPAMDrivers(drvRegistry, nil, c.getStore(datastore.GlobalScope), c.cfg.Daemon.DefaultAddressPool, c.cfg.Daemon.NamedAddressPools); err != nil {
 		return nil, err
 	}
 
@@ -249,6 +300,14 @@ func New(cfgOptions ...config.Option) (NetworkController, error) {
 	c.cleanupLocalEndpoints()
 	c.networkCleanup()
 
+	// Detect addresses leaked by failed endpoint operations
+	c.auditIPAM(c.cfg.Daemon.IPAMAuditRelease)
+
+	// Remove the firewall rules of the networks and endpoints gone
+	sweepStaleRules(c)
+
+	c.setupFlowLog()
+
 	if err := c.startExternalKeyListener(); err != nil {
 		return nil, err
 	}
@@ -701,6 +760,18 @@ func (c *controller) RegisterDriver(networkType string, driver driverapi.Driver,
 	return nil
 }
 
+func (c *controller) SetStaticPeers(networkType string, peers []types.StaticPeer) error {
+	d, _ := c.drvRegistry.Driver(networkType)
+	if d == nil {
+		return types.NotFoundErrorf("could not find driver for network type %s", networkType)
+	}
+	s, ok := d.(driverapi.StaticPeerSetter)
+	if !ok {
+		return types.NotImplementedErrorf("driver %s does not support static peers", networkType)
+	}
+	return s.SetStaticPeers(peers)
+}
+
 // XXX  This should be made driver agnostic.  See comment below.
 const overlayDSROptionString = "dsr"
 
@@ -727,6 +798,12 @@ func (c *controller) NewNetwork(networkType, name string, id string, options ...
 		return nil, ErrInvalidName(name)
 	}
 
+	if networkType == "overlay" {
+		if err := c.overlaySupported(); err != nil {
+			return nil, err
+		}
+	}
+
 	if id == "" {
 		id = stringid.GenerateRandomID()
 	}
@@ -1372,20 +1449,43 @@ func (c *controller) IsDiagnosticEnabled() bool {
 	return c.DiagnosticServer.IsDiagnosticEnabled()
 }
 
-func (c *controller) iptablesEnabled() bool {
+// bridgeConfig returns the generic configuration of the bridge driver
+func (c *controller) bridgeConfig() options.Generic {
 	c.Lock()
 	defer c.Unlock()
 
 	if c.cfg == nil {
-		return false
+		return nil
 	}
-	// parse map cfg["bridge"]["generic"]["EnableIPTable"]
+	// parse map cfg["bridge"]["generic"]
 	cfgBridge, ok := c.cfg.Daemon.DriverCfg["bridge"].(map[string]interface{})
 	if !ok {
-		return false
+		return nil
 	}
-	cfgGeneric, ok := cfgBridge[netlabel.GenericData].(options.Generic)
-	if !ok {
+	cfgGeneric, _ := cfgBridge[netlabel.GenericData].(options.Generic)
+	return cfgGeneric
+}
+
+// firewallBackend returns the firewall backend the bridge driver is
+// configured with, empty for the default iptables one
+func (c *controller) firewallBackend() string {
+	backend, _ := c.bridgeConfig()["FirewallBackend"].(string)
+	return backend
+}
+
+// overlaySupported returns an error if the overlay networks, and therefore
+// swarm mode and multi-host networking, cannot be used with the firewall
+// backend
+func (c *controller) overlaySupported() error {
+	if c.firewallBackend() == "nftables" {
+		return types.NotImplementedErrorf("overlay networks, swarm mode and multi-host networking are not supported with the nftables firewall backend, use the iptables one")
+	}
+	return nil
+}
+
+func (c *controller) iptablesEnabled() bool {
+	cfgGeneric := c.bridgeConfig()
+	if cfgGeneric == nil {
 		return false
 	}
 	enabled, ok := cfgGeneric["EnableIPTables"].(bool)
@@ -1393,5 +1493,9 @@ func (c *controller) iptablesEnabled() bool {
 		// unless user explicitly stated, assume iptable is enabled
 		enabled = true
 	}
+	// the nftables firewall backend manages its own DOCKER-USER chain
+	if c.firewallBackend() == "nftables" {
+		return false
+	}
 	return enabled
 }
@@ -130,3 +130,141 @@ type NetworkStatsResult struct {
 func (n *NetworkStatsResult) String() string {
 	return fmt.Sprintf("entries: %d, qlen: %d\n", n.Entries, n.QueueLen)
 }
+
+// IPAMAuditEntryObj an address found out of sync between the IPAM driver and the endpoints
+type IPAMAuditEntryObj struct {
+	Network  string `json:"network"`
+	PoolID   string `json:"pool"`
+	Address  string `json:"address"`
+	Owner    string `json:"owner,omitempty"`
+	Repaired bool   `json:"repaired"`
+}
+
+func (e *IPAMAuditEntryObj) String() string {
+	s := fmt.Sprintf("network:%s pool:%s address:%s", e.Network, e.PoolID, e.Address)
+	if e.Owner != "" {
+		s += " owner:" + e.Owner
+	}
+	if e.Repaired {
+		s += " (repaired)"
+	}
+	return s + "\n"
+}
+
+// IPAMAuditResult result of an IPAM audit run
+type IPAMAuditResult struct {
+	Leaked  []IPAMAuditEntryObj `json:"leaked"`
+	Missing []IPAMAuditEntryObj `json:"missing"`
+}
+
+func (r *IPAMAuditResult) String() string {
+	output := fmt.Sprintf("allocated but not used: %d\n", len(r.Leaked))
+	for _, e := range r.Leaked {
+		output += e.String()
+	}
+	output += fmt.Sprintf("used but not allocated: %d\n", len(r.Missing))
+	for _, e := range r.Missing {
+		output += e.String()
+	}
+	return output
+}
+
+// PortMappingObj a host port mapped to a container port
+type PortMappingObj struct {
+	Proto         string         `json:"proto"`
+	HostIP        string         `json:"host_ip"`
+	HostPort      uint16         `json:"host_port"`
+	ContainerIP   string         `json:"container_ip"`
+	ContainerPort uint16         `json:"container_port"`
+	Network       string         `json:"network"`
+	Endpoint      string         `json:"endpoint"`
+	Sandbox       string         `json:"sandbox,omitempty"`
+	UserlandProxy bool           `json:"userland_proxy"`
+	DNAT          bool           `json:"dnat"`
+	Routed        bool           `json:"routed"`
+	ProxyStats    *ProxyStatsObj `json:"proxy_stats,omitempty"`
+}
+
+// ProxyStatsObj the counters of the userland proxy of a port mapping
+type ProxyStatsObj struct {
+	ActiveConnections   uint64 `json:"active_connections"`
+	TotalConnections    uint64 `json:"total_connections"`
+	RejectedConnections uint64 `json:"rejected_connections"`
+	BytesIn             uint64 `json:"bytes_in"`
+	BytesOut            uint64 `json:"bytes_out"`
+}
+
+func (m *PortMappingObj) String() string {
+	output := fmt.Sprintf("%s:%d/%s -> %s:%d network:%s endpoint:%s sandbox:%s proxy:%t dnat:%t routed:%t",
+		m.HostIP, m.HostPort, m.Proto, m.ContainerIP, m.ContainerPort, m.Network, m.Endpoint, m.Sandbox, m.UserlandProxy, m.DNAT, m.Routed)
+	if s := m.ProxyStats; s != nil {
+		output += fmt.Sprintf(" connections:%d/%d rejected:%d in:%d out:%d",
+			s.ActiveConnections, s.TotalConnections, s.RejectedConnections, s.BytesIn, s.BytesOut)
+	}
+	return output + "\n"
+}
+
+// PortMappingsResult the port mappings of the host
+type PortMappingsResult struct {
+	Mappings []PortMappingObj `json:"mappings"`
+}
+
+func (r *PortMappingsResult) String() string {
+	output := fmt.Sprintf("port mappings: %d\n", len(r.Mappings))
+	for _, m := range r.Mappings {
+		output += m.String()
+	}
+	return output
+}
+
+// EncryptionKeyObj a datapath encryption key of the node key ring
+type EncryptionKeyObj struct {
+	LamportTime uint64 `json:"lamport_time"`
+	Tag         uint32 `json:"tag"`
+	Primary     bool   `json:"primary"`
+}
+
+// EncryptionPeerObj the datapath encryption state with a remote node
+type EncryptionPeerObj struct {
+	Node    string   `json:"node"`
+	Backend string   `json:"backend"`
+	SPIs    []string `json:"spis,omitempty"`
+	InSync  bool     `json:"in_sync"`
+}
+
+func (p *EncryptionPeerObj) String() string {
+	return fmt.Sprintf("  node:%s backend:%s in-sync:%t spis:%v\n", p.Node, p.Backend, p.InSync, p.SPIs)
+}
+
+// EncryptionDriverObj the datapath encryption state of a driver
+type EncryptionDriverObj struct {
+	Name    string              `json:"name"`
+	KeyTags []uint32            `json:"key_tags"`
+	Peers   []EncryptionPeerObj `json:"peers"`
+}
+
+func (d *EncryptionDriverObj) String() string {
+	output := fmt.Sprintf("driver:%s keys:%v\n", d.Name, d.KeyTags)
+	for _, p := range d.Peers {
+		output += p.String()
+	}
+	return output
+}
+
+// EncryptionResult the datapath encryption keys of the node and the state of
+// the drivers using them
+type EncryptionResult struct {
+	Keys    []EncryptionKeyObj    `json:"keys"`
+	Drivers []EncryptionDriverObj `json:"drivers"`
+}
+
+func (r *EncryptionResult) String() string {
+	output := fmt.Sprintf("keys: %d\n", len(r.Keys))
+	for _, k := range r.Keys {
+		output += fmt.Sprintf("lamport time:%d tag:%d primary:%t\n", k.LamportTime, k.Tag, k.Primary)
+	}
+	for _, d := range r.Drivers {
+		output += d.String()
+	}
+	return output
+}
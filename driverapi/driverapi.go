@@ -5,6 +5,7 @@ import (
 
 	"github.com/docker/docker/pkg/plugingetter"
 	"github.com/docker/libnetwork/discoverapi"
+	"github.com/docker/libnetwork/types"
 )
 
 // NetworkPluginEndpointType represents the Endpoint Type used by Plugin system
@@ -156,6 +157,34 @@ type JoinInfo interface {
 	AddTableEntry(tableName string, key string, value []byte) error
 }
 
+// PortMappingLister is an optional interface a driver can implement to let
+// libnetwork list the host ports it maps to the endpoints.
+type PortMappingLister interface {
+	// PortMappings returns the current port mappings of the networks of
+	// the driver
+	PortMappings() []types.PortMapping
+}
+
+// EncryptionInspector is an optional interface a driver can implement to let
+// libnetwork inspect and repair its datapath encryption state.
+type EncryptionInspector interface {
+	// EncryptionState returns the keys of the driver and the state of the
+	// encryption with each remote node
+	EncryptionState() types.EncryptionState
+
+	// Rekey programs again the encryption with the remote node from the
+	// current keys, or with all the remote nodes if node is empty
+	Rekey(node string) error
+}
+
+// StaticPeerSetter is an optional interface a driver can implement to take
+// the remote endpoints of its networks from a static list rather than from
+// the cluster.
+type StaticPeerSetter interface {
+	// SetStaticPeers replaces the static peers of the driver
+	SetStaticPeers(peers []types.StaticPeer) error
+}
+
 // DriverCallback provides a Callback interface for Drivers into LibNetwork
 type DriverCallback interface {
 	// GetPluginGetter returns the pluginv2 getter.
@@ -3,6 +3,7 @@ package bridge
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
@@ -11,13 +12,16 @@ import (
 	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/discoverapi"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/egress"
 	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/nftables"
 	"github.com/docker/libnetwork/ns"
 	"github.com/docker/libnetwork/options"
 	"github.com/docker/libnetwork/osl"
@@ -35,6 +39,25 @@ const (
 	maxAllocatePortAttempts    = 10
 )
 
+const (
+	// FirewallBackendIptables programs the firewall rules through iptables
+	FirewallBackendIptables = "iptables"
+	// FirewallBackendNftables programs the firewall rules in a nftables
+	// table. It supports neither the network policies, flow logging,
+	// egress rules and source CIDRs of published ports, nor the overlay
+	// networks.
+	FirewallBackendNftables = "nftables"
+)
+
+const (
+	// GatewayModeNAT masquerades the outbound traffic and publishes the
+	// ports through DNAT
+	GatewayModeNAT = "nat"
+	// GatewayModeRouted leaves the addresses untranslated: the containers
+	// are reached at their address, on the published ports only
+	GatewayModeRouted = "routed"
+)
+
 const (
 	// DefaultGatewayV4AuxKey represents the default-gateway configured by the user
 	DefaultGatewayV4AuxKey = "DefaultGatewayIPv4"
@@ -60,6 +83,11 @@ type configuration struct {
 	EnableIP6Tables     bool
 	EnableUserlandProxy bool
 	UserlandProxyPath   string
+	FirewallBackend     string
+	// UserlandProxyMaxConnections and UserlandProxyIdleTimeout limit the
+	// connections of each userland proxy, unbounded if 0
+	UserlandProxyMaxConnections int
+	UserlandProxyIdleTimeout    time.Duration
 }
 
 // networkConfiguration for network specific configuration
@@ -68,12 +96,23 @@ type networkConfiguration struct {
 	BridgeName           string
 	EnableIPv6           bool
 	EnableIPMasquerade   bool
+	EnableIPv6Masquerade *bool
 	EnableICC            bool
+	IsolatePorts         bool
+	GatewayMode          string
 	InhibitIPv4          bool
 	Mtu                  int
 	DefaultBindingIP     net.IP
 	DefaultBridge        bool
 	HostIP               net.IP
+	HostIPv6             net.IP
+	EgressIPs            []net.IP
+	Policy               *networkPolicy
+	FlowLog              bool
+	Egress               *egress.Policy
+	VlanFiltering        bool
+	VlanUplink           string
+	VlanTrunk            []uint16
 	ContainerIfacePrefix string
 	// Internal fields set after ipam data parsing
 	AddressIPv4        *net.IPNet
@@ -98,7 +137,10 @@ const (
 
 // endpointConfiguration represents the user specified configuration for the sandbox endpoint
 type endpointConfiguration struct {
-	MacAddress net.HardwareAddr
+	MacAddress   net.HardwareAddr
+	EgressIP     net.IP
+	Vlan         uint16
+	PolicyLabels map[string]string
 }
 
 // containerConfiguration represents the user specified configuration for a container
@@ -111,6 +153,9 @@ type containerConfiguration struct {
 type connectivityConfiguration struct {
 	PortBindings []types.PortBinding
 	ExposedPorts []types.TransportPort
+	// PortOwner identifies the container the ephemeral host ports are
+	// leased to
+	PortOwner string
 }
 
 type bridgeEndpoint struct {
@@ -124,6 +169,8 @@ type bridgeEndpoint struct {
 	containerConfig *containerConfiguration
 	extConnConfig   *connectivityConfiguration
 	portMapping     []types.PortBinding // Operation port bindings
+	egressIP        net.IP              // Source address of the outbound traffic
+	vlan            uint16              // VLAN of the bridge port, on a VLAN aware bridge
 	dbIndex         uint64
 	dbExists        bool
 }
@@ -151,9 +198,14 @@ type driver struct {
 	filterChainV6     *iptables.ChainInfo
 	isolationChain1V6 *iptables.ChainInfo
 	isolationChain2V6 *iptables.ChainInfo
+	nftNatChain       *nftables.ChainInfo
+	nftFilterChain    *nftables.ChainInfo
+	nftNatChainV6     *nftables.ChainInfo
+	nftFilterChainV6  *nftables.ChainInfo
 	networks          map[string]*bridgeNetwork
 	store             datastore.DataStore
 	nlh               *netlink.Handle
+	flowLog           io.Closer
 	configNetwork     sync.Mutex
 	sync.Mutex
 }
@@ -200,9 +252,59 @@ func (c *networkConfiguration) Validate() error {
 			return &ErrInvalidGateway{}
 		}
 	}
+
+	switch c.GatewayMode {
+	case "", GatewayModeNAT:
+	case GatewayModeRouted:
+		if len(c.EgressIPs) > 0 {
+			return types.BadRequestErrorf("%s cannot be used with %s %s", EgressIPPool, GatewayMode, GatewayModeRouted)
+		}
+	default:
+		return types.BadRequestErrorf("invalid %s: %s", GatewayMode, c.GatewayMode)
+	}
+
+	// Port isolation is an alternative implementation of ICC disabled
+	if c.IsolatePorts && c.EnableICC {
+		return types.BadRequestErrorf("%s requires %s to be false", IsolatePorts, EnableICC)
+	}
+
+	if !c.VlanFiltering && (c.VlanUplink != "" || len(c.VlanTrunk) > 0) {
+		return types.BadRequestErrorf("%s and %s require %s", VlanUplink, VlanTrunk, VlanFiltering)
+	}
+
+	// The egress pool replaces the network wide SNAT address
+	if len(c.EgressIPs) > 0 && c.HostIP != nil {
+		return types.BadRequestErrorf("%s and %s are mutually exclusive", EgressIPPool, netlabel.HostIP)
+	}
 	return nil
 }
 
+// natConfig returns the address the outbound traffic of the IP version is
+// translated to, nil for masquerading, and whether it is translated at all.
+func (c *networkConfiguration) natConfig(version iptables.IPVersion) (net.IP, bool) {
+	if c.routed() {
+		return nil, false
+	}
+	if version == iptables.IPv6 {
+		if c.EnableIPv6Masquerade != nil {
+			return c.HostIPv6, *c.EnableIPv6Masquerade
+		}
+		return c.HostIPv6, c.EnableIPMasquerade
+	}
+	return c.HostIP, c.EnableIPMasquerade
+}
+
+// routed returns whether the network is in routed gateway mode
+func (c *networkConfiguration) routed() bool {
+	return c.GatewayMode == GatewayModeRouted
+}
+
+// firewallICC returns whether the firewall lets the traffic between the
+// endpoints through. With port isolation the bridge drops it instead.
+func (c *networkConfiguration) firewallICC() bool {
+	return c.EnableICC || c.IsolatePorts
+}
+
 // Conflicts check if two NetworkConfiguration objects overlap
 func (c *networkConfiguration) Conflicts(o *networkConfiguration) error {
 	if o == nil {
@@ -247,10 +349,22 @@ func (c *networkConfiguration) fromLabels(labels map[string]string) error {
 			if c.EnableIPMasquerade, err = strconv.ParseBool(value); err != nil {
 				return parseErr(label, value, err.Error())
 			}
+		case EnableIPv6Masquerade:
+			var masquerade bool
+			if masquerade, err = strconv.ParseBool(value); err != nil {
+				return parseErr(label, value, err.Error())
+			}
+			c.EnableIPv6Masquerade = &masquerade
 		case EnableICC:
 			if c.EnableICC, err = strconv.ParseBool(value); err != nil {
 				return parseErr(label, value, err.Error())
 			}
+		case GatewayMode:
+			c.GatewayMode = value
+		case IsolatePorts:
+			if c.IsolatePorts, err = strconv.ParseBool(value); err != nil {
+				return parseErr(label, value, err.Error())
+			}
 		case InhibitIPv4:
 			if c.InhibitIPv4, err = strconv.ParseBool(value); err != nil {
 				return parseErr(label, value, err.Error())
@@ -269,6 +383,45 @@ func (c *networkConfiguration) fromLabels(labels map[string]string) error {
 			if c.HostIP = net.ParseIP(value); c.HostIP == nil {
 				return parseErr(label, value, "nil ip")
 			}
+		case netlabel.HostIPv6:
+			if c.HostIPv6 = net.ParseIP(value); c.HostIPv6 == nil || c.HostIPv6.To4() != nil {
+				return parseErr(label, value, "invalid IPv6 address")
+			}
+		case NetworkPolicy:
+			if c.Policy, err = parsePolicy(value); err != nil {
+				return parseErr(label, value, err.Error())
+			}
+		case netlabel.EgressAllow, netlabel.EgressDeny:
+			var rules []egress.Rule
+			if rules, err = egress.ParseRules(value); err != nil {
+				return parseErr(label, value, err.Error())
+			}
+			if c.Egress == nil {
+				c.Egress = &egress.Policy{}
+			}
+			if label == netlabel.EgressAllow {
+				c.Egress.Allow = rules
+			} else {
+				c.Egress.Deny = rules
+			}
+		case netlabel.FlowLog:
+			if c.FlowLog, err = strconv.ParseBool(value); err != nil {
+				return parseErr(label, value, err.Error())
+			}
+		case VlanFiltering:
+			if c.VlanFiltering, err = strconv.ParseBool(value); err != nil {
+				return parseErr(label, value, err.Error())
+			}
+		case VlanUplink:
+			c.VlanUplink = value
+		case VlanTrunk:
+			if c.VlanTrunk, err = parseVlanList(value); err != nil {
+				return parseErr(label, value, err.Error())
+			}
+		case EgressIPPool:
+			if c.EgressIPs, err = parseEgressIPs(value); err != nil {
+				return parseErr(label, value, err.Error())
+			}
 		}
 	}
 
@@ -333,15 +486,27 @@ func (n *bridgeNetwork) isolateNetwork(others []*bridgeNetwork, enable bool) err
 	}
 
 	// Install the rules to isolate this network against each of the other networks
+	if n.driver.config.useNftables() {
+		if n.driver.config.EnableIP6Tables {
+			if err := setNFTIsolation(nftables.IPv6, thisConfig.BridgeName, enable); err != nil {
+				return err
+			}
+		}
+		if n.driver.config.EnableIPTables {
+			return setNFTIsolation(nftables.IPv4, thisConfig.BridgeName, enable)
+		}
+		return nil
+	}
+
 	if n.driver.config.EnableIP6Tables {
-		err := setINC(iptables.IPv6, thisConfig.BridgeName, enable)
+		err := setINC(iptables.Owner{NetworkID: thisConfig.ID}, iptables.IPv6, thisConfig.BridgeName, enable)
 		if err != nil {
 			return err
 		}
 	}
 
 	if n.driver.config.EnableIPTables {
-		return setINC(iptables.IPv4, thisConfig.BridgeName, enable)
+		return setINC(iptables.Owner{NetworkID: thisConfig.ID}, iptables.IPv4, thisConfig.BridgeName, enable)
 	}
 	return nil
 }
@@ -358,6 +523,10 @@ func (d *driver) configure(option map[string]interface{}) error {
 		filterChainV6     *iptables.ChainInfo
 		isolationChain1V6 *iptables.ChainInfo
 		isolationChain2V6 *iptables.ChainInfo
+		nftNatChain       *nftables.ChainInfo
+		nftFilterChain    *nftables.ChainInfo
+		nftNatChainV6     *nftables.ChainInfo
+		nftFilterChainV6  *nftables.ChainInfo
 	)
 
 	genericData, ok := option[netlabel.GenericData]
@@ -378,6 +547,18 @@ func (d *driver) configure(option map[string]interface{}) error {
 		return &ErrInvalidDriverConfig{}
 	}
 
+	switch config.FirewallBackend {
+	case "", FirewallBackendIptables, FirewallBackendNftables:
+	default:
+		return types.BadRequestErrorf("unsupported firewall backend: %s", config.FirewallBackend)
+	}
+	if config.UserlandProxyMaxConnections < 0 {
+		return types.BadRequestErrorf("invalid userland proxy maximum number of connections: %d", config.UserlandProxyMaxConnections)
+	}
+	if config.UserlandProxyIdleTimeout < 0 {
+		return types.BadRequestErrorf("invalid userland proxy idle timeout: %v", config.UserlandProxyIdleTimeout)
+	}
+
 	if config.EnableIPTables || config.EnableIP6Tables {
 		if _, err := os.Stat("/proc/sys/net/bridge"); err != nil {
 			if out, err := exec.Command("modprobe", "-va", "bridge", "br_netfilter").CombinedOutput(); err != nil {
@@ -386,7 +567,22 @@ func (d *driver) configure(option map[string]interface{}) error {
 		}
 	}
 
-	if config.EnableIPTables {
+	if config.useNftables() {
+		if config.EnableIPTables {
+			nftNatChain, nftFilterChain, err = setupNFTChains(config, nftables.IPv4)
+			if err != nil {
+				return err
+			}
+		}
+		if config.EnableIP6Tables {
+			nftNatChainV6, nftFilterChainV6, err = setupNFTChains(config, nftables.IPv6)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.EnableIPTables && !config.useNftables() {
 		removeIPChains(iptables.IPv4)
 
 		natChain, filterChain, isolationChain1, isolationChain2, err = setupIPChains(config, iptables.IPv4)
@@ -401,7 +597,7 @@ func (d *driver) configure(option map[string]interface{}) error {
 		})
 	}
 
-	if config.EnableIP6Tables {
+	if config.EnableIP6Tables && !config.useNftables() {
 		removeIPChains(iptables.IPv6)
 
 		natChainV6, filterChainV6, isolationChain1V6, isolationChain2V6, err = setupIPChains(config, iptables.IPv6)
@@ -416,7 +612,13 @@ func (d *driver) configure(option map[string]interface{}) error {
 		})
 	}
 
-	if config.EnableIPForwarding {
+	if config.EnableIPForwarding && config.useNftables() {
+		err = setupNFTForwarding(config.EnableIPTables, config.EnableIP6Tables)
+		if err != nil {
+			logrus.Warn(err)
+			return err
+		}
+	} else if config.EnableIPForwarding {
 		err = setupIPForwarding(config.EnableIPTables, config.EnableIP6Tables)
 		if err != nil {
 			logrus.Warn(err)
@@ -433,6 +635,10 @@ func (d *driver) configure(option map[string]interface{}) error {
 	d.filterChainV6 = filterChainV6
 	d.isolationChain1V6 = isolationChain1V6
 	d.isolationChain2V6 = isolationChain2V6
+	d.nftNatChain = nftNatChain
+	d.nftFilterChain = nftFilterChain
+	d.nftNatChainV6 = nftNatChainV6
+	d.nftFilterChainV6 = nftFilterChainV6
 	d.config = config
 	d.Unlock()
 
@@ -680,6 +886,18 @@ func (d *driver) createNetwork(config *networkConfiguration) (err error) {
 
 	networkList := d.getNetworks()
 
+	if err = d.config.validatePolicy(config); err != nil {
+		return err
+	}
+
+	if err = d.config.validateFlowLog(config); err != nil {
+		return err
+	}
+
+	if err = d.config.validateEgressFilter(config); err != nil {
+		return err
+	}
+
 	// Initialize handle when needed
 	d.Lock()
 	if d.nlh == nil {
@@ -744,6 +962,15 @@ func (d *driver) createNetwork(config *networkConfiguration) (err error) {
 		bridgeSetup.queueStep(setupDefaultSysctl)
 	}
 
+	// Make the bridge VLAN aware and trunk its VLANs on the uplink. The
+	// bridges created by setupDevice are VLAN aware already.
+	if config.VlanFiltering && bridgeAlreadyExists {
+		bridgeSetup.queueStep(setupVlanFiltering)
+	}
+	if config.VlanUplink != "" {
+		bridgeSetup.queueStep(setupVlanUplink)
+	}
+
 	// For the default bridge, set expected sysctls
 	if config.DefaultBridge {
 		bridgeSetup.queueStep(setupDefaultSysctl)
@@ -783,9 +1010,9 @@ func (d *driver) createNetwork(config *networkConfiguration) (err error) {
 
 		// We want to track firewalld configuration so that
 		// if it is started/reloaded, the rules can be applied correctly
-		{d.config.EnableIPTables, network.setupFirewalld},
+		{d.config.EnableIPTables && !d.config.useNftables(), network.setupFirewalld},
 		// same for IPv6
-		{config.EnableIPv6 && d.config.EnableIP6Tables, network.setupFirewalld6},
+		{config.EnableIPv6 && d.config.EnableIP6Tables && !d.config.useNftables(), network.setupFirewalld6},
 
 		// Setup DefaultGatewayIPv4
 		{config.DefaultGatewayIPv4 != nil, setupGatewayIPv4},
@@ -796,8 +1023,17 @@ func (d *driver) createNetwork(config *networkConfiguration) (err error) {
 		// Add inter-network communication rules.
 		{d.config.EnableIPTables, setupNetworkIsolationRules},
 
+		// Enforce the network policy
+		{config.Policy != nil && d.config.EnableIPTables, network.setupPolicy},
+
+		// Filter the destinations of the traffic leaving the network
+		{!config.Egress.IsZero() && d.config.EnableIPTables, network.setupEgressFilter},
+
+		// Log the flows of the network
+		{config.FlowLog && d.config.EnableIPTables, network.setupFlowLog},
+
 		// Configure bridge networking filtering if ICC is off and IP tables are enabled
-		{!config.EnableICC && d.config.EnableIPTables, setupBridgeNetFiltering},
+		{(!config.firewallICC() || config.Policy != nil) && d.config.EnableIPTables, setupBridgeNetFiltering},
 	} {
 		if step.Condition {
 			bridgeSetup.queueStep(step.Fn)
@@ -806,7 +1042,13 @@ func (d *driver) createNetwork(config *networkConfiguration) (err error) {
 
 	// Apply the prepared list of steps, and abort at the first error.
 	bridgeSetup.queueStep(setupDeviceUp)
-	return bridgeSetup.apply()
+	if err = bridgeSetup.apply(); err != nil {
+		return err
+	}
+
+	// The network may be the peer of the policies of the other networks
+	d.refreshPolicies()
+	return nil
 }
 
 func (d *driver) DeleteNetwork(nid string) error {
@@ -885,6 +1127,7 @@ func (d *driver) deleteNetwork(nid string) error {
 			logrus.Warnf("Failed to clean iptables rules for bridge network: %v", errClean)
 		}
 	}
+	d.refreshPolicies()
 	return d.storeDelete(config)
 }
 
@@ -1069,6 +1312,28 @@ func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo,
 		return fmt.Errorf("adding interface %s to bridge %s failed: %v", hostIfName, config.BridgeName, err)
 	}
 
+	// Isolated ports only talk to the bridge and the non isolated ports
+	if config.IsolatePorts {
+		if err = setPortIsolation(hostIfName, true); err != nil {
+			return err
+		}
+	}
+
+	// The bridge port is placed on the endpoint VLAN on join
+	if epConfig != nil && epConfig.Vlan != 0 {
+		if !config.VlanFiltering {
+			err = types.BadRequestErrorf("cannot place endpoint on VLAN %d: network is not VLAN aware", epConfig.Vlan)
+			return err
+		}
+		// The bridge sends its own traffic on the default VLAN only
+		if epConfig.Vlan != defaultVlanID && config.gatewayOnBridge() {
+			err = types.BadRequestErrorf("cannot place endpoint on VLAN %d: the gateway on bridge %s is only reachable from VLAN %d",
+				epConfig.Vlan, config.BridgeName, defaultVlanID)
+			return err
+		}
+		endpoint.vlan = epConfig.Vlan
+	}
+
 	if !dconfig.EnableUserlandProxy {
 		err = setHairpinMode(d.nlh, host, true)
 		if err != nil {
@@ -1120,10 +1385,30 @@ func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo,
 		}
 	}
 
+	var pinned net.IP
+	if epConfig != nil {
+		pinned = epConfig.EgressIP
+	}
+	if endpoint.egressIP, err = config.egressIP(eid, pinned); err != nil {
+		return err
+	}
+	if err = n.setupEgressSNAT(endpoint, true); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if err := n.setupEgressSNAT(endpoint, false); err != nil {
+				logrus.Warnf("Failed to remove the egress SNAT rule of endpoint %.7s: %v", endpoint.id, err)
+			}
+		}
+	}()
+
 	if err = d.storeUpdate(endpoint); err != nil {
 		return fmt.Errorf("failed to save bridge endpoint %.7s to store: %v", endpoint.id, err)
 	}
 
+	// The endpoint may be the peer of network policies
+	d.refreshPolicies()
 	return nil
 }
 
@@ -1178,6 +1463,10 @@ func (d *driver) DeleteEndpoint(nid, eid string) error {
 		}
 	}()
 
+	if err := n.setupEgressSNAT(ep, false); err != nil {
+		logrus.Warnf("Failed to remove the egress SNAT rule of endpoint %.7s: %v", ep.id, err)
+	}
+
 	// Try removal of link. Discard error: it is a best effort.
 	// Also make sure defer does not see this error either.
 	if link, err := d.nlh.LinkByName(ep.srcName); err == nil {
@@ -1190,6 +1479,7 @@ func (d *driver) DeleteEndpoint(nid, eid string) error {
 		logrus.Warnf("Failed to remove bridge endpoint %.7s from store: %v", ep.id, err)
 	}
 
+	d.refreshPolicies()
 	return nil
 }
 
@@ -1272,6 +1562,18 @@ func (d *driver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo,
 		return err
 	}
 
+	// The bridge drops the traffic between isolated ports, which no link
+	// rule can let through
+	if cc := endpoint.containerConfig; network.config.IsolatePorts && cc != nil && (len(cc.ParentEndpoints) > 0 || len(cc.ChildEndpoints) > 0) {
+		return types.BadRequestErrorf("links are not supported on network %s: its ports are isolated (%s)", network.config.BridgeName, IsolatePorts)
+	}
+
+	if endpoint.vlan != 0 {
+		if err = d.setupEndpointVlan(endpoint); err != nil {
+			return err
+		}
+	}
+
 	iNames := jinfo.InterfaceName()
 	containerVethPrefix := defaultContainerVethPrefix
 	if network.config.ContainerIfacePrefix != "" {
@@ -1313,7 +1615,7 @@ func (d *driver) Leave(nid, eid string) error {
 		return EndpointNotFoundError(eid)
 	}
 
-	if !network.config.EnableICC {
+	if !network.config.firewallICC() {
 		if err = d.link(network, endpoint, false); err != nil {
 			return err
 		}
@@ -1364,7 +1666,7 @@ func (d *driver) ProgramExternalConnectivity(nid, eid string, options map[string
 		return fmt.Errorf("failed to update bridge endpoint %.7s to store: %v", endpoint.id, err)
 	}
 
-	if !network.config.EnableICC {
+	if !network.config.firewallICC() {
 		return d.link(network, endpoint, true)
 	}
 
@@ -1436,6 +1738,8 @@ func (d *driver) link(network *bridgeNetwork, endpoint *bridgeEndpoint, enable b
 			l := newLink(parentEndpoint.addr.IP.String(),
 				endpoint.addr.IP.String(),
 				ec.ExposedPorts, network.config.BridgeName)
+			l.chain = d.linkChain()
+			l.owner = iptables.Owner{NetworkID: network.id, EndpointID: endpoint.id}
 			if enable {
 				err = l.Enable()
 				if err != nil {
@@ -1469,6 +1773,8 @@ func (d *driver) link(network *bridgeNetwork, endpoint *bridgeEndpoint, enable b
 		l := newLink(endpoint.addr.IP.String(),
 			childEndpoint.addr.IP.String(),
 			childEndpoint.extConnConfig.ExposedPorts, network.config.BridgeName)
+		l.chain = d.linkChain()
+		l.owner = iptables.Owner{NetworkID: network.id, EndpointID: endpoint.id}
 		if enable {
 			err = l.Enable()
 			if err != nil {
@@ -1520,6 +1826,38 @@ func parseEndpointOptions(epOptions map[string]interface{}) (*endpointConfigurat
 		}
 	}
 
+	if opt, ok := epOptions[Vlan]; ok {
+		if s, ok := opt.(string); ok {
+			var err error
+			if ec.Vlan, err = parseVlanID(s); err != nil {
+				return nil, parseErr(Vlan, s, err.Error())
+			}
+		} else {
+			return nil, &ErrInvalidEndpointConfig{}
+		}
+	}
+
+	if opt, ok := epOptions[PolicyLabels]; ok {
+		if s, ok := opt.(string); ok {
+			var err error
+			if ec.PolicyLabels, err = parsePolicyLabels(s); err != nil {
+				return nil, parseErr(PolicyLabels, s, err.Error())
+			}
+		} else {
+			return nil, &ErrInvalidEndpointConfig{}
+		}
+	}
+
+	if opt, ok := epOptions[EgressIP]; ok {
+		if s, ok := opt.(string); ok {
+			if ec.EgressIP = net.ParseIP(s); ec.EgressIP == nil || ec.EgressIP.To4() == nil {
+				return nil, parseErr(EgressIP, s, "invalid IPv4 address")
+			}
+		} else {
+			return nil, &ErrInvalidEndpointConfig{}
+		}
+	}
+
 	return ec, nil
 }
 
@@ -1568,6 +1906,14 @@ func parseConnectivityOptions(cOptions map[string]interface{}) (*connectivityCon
 		}
 	}
 
+	if opt, ok := cOptions[netlabel.PortOwner]; ok {
+		if owner, ok := opt.(string); ok {
+			cc.PortOwner = owner
+		} else {
+			return nil, types.BadRequestErrorf("Invalid port owner in connectivity configuration: %v", opt)
+		}
+	}
+
 	return cc, nil
 }
 
@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/discoverapi"
+	"github.com/docker/libnetwork/egress"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/types"
 	"github.com/sirupsen/logrus"
@@ -41,6 +43,9 @@ func (d *driver) initStore(option map[string]interface{}) error {
 		if err != nil {
 			return err
 		}
+
+		// Compile the policies against the restored endpoints
+		d.refreshPolicies()
 	}
 
 	return nil
@@ -91,6 +96,9 @@ func (d *driver) populateEndpoints() error {
 		}
 		n.endpoints[ep.id] = ep
 		n.restorePortAllocations(ep)
+		if err := n.setupEgressSNAT(ep, true); err != nil {
+			logrus.Warnf("Failed to restore the egress SNAT rule of endpoint %.7s: %v", ep.id, err)
+		}
 		logrus.Debugf("Endpoint (%.7s) restored to network (%.7s)", ep.id, ep.nid)
 	}
 
@@ -137,12 +145,38 @@ func (ncfg *networkConfiguration) MarshalJSON() ([]byte, error) {
 	nMap["EnableIPv6"] = ncfg.EnableIPv6
 	nMap["EnableIPMasquerade"] = ncfg.EnableIPMasquerade
 	nMap["EnableICC"] = ncfg.EnableICC
+	nMap["IsolatePorts"] = ncfg.IsolatePorts
+	nMap["GatewayMode"] = ncfg.GatewayMode
+	if ncfg.Policy != nil {
+		nMap["Policy"] = ncfg.Policy.String()
+	}
+	nMap["FlowLog"] = ncfg.FlowLog
+	if !ncfg.Egress.IsZero() {
+		nMap["EgressAllow"] = egress.FormatRules(ncfg.Egress.Allow)
+		nMap["EgressDeny"] = egress.FormatRules(ncfg.Egress.Deny)
+	}
 	nMap["InhibitIPv4"] = ncfg.InhibitIPv4
 	nMap["Mtu"] = ncfg.Mtu
 	nMap["Internal"] = ncfg.Internal
 	nMap["DefaultBridge"] = ncfg.DefaultBridge
 	nMap["DefaultBindingIP"] = ncfg.DefaultBindingIP.String()
 	nMap["HostIP"] = ncfg.HostIP.String()
+	if ncfg.HostIPv6 != nil {
+		nMap["HostIPv6"] = ncfg.HostIPv6.String()
+	}
+	if ncfg.EnableIPv6Masquerade != nil {
+		nMap["EnableIPv6Masquerade"] = *ncfg.EnableIPv6Masquerade
+	}
+	nMap["VlanFiltering"] = ncfg.VlanFiltering
+	nMap["VlanUplink"] = ncfg.VlanUplink
+	nMap["VlanTrunk"] = formatVlanList(ncfg.VlanTrunk)
+	if len(ncfg.EgressIPs) > 0 {
+		egressIPs := make([]string, 0, len(ncfg.EgressIPs))
+		for _, ip := range ncfg.EgressIPs {
+			egressIPs = append(egressIPs, ip.String())
+		}
+		nMap["EgressIPs"] = strings.Join(egressIPs, ",")
+	}
 	nMap["DefaultGatewayIPv4"] = ncfg.DefaultGatewayIPv4.String()
 	nMap["DefaultGatewayIPv6"] = ncfg.DefaultGatewayIPv6.String()
 	nMap["ContainerIfacePrefix"] = ncfg.ContainerIfacePrefix
@@ -189,6 +223,35 @@ func (ncfg *networkConfiguration) UnmarshalJSON(b []byte) error {
 		ncfg.HostIP = net.ParseIP(v.(string))
 	}
 
+	if v, ok := nMap["HostIPv6"]; ok {
+		ncfg.HostIPv6 = net.ParseIP(v.(string))
+	}
+
+	if v, ok := nMap["EnableIPv6Masquerade"]; ok {
+		masquerade := v.(bool)
+		ncfg.EnableIPv6Masquerade = &masquerade
+	}
+
+	if v, ok := nMap["VlanFiltering"]; ok {
+		ncfg.VlanFiltering = v.(bool)
+	}
+
+	if v, ok := nMap["VlanUplink"]; ok {
+		ncfg.VlanUplink = v.(string)
+	}
+
+	if v, ok := nMap["VlanTrunk"]; ok {
+		if ncfg.VlanTrunk, err = parseVlanList(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge network VLAN trunk after json unmarshal: %s", v.(string))
+		}
+	}
+
+	if v, ok := nMap["EgressIPs"]; ok {
+		if ncfg.EgressIPs, err = parseEgressIPs(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge network egress addresses after json unmarshal: %s", v.(string))
+		}
+	}
+
 	ncfg.DefaultBridge = nMap["DefaultBridge"].(bool)
 	ncfg.DefaultBindingIP = net.ParseIP(nMap["DefaultBindingIP"].(string))
 	ncfg.DefaultGatewayIPv4 = net.ParseIP(nMap["DefaultGatewayIPv4"].(string))
@@ -198,6 +261,38 @@ func (ncfg *networkConfiguration) UnmarshalJSON(b []byte) error {
 	ncfg.EnableIPv6 = nMap["EnableIPv6"].(bool)
 	ncfg.EnableIPMasquerade = nMap["EnableIPMasquerade"].(bool)
 	ncfg.EnableICC = nMap["EnableICC"].(bool)
+	if v, ok := nMap["IsolatePorts"]; ok {
+		ncfg.IsolatePorts = v.(bool)
+	}
+	if v, ok := nMap["GatewayMode"]; ok {
+		ncfg.GatewayMode = v.(string)
+	}
+	if v, ok := nMap["Policy"]; ok {
+		if ncfg.Policy, err = parsePolicy(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge network policy after json unmarshal: %v", err)
+		}
+	}
+	if v, ok := nMap["FlowLog"]; ok {
+		ncfg.FlowLog = v.(bool)
+	}
+	for _, key := range []string{"EgressAllow", "EgressDeny"} {
+		v, ok := nMap[key]
+		if !ok || v.(string) == "" {
+			continue
+		}
+		rules, err := egress.ParseRules(v.(string))
+		if err != nil {
+			return types.InternalErrorf("failed to decode bridge network egress rules after json unmarshal: %v", err)
+		}
+		if ncfg.Egress == nil {
+			ncfg.Egress = &egress.Policy{}
+		}
+		if key == "EgressAllow" {
+			ncfg.Egress.Allow = rules
+		} else {
+			ncfg.Egress.Deny = rules
+		}
+	}
 	if v, ok := nMap["InhibitIPv4"]; ok {
 		ncfg.InhibitIPv4 = v.(bool)
 	}
@@ -279,6 +374,10 @@ func (ep *bridgeEndpoint) MarshalJSON() ([]byte, error) {
 	epMap["ContainerConfig"] = ep.containerConfig
 	epMap["ExternalConnConfig"] = ep.extConnConfig
 	epMap["PortMapping"] = ep.portMapping
+	if ep.egressIP != nil {
+		epMap["EgressIP"] = ep.egressIP.String()
+	}
+	epMap["Vlan"] = ep.vlan
 
 	return json.Marshal(epMap)
 }
@@ -323,6 +422,12 @@ func (ep *bridgeEndpoint) UnmarshalJSON(b []byte) error {
 	if err := json.Unmarshal(d, &ep.extConnConfig); err != nil {
 		logrus.Warnf("Failed to decode endpoint external connectivity configuration %v", err)
 	}
+	if v, ok := epMap["EgressIP"]; ok {
+		ep.egressIP = net.ParseIP(v.(string))
+	}
+	if v, ok := epMap["Vlan"]; ok {
+		ep.vlan = uint16(v.(float64))
+	}
 	d, _ = json.Marshal(epMap["PortMapping"])
 	if err := json.Unmarshal(d, &ep.portMapping); err != nil {
 		logrus.Warnf("Failed to decode endpoint port mapping %v", err)
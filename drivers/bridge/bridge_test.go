@@ -30,7 +30,9 @@ func TestEndpointMarshalling(t *testing.T) {
 		addrv6:     ip2,
 		macAddress: mac,
 		srcName:    "veth123456",
-		config:     &endpointConfiguration{MacAddress: mac},
+		config:     &endpointConfiguration{MacAddress: mac, EgressIP: net.ParseIP("192.0.2.10")},
+		egressIP:   net.ParseIP("192.0.2.10"),
+		vlan:       20,
 		containerConfig: &containerConfiguration{
 			ParentEndpoints: []string{"one", "due", "three"},
 			ChildEndpoints:  []string{"four", "five", "six"},
@@ -88,7 +90,7 @@ func TestEndpointMarshalling(t *testing.T) {
 		!compareEpConfig(e.config, ee.config) ||
 		!compareContainerConfig(e.containerConfig, ee.containerConfig) ||
 		!compareConnConfig(e.extConnConfig, ee.extConnConfig) ||
-		!compareBindings(e.portMapping, ee.portMapping) {
+		!compareBindings(e.portMapping, ee.portMapping) || !e.egressIP.Equal(ee.egressIP) || e.vlan != ee.vlan {
 		t.Fatalf("JSON marsh/unmarsh failed.\nOriginal:\n%#v\nDecoded:\n%#v", e, ee)
 	}
 }
@@ -100,7 +102,7 @@ func compareEpConfig(a, b *endpointConfiguration) bool {
 	if a == nil || b == nil {
 		return false
 	}
-	return bytes.Equal(a.MacAddress, b.MacAddress)
+	return bytes.Equal(a.MacAddress, b.MacAddress) && a.EgressIP.Equal(b.EgressIP)
 }
 
 func compareContainerConfig(a, b *containerConfiguration) bool {
@@ -247,6 +249,278 @@ func TestCreateNoConfig(t *testing.T) {
 	}
 }
 
+func TestFirewallBackendConfig(t *testing.T) {
+	d := newDriver()
+
+	genericOption := make(map[string]interface{})
+	genericOption[netlabel.GenericData] = &configuration{FirewallBackend: "ebtables"}
+	if err := d.configure(genericOption); err == nil {
+		t.Fatal("Expected an error for an unsupported firewall backend")
+	}
+
+	genericOption[netlabel.GenericData] = &configuration{FirewallBackend: FirewallBackendNftables}
+	if err := d.configure(genericOption); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+	if !d.config.useNftables() {
+		t.Fatal("Expected the nftables firewall backend to be selected")
+	}
+	if _, ok := d.linkChain().(*iptables.ChainInfo); !ok {
+		t.Fatal("Expected the iptables chain to be used for links when nftables chains are not set up")
+	}
+}
+
+func TestEgressFilterConfig(t *testing.T) {
+	config := &networkConfiguration{ID: "n1", BridgeName: "br-egress"}
+	if err := config.fromLabels(map[string]string{
+		netlabel.EgressAllow: "192.0.2.10/32=443/tcp",
+		netlabel.EgressDeny:  "169.254.169.254/32",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if config.Egress.IsZero() || len(config.Egress.Allow) != 1 || len(config.Egress.Deny) != 1 {
+		t.Fatalf("Unexpected egress rules %v", config.Egress)
+	}
+	if err := config.fromLabels(map[string]string{netlabel.EgressAllow: "192.0.2.10"}); err == nil {
+		t.Fatal("Expected an error for a destination without prefix length")
+	}
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &networkConfiguration{}
+	if err := json.Unmarshal(b, restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Egress.IsZero() || restored.Egress.Allow[0].String() != "192.0.2.10/32=443/tcp" || restored.Egress.Deny[0].String() != "169.254.169.254/32" {
+		t.Fatalf("Egress rules changed through the store: %v", restored.Egress)
+	}
+
+	config.Internal = true
+	if err := (&configuration{EnableIPTables: true}).validateEgressFilter(config); err == nil {
+		t.Fatal("Expected an error for the egress rules of an internal network")
+	}
+}
+
+func TestEgressIPPool(t *testing.T) {
+	config := &networkConfiguration{}
+	if err := config.fromLabels(map[string]string{EgressIPPool: "192.0.2.10, 192.0.2.11"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.EgressIPs) != 2 {
+		t.Fatalf("Expected 2 egress addresses, got %v", config.EgressIPs)
+	}
+	for _, invalid := range []string{"", "192.0.2.10,2001:db8::1", "192.0.2.10,192.0.2.10", "foo"} {
+		if err := (&networkConfiguration{}).fromLabels(map[string]string{EgressIPPool: invalid}); err == nil {
+			t.Fatalf("Expected an error for egress address pool %q", invalid)
+		}
+	}
+
+	// The choice of an unpinned endpoint is stable
+	ip, err := config.egressIP("ep1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := config.egressIP("ep1", nil); !ip.Equal(again) {
+		t.Fatalf("Egress address changed from %s to %s", ip, again)
+	}
+	if ip, err = config.egressIP("ep1", net.ParseIP("192.0.2.11")); err != nil || !ip.Equal(net.ParseIP("192.0.2.11")) {
+		t.Fatalf("Expected the pinned egress address, got %s (%v)", ip, err)
+	}
+	if _, err = config.egressIP("ep1", net.ParseIP("192.0.2.12")); err == nil {
+		t.Fatal("Expected an error for an egress address out of the pool")
+	}
+	if _, err = (&networkConfiguration{}).egressIP("ep1", net.ParseIP("192.0.2.12")); err == nil {
+		t.Fatal("Expected an error for an egress address pinned without pool")
+	}
+
+	config.HostIP = net.ParseIP("192.0.2.1")
+	if err := config.Validate(); err == nil {
+		t.Fatal("Expected an error for a host IP combined with an egress address pool")
+	}
+}
+
+func TestNATConfig(t *testing.T) {
+	config := &networkConfiguration{EnableIPMasquerade: true}
+	if err := config.fromLabels(map[string]string{
+		netlabel.HostIP:   "192.0.2.1",
+		netlabel.HostIPv6: "2001:db8::1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if hostIP, masq := config.natConfig(iptables.IPv4); !masq || !hostIP.Equal(net.ParseIP("192.0.2.1")) {
+		t.Fatalf("Unexpected IPv4 NAT configuration: %v %t", hostIP, masq)
+	}
+	// The IPv6 traffic follows the IPv4 masquerade setting by default
+	if hostIP, masq := config.natConfig(iptables.IPv6); !masq || !hostIP.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("Unexpected IPv6 NAT configuration: %v %t", hostIP, masq)
+	}
+
+	if err := config.fromLabels(map[string]string{EnableIPv6Masquerade: "false"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, masq := config.natConfig(iptables.IPv6); masq {
+		t.Fatal("Expected the IPv6 traffic not to be masqueraded")
+	}
+	if _, masq := config.natConfig(iptables.IPv4); !masq {
+		t.Fatal("Expected the IPv4 traffic to be masqueraded")
+	}
+
+	if err := config.fromLabels(map[string]string{netlabel.HostIPv6: "192.0.2.1"}); err == nil {
+		t.Fatal("Expected an error for an IPv4 SNAT address for IPv6")
+	}
+}
+
+func TestIsolatePortsConfig(t *testing.T) {
+	config := &networkConfiguration{}
+	if err := config.fromLabels(map[string]string{IsolatePorts: "true", EnableICC: "true"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate(); err == nil {
+		t.Fatal("Expected an error for port isolation with ICC enabled")
+	}
+
+	config.EnableICC = false
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !config.firewallICC() {
+		t.Fatal("Expected the firewall to let the intercontainer traffic through with isolated ports")
+	}
+}
+
+func TestIsolatePortsLinks(t *testing.T) {
+	d := newDriver()
+	n := &bridgeNetwork{
+		id:        "isolated",
+		driver:    d,
+		config:    &networkConfiguration{BridgeName: "br-isolated", IsolatePorts: true},
+		endpoints: map[string]*bridgeEndpoint{"ep1": {id: "ep1"}},
+	}
+	d.networks[n.id] = n
+
+	for _, cc := range []*containerConfiguration{
+		{ParentEndpoints: []string{"ep2"}},
+		{ChildEndpoints: []string{"ep2"}},
+	} {
+		err := d.Join(n.id, "ep1", "", nil, map[string]interface{}{netlabel.GenericData: cc})
+		if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Expected a bad request error linking %+v on isolated ports, got %v", cc, err)
+		}
+	}
+}
+
+func TestVlanOptions(t *testing.T) {
+	config := &networkConfiguration{}
+	labels := map[string]string{
+		VlanFiltering: "true",
+		VlanUplink:    "eth1",
+		VlanTrunk:     "10, 20-22,10",
+	}
+	if err := config.fromLabels(labels); err != nil {
+		t.Fatal(err)
+	}
+	if !config.VlanFiltering || config.VlanUplink != "eth1" {
+		t.Fatalf("Unexpected VLAN configuration %+v", config)
+	}
+	if trunk := formatVlanList(config.VlanTrunk); trunk != "10,20,21,22" {
+		t.Fatalf("Unexpected VLAN trunk %s", trunk)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []string{"0", "4095", "20-10", "foo"} {
+		if err := (&networkConfiguration{}).fromLabels(map[string]string{VlanTrunk: invalid}); err == nil {
+			t.Fatalf("Expected an error for VLAN trunk %q", invalid)
+		}
+	}
+
+	config.VlanFiltering = false
+	if err := config.Validate(); err == nil {
+		t.Fatal("Expected an error for a VLAN uplink without VLAN filtering")
+	}
+
+	ec, err := parseEndpointOptions(map[string]interface{}{Vlan: "20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ec.Vlan != 20 {
+		t.Fatalf("Unexpected endpoint VLAN %d", ec.Vlan)
+	}
+	if _, err := parseEndpointOptions(map[string]interface{}{Vlan: "5000"}); err == nil {
+		t.Fatal("Expected an error for an invalid endpoint VLAN")
+	}
+}
+
+func TestEndpointVlan(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+	d := newDriver()
+
+	if err := d.configure(map[string]interface{}{netlabel.GenericData: &configuration{}}); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netconfig := &networkConfiguration{
+		BridgeName:    DefaultBridgeName,
+		VlanFiltering: true,
+	}
+	ipdList := getIPv4Data(t, "")
+	if err := d.CreateNetwork("net1", map[string]interface{}{netlabel.GenericData: netconfig}, nil, ipdList, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	// The endpoint could not reach the gateway on the bridge
+	te := newTestEndpoint(ipdList[0].Pool, 11)
+	err := d.CreateEndpoint("net1", "ep1", te.Interface(), map[string]interface{}{Vlan: "20"})
+	if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Expected a bad request error for an endpoint VLAN with the gateway on the bridge, got %v", err)
+	}
+	if err := d.DeleteNetwork("net1"); err != nil {
+		t.Fatal(err)
+	}
+
+	netconfig = &networkConfiguration{
+		BridgeName:    "vlanbr",
+		VlanFiltering: true,
+		InhibitIPv4:   true,
+	}
+	if err := d.CreateNetwork("net2", map[string]interface{}{netlabel.GenericData: netconfig}, nil, ipdList, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	if br, err := d.nlh.LinkByName("vlanbr"); err != nil {
+		t.Fatal(err)
+	} else if f := br.(*netlink.Bridge).VlanFiltering; f == nil || !*f {
+		t.Skip("VLAN filtering not supported by the kernel")
+	}
+	te = newTestEndpoint(ipdList[0].Pool, 12)
+	if err := d.CreateEndpoint("net2", "ep2", te.Interface(), map[string]interface{}{Vlan: "20"}); err != nil {
+		t.Fatalf("Failed to create an endpoint: %v", err)
+	}
+	if err := d.Join("net2", "ep2", "sbox", te, nil); err != nil {
+		t.Fatalf("Failed to join the endpoint: %v", err)
+	}
+
+	ep, err := d.networks["net2"].getEndpoint("ep2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbox, err := d.nlh.LinkByName(ep.srcName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vlans, err := d.nlh.BridgeVlanList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := vlans[int32(sbox.Attrs().ParentIndex)]
+	if len(port) != 1 || port[0].Vid != 20 || !port[0].PortVID() || !port[0].EngressUntag() {
+		t.Fatalf("Unexpected VLANs of the endpoint bridge port: %v", port)
+	}
+}
+
 func TestCreateFullOptionsLabels(t *testing.T) {
 	if !testutils.IsRunningInContainer() {
 		defer testutils.SetupTestOSContext(t)()
@@ -0,0 +1,127 @@
+package bridge
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/docker/libnetwork/flowlog"
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+// nflogArgs returns the target arguments logging a packet of the network
+// to the flow log group
+func nflogArgs(verdict, nid string) []string {
+	return []string{"-j", "NFLOG", "--nflog-group", strconv.Itoa(flowlog.Group), "--nflog-prefix", flowlog.Prefix(verdict, nid)}
+}
+
+// logDrops precedes the rules dropping the packets with a rule logging them
+func logDrops(rules [][]string, nid string) [][]string {
+	var logged [][]string
+	for _, rule := range rules {
+		if l := len(rule); l >= 2 && rule[l-2] == "-j" && rule[l-1] == "DROP" {
+			logged = append(logged, append(rule[:l-2:l-2], nflogArgs(flowlog.VerdictDrop, nid)...))
+		}
+		logged = append(logged, rule)
+	}
+	return logged
+}
+
+// flowLogRules returns the rules logging the flows of the network. The first
+// packet of the connections is logged once it made it through the filter
+// table, in the mangle POSTROUTING chain, for the traffic to the endpoints
+// and for the traffic from the endpoints leaving the bridge. The packets
+// left at the end of the FORWARD chain, which the daemon drops by default,
+// are logged as dropped.
+func flowLogRules(config *networkConfiguration, version iptables.IPVersion) (inserted []iptRule, appended []iptRule) {
+	owner := iptables.Owner{NetworkID: config.ID}
+	subnet := config.AddressIPv4
+	if version == iptables.IPv6 {
+		subnet = config.AddressIPv6
+	}
+	newConn := []string{"-m", "conntrack", "--ctstate", "NEW"}
+	accept := append(nflogArgs(flowlog.VerdictAccept, config.ID), owner.Args()...)
+	drop := append(nflogArgs(flowlog.VerdictDrop, config.ID), owner.Args()...)
+
+	inserted = append(inserted, iptRule{table: iptables.Mangle, chain: "POSTROUTING", preArgs: []string{"-t", "mangle"},
+		args: append(append([]string{"-o", config.BridgeName}, newConn...), accept...)})
+	if subnet != nil {
+		network := &net.IPNet{IP: subnet.IP.Mask(subnet.Mask), Mask: subnet.Mask}
+		inserted = append(inserted, iptRule{table: iptables.Mangle, chain: "POSTROUTING", preArgs: []string{"-t", "mangle"},
+			args: append(append([]string{"-s", network.String(), "!", "-o", config.BridgeName}, newConn...), accept...)})
+	}
+
+	for _, dir := range []string{"-i", "-o"} {
+		appended = append(appended, iptRule{table: iptables.Filter, chain: "FORWARD",
+			args: append([]string{dir, config.BridgeName}, drop...)})
+	}
+	return inserted, appended
+}
+
+// setupFlowLog logs the flows of the network to the flow log group, and
+// makes sure the driver listens to it.
+func (n *bridgeNetwork) setupFlowLog(config *networkConfiguration, i *bridgeInterface) error {
+	if err := n.driver.startFlowLog(); err != nil {
+		return err
+	}
+
+	for _, version := range n.iptablesVersions() {
+		version := version
+		inserted, appended := flowLogRules(config, version)
+		for _, rule := range inserted {
+			if err := programChainRule(version, rule, "FLOW LOG", true); err != nil {
+				return err
+			}
+		}
+		iptable := iptables.GetIptable(version)
+		for _, rule := range appended {
+			if iptable.Exists(rule.table, rule.chain, rule.args...) {
+				continue
+			}
+			if err := iptable.RawCombinedOutput(append([]string{"-A", rule.chain}, rule.args...)...); err != nil {
+				return fmt.Errorf("Unable to enable FLOW LOG rule: %v", err)
+			}
+		}
+
+		n.registerIptCleanFunc(func() error {
+			for _, rule := range append(inserted, appended...) {
+				if err := programChainRule(version, rule, "FLOW LOG", false); err != nil {
+					logrus.Warnf("Failed to remove the flow log rule of %s: %v", config.BridgeName, err)
+				}
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+// startFlowLog starts listening to the flow log group, once
+func (d *driver) startFlowLog() error {
+	d.Lock()
+	defer d.Unlock()
+	if d.flowLog != nil {
+		return nil
+	}
+	l, err := flowlog.Listen()
+	if err != nil {
+		return err
+	}
+	d.flowLog = l
+	return nil
+}
+
+// validateFlowLog checks the flows of the network can be logged
+func (c *configuration) validateFlowLog(config *networkConfiguration) error {
+	if !config.FlowLog {
+		return nil
+	}
+	if c.useNftables() {
+		return types.NotImplementedErrorf("flow logging is not supported with the %s firewall backend", FirewallBackendNftables)
+	}
+	if !c.EnableIPTables {
+		return types.BadRequestErrorf("flow logging requires iptables")
+	}
+	return nil
+}
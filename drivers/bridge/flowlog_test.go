@@ -0,0 +1,42 @@
+package bridge
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/iptables"
+)
+
+func TestFlowLogRules(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("172.18.0.1/16")
+	config := &networkConfiguration{ID: "0123456789abcdef", BridgeName: "br-flow", AddressIPv4: subnet, FlowLog: true}
+
+	inserted, appended := flowLogRules(config, iptables.IPv4)
+	if len(inserted) != 2 || len(appended) != 2 {
+		t.Fatalf("Unexpected rules %v %v", inserted, appended)
+	}
+	egress := strings.Join(inserted[1].args, " ")
+	if !strings.HasPrefix(egress, "-s 172.18.0.0/16 ! -o br-flow -m conntrack --ctstate NEW -j NFLOG --nflog-group 2048 --nflog-prefix accept:0123456789ab") {
+		t.Fatalf("Unexpected egress rule %s", egress)
+	}
+	if inserted[0].table != iptables.Mangle || appended[0].chain != "FORWARD" {
+		t.Fatalf("Unexpected chains %v %v", inserted[0], appended[0])
+	}
+
+	// No IPv6 subnet, only the traffic to the bridge is logged
+	if inserted, _ = flowLogRules(config, iptables.IPv6); len(inserted) != 1 {
+		t.Fatalf("Unexpected IPv6 rules %v", inserted)
+	}
+
+	rules := logDrops([][]string{{"-j", "RETURN"}, {"-d", "10.0.0.0/8", "-j", "DROP"}}, config.ID)
+	expected := [][]string{
+		{"-j", "RETURN"},
+		{"-d", "10.0.0.0/8", "-j", "NFLOG", "--nflog-group", "2048", "--nflog-prefix", "drop:0123456789ab"},
+		{"-d", "10.0.0.0/8", "-j", "DROP"},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("Unexpected rules %v", rules)
+	}
+}
@@ -7,9 +7,21 @@ const (
 	// EnableIPMasquerade label for bridge driver
 	EnableIPMasquerade = "com.docker.network.bridge.enable_ip_masquerade"
 
+	// EnableIPv6Masquerade label, the IPv6 traffic is masqueraded along with
+	// the IPv4 traffic when not set
+	EnableIPv6Masquerade = "com.docker.network.bridge.enable_ipv6_masquerade"
+
 	// EnableICC label
 	EnableICC = "com.docker.network.bridge.enable_icc"
 
+	// GatewayMode label, either "nat" (default) or "routed"
+	GatewayMode = "com.docker.network.bridge.gateway_mode"
+
+	// IsolatePorts label for dropping the traffic between the endpoints in
+	// the bridge, by means of the isolated flag of its ports. The endpoints
+	// cannot be linked.
+	IsolatePorts = "com.docker.network.bridge.isolate_ports"
+
 	// InhibitIPv4 label
 	InhibitIPv4 = "com.docker.network.bridge.inhibit_ipv4"
 
@@ -18,4 +30,33 @@ const (
 
 	// DefaultBridge label
 	DefaultBridge = "com.docker.network.bridge.default_bridge"
+
+	// EgressIPPool label for the comma separated list of IPv4 addresses
+	// the outbound traffic of the endpoints is translated to
+	EgressIPPool = "com.docker.network.bridge.egress_ipv4_pool"
+
+	// NetworkPolicy label for the JSON policy allowing or denying the
+	// traffic of the endpoints
+	NetworkPolicy = "com.docker.network.bridge.policy"
+
+	// PolicyLabels endpoint option for the comma separated key=value labels
+	// network policies select peers by
+	PolicyLabels = "com.docker.network.bridge.policy_labels"
+
+	// VlanFiltering label for the VLAN aware bridge mode
+	VlanFiltering = "com.docker.network.bridge.vlan_filtering"
+
+	// VlanUplink label for the interface trunking the VLANs of the bridge
+	VlanUplink = "com.docker.network.bridge.vlan_uplink"
+
+	// VlanTrunk label for the VLANs trunked on the uplink, as in "10,20-29"
+	VlanTrunk = "com.docker.network.bridge.vlan_trunk"
+
+	// Vlan endpoint option placing the endpoint on a VLAN of a VLAN aware
+	// bridge
+	Vlan = "com.docker.network.bridge.vlan"
+
+	// EgressIP endpoint option pinning the endpoint to an address of the
+	// network egress pool
+	EgressIP = "com.docker.network.bridge.egress_ipv4"
 )
@@ -9,11 +9,19 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// linkChain is the firewall chain the rules allowing the traffic between
+// linked containers are programmed in
+type linkChain interface {
+	LinkOwned(owner iptables.Owner, action iptables.Action, ip1, ip2 net.IP, port int, proto string, bridgeName string) error
+}
+
 type link struct {
 	parentIP string
 	childIP  string
 	ports    []types.TransportPort
 	bridge   string
+	chain    linkChain
+	owner    iptables.Owner
 }
 
 func (l *link) String() string {
@@ -26,6 +34,7 @@ func newLink(parentIP, childIP string, ports []types.TransportPort, bridge strin
 		parentIP: parentIP,
 		ports:    ports,
 		bridge:   bridge,
+		chain:    &iptables.ChainInfo{Name: DockerChain},
 	}
 
 }
@@ -33,7 +42,7 @@ func newLink(parentIP, childIP string, ports []types.TransportPort, bridge strin
 func (l *link) Enable() error {
 	// -A == iptables append flag
 	linkFunction := func() error {
-		return linkContainers("-A", l.parentIP, l.childIP, l.ports, l.bridge, false)
+		return linkContainers(l.chain, l.owner, "-A", l.parentIP, l.childIP, l.ports, l.bridge, false)
 	}
 
 	iptables.OnReloaded(func() { linkFunction() })
@@ -42,7 +51,7 @@ func (l *link) Enable() error {
 
 func (l *link) Disable() {
 	// -D == iptables delete flag
-	err := linkContainers("-D", l.parentIP, l.childIP, l.ports, l.bridge, true)
+	err := linkContainers(l.chain, l.owner, "-D", l.parentIP, l.childIP, l.ports, l.bridge, true)
 	if err != nil {
 		logrus.Errorf("Error removing IPTables rules for a link %s due to %s", l.String(), err.Error())
 	}
@@ -50,7 +59,7 @@ func (l *link) Disable() {
 	// that returns typed errors
 }
 
-func linkContainers(action, parentIP, childIP string, ports []types.TransportPort, bridge string,
+func linkContainers(chain linkChain, owner iptables.Owner, action, parentIP, childIP string, ports []types.TransportPort, bridge string,
 	ignoreErrors bool) error {
 	var nfAction iptables.Action
 
@@ -74,9 +83,8 @@ func linkContainers(action, parentIP, childIP string, ports []types.TransportPor
 		return InvalidLinkIPAddrError(childIP)
 	}
 
-	chain := iptables.ChainInfo{Name: DockerChain}
 	for _, port := range ports {
-		err := chain.Link(nfAction, ip1, ip2, int(port.Port), port.Proto.String(), bridge)
+		err := chain.LinkOwned(owner, nfAction, ip1, ip2, int(port.Port), port.Proto.String(), bridge)
 		if !ignoreErrors && err != nil {
 			return err
 		}
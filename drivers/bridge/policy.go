@@ -0,0 +1,371 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PolicyChain dispatches the traffic of the bridge networks to the
+	// chains compiled from their policy
+	PolicyChain = "DOCKER-POLICY"
+
+	policyChainIn  = "DOCKER-POL-IN-"
+	policyChainOut = "DOCKER-POL-OUT-"
+
+	policyAllow = "allow"
+	policyDeny  = "deny"
+)
+
+// networkPolicy allows or denies the traffic to the endpoints of a network
+// (ingress) and from them (egress). The rules are evaluated in order, the
+// first match wins, and the traffic matching no rule gets the default
+// action. A policy only restricts the traffic the driver lets through
+// otherwise: allowing a peer does not lift the isolation between networks.
+type networkPolicy struct {
+	Default string       `json:"default,omitempty"`
+	Ingress []policyRule `json:"ingress,omitempty"`
+	Egress  []policyRule `json:"egress,omitempty"`
+}
+
+// policyRule matches the traffic by peer, the source of the ingress traffic
+// or the destination of the egress traffic, and by destination port. The
+// peer is selected by network ID, by endpoint label or by CIDR; no selector
+// matches any peer.
+type policyRule struct {
+	Action   string `json:"action"`
+	Network  string `json:"network,omitempty"`
+	Label    string `json:"label,omitempty"`
+	CIDR     string `json:"cidr,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Port     string `json:"port,omitempty"`
+}
+
+// parsePolicy parses the JSON representation of a network policy
+func parsePolicy(value string) (*networkPolicy, error) {
+	p := &networkPolicy{}
+	if err := json.Unmarshal([]byte(value), p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *networkPolicy) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+func (p *networkPolicy) validate() error {
+	switch p.Default {
+	case "", policyAllow, policyDeny:
+	default:
+		return fmt.Errorf("invalid default action %q", p.Default)
+	}
+	for _, rules := range [][]policyRule{p.Ingress, p.Egress} {
+		for i := range rules {
+			if err := rules[i].validate(); err != nil {
+				return fmt.Errorf("invalid rule %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *policyRule) validate() error {
+	if r.Action != policyAllow && r.Action != policyDeny {
+		return fmt.Errorf("invalid action %q", r.Action)
+	}
+	selectors := 0
+	for _, s := range []string{r.Network, r.Label, r.CIDR} {
+		if s != "" {
+			selectors++
+		}
+	}
+	if selectors > 1 {
+		return fmt.Errorf("network, label and cidr are mutually exclusive")
+	}
+	if r.Label != "" && !strings.Contains(r.Label, "=") {
+		return fmt.Errorf("invalid label %q, expected key=value", r.Label)
+	}
+	if r.CIDR != "" {
+		if _, _, err := net.ParseCIDR(r.CIDR); err != nil {
+			return err
+		}
+	}
+	switch r.Protocol {
+	case "", "tcp", "udp", "sctp":
+	default:
+		return fmt.Errorf("invalid protocol %q", r.Protocol)
+	}
+	if r.Port != "" {
+		if r.Protocol == "" {
+			return fmt.Errorf("port %s requires a protocol", r.Port)
+		}
+		for _, port := range strings.SplitN(r.Port, "-", 2) {
+			if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+				return fmt.Errorf("invalid port %q", r.Port)
+			}
+		}
+	}
+	return nil
+}
+
+// policyPeers returns the addresses of the peers of the rule of the IP
+// version, and whether the rule matches any peer.
+type policyPeers func(r policyRule, version iptables.IPVersion) ([]string, bool)
+
+// compile returns the rules of the chain enforcing the ingress or egress
+// rules of the policy, in order.
+func (p *networkPolicy) compile(ingress bool, version iptables.IPVersion, peers policyPeers) [][]string {
+	var (
+		rules    = p.Egress
+		peerFlag = "-d"
+		compiled = [][]string{{"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "RETURN"}}
+	)
+	if ingress {
+		rules = p.Ingress
+		peerFlag = "-s"
+	}
+
+	for _, r := range rules {
+		var match []string
+		if r.Protocol != "" {
+			match = append(match, "-p", r.Protocol)
+			if r.Port != "" {
+				match = append(match, "--dport", strings.Replace(r.Port, "-", ":", 1))
+			}
+		}
+		target := "RETURN"
+		if r.Action == policyDeny {
+			target = "DROP"
+		}
+
+		addrs, any := peers(r, version)
+		if any {
+			compiled = append(compiled, append(match, "-j", target))
+			continue
+		}
+		for _, addr := range addrs {
+			rule := append([]string{peerFlag, addr}, match...)
+			compiled = append(compiled, append(rule, "-j", target))
+		}
+	}
+
+	if p.Default == policyDeny {
+		compiled = append(compiled, []string{"-j", "DROP"})
+	}
+	return compiled
+}
+
+// parsePolicyLabels parses the comma separated key=value labels of an
+// endpoint the policy rules select peers by.
+func parsePolicyLabels(value string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, kv := range strings.Split(value, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", kv)
+		}
+		labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return labels, nil
+}
+
+func policyChains(nid string) (string, string) {
+	if len(nid) > 12 {
+		nid = nid[:12]
+	}
+	return policyChainIn + nid, policyChainOut + nid
+}
+
+// iptablesVersions returns the IP versions the iptables rules of the network
+// are programmed for
+func (n *bridgeNetwork) iptablesVersions() []iptables.IPVersion {
+	n.Lock()
+	config := n.config
+	d := n.driver
+	n.Unlock()
+
+	d.Lock()
+	driverConfig := d.config
+	d.Unlock()
+
+	var versions []iptables.IPVersion
+	if driverConfig.EnableIPTables {
+		versions = append(versions, iptables.IPv4)
+	}
+	if config.EnableIPv6 && driverConfig.EnableIP6Tables {
+		versions = append(versions, iptables.IPv6)
+	}
+	return versions
+}
+
+// setupPolicy creates the chains of the network policy and dispatches the
+// traffic of the bridge to them.
+func (n *bridgeNetwork) setupPolicy(config *networkConfiguration, i *bridgeInterface) error {
+	in, out := policyChains(config.ID)
+	owner := iptables.Owner{NetworkID: config.ID}
+	jumps := []iptRule{
+		{table: iptables.Filter, chain: PolicyChain, args: append([]string{"-i", config.BridgeName, "-j", out}, owner.Args()...)},
+		{table: iptables.Filter, chain: PolicyChain, args: append([]string{"-o", config.BridgeName, "-j", in}, owner.Args()...)},
+	}
+
+	for _, version := range n.iptablesVersions() {
+		version := version
+		iptable := iptables.GetIptable(version)
+		for _, chain := range []string{PolicyChain, in, out} {
+			if _, err := iptable.NewChain(chain, iptables.Filter, false); err != nil {
+				return fmt.Errorf("failed to create policy chain %s: %v", chain, err)
+			}
+		}
+		for _, jump := range jumps {
+			if err := programChainRule(version, jump, "POLICY", true); err != nil {
+				return err
+			}
+		}
+		if err := iptable.EnsureJumpRule("FORWARD", PolicyChain); err != nil {
+			return err
+		}
+
+		n.registerIptCleanFunc(func() error {
+			for _, jump := range jumps {
+				if err := programChainRule(version, jump, "POLICY", false); err != nil {
+					logrus.Warnf("Failed to remove the policy jump rule of %s: %v", config.BridgeName, err)
+				}
+			}
+			for _, chain := range []string{in, out} {
+				if err := iptable.RemoveExistingChain(chain, iptables.Filter); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return n.applyPolicy()
+}
+
+// applyPolicy compiles the policy of the network against the current
+// networks and endpoints, and replaces the rules of its chains.
+func (n *bridgeNetwork) applyPolicy() error {
+	n.Lock()
+	config := n.config
+	d := n.driver
+	n.Unlock()
+
+	if config.Policy == nil {
+		return nil
+	}
+
+	in, out := policyChains(config.ID)
+	for _, version := range n.iptablesVersions() {
+		tx := iptables.GetIptable(version).NewTransaction()
+		for _, chain := range []struct {
+			name    string
+			ingress bool
+		}{{in, true}, {out, false}} {
+			tx.Queue(iptables.Filter, chain.name, iptables.Flush)
+			rules := config.Policy.compile(chain.ingress, version, d.policyPeers)
+			if config.FlowLog {
+				rules = logDrops(rules, config.ID)
+			}
+			for _, rule := range rules {
+				tx.Queue(iptables.Filter, chain.name, iptables.Append, rule...)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to apply the policy of network %.7s: %v", config.ID, err)
+		}
+	}
+	return nil
+}
+
+// refreshPolicies recompiles the policies of the networks, as the peers
+// they select come and go.
+func (d *driver) refreshPolicies() {
+	for _, n := range d.getNetworks() {
+		if err := n.applyPolicy(); err != nil {
+			logrus.Warn(err)
+		}
+	}
+}
+
+func (d *driver) policyPeers(r policyRule, version iptables.IPVersion) ([]string, bool) {
+	ipv6 := version == iptables.IPv6
+
+	switch {
+	case r.CIDR != "":
+		ip, _, _ := net.ParseCIDR(r.CIDR)
+		if (ip.To4() == nil) != ipv6 {
+			return nil, false
+		}
+		return []string{r.CIDR}, false
+
+	case r.Network != "":
+		n, err := d.getNetwork(r.Network)
+		if err != nil {
+			return nil, false
+		}
+		n.Lock()
+		subnet := n.config.AddressIPv4
+		if ipv6 {
+			subnet = n.config.AddressIPv6
+		}
+		n.Unlock()
+		if subnet == nil {
+			return nil, false
+		}
+		return []string{(&net.IPNet{IP: subnet.IP.Mask(subnet.Mask), Mask: subnet.Mask}).String()}, false
+
+	case r.Label != "":
+		kv := strings.SplitN(r.Label, "=", 2)
+		var addrs []string
+		for _, n := range d.getNetworks() {
+			n.Lock()
+			for _, ep := range n.endpoints {
+				if ep.config == nil {
+					continue
+				}
+				if v, ok := ep.config.PolicyLabels[kv[0]]; !ok || v != kv[1] {
+					continue
+				}
+				if ipv6 && ep.addrv6 != nil {
+					addrs = append(addrs, ep.addrv6.IP.String())
+				} else if !ipv6 && ep.addr != nil {
+					addrs = append(addrs, ep.addr.IP.String())
+				}
+			}
+			n.Unlock()
+		}
+		return addrs, false
+	}
+
+	return nil, true
+}
+
+// validatePolicy checks the policy of the network can be enforced
+func (c *configuration) validatePolicy(config *networkConfiguration) error {
+	if config.Policy == nil {
+		return nil
+	}
+	if c.useNftables() {
+		return types.NotImplementedErrorf("network policies are not supported with the %s firewall backend", FirewallBackendNftables)
+	}
+	if !c.EnableIPTables {
+		return types.BadRequestErrorf("network policies require iptables")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package bridge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/iptables"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, invalid := range []string{
+		`{"default": "reject"}`,
+		`{"ingress": [{"action": "permit"}]}`,
+		`{"ingress": [{"action": "allow", "network": "n1", "cidr": "10.0.0.0/8"}]}`,
+		`{"ingress": [{"action": "allow", "label": "app"}]}`,
+		`{"ingress": [{"action": "allow", "port": "80"}]}`,
+		`{"egress": [{"action": "deny", "protocol": "tcp", "port": "80-foo"}]}`,
+		`{"egress": [{"action": "deny", "cidr": "10.0.0.0"}]}`,
+		`not json`,
+	} {
+		if _, err := parsePolicy(invalid); err == nil {
+			t.Fatalf("Expected an error for policy %s", invalid)
+		}
+	}
+
+	p, err := parsePolicy(`{"default": "deny", "ingress": [{"action": "allow", "protocol": "tcp", "port": "80"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p2, err := parsePolicy(p.String()); err != nil || !reflect.DeepEqual(p, p2) {
+		t.Fatalf("Policy changed through its string representation: %v (%v)", p2, err)
+	}
+}
+
+func TestCompilePolicy(t *testing.T) {
+	p, err := parsePolicy(`{
+		"default": "deny",
+		"ingress": [
+			{"action": "allow", "label": "role=frontend", "protocol": "tcp", "port": "8080-8081"},
+			{"action": "allow", "cidr": "2001:db8::/64"},
+			{"action": "allow", "protocol": "udp", "port": "53"}
+		],
+		"egress": [
+			{"action": "deny", "network": "n2"}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peers := func(r policyRule, version iptables.IPVersion) ([]string, bool) {
+		switch {
+		case r.Label == "role=frontend":
+			return []string{"172.18.0.2", "172.18.0.3"}, false
+		case r.Network == "n2":
+			return []string{"172.19.0.0/16"}, false
+		case r.CIDR != "":
+			// Not of the IP version
+			return nil, false
+		}
+		return nil, true
+	}
+
+	compile := func(ingress bool) []string {
+		var rules []string
+		for _, r := range p.compile(ingress, iptables.IPv4, peers) {
+			rules = append(rules, strings.Join(r, " "))
+		}
+		return rules
+	}
+
+	expected := []string{
+		"-m conntrack --ctstate RELATED,ESTABLISHED -j RETURN",
+		"-s 172.18.0.2 -p tcp --dport 8080:8081 -j RETURN",
+		"-s 172.18.0.3 -p tcp --dport 8080:8081 -j RETURN",
+		"-p udp --dport 53 -j RETURN",
+		"-j DROP",
+	}
+	if rules := compile(true); !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("Unexpected ingress rules:\n%s", strings.Join(rules, "\n"))
+	}
+
+	expected = []string{
+		"-m conntrack --ctstate RELATED,ESTABLISHED -j RETURN",
+		"-d 172.19.0.0/16 -j DROP",
+		"-j DROP",
+	}
+	if rules := compile(false); !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("Unexpected egress rules:\n%s", strings.Join(rules, "\n"))
+	}
+
+	if labels, err := parsePolicyLabels("role=frontend, tier=web"); err != nil || labels["tier"] != "web" {
+		t.Fatalf("Unexpected labels %v (%v)", labels, err)
+	}
+	if _, err := parsePolicyLabels("role"); err == nil {
+		t.Fatal("Expected an error for a label without value")
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
 
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/nftables"
+	"github.com/docker/libnetwork/portmapper"
 	"github.com/docker/libnetwork/types"
 	"github.com/ishidawataru/sctp"
 	"github.com/sirupsen/logrus"
@@ -27,23 +31,31 @@ func (n *bridgeNetwork) allocatePorts(ep *bridgeEndpoint, reqDefBindIP net.IP, u
 		containerIPv6 = ep.addrv6.IP
 	}
 
-	pb, err := n.allocatePortsInternal(ep.extConnConfig.PortBindings, ep.addr.IP, containerIPv6, defHostIP, ulPxyEnabled)
+	pb, err := n.allocatePortsInternal(ep.id, ep.extConnConfig.PortOwner, ep.extConnConfig.PortBindings, ep.addr.IP, containerIPv6, defHostIP, ulPxyEnabled)
 	if err != nil {
 		return nil, err
 	}
 	return pb, nil
 }
 
-func (n *bridgeNetwork) allocatePortsInternal(bindings []types.PortBinding, containerIPv4, containerIPv6, defHostIP net.IP, ulPxyEnabled bool) ([]types.PortBinding, error) {
+func (n *bridgeNetwork) allocatePortsInternal(eid, owner string, bindings []types.PortBinding, containerIPv4, containerIPv6, defHostIP net.IP, ulPxyEnabled bool) ([]types.PortBinding, error) {
+	if n.config.routed() {
+		for _, c := range bindings {
+			if err := validateRoutedBinding(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	bs := make([]types.PortBinding, 0, len(bindings))
 	for _, c := range bindings {
 		bIPv4 := c.GetCopy()
 		bIPv6 := c.GetCopy()
 		// Allocate IPv4 Port mappings
 		if ok := n.validatePortBindingIPv4(&bIPv4, containerIPv4, defHostIP); ok {
-			if err := n.allocatePort(&bIPv4, ulPxyEnabled); err != nil {
+			if err := n.allocatePort(eid, owner, &bIPv4, ulPxyEnabled); err != nil {
 				// On allocation failure, release previously allocated ports. On cleanup error, just log a warning message
-				if cuErr := n.releasePortsInternal(bs); cuErr != nil {
+				if cuErr := n.releasePortsInternal(eid, bs); cuErr != nil {
 					logrus.Warnf("allocation failure for %v, failed to clear previously allocated ipv4 port bindings: %v", bIPv4, cuErr)
 				}
 				return nil, err
@@ -62,14 +74,16 @@ func (n *bridgeNetwork) allocatePortsInternal(bindings []types.PortBinding, cont
 		// If the container has no IPv6 address, allow proxying host IPv6 traffic to it
 		// by setting up the binding with the IPv4 interface if the userland proxy is enabled
 		// This change was added to keep backward compatibility
+		// Not when the binding restricts its sources: the proxied traffic
+		// does not go through the forwarding rules enforcing them.
 		containerIP := containerIPv6
-		if ulPxyEnabled && (containerIPv6 == nil) {
+		if ulPxyEnabled && (containerIPv6 == nil) && !n.config.routed() && len(c.SourceCIDRs) == 0 {
 			containerIP = containerIPv4
 		}
 		if ok := n.validatePortBindingIPv6(&bIPv6, containerIP, defHostIP); ok {
-			if err := n.allocatePort(&bIPv6, ulPxyEnabled); err != nil {
+			if err := n.allocatePort(eid, owner, &bIPv6, ulPxyEnabled); err != nil {
 				// On allocation failure, release previously allocated ports. On cleanup error, just log a warning message
-				if cuErr := n.releasePortsInternal(bs); cuErr != nil {
+				if cuErr := n.releasePortsInternal(eid, bs); cuErr != nil {
 					logrus.Warnf("allocation failure for %v, failed to clear previously allocated ipv6 port bindings: %v", bIPv6, cuErr)
 				}
 				return nil, err
@@ -80,6 +94,24 @@ func (n *bridgeNetwork) allocatePortsInternal(bindings []types.PortBinding, cont
 	return bs, nil
 }
 
+// validateRoutedBinding checks that the binding does not ask for a host
+// port or address: in routed mode the container port is reached directly.
+func validateRoutedBinding(bnd types.PortBinding) error {
+	if bnd.HostPort != 0 && bnd.HostPort != bnd.Port || bnd.HostPortEnd != 0 && bnd.HostPortEnd != bnd.Port {
+		return types.BadRequestErrorf("cannot map host port %d to port %d/%s: host ports are not supported in %s %s",
+			bnd.HostPort, bnd.Port, bnd.Proto, GatewayMode, GatewayModeRouted)
+	}
+	if len(bnd.HostIP) > 0 && !bnd.HostIP.IsUnspecified() {
+		return types.BadRequestErrorf("cannot publish port %d/%s on host address %s: host addresses are not supported in %s %s",
+			bnd.Port, bnd.Proto, bnd.HostIP, GatewayMode, GatewayModeRouted)
+	}
+	if bnd.ProxyProtocol != "" {
+		return types.BadRequestErrorf("cannot send a PROXY protocol header to port %d/%s: there is no userland proxy in %s %s",
+			bnd.Port, bnd.Proto, GatewayMode, GatewayModeRouted)
+	}
+	return nil
+}
+
 // validatePortBindingIPv4 validates the port binding, populates the missing Host IP field and returns true
 // if this is a valid IPv4 binding, else returns false
 func (n *bridgeNetwork) validatePortBindingIPv4(bnd *types.PortBinding, containerIPv4, defHostIP net.IP) bool {
@@ -128,12 +160,27 @@ func (n *bridgeNetwork) validatePortBindingIPv6(bnd *types.PortBinding, containe
 	return true
 }
 
-func (n *bridgeNetwork) allocatePort(bnd *types.PortBinding, ulPxyEnabled bool) error {
+// allocatePort maps the host port of the binding to the container port. The
+// ephemeral host port of the binding is leased to the owner, if any, which
+// gets it back the next time it is published.
+func (n *bridgeNetwork) allocatePort(eid, owner string, bnd *types.PortBinding, ulPxyEnabled bool) error {
 	var (
 		host net.Addr
 		err  error
 	)
 
+	sources, err := parseSourceCIDRs(bnd.SourceCIDRs)
+	if err != nil {
+		return types.BadRequestErrorf("invalid source CIDRs for port %s: %v", bnd, err)
+	}
+
+	// In routed mode the container port is reached directly
+	if n.config.routed() {
+		bnd.HostPort = bnd.Port
+		bnd.HostPortEnd = bnd.Port
+		return n.setupRoutedPort(eid, bnd, true)
+	}
+
 	// Adjust HostPortEnd if this is not a range.
 	if bnd.HostPortEnd == 0 {
 		bnd.HostPortEnd = bnd.HostPort
@@ -145,15 +192,48 @@ func (n *bridgeNetwork) allocatePort(bnd *types.PortBinding, ulPxyEnabled bool)
 		return err
 	}
 
+	if err := bnd.Validate(); err != nil {
+		return types.BadRequestErrorf("invalid port %s: %v", bnd, err)
+	}
+	if bnd.ProxyProtocol != "" && !ulPxyEnabled {
+		return types.BadRequestErrorf("PROXY protocol requires the userland proxy, disabled for port %s", bnd)
+	}
+	d := n.driver
+	d.Lock()
+	useNftables := d.config.useNftables()
+	maxConns, idleTimeout := d.config.UserlandProxyMaxConnections, d.config.UserlandProxyIdleTimeout
+	d.Unlock()
+	if len(sources) > 0 && useNftables {
+		return types.NotImplementedErrorf("source CIDRs of published ports are not supported with the %s firewall backend", FirewallBackendNftables)
+	}
+	opts := portmapper.MapOptions{
+		NetworkID:      n.id,
+		EndpointID:     eid,
+		ProxyProtocol:  bnd.ProxyProtocol,
+		SourceCIDRs:    sources,
+		MaxConnections: maxConns,
+		IdleTimeout:    idleTimeout,
+	}
+
 	portmapper := n.portMapper
 
 	if bnd.HostIP.To4() == nil {
 		portmapper = n.portMapperV6
 	}
 
+	var lessee string
+	if owner != "" && (bnd.HostPort == 0 || bnd.HostPort != bnd.HostPortEnd) {
+		lessee = owner + "/" + strconv.Itoa(int(bnd.Port))
+		if port := portmapper.Allocator.LeasedPort(lessee, bnd.HostIP, bnd.Proto.String(), int(bnd.HostPort), int(bnd.HostPortEnd)); port != 0 {
+			if host, err = portmapper.MapRangeWithOptions(container, bnd.HostIP, port, port, ulPxyEnabled, opts); err != nil {
+				logrus.Debugf("Failed to map port %d leased to %s, allocating another one: %v", port, lessee, err)
+			}
+		}
+	}
+
 	// Try up to maxAllocatePortAttempts times to get a port that's not already allocated.
-	for i := 0; i < maxAllocatePortAttempts; i++ {
-		if host, err = portmapper.MapRange(container, bnd.HostIP, int(bnd.HostPort), int(bnd.HostPortEnd), ulPxyEnabled); err == nil {
+	for i := 0; host == nil && i < maxAllocatePortAttempts; i++ {
+		if host, err = portmapper.MapRangeWithOptions(container, bnd.HostIP, int(bnd.HostPort), int(bnd.HostPortEnd), ulPxyEnabled, opts); err == nil {
 			break
 		}
 		// There is no point in immediately retrying to map an explicitly chosen port.
@@ -171,29 +251,110 @@ func (n *bridgeNetwork) allocatePort(bnd *types.PortBinding, ulPxyEnabled bool)
 	switch netAddr := host.(type) {
 	case *net.TCPAddr:
 		bnd.HostPort = uint16(host.(*net.TCPAddr).Port)
-		return nil
 	case *net.UDPAddr:
 		bnd.HostPort = uint16(host.(*net.UDPAddr).Port)
-		return nil
 	case *sctp.SCTPAddr:
 		bnd.HostPort = uint16(host.(*sctp.SCTPAddr).Port)
-		return nil
 	default:
 		// For completeness
 		return ErrUnsupportedAddressType(fmt.Sprintf("%T", netAddr))
 	}
+
+	if lessee != "" {
+		portmapper.Allocator.Lease(lessee, bnd.HostIP, bnd.Proto.String(), int(bnd.HostPort))
+	}
+	return nil
+}
+
+// setupRoutedPort accepts [stops accepting] the forwarded traffic to the
+// container port of the binding, in place of mapping a host port to it.
+func (n *bridgeNetwork) setupRoutedPort(eid string, bnd *types.PortBinding, enable bool) error {
+	d := n.driver
+	d.Lock()
+	driverConfig := d.config
+	d.Unlock()
+
+	var (
+		bridgeName = n.getNetworkBridgeName()
+		proto      = bnd.Proto.String()
+		version    = iptables.IPv4
+		family     = nftables.IPv4
+	)
+	if bnd.IP.To4() == nil {
+		version = iptables.IPv6
+		family = nftables.IPv6
+	}
+
+	if version == iptables.IPv4 && !driverConfig.EnableIPTables || version == iptables.IPv6 && !driverConfig.EnableIP6Tables {
+		return nil
+	}
+
+	// Only the sources of the IP version of the port are let through
+	sources, _ := parseSourceCIDRs(bnd.SourceCIDRs)
+	var saddrs []string
+	for _, s := range sources {
+		if (s.IP.To4() == nil) == (version == iptables.IPv6) {
+			saddrs = append(saddrs, s.String())
+		}
+	}
+	if len(sources) > 0 && len(saddrs) == 0 {
+		return nil
+	}
+
+	if driverConfig.useNftables() {
+		spec := fmt.Sprintf("iifname != %[1]q oifname %[1]q %s daddr %s %s dport %d", bridgeName, family, bnd.IP, proto, bnd.Port)
+		if len(saddrs) == 0 {
+			return programNFTRule(family, nftRule{table: iptables.Filter, chain: DockerChain, spec: spec + " accept"}, "ROUTED PORT", enable)
+		}
+		for _, saddr := range saddrs {
+			rule := nftRule{table: iptables.Filter, chain: DockerChain, spec: fmt.Sprintf("%s %s saddr %s accept", spec, family, saddr)}
+			if err := programNFTRule(family, rule, "ROUTED PORT", enable); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	owner := iptables.Owner{NetworkID: n.id, EndpointID: eid}
+	args := []string{"!", "-i", bridgeName, "-o", bridgeName, "-p", proto, "-d", bnd.IP.String(),
+		"--dport", strconv.Itoa(int(bnd.Port))}
+	if len(saddrs) == 0 {
+		rule := iptRule{table: iptables.Filter, chain: DockerChain, args: append(append(args, "-j", "ACCEPT"), owner.Args()...)}
+		return programChainRule(version, rule, "ROUTED PORT", enable)
+	}
+	for _, saddr := range saddrs {
+		rule := iptRule{table: iptables.Filter, chain: DockerChain,
+			args: append(append(args[:len(args):len(args)], "-s", saddr, "-j", "ACCEPT"), owner.Args()...)}
+		if err := programChainRule(version, rule, "ROUTED PORT", enable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSourceCIDRs parses the source CIDRs of a port binding
+func parseSourceCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var sources []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, ipNet)
+	}
+	return sources, nil
 }
 
 func (n *bridgeNetwork) releasePorts(ep *bridgeEndpoint) error {
-	return n.releasePortsInternal(ep.portMapping)
+	return n.releasePortsInternal(ep.id, ep.portMapping)
 }
 
-func (n *bridgeNetwork) releasePortsInternal(bindings []types.PortBinding) error {
+func (n *bridgeNetwork) releasePortsInternal(eid string, bindings []types.PortBinding) error {
 	var errorBuf bytes.Buffer
 
 	// Attempt to release all port bindings, do not stop on failure
 	for _, m := range bindings {
-		if err := n.releasePort(m); err != nil {
+		if err := n.releasePort(eid, m); err != nil {
 			errorBuf.WriteString(fmt.Sprintf("\ncould not release %v because of %v", m, err))
 		}
 	}
@@ -204,7 +365,11 @@ func (n *bridgeNetwork) releasePortsInternal(bindings []types.PortBinding) error
 	return nil
 }
 
-func (n *bridgeNetwork) releasePort(bnd types.PortBinding) error {
+func (n *bridgeNetwork) releasePort(eid string, bnd types.PortBinding) error {
+	if n.config.routed() {
+		return n.setupRoutedPort(eid, &bnd, false)
+	}
+
 	// Construct the host side transport address
 	host, err := bnd.HostAddr()
 	if err != nil {
@@ -242,3 +407,36 @@ func IsV6Listenable() bool {
 	})
 	return v6ListenableCached
 }
+
+// PortMappings returns the port mappings of the bridge networks, and the
+// container ports published by the networks in routed mode
+func (d *driver) PortMappings() []types.PortMapping {
+	var mappings []types.PortMapping
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		pms := []*portmapper.PortMapper{n.portMapper, n.portMapperV6}
+		if n.config.routed() {
+			for _, ep := range n.endpoints {
+				for _, bnd := range ep.portMapping {
+					mappings = append(mappings, types.PortMapping{
+						Proto:         bnd.Proto,
+						HostIP:        types.GetIPCopy(bnd.IP),
+						HostPort:      bnd.Port,
+						ContainerIP:   types.GetIPCopy(bnd.IP),
+						ContainerPort: bnd.Port,
+						NetworkID:     n.id,
+						EndpointID:    ep.id,
+						Routed:        true,
+					})
+				}
+			}
+		}
+		n.Unlock()
+		for _, pm := range pms {
+			if pm != nil {
+				mappings = append(mappings, pm.Mappings()...)
+			}
+		}
+	}
+	return mappings
+}
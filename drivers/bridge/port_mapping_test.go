@@ -1,11 +1,15 @@
 package bridge
 
 import (
+	"fmt"
+	"net"
 	"os"
 	"testing"
 
 	"github.com/docker/docker/pkg/reexec"
+	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/nftables"
 	"github.com/docker/libnetwork/testutils"
 	"github.com/docker/libnetwork/types"
 )
@@ -168,3 +172,131 @@ func TestPortMappingV6Config(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRoutedPortBindings(t *testing.T) {
+	d := newDriver()
+	n := &bridgeNetwork{
+		id:     "routed",
+		driver: d,
+		config: &networkConfiguration{BridgeName: "br-routed", GatewayMode: GatewayModeRouted},
+	}
+	if _, masq := n.config.natConfig(iptables.IPv4); masq {
+		t.Fatal("Expected no masquerade in routed mode")
+	}
+
+	// The host port and address cannot be honoured
+	for _, b := range []types.PortBinding{
+		{Proto: types.TCP, Port: uint16(80), HostPort: uint16(8080)},
+		{Proto: types.TCP, Port: uint16(80), HostIP: net.ParseIP("192.168.1.1")},
+	} {
+		_, err := n.allocatePortsInternal("ep", "", []types.PortBinding{b}, net.ParseIP("172.20.0.2"), nil, net.IPv4zero, true)
+		if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Expected a bad request error for routed binding %v, got %v", b, err)
+		}
+	}
+
+	bindings := []types.PortBinding{
+		{Proto: types.TCP, Port: uint16(80), HostPort: uint16(80)},
+		{Proto: types.UDP, Port: uint16(53)},
+	}
+	pb, err := n.allocatePortsInternal("ep", "", bindings, net.ParseIP("172.20.0.2"), nil, net.IPv4zero, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pb) != 2 {
+		t.Fatalf("Expected 2 bindings, got %v", pb)
+	}
+	for _, b := range pb {
+		if b.HostPort != b.Port || !b.IP.Equal(net.ParseIP("172.20.0.2")) {
+			t.Fatalf("Unexpected routed binding %v", b)
+		}
+	}
+
+	// The routed ports are part of the inventory, without host port mapping
+	n.endpoints = map[string]*bridgeEndpoint{"ep": {id: "ep", portMapping: pb}}
+	d.networks[n.id] = n
+	mappings := d.PortMappings()
+	if len(mappings) != 2 {
+		t.Fatalf("Expected 2 port mappings, got %v", mappings)
+	}
+	for _, m := range mappings {
+		if !m.Routed || m.DNAT || m.EndpointID != "ep" || !m.ContainerIP.Equal(net.ParseIP("172.20.0.2")) || m.HostPort != m.ContainerPort {
+			t.Fatalf("Unexpected routed port mapping %+v", m)
+		}
+	}
+
+	if err := n.releasePortsInternal("ep", pb); err != nil {
+		t.Fatal(err)
+	}
+
+	n.config.GatewayMode = "bgp"
+	if err := n.config.Validate(); err == nil {
+		t.Fatal("Expected an error for an invalid gateway mode")
+	}
+}
+
+func TestRoutedDefaultDrop(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+	d := newDriver()
+
+	config := &configuration{
+		EnableIPTables:  true,
+		FirewallBackend: FirewallBackendNftables,
+	}
+	if err := d.configure(map[string]interface{}{netlabel.GenericData: config}); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netconfig := &networkConfiguration{
+		BridgeName:  DefaultBridgeName,
+		GatewayMode: GatewayModeRouted,
+	}
+	ipdList := getIPv4Data(t, "")
+	if err := d.CreateNetwork("routed", map[string]interface{}{netlabel.GenericData: netconfig}, nil, ipdList, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	te := newTestEndpoint(ipdList[0].Pool, 11)
+	if err := d.CreateEndpoint("routed", "ep1", te.Interface(), nil); err != nil {
+		t.Fatalf("Failed to create an endpoint: %v", err)
+	}
+	if err := d.Join("routed", "ep1", "sbox", te, nil); err != nil {
+		t.Fatalf("Failed to join the endpoint: %v", err)
+	}
+	pm := map[string]interface{}{netlabel.PortMap: []types.PortBinding{
+		{Proto: types.TCP, Port: uint16(80)},
+		{Proto: types.UDP, Port: uint16(53), SourceCIDRs: []string{"203.0.113.0/24", "2001:db8::/32"}},
+	}}
+	if err := d.ProgramExternalConnectivity("routed", "ep1", pm); err != nil {
+		t.Fatalf("Failed to program external connectivity: %v", err)
+	}
+
+	// The published port is accepted, any other one is dropped
+	table := nftables.GetTable(nftables.IPv4)
+	accept := fmt.Sprintf(`iifname != %[1]q oifname %[1]q ip daddr %s tcp dport 80 accept`, DefaultBridgeName, te.iface.addr.IP)
+	if !table.Exists(iptables.Filter, DockerChain, accept) {
+		t.Fatal("Published port not accepted")
+	}
+	drop := fmt.Sprintf(`iifname != %[1]q oifname %[1]q drop`, DefaultBridgeName)
+	if !table.Exists(iptables.Filter, DockerChain, drop) {
+		t.Fatal("Unpublished ports not dropped")
+	}
+	// The allowed sources of a port are accepted ahead of the default drop
+	sourceAccept := fmt.Sprintf(`iifname != %[1]q oifname %[1]q ip daddr %s udp dport 53 ip saddr 203.0.113.0/24 accept`, DefaultBridgeName, te.iface.addr.IP)
+	if !table.Exists(iptables.Filter, DockerChain, sourceAccept) {
+		t.Fatal("Allowed source of the published port not accepted")
+	}
+
+	if err := d.RevokeExternalConnectivity("routed", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+	if table.Exists(iptables.Filter, DockerChain, accept) || table.Exists(iptables.Filter, DockerChain, sourceAccept) {
+		t.Fatal("Published port still accepted")
+	}
+	if err := d.DeleteNetwork("routed"); err != nil {
+		t.Fatal(err)
+	}
+	if table.Exists(iptables.Filter, DockerChain, drop) {
+		t.Fatal("Default drop rule not removed with the network")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/docker/libnetwork/netutils"
 	"github.com/sirupsen/logrus"
@@ -25,6 +27,10 @@ func setupDevice(config *networkConfiguration, i *bridgeInterface) error {
 			Name: config.BridgeName,
 		},
 	}
+	if config.VlanFiltering {
+		vlanFiltering := true
+		i.Link.(*netlink.Bridge).VlanFiltering = &vlanFiltering
+	}
 
 	// Set the bridge's MAC address. Requires kernel version 3.3 or up.
 	hwAddr := netutils.GenerateRandomMAC()
@@ -71,3 +77,152 @@ func setupDeviceUp(config *networkConfiguration, i *bridgeInterface) error {
 	}
 	return nil
 }
+
+// setPortIsolation sets the isolated flag of the bridge port: the kernel
+// drops the traffic between isolated ports. Requires kernel 4.18 or up.
+func setPortIsolation(ifaceName string, enable bool) error {
+	path := filepath.Join("/sys/class/net", ifaceName, "brport/isolated")
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("bridge port isolation is not supported on %s: %v", ifaceName, err)
+	}
+
+	val := []byte{'0', '\n'}
+	if enable {
+		val = []byte{'1', '\n'}
+	}
+	if err := ioutil.WriteFile(path, val, 0644); err != nil {
+		return fmt.Errorf("unable to set port isolation on %s: %v", ifaceName, err)
+	}
+	return nil
+}
+
+// defaultVlanID is the VLAN the bridge ports are placed on by the kernel
+const defaultVlanID = 1
+
+// setupVlanFiltering turns the bridge into a VLAN aware bridge, also when it
+// was created outside of libnetwork.
+func setupVlanFiltering(config *networkConfiguration, i *bridgeInterface) error {
+	sysPath := filepath.Join("/sys/class/net", config.BridgeName, "bridge/vlan_filtering")
+	if err := ioutil.WriteFile(sysPath, []byte{'1', '\n'}, 0644); err != nil {
+		return fmt.Errorf("failed to enable VLAN filtering on bridge %s: %v", config.BridgeName, err)
+	}
+	return nil
+}
+
+// setupVlanUplink attaches the uplink interface to the bridge and lets the
+// trunked VLANs through it, tagged.
+func setupVlanUplink(config *networkConfiguration, i *bridgeInterface) error {
+	br, err := i.nlh.LinkByName(config.BridgeName)
+	if err != nil {
+		return fmt.Errorf("could not find bridge %s: %v", config.BridgeName, err)
+	}
+	uplink, err := i.nlh.LinkByName(config.VlanUplink)
+	if err != nil {
+		return fmt.Errorf("could not find VLAN uplink %s: %v", config.VlanUplink, err)
+	}
+	if uplink.Attrs().MasterIndex != br.Attrs().Index {
+		if err := addToBridge(i.nlh, config.VlanUplink, config.BridgeName); err != nil {
+			return fmt.Errorf("adding VLAN uplink %s to bridge %s failed: %v", config.VlanUplink, config.BridgeName, err)
+		}
+	}
+	for _, vid := range config.VlanTrunk {
+		if err := i.nlh.BridgeVlanAdd(uplink, vid, false, false, false, true); err != nil {
+			return fmt.Errorf("failed to trunk VLAN %d on uplink %s: %v", vid, config.VlanUplink, err)
+		}
+	}
+	if err := i.nlh.LinkSetUp(uplink); err != nil {
+		return fmt.Errorf("failed to set link up for VLAN uplink %s: %v", config.VlanUplink, err)
+	}
+	return nil
+}
+
+// setupPortVlan places the bridge port on the VLAN, untagged: the traffic
+// of the endpoint only reaches the ports of the same VLAN and the uplink.
+func setupPortVlan(nlh *netlink.Handle, link netlink.Link, vid uint16) error {
+	if err := nlh.BridgeVlanAdd(link, vid, true, true, false, true); err != nil {
+		return fmt.Errorf("failed to place interface %s on VLAN %d: %v", link.Attrs().Name, vid, err)
+	}
+	if vid != defaultVlanID {
+		if err := nlh.BridgeVlanDel(link, defaultVlanID, false, false, false, true); err != nil {
+			return fmt.Errorf("failed to remove interface %s from the default VLAN: %v", link.Attrs().Name, err)
+		}
+	}
+	return nil
+}
+
+// setupEndpointVlan places the bridge port of the endpoint on its VLAN. The
+// host side of the veth pair is found as the peer of the sandbox side, which
+// is still in the host namespace when the endpoint joins the sandbox.
+func (d *driver) setupEndpointVlan(ep *bridgeEndpoint) error {
+	sbox, err := d.nlh.LinkByName(ep.srcName)
+	if err != nil {
+		return fmt.Errorf("could not find interface %s of endpoint %s: %v", ep.srcName, ep.id, err)
+	}
+	host, err := d.nlh.LinkByIndex(sbox.Attrs().ParentIndex)
+	if err != nil {
+		return fmt.Errorf("could not find the bridge port of endpoint %s: %v", ep.id, err)
+	}
+	return setupPortVlan(d.nlh, host, ep.vlan)
+}
+
+// gatewayOnBridge tells whether the bridge holds a gateway address of the
+// network
+func (c *networkConfiguration) gatewayOnBridge() bool {
+	return !c.InhibitIPv4 || c.EnableIPv6
+}
+
+// parseVlanID parses a VLAN ID, valid from 1 to 4094
+func parseVlanID(value string) (uint16, error) {
+	vid, err := strconv.ParseUint(strings.TrimSpace(value), 10, 16)
+	if err != nil {
+		return 0, err
+	}
+	if vid < 1 || vid > 4094 {
+		return 0, fmt.Errorf("VLAN ID %d out of range 1-4094", vid)
+	}
+	return uint16(vid), nil
+}
+
+// parseVlanList parses a comma separated list of VLAN IDs and ranges of
+// VLAN IDs, as in "10,20-29".
+func parseVlanList(value string) ([]uint16, error) {
+	var (
+		vids []uint16
+		seen = make(map[uint16]bool)
+	)
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		first, err := parseVlanID(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseVlanID(bounds[1]); err != nil {
+				return nil, err
+			}
+			if last < first {
+				return nil, fmt.Errorf("invalid VLAN range %s", item)
+			}
+		}
+		for vid := first; vid <= last; vid++ {
+			if !seen[vid] {
+				seen[vid] = true
+				vids = append(vids, vid)
+			}
+		}
+	}
+	return vids, nil
+}
+
+// formatVlanList is the reverse of parseVlanList
+func formatVlanList(vids []uint16) string {
+	items := make([]string, 0, len(vids))
+	for _, vid := range vids {
+		items = append(items, strconv.Itoa(int(vid)))
+	}
+	return strings.Join(items, ",")
+}
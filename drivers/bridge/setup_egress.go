@@ -0,0 +1,94 @@
+package bridge
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strings"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/nftables"
+	"github.com/docker/libnetwork/types"
+)
+
+// parseEgressIPs parses a comma separated list of IPv4 addresses
+func parseEgressIPs(value string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid IPv4 address %q", s)
+		}
+		for _, other := range ips {
+			if other.Equal(ip) {
+				return nil, fmt.Errorf("duplicate address %s", s)
+			}
+		}
+		ips = append(ips, ip.To4())
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("empty address pool")
+	}
+	return ips, nil
+}
+
+// egressIP returns the source address the outbound traffic of the endpoint
+// is translated to: the pinned address if any, otherwise the address of the
+// pool the endpoint ID hashes to, so that the choice is stable across
+// restarts. It returns nil if the network has no egress pool.
+func (c *networkConfiguration) egressIP(eid string, pinned net.IP) (net.IP, error) {
+	if len(c.EgressIPs) == 0 {
+		if pinned != nil {
+			return nil, types.BadRequestErrorf("cannot pin egress address %s: network has no egress address pool", pinned)
+		}
+		return nil, nil
+	}
+	if pinned != nil {
+		for _, ip := range c.EgressIPs {
+			if ip.Equal(pinned) {
+				return ip, nil
+			}
+		}
+		return nil, types.BadRequestErrorf("egress address %s is not in the network egress address pool", pinned)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(eid))
+	return c.EgressIPs[h.Sum32()%uint32(len(c.EgressIPs))], nil
+}
+
+// setupEgressSNAT installs [removes] the rule translating the source address
+// of the outbound traffic of the endpoint to its egress address. The rule is
+// inserted ahead of the network wide masquerade rule.
+func (n *bridgeNetwork) setupEgressSNAT(ep *bridgeEndpoint, enable bool) error {
+	n.Lock()
+	config := n.config
+	d := n.driver
+	n.Unlock()
+
+	if _, ipmasq := config.natConfig(iptables.IPv4); ep.egressIP == nil || ep.addr == nil || config.Internal || !ipmasq {
+		return nil
+	}
+
+	d.Lock()
+	driverConfig := d.config
+	d.Unlock()
+
+	if !driverConfig.EnableIPTables {
+		return nil
+	}
+
+	if driverConfig.useNftables() {
+		rule := nftRule{table: iptables.Nat, chain: "POSTROUTING",
+			spec: fmt.Sprintf("ip saddr %s oifname != %q snat to %s", ep.addr.IP, config.BridgeName, ep.egressIP)}
+		return programNFTRule(nftables.IPv4, rule, "EGRESS SNAT", enable)
+	}
+
+	owner := iptables.Owner{NetworkID: n.id, EndpointID: ep.id}
+	rule := iptRule{table: iptables.Nat, chain: "POSTROUTING", preArgs: []string{"-t", "nat"},
+		args: append([]string{"-s", ep.addr.IP.String(), "!", "-o", config.BridgeName, "-j", "SNAT", "--to-source", ep.egressIP.String()}, owner.Args()...)}
+	return programChainRule(iptables.IPv4, rule, "EGRESS SNAT", enable)
+}
@@ -0,0 +1,78 @@
+package bridge
+
+import (
+	"fmt"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+const egressFilterChain = "DOCKER-EGRESS-"
+
+func egressFilterChainName(nid string) string {
+	if len(nid) > 12 {
+		nid = nid[:12]
+	}
+	return egressFilterChain + nid
+}
+
+// setupEgressFilter restricts the destinations the endpoints can reach
+// outside of the network, by sending the traffic leaving the bridge through
+// a chain enforcing the egress rules of the network.
+func (n *bridgeNetwork) setupEgressFilter(config *networkConfiguration, i *bridgeInterface) error {
+	chain := egressFilterChainName(config.ID)
+	owner := iptables.Owner{NetworkID: config.ID}
+	jump := iptRule{table: iptables.Filter, chain: "FORWARD",
+		args: append([]string{"-i", config.BridgeName, "!", "-o", config.BridgeName, "-j", chain}, owner.Args()...)}
+
+	for _, version := range n.iptablesVersions() {
+		version := version
+		iptable := iptables.GetIptable(version)
+		if _, err := iptable.NewChain(chain, iptables.Filter, false); err != nil {
+			return fmt.Errorf("failed to create egress filter chain %s: %v", chain, err)
+		}
+
+		tx := iptable.NewTransaction()
+		tx.Queue(iptables.Filter, chain, iptables.Flush)
+		rules := config.Egress.Compile(version == iptables.IPv6)
+		if config.FlowLog {
+			rules = logDrops(rules, config.ID)
+		}
+		for _, rule := range rules {
+			tx.Queue(iptables.Filter, chain, iptables.Append, rule...)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to program the egress filter of network %.7s: %v", config.ID, err)
+		}
+
+		if err := programChainRule(version, jump, "EGRESS FILTER", true); err != nil {
+			return err
+		}
+
+		n.registerIptCleanFunc(func() error {
+			if err := programChainRule(version, jump, "EGRESS FILTER", false); err != nil {
+				logrus.Warnf("Failed to remove the egress filter jump rule of %s: %v", config.BridgeName, err)
+			}
+			return iptable.RemoveExistingChain(chain, iptables.Filter)
+		})
+	}
+	return nil
+}
+
+// validateEgressFilter checks the egress rules of the network can be enforced
+func (c *configuration) validateEgressFilter(config *networkConfiguration) error {
+	if config.Egress.IsZero() {
+		return nil
+	}
+	if config.Internal {
+		return types.BadRequestErrorf("egress rules do not apply to internal networks")
+	}
+	if c.useNftables() {
+		return types.NotImplementedErrorf("egress rules are not supported with the %s firewall backend", FirewallBackendNftables)
+	}
+	if !c.EnableIPTables {
+		return types.BadRequestErrorf("egress rules require iptables")
+	}
+	return nil
+}
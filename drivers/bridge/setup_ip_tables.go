@@ -6,6 +6,7 @@ import (
 	"net"
 
 	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/nftables"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
 )
@@ -111,6 +112,9 @@ func (n *bridgeNetwork) setupIP4Tables(config *networkConfiguration, i *bridgeIn
 		IP:   i.bridgeIPv4.IP.Mask(i.bridgeIPv4.Mask),
 		Mask: i.bridgeIPv4.Mask,
 	}
+	if driverConfig.useNftables() {
+		return n.setupNFTables(nftables.IPv4, maskedAddrv4, config)
+	}
 	return n.setupIPTables(iptables.IPv4, maskedAddrv4, config, i)
 }
 
@@ -129,6 +133,9 @@ func (n *bridgeNetwork) setupIP6Tables(config *networkConfiguration, i *bridgeIn
 		IP:   i.bridgeIPv6.IP.Mask(i.bridgeIPv6.Mask),
 		Mask: i.bridgeIPv6.Mask,
 	}
+	if driverConfig.useNftables() {
+		return n.setupNFTables(nftables.IPv6, maskedAddrv6, config)
+	}
 
 	return n.setupIPTables(iptables.IPv6, maskedAddrv6, config, i)
 }
@@ -146,39 +153,53 @@ func (n *bridgeNetwork) setupIPTables(ipVersion iptables.IPVersion, maskedAddr *
 
 	iptable := iptables.GetIptable(ipVersion)
 
+	// Tag the rules with the network, for the stale rules to be removed
+	// should the daemon stop before cleaning them up.
+	owner := iptables.Owner{NetworkID: config.ID}
+	hostIP, ipmasq := config.natConfig(ipVersion)
+
 	if config.Internal {
-		if err = setupInternalNetworkRules(config.BridgeName, maskedAddr, config.EnableICC, true); err != nil {
+		if err = setupInternalNetworkRules(owner, config.BridgeName, maskedAddr, config.firewallICC(), true); err != nil {
 			return fmt.Errorf("Failed to Setup IP tables: %s", err.Error())
 		}
 		n.registerIptCleanFunc(func() error {
-			return setupInternalNetworkRules(config.BridgeName, maskedAddr, config.EnableICC, false)
+			return setupInternalNetworkRules(owner, config.BridgeName, maskedAddr, config.firewallICC(), false)
 		})
 	} else {
-		if err = setupIPTablesInternal(config.HostIP, config.BridgeName, maskedAddr, config.EnableICC, config.EnableIPMasquerade, hairpinMode, true); err != nil {
+		if err = setupIPTablesInternal(owner, hostIP, config.BridgeName, maskedAddr, config.firewallICC(), ipmasq, hairpinMode, true); err != nil {
 			return fmt.Errorf("Failed to Setup IP tables: %s", err.Error())
 		}
 		n.registerIptCleanFunc(func() error {
-			return setupIPTablesInternal(config.HostIP, config.BridgeName, maskedAddr, config.EnableICC, config.EnableIPMasquerade, hairpinMode, false)
+			return setupIPTablesInternal(owner, hostIP, config.BridgeName, maskedAddr, config.firewallICC(), ipmasq, hairpinMode, false)
 		})
 		natChain, filterChain, _, _, err := n.getDriverChains(ipVersion)
 		if err != nil {
 			return fmt.Errorf("Failed to setup IP tables, cannot acquire chain info %s", err.Error())
 		}
 
-		err = iptable.ProgramChain(natChain, config.BridgeName, hairpinMode, true)
+		err = iptable.ProgramChainOwned(owner, natChain, config.BridgeName, hairpinMode, true)
 		if err != nil {
 			return fmt.Errorf("Failed to program NAT chain: %s", err.Error())
 		}
 
-		err = iptable.ProgramChain(filterChain, config.BridgeName, hairpinMode, true)
+		err = iptable.ProgramChainOwned(owner, filterChain, config.BridgeName, hairpinMode, true)
 		if err != nil {
 			return fmt.Errorf("Failed to program FILTER chain: %s", err.Error())
 		}
 
 		n.registerIptCleanFunc(func() error {
-			return iptable.ProgramChain(filterChain, config.BridgeName, hairpinMode, false)
+			return iptable.ProgramChainOwned(owner, filterChain, config.BridgeName, hairpinMode, false)
 		})
 
+		if config.routed() {
+			if err = setRoutedDefaultDrop(ipVersion, owner, config.BridgeName, true); err != nil {
+				return fmt.Errorf("Failed to setup IP tables: %s", err.Error())
+			}
+			n.registerIptCleanFunc(func() error {
+				return setRoutedDefaultDrop(ipVersion, owner, config.BridgeName, false)
+			})
+		}
+
 		if ipVersion == iptables.IPv4 {
 			n.portMapper.SetIptablesChain(natChain, n.getNetworkBridgeName())
 		} else {
@@ -192,6 +213,25 @@ func (n *bridgeNetwork) setupIPTables(ipVersion iptables.IPVersion, maskedAddr *
 	return err
 }
 
+// setRoutedDefaultDrop drops the forwarded traffic entering the bridge of a
+// routed network. It is appended to the DOCKER chain, after the rules
+// accepting the traffic to the published ports.
+func setRoutedDefaultDrop(version iptables.IPVersion, owner iptables.Owner, bridgeIface string, enable bool) error {
+	var (
+		action    = iptables.Append
+		operation = "enable"
+	)
+	if !enable {
+		action = iptables.Delete
+		operation = "disable"
+	}
+	args := append([]string{"!", "-i", bridgeIface, "-o", bridgeIface, "-j", "DROP"}, owner.Args()...)
+	if err := iptables.GetIptable(version).ProgramRule(iptables.Filter, DockerChain, action, args); err != nil {
+		return fmt.Errorf("Unable to %s routed mode default DROP rule: %v", operation, err)
+	}
+	return nil
+}
+
 type iptRule struct {
 	table   iptables.Table
 	chain   string
@@ -199,7 +239,7 @@ type iptRule struct {
 	args    []string
 }
 
-func setupIPTablesInternal(hostIP net.IP, bridgeIface string, addr *net.IPNet, icc, ipmasq, hairpin, enable bool) error {
+func setupIPTablesInternal(owner iptables.Owner, hostIP net.IP, bridgeIface string, addr *net.IPNet, icc, ipmasq, hairpin, enable bool) error {
 
 	var (
 		address   = addr.String()
@@ -228,33 +268,56 @@ func setupIPTablesInternal(hostIP net.IP, bridgeIface string, addr *net.IPNet, i
 		ipVersion = iptables.IPv6
 	}
 
+	for _, rule := range []*iptRule{&skipDNAT, &outRule, &natRule, &hpNatRule} {
+		rule.args = append(rule.args, owner.Args()...)
+	}
+
+	iptable := iptables.GetIptable(ipVersion)
+	tx := iptable.NewTransaction()
+
 	// Set NAT.
 	if ipmasq {
-		if err := programChainRule(ipVersion, natRule, "NAT", enable); err != nil {
-			return err
-		}
+		queueChainRule(tx, iptable, natRule, enable)
 	}
 
 	if ipmasq && !hairpin {
-		if err := programChainRule(ipVersion, skipDNAT, "SKIP DNAT", enable); err != nil {
-			return err
-		}
+		queueChainRule(tx, iptable, skipDNAT, enable)
 	}
 
 	// In hairpin mode, masquerade traffic from localhost
 	if hairpin {
-		if err := programChainRule(ipVersion, hpNatRule, "MASQ LOCAL HOST", enable); err != nil {
-			return err
-		}
+		queueChainRule(tx, iptable, hpNatRule, enable)
 	}
 
 	// Set Inter Container Communication.
-	if err := setIcc(ipVersion, bridgeIface, icc, enable); err != nil {
-		return err
-	}
+	queueIcc(tx, iptable, owner, bridgeIface, icc, enable)
 
 	// Set Accept on all non-intercontainer outgoing packets.
-	return programChainRule(ipVersion, outRule, "ACCEPT NON_ICC OUTGOING", enable)
+	queueChainRule(tx, iptable, outRule, enable)
+
+	return commitBridgeRules(tx, bridgeIface, enable)
+}
+
+// queueChainRule queues the insertion [removal] of the rule in the
+// transaction, only if it is [not] present.
+func queueChainRule(tx *iptables.Transaction, iptable *iptables.IPTable, rule iptRule, insert bool) {
+	doesExist := iptable.Exists(rule.table, rule.chain, rule.args...)
+	if insert && !doesExist {
+		tx.Queue(rule.table, rule.chain, iptables.Insert, rule.args...)
+	} else if !insert && doesExist {
+		tx.Queue(rule.table, rule.chain, iptables.Delete, rule.args...)
+	}
+}
+
+func commitBridgeRules(tx *iptables.Transaction, bridgeIface string, enable bool) error {
+	operation := "enable"
+	if !enable {
+		operation = "disable"
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Unable to %s iptables rules for %s: %s", operation, bridgeIface, err.Error())
+	}
+	return nil
 }
 
 func programChainRule(version iptables.IPVersion, rule iptRule, ruleDescr string, insert bool) error {
@@ -290,82 +353,61 @@ func programChainRule(version iptables.IPVersion, rule iptRule, ruleDescr string
 	return nil
 }
 
-func setIcc(version iptables.IPVersion, bridgeIface string, iccEnable, insert bool) error {
-	iptable := iptables.GetIptable(version)
+func queueIcc(tx *iptables.Transaction, iptable *iptables.IPTable, owner iptables.Owner, bridgeIface string, iccEnable, insert bool) {
 	var (
-		table      = iptables.Filter
-		chain      = "FORWARD"
 		args       = []string{"-i", bridgeIface, "-o", bridgeIface, "-j"}
-		acceptArgs = append(args, "ACCEPT")
-		dropArgs   = append(args, "DROP")
+		acceptRule = iptRule{table: iptables.Filter, chain: "FORWARD", args: append(append(args[:len(args):len(args)], "ACCEPT"), owner.Args()...)}
+		dropRule   = iptRule{table: iptables.Filter, chain: "FORWARD", args: append(append(args[:len(args):len(args)], "DROP"), owner.Args()...)}
 	)
 
 	if insert {
 		if !iccEnable {
-			iptable.Raw(append([]string{"-D", chain}, acceptArgs...)...)
+			queueChainRule(tx, iptable, acceptRule, false)
 
-			if !iptable.Exists(table, chain, dropArgs...) {
-				if err := iptable.RawCombinedOutput(append([]string{"-A", chain}, dropArgs...)...); err != nil {
-					return fmt.Errorf("Unable to prevent intercontainer communication: %s", err.Error())
-				}
+			if !iptable.Exists(dropRule.table, dropRule.chain, dropRule.args...) {
+				tx.Queue(dropRule.table, dropRule.chain, iptables.Append, dropRule.args...)
 			}
 		} else {
-			iptable.Raw(append([]string{"-D", chain}, dropArgs...)...)
-
-			if !iptable.Exists(table, chain, acceptArgs...) {
-				if err := iptable.RawCombinedOutput(append([]string{"-I", chain}, acceptArgs...)...); err != nil {
-					return fmt.Errorf("Unable to allow intercontainer communication: %s", err.Error())
-				}
-			}
+			queueChainRule(tx, iptable, dropRule, false)
+			queueChainRule(tx, iptable, acceptRule, true)
 		}
 	} else {
 		// Remove any ICC rule.
 		if !iccEnable {
-			if iptable.Exists(table, chain, dropArgs...) {
-				iptable.Raw(append([]string{"-D", chain}, dropArgs...)...)
-			}
+			queueChainRule(tx, iptable, dropRule, false)
 		} else {
-			if iptable.Exists(table, chain, acceptArgs...) {
-				iptable.Raw(append([]string{"-D", chain}, acceptArgs...)...)
-			}
+			queueChainRule(tx, iptable, acceptRule, false)
 		}
 	}
-
-	return nil
 }
 
 // Control Inter Network Communication. Install[Remove] only if it is [not] present.
-func setINC(version iptables.IPVersion, iface string, enable bool) error {
-	iptable := iptables.GetIptable(version)
+func setINC(owner iptables.Owner, version iptables.IPVersion, iface string, enable bool) error {
 	var (
-		action    = iptables.Insert
+		iptable   = iptables.GetIptable(version)
+		tx        = iptable.NewTransaction()
 		actionMsg = "add"
-		chains    = []string{IsolationChain1, IsolationChain2}
-		rules     = [][]string{
-			{"-i", iface, "!", "-o", iface, "-j", IsolationChain2},
-			{"-o", iface, "-j", "DROP"},
+		rules     = []iptRule{
+			{table: iptables.Filter, chain: IsolationChain1, args: append([]string{"-i", iface, "!", "-o", iface, "-j", IsolationChain2}, owner.Args()...)},
+			{table: iptables.Filter, chain: IsolationChain2, args: append([]string{"-o", iface, "-j", "DROP"}, owner.Args()...)},
 		}
 	)
 
 	if !enable {
-		action = iptables.Delete
 		actionMsg = "remove"
 	}
 
-	for i, chain := range chains {
-		if err := iptable.ProgramRule(iptables.Filter, chain, action, rules[i]); err != nil {
-			msg := fmt.Sprintf("unable to %s inter-network communication rule: %v", actionMsg, err)
-			if enable {
-				if i == 1 {
-					// Rollback the rule installed on first chain
-					if err2 := iptable.ProgramRule(iptables.Filter, chains[0], iptables.Delete, rules[0]); err2 != nil {
-						logrus.Warnf("Failed to rollback iptables rule after failure (%v): %v", err, err2)
-					}
-				}
-				return fmt.Errorf(msg)
-			}
-			logrus.Warn(msg)
+	for _, rule := range rules {
+		queueChainRule(tx, iptable, rule, enable)
+	}
+
+	// Both rules are committed at once, no rollback is needed on failure
+	if err := tx.Commit(); err != nil {
+		msg := fmt.Sprintf("unable to %s inter-network communication rule: %v", actionMsg, err)
+		if enable {
+			return errors.New(msg)
 		}
+		logrus.Warn(msg)
 	}
 
 	return nil
@@ -395,10 +437,10 @@ func removeIPChains(version iptables.IPVersion) {
 	}
 }
 
-func setupInternalNetworkRules(bridgeIface string, addr *net.IPNet, icc, insert bool) error {
+func setupInternalNetworkRules(owner iptables.Owner, bridgeIface string, addr *net.IPNet, icc, insert bool) error {
 	var (
-		inDropRule  = iptRule{table: iptables.Filter, chain: IsolationChain1, args: []string{"-i", bridgeIface, "!", "-d", addr.String(), "-j", "DROP"}}
-		outDropRule = iptRule{table: iptables.Filter, chain: IsolationChain1, args: []string{"-o", bridgeIface, "!", "-s", addr.String(), "-j", "DROP"}}
+		inDropRule  = iptRule{table: iptables.Filter, chain: IsolationChain1, args: append([]string{"-i", bridgeIface, "!", "-d", addr.String(), "-j", "DROP"}, owner.Args()...)}
+		outDropRule = iptRule{table: iptables.Filter, chain: IsolationChain1, args: append([]string{"-o", bridgeIface, "!", "-s", addr.String(), "-j", "DROP"}, owner.Args()...)}
 	)
 
 	version := iptables.IPv4
@@ -407,14 +449,15 @@ func setupInternalNetworkRules(bridgeIface string, addr *net.IPNet, icc, insert
 		version = iptables.IPv6
 	}
 
-	if err := programChainRule(version, inDropRule, "DROP INCOMING", insert); err != nil {
-		return err
-	}
-	if err := programChainRule(version, outDropRule, "DROP OUTGOING", insert); err != nil {
-		return err
-	}
+	iptable := iptables.GetIptable(version)
+	tx := iptable.NewTransaction()
+
+	queueChainRule(tx, iptable, inDropRule, insert)
+	queueChainRule(tx, iptable, outDropRule, insert)
 	// Set Inter Container Communication.
-	return setIcc(version, bridgeIface, icc, insert)
+	queueIcc(tx, iptable, owner, bridgeIface, icc, insert)
+
+	return commitBridgeRules(tx, bridgeIface, insert)
 }
 
 func clearEndpointConnections(nlh *netlink.Handle, ep *bridgeEndpoint) {
@@ -0,0 +1,387 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/nftables"
+	"github.com/sirupsen/logrus"
+)
+
+type nftRule struct {
+	table iptables.Table
+	chain string
+	spec  string
+}
+
+func (c *configuration) useNftables() bool {
+	return c.FirewallBackend == FirewallBackendNftables
+}
+
+// linkChain returns the chain the rules of the legacy links are programmed in
+func (d *driver) linkChain() linkChain {
+	d.Lock()
+	defer d.Unlock()
+	if d.config.useNftables() && d.nftFilterChain != nil {
+		return d.nftFilterChain
+	}
+	return &iptables.ChainInfo{Name: DockerChain}
+}
+
+// setupNFTChains sets up the docker table of the family and creates the chains
+// of the bridge driver, discarding the rules left by a previous run.
+func setupNFTChains(config *configuration, family nftables.Family) (*nftables.ChainInfo, *nftables.ChainInfo, error) {
+	// Sanity check.
+	if !config.EnableIPTables && !config.EnableIP6Tables {
+		return nil, nil, errors.New("cannot create new chains, EnableIPTable is disabled")
+	}
+
+	hairpinMode := !config.EnableUserlandProxy
+
+	table := nftables.GetTable(family)
+	if err := table.Setup(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, chain := range []struct {
+		name  string
+		table iptables.Table
+	}{
+		{DockerChain, iptables.Nat},
+		{DockerChain, iptables.Filter},
+		{IsolationChain1, iptables.Filter},
+		{IsolationChain2, iptables.Filter},
+	} {
+		if err := table.RemoveExistingChain(chain.name, chain.table); err != nil {
+			logrus.Warnf("Failed to remove existing nftables chain %s (%s): %v", chain.name, chain.table, err)
+		}
+	}
+
+	natChain, err := table.NewChain(DockerChain, iptables.Nat, hairpinMode)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create NAT chain %s: %v", DockerChain, err)
+	}
+
+	filterChain, err := table.NewChain(DockerChain, iptables.Filter, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create FILTER chain %s: %v", DockerChain, err)
+	}
+
+	for _, name := range []string{IsolationChain1, IsolationChain2} {
+		if _, err := table.NewChain(name, iptables.Filter, false); err != nil {
+			return nil, nil, fmt.Errorf("failed to create FILTER isolation chain: %v", err)
+		}
+	}
+
+	return natChain, filterChain, nil
+}
+
+// setupNFTForwarding enables IPv4 forwarding, like setupIPForwarding does,
+// and drops the forwarded traffic not accepted by the docker table.
+func setupNFTForwarding(enableIPv4, enableIPv6 bool) error {
+	ipv4ForwardData, err := ioutil.ReadFile(ipv4ForwardConf)
+	if err != nil {
+		return fmt.Errorf("Cannot read IP forwarding setup: %v", err)
+	}
+
+	if ipv4ForwardData[0] != '1' {
+		if err := configureIPForwarding(true); err != nil {
+			return fmt.Errorf("Enabling IP forwarding failed: %v", err)
+		}
+		if enableIPv4 {
+			if err := nftables.GetTable(nftables.IPv4).SetDefaultPolicy(iptables.Drop); err != nil {
+				if err := configureIPForwarding(false); err != nil {
+					logrus.Errorf("Disabling IP forwarding failed, %v", err)
+				}
+				return err
+			}
+		}
+	}
+
+	if enableIPv6 {
+		if err := nftables.GetTable(nftables.IPv6).SetDefaultPolicy(iptables.Drop); err != nil {
+			logrus.Warnf("Setting the default DROP policy failed, %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (n *bridgeNetwork) getNFTChains(family nftables.Family) (*nftables.ChainInfo, *nftables.ChainInfo, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.driver == nil {
+		return nil, nil, errors.New("no driver found")
+	}
+
+	if family == nftables.IPv6 {
+		return n.driver.nftNatChainV6, n.driver.nftFilterChainV6, nil
+	}
+	return n.driver.nftNatChain, n.driver.nftFilterChain, nil
+}
+
+func (n *bridgeNetwork) setupNFTables(family nftables.Family, maskedAddr *net.IPNet, config *networkConfiguration) error {
+	var err error
+
+	d := n.driver
+	d.Lock()
+	driverConfig := d.config
+	d.Unlock()
+
+	// Pickup this configuration option from driver
+	hairpinMode := !driverConfig.EnableUserlandProxy
+
+	table := nftables.GetTable(family)
+
+	version := iptables.IPv4
+	if family == nftables.IPv6 {
+		version = iptables.IPv6
+	}
+	hostIP, ipmasq := config.natConfig(version)
+
+	if config.Internal {
+		if err = setupNFTInternalNetworkRules(family, config.BridgeName, maskedAddr, config.firewallICC(), true); err != nil {
+			return fmt.Errorf("Failed to Setup nftables: %s", err.Error())
+		}
+		n.registerIptCleanFunc(func() error {
+			return setupNFTInternalNetworkRules(family, config.BridgeName, maskedAddr, config.firewallICC(), false)
+		})
+	} else {
+		if err = setupNFTablesInternal(family, hostIP, config.BridgeName, maskedAddr, config.firewallICC(), ipmasq, hairpinMode, true); err != nil {
+			return fmt.Errorf("Failed to Setup nftables: %s", err.Error())
+		}
+		n.registerIptCleanFunc(func() error {
+			return setupNFTablesInternal(family, hostIP, config.BridgeName, maskedAddr, config.firewallICC(), ipmasq, hairpinMode, false)
+		})
+		natChain, filterChain, err := n.getNFTChains(family)
+		if err != nil {
+			return fmt.Errorf("Failed to setup nftables, cannot acquire chain info %s", err.Error())
+		}
+		if natChain == nil || filterChain == nil {
+			return fmt.Errorf("Failed to setup nftables, chains of family %s are not initialized", family)
+		}
+
+		err = table.ProgramChain(natChain, config.BridgeName, hairpinMode, true)
+		if err != nil {
+			return fmt.Errorf("Failed to program NAT chain: %s", err.Error())
+		}
+
+		err = table.ProgramChain(filterChain, config.BridgeName, hairpinMode, true)
+		if err != nil {
+			return fmt.Errorf("Failed to program FILTER chain: %s", err.Error())
+		}
+
+		n.registerIptCleanFunc(func() error {
+			return table.ProgramChain(filterChain, config.BridgeName, hairpinMode, false)
+		})
+
+		if config.routed() {
+			if err = setNFTRoutedDefaultDrop(family, config.BridgeName, true); err != nil {
+				return fmt.Errorf("Failed to setup nftables: %s", err.Error())
+			}
+			n.registerIptCleanFunc(func() error {
+				return setNFTRoutedDefaultDrop(family, config.BridgeName, false)
+			})
+		}
+
+		if family == nftables.IPv4 {
+			n.portMapper.SetForwardingChain(natChain, n.getNetworkBridgeName())
+		} else {
+			n.portMapperV6.SetForwardingChain(natChain, n.getNetworkBridgeName())
+		}
+	}
+
+	return table.EnsureJumpRule("FORWARD", IsolationChain1)
+}
+
+func setupNFTablesInternal(family nftables.Family, hostIP net.IP, bridgeIface string, addr *net.IPNet, icc, ipmasq, hairpin, enable bool) error {
+	var (
+		f        = string(family)
+		skipDNAT = nftRule{table: iptables.Nat, chain: DockerChain, spec: fmt.Sprintf("iifname %q return", bridgeIface)}
+		outRule  = nftRule{table: iptables.Filter, chain: "FORWARD", spec: fmt.Sprintf("iifname %[1]q oifname != %[1]q accept", bridgeIface)}
+		natRule  nftRule
+		hpRule   nftRule
+	)
+	// if hostIP is set use this address as the src-ip during SNAT
+	if hostIP != nil {
+		natRule = nftRule{table: iptables.Nat, chain: "POSTROUTING", spec: fmt.Sprintf("%s saddr %s oifname != %q snat to %s", f, addr, bridgeIface, hostIP)}
+		hpRule = nftRule{table: iptables.Nat, chain: "POSTROUTING", spec: fmt.Sprintf("fib saddr type local oifname %q snat to %s", bridgeIface, hostIP)}
+		// Else use masquerade which picks the src-ip based on NH from the route table
+	} else {
+		natRule = nftRule{table: iptables.Nat, chain: "POSTROUTING", spec: fmt.Sprintf("%s saddr %s oifname != %q masquerade", f, addr, bridgeIface)}
+		hpRule = nftRule{table: iptables.Nat, chain: "POSTROUTING", spec: fmt.Sprintf("fib saddr type local oifname %q masquerade", bridgeIface)}
+	}
+
+	// Set NAT.
+	if ipmasq {
+		if err := programNFTRule(family, natRule, "NAT", enable); err != nil {
+			return err
+		}
+	}
+
+	if ipmasq && !hairpin {
+		if err := programNFTRule(family, skipDNAT, "SKIP DNAT", enable); err != nil {
+			return err
+		}
+	}
+
+	// In hairpin mode, masquerade traffic from localhost
+	if hairpin {
+		if err := programNFTRule(family, hpRule, "MASQ LOCAL HOST", enable); err != nil {
+			return err
+		}
+	}
+
+	// Set Inter Container Communication.
+	if err := setNFTIcc(family, bridgeIface, icc, enable); err != nil {
+		return err
+	}
+
+	// Set Accept on all non-intercontainer outgoing packets.
+	return programNFTRule(family, outRule, "ACCEPT NON_ICC OUTGOING", enable)
+}
+
+// setNFTRoutedDefaultDrop drops the forwarded traffic entering the bridge of
+// a routed network, see setRoutedDefaultDrop.
+func setNFTRoutedDefaultDrop(family nftables.Family, bridgeIface string, enable bool) error {
+	var (
+		table     = nftables.GetTable(family)
+		spec      = fmt.Sprintf("iifname != %[1]q oifname %[1]q drop", bridgeIface)
+		action    = iptables.Append
+		operation = "enable"
+	)
+	if !enable {
+		action = iptables.Delete
+		operation = "disable"
+	}
+	if table.Exists(iptables.Filter, DockerChain, spec) == enable {
+		return nil
+	}
+	if err := table.ProgramRule(iptables.Filter, DockerChain, action, spec); err != nil {
+		return fmt.Errorf("Unable to %s routed mode default drop rule: %v", operation, err)
+	}
+	return nil
+}
+
+func programNFTRule(family nftables.Family, rule nftRule, ruleDescr string, insert bool) error {
+	table := nftables.GetTable(family)
+
+	var (
+		action    = iptables.Insert
+		operation = "enable"
+		condition = !table.Exists(rule.table, rule.chain, rule.spec)
+	)
+	if !insert {
+		action = iptables.Delete
+		operation = "disable"
+		condition = !condition
+	}
+
+	if condition {
+		if err := table.ProgramRule(rule.table, rule.chain, action, rule.spec); err != nil {
+			return fmt.Errorf("Unable to %s %s rule: %s", operation, ruleDescr, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func setNFTIcc(family nftables.Family, bridgeIface string, iccEnable, insert bool) error {
+	var (
+		table  = nftables.GetTable(family)
+		chain  = "FORWARD"
+		spec   = fmt.Sprintf("iifname %[1]q oifname %[1]q", bridgeIface)
+		accept = spec + " accept"
+		drop   = spec + " drop"
+	)
+
+	if insert {
+		if !iccEnable {
+			if table.Exists(iptables.Filter, chain, accept) {
+				table.ProgramRule(iptables.Filter, chain, iptables.Delete, accept)
+			}
+
+			if !table.Exists(iptables.Filter, chain, drop) {
+				if err := table.ProgramRule(iptables.Filter, chain, iptables.Append, drop); err != nil {
+					return fmt.Errorf("Unable to prevent intercontainer communication: %s", err.Error())
+				}
+			}
+		} else {
+			if table.Exists(iptables.Filter, chain, drop) {
+				table.ProgramRule(iptables.Filter, chain, iptables.Delete, drop)
+			}
+
+			if !table.Exists(iptables.Filter, chain, accept) {
+				if err := table.ProgramRule(iptables.Filter, chain, iptables.Insert, accept); err != nil {
+					return fmt.Errorf("Unable to allow intercontainer communication: %s", err.Error())
+				}
+			}
+		}
+		return nil
+	}
+
+	// Remove any ICC rule.
+	rule := accept
+	if !iccEnable {
+		rule = drop
+	}
+	if table.Exists(iptables.Filter, chain, rule) {
+		table.ProgramRule(iptables.Filter, chain, iptables.Delete, rule)
+	}
+
+	return nil
+}
+
+// Control Inter Network Communication. Install[Remove] only if it is [not] present.
+func setNFTIsolation(family nftables.Family, iface string, enable bool) error {
+	var (
+		actionMsg = "add"
+		rules     = []nftRule{
+			{table: iptables.Filter, chain: IsolationChain1, spec: fmt.Sprintf("iifname %[1]q oifname != %[1]q jump %[2]s", iface, IsolationChain2)},
+			{table: iptables.Filter, chain: IsolationChain2, spec: fmt.Sprintf("oifname %q drop", iface)},
+		}
+	)
+
+	if !enable {
+		actionMsg = "remove"
+	}
+
+	for i, rule := range rules {
+		if err := programNFTRule(family, rule, "inter-network communication", enable); err != nil {
+			msg := fmt.Sprintf("unable to %s inter-network communication rule: %v", actionMsg, err)
+			if enable {
+				if i == 1 {
+					// Rollback the rule installed on first chain
+					if err2 := programNFTRule(family, rules[0], "inter-network communication", false); err2 != nil {
+						logrus.Warnf("Failed to rollback nftables rule after failure (%v): %v", err, err2)
+					}
+				}
+				return errors.New(msg)
+			}
+			logrus.Warn(msg)
+		}
+	}
+
+	return nil
+}
+
+func setupNFTInternalNetworkRules(family nftables.Family, bridgeIface string, addr *net.IPNet, icc, insert bool) error {
+	var (
+		f           = string(family)
+		inDropRule  = nftRule{table: iptables.Filter, chain: IsolationChain1, spec: fmt.Sprintf("iifname %q %s daddr != %s drop", bridgeIface, f, addr)}
+		outDropRule = nftRule{table: iptables.Filter, chain: IsolationChain1, spec: fmt.Sprintf("oifname %q %s saddr != %s drop", bridgeIface, f, addr)}
+	)
+
+	if err := programNFTRule(family, inDropRule, "DROP INCOMING", insert); err != nil {
+		return err
+	}
+	if err := programNFTRule(family, outDropRule, "DROP OUTGOING", insert); err != nil {
+		return err
+	}
+	// Set Inter Container Communication.
+	return setNFTIcc(family, bridgeIface, icc, insert)
+}
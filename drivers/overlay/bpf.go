@@ -31,6 +31,23 @@ func vniMatchBPF(vni uint32) []bpf.RawInstruction {
 	return asm
 }
 
+// vniMatchBPF6 is the IPv6 variant of vniMatchBPF. The program assumes the
+// UDP header directly follows the fixed 40 octet IPv6 header.
+func vniMatchBPF6(vni uint32) []bpf.RawInstruction {
+	asm, err := bpf.Assemble([]bpf.Instruction{
+		bpf.LoadAbsolute{Off: 52, Size: 4},                          // ld [52]           ; Load VXLAN ID (IPv6 header + UDP header + 4 bytes) into A
+		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xffffff00},        // and #0xffffff00   ; VXLAN ID is in top 24 bits
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: vni << 8, SkipTrue: 1}, // jeq ($vni << 8), match
+		bpf.RetConstant{Val: 0},                                     // ret #0
+		bpf.RetConstant{Val: ^uint32(0)},                            // match: ret #-1
+	})
+	// See vniMatchBPF
+	if err != nil {
+		panic(err)
+	}
+	return asm
+}
+
 // marshalXTBPF marshals a BPF program into the "decimal" byte code format
 // which is suitable for passing to the [iptables bpf match].
 //
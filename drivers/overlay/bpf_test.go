@@ -10,5 +10,6 @@ func FuzzVNIMatchBPFDoesNotPanic(f *testing.F) {
 	}
 	f.Fuzz(func(t *testing.T, vni uint32) {
 		_ = vniMatchBPF(vni)
+		_ = vniMatchBPF6(vni)
 	})
 }
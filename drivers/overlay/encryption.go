@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"net"
+	"sort"
 	"sync"
 	"syscall"
 
@@ -23,7 +24,8 @@ import (
 
 /*
 Encrypted overlay networks use IPsec in transport mode to encrypt and
-authenticate the VXLAN UDP datagrams. This driver implements a bespoke control
+authenticate the VXLAN, or Geneve, UDP datagrams, unless they select the
+WireGuard backend of wireguard.go. This driver implements a bespoke control
 plane which negotiates the security parameters for each peer-to-peer tunnel.
 
 IPsec Terminology
@@ -146,6 +148,21 @@ func (d *driver) checkEncryption(nid string, rIP net.IP, isLocal, add bool) erro
 
 	logrus.Debugf("List of nodes: %s", nodes)
 
+	if n.encryption == encryptionWireGuard {
+		if add {
+			for _, rIP := range nodes {
+				if err := d.programWireguardPeer(nid, aIP, rIP, n.mtu, true); err != nil {
+					logrus.Warnf("Failed to program WireGuard peer %s: %v", rIP, err)
+				}
+			}
+		} else if len(nodes) == 0 {
+			if err := d.programWireguardPeer(nid, aIP, rIP, n.mtu, false); err != nil {
+				logrus.Warnf("Failed to remove WireGuard peer %s: %v", rIP, err)
+			}
+		}
+		return nil
+	}
+
 	if add {
 		for _, rIP := range nodes {
 			if err := setupEncryption(lIP, aIP, rIP, d.secMap, d.keys); err != nil {
@@ -225,57 +242,79 @@ func removeEncryption(localIP, remoteIP net.IP, em *encrMap) error {
 	return nil
 }
 
-type matchVXLANFunc func(port, vni uint32) []string
+// tunnelPorts returns the default destination UDP ports of the tunnels of the
+// overlay networks, whichever their encapsulation.
+func tunnelPorts() []uint32 {
+	return []uint32{overlayutils.VXLANUDPPort(), geneveUDPPort}
+}
+
+// matchVXLANFunc returns an iptables rule fragment matching the datagrams of a
+// VNI tunneled to the given port. The Geneve header carries the VNI at the
+// same offset as the VXLAN header, so the matches apply to both.
+type matchVXLANFunc func(ipv iptables.IPVersion, port, vni uint32) []string
 
 // programVXLANRuleFunc returns a function which tries calling programWithMatch
 // with the u32 match, falling back to the BPF match if installing u32 variant
 // of the rules fails.
-func programVXLANRuleFunc(programWithMatch func(matchVXLAN matchVXLANFunc, vni uint32, add bool) error) func(vni uint32, add bool) error {
-	return func(vni uint32, add bool) error {
+func programVXLANRuleFunc(programWithMatch func(matchVXLAN matchVXLANFunc, ipv iptables.IPVersion, port, vni uint32, add bool) error) func(ipv iptables.IPVersion, port, vni uint32, add bool) error {
+	return func(ipv iptables.IPVersion, port, vni uint32, add bool) error {
 		if add {
-			if err := programWithMatch(matchVXLANWithU32, vni, add); err != nil {
+			if err := programWithMatch(matchVXLANWithU32, ipv, port, vni, add); err != nil {
 				// That didn't work. Maybe the xt_u32 module isn't available? Try again with xt_bpf.
-				err2 := programWithMatch(matchVXLANWithBPF, vni, add)
+				err2 := programWithMatch(matchVXLANWithBPF, ipv, port, vni, add)
 				if err2 != nil {
 					return multierror.Append(err, err2)
 				}
 			}
 		} else {
 			// Delete both flavours.
-			err := programWithMatch(matchVXLANWithU32, vni, add)
-			return multierror.Append(err, programWithMatch(matchVXLANWithBPF, vni, add)).ErrorOrNil()
+			err := programWithMatch(matchVXLANWithU32, ipv, port, vni, add)
+			return multierror.Append(err, programWithMatch(matchVXLANWithBPF, ipv, port, vni, add)).ErrorOrNil()
 		}
 		return nil
 	}
 }
 
-var programMangle = programVXLANRuleFunc(func(matchVXLAN matchVXLANFunc, vni uint32, add bool) error {
-	var (
-		m      = strconv.FormatUint(mark, 10)
-		chain  = "OUTPUT"
-		rule   = append(matchVXLAN(overlayutils.VXLANUDPPort(), vni), "-j", "MARK", "--set-mark", m)
-		a      = iptables.Append
-		action = "install"
-	)
+var programMangle = programMarkFunc(mark)
 
-	// TODO IPv6 support
-	iptable := iptables.GetIptable(iptables.IPv4)
+// programMarkFunc returns a function programming the mangle rule which marks
+// the outgoing tunnel datagrams of a VNI with m.
+func programMarkFunc(m uint32) func(ipv iptables.IPVersion, port, vni uint32, add bool) error {
+	return programVXLANRuleFunc(func(matchVXLAN matchVXLANFunc, ipv iptables.IPVersion, port, vni uint32, add bool) error {
+		var (
+			chain  = "OUTPUT"
+			rule   = append(matchVXLAN(ipv, port, vni), "-j", "MARK", "--set-mark", strconv.FormatUint(uint64(m), 10))
+			a      = iptables.Append
+			action = "install"
+		)
 
-	if !add {
-		a = iptables.Delete
-		action = "remove"
-	}
+		iptable := iptables.GetIptable(ipv)
 
-	if err := iptable.ProgramRule(iptables.Mangle, chain, a, rule); err != nil {
-		return fmt.Errorf("could not %s mangle rule: %w", action, err)
-	}
+		if !add {
+			a = iptables.Delete
+			action = "remove"
+		}
 
-	return nil
-})
+		if err := iptable.ProgramRule(iptables.Mangle, chain, a, rule); err != nil {
+			return fmt.Errorf("could not %s mangle rule: %w", action, err)
+		}
+
+		return nil
+	})
+}
 
-var programInput = programVXLANRuleFunc(func(matchVXLAN matchVXLANFunc, vni uint32, add bool) error {
+// encryptionRules returns the functions programming the iptables rules which
+// enforce the encryption of the tunnel datagrams of the network.
+func (n *network) encryptionRules() (mangle, input func(ipv iptables.IPVersion, port, vni uint32, add bool) error) {
+	if n.encryption == encryptionWireGuard {
+		return programWireguardMangle, programWireguardInput
+	}
+	return programMangle, programInput
+}
+
+var programInput = programVXLANRuleFunc(func(matchVXLAN matchVXLANFunc, ipv iptables.IPVersion, port, vni uint32, add bool) error {
 	var (
-		plainVxlan = matchVXLAN(overlayutils.VXLANUDPPort(), vni)
+		plainVxlan = matchVXLAN(ipv, port, vni)
 		chain      = "INPUT"
 		msg        = "add"
 	)
@@ -285,8 +324,7 @@ var programInput = programVXLANRuleFunc(func(matchVXLAN matchVXLANFunc, vni uint
 		return append(args, "-j", jump)
 	}
 
-	// TODO IPv6 support
-	iptable := iptables.GetIptable(iptables.IPv4)
+	iptable := iptables.GetIptable(ipv)
 
 	if !add {
 		msg = "remove"
@@ -390,18 +428,39 @@ func programSP(fSA *netlink.XfrmState, rSA *netlink.XfrmState, add bool) error {
 		xfrmProgram = ns.NlHandle().XfrmPolicyAdd
 	}
 
+	fPol := buildSP(fSA)
+
+	exists, err := spExists(fPol)
+	if err != nil {
+		exists = !add
+	}
+
+	if add != exists {
+		logrus.Debugf("%s fSP{%s}", action, fPol)
+		if err := xfrmProgram(fPol); err != nil {
+			logrus.Warnf("%s fSP{%s}: %v", action, fPol, err)
+		}
+	}
+
+	return nil
+}
+
+// buildSP returns the outbound security policy applying the given SA to the
+// marked datagrams. The policy does not select the destination port: the
+// mangle rules only mark the tunnel datagrams of the encrypted VNIs, and the
+// networks do not all tunnel to the same port.
+func buildSP(fSA *netlink.XfrmState) *netlink.XfrmPolicy {
 	// Create a congruent cidr
 	s := types.GetMinimalIP(fSA.Src)
 	d := types.GetMinimalIP(fSA.Dst)
 	fullMask := net.CIDRMask(8*len(s), 8*len(s))
 
-	fPol := &netlink.XfrmPolicy{
-		Src:     &net.IPNet{IP: s, Mask: fullMask},
-		Dst:     &net.IPNet{IP: d, Mask: fullMask},
-		Dir:     netlink.XFRM_DIR_OUT,
-		Proto:   17,
-		DstPort: 4789,
-		Mark:    &spMark,
+	return &netlink.XfrmPolicy{
+		Src:   &net.IPNet{IP: s, Mask: fullMask},
+		Dst:   &net.IPNet{IP: d, Mask: fullMask},
+		Dir:   netlink.XFRM_DIR_OUT,
+		Proto: 17,
+		Mark:  &spMark,
 		Tmpls: []netlink.XfrmPolicyTmpl{
 			{
 				Src:   fSA.Src,
@@ -413,20 +472,6 @@ func programSP(fSA *netlink.XfrmState, rSA *netlink.XfrmState, add bool) error {
 			},
 		},
 	}
-
-	exists, err := spExists(fPol)
-	if err != nil {
-		exists = !add
-	}
-
-	if add != exists {
-		logrus.Debugf("%s fSP{%s}", action, fPol)
-		if err := xfrmProgram(fPol); err != nil {
-			logrus.Warnf("%s fSP{%s}: %v", action, fPol, err)
-		}
-	}
-
-	return nil
 }
 
 func saExists(sa *netlink.XfrmState) (bool, error) {
@@ -492,6 +537,149 @@ func (d *driver) secMapWalk(f func(string, []*spi) ([]*spi, bool)) error {
 	return nil
 }
 
+// buildSPIs returns the Security Parameter Indices of the flows between the
+// local node and a remote node for each of the keys.
+func buildSPIs(aIP, rIP net.IP, keys []*key) []*spi {
+	spis := make([]*spi, 0, len(keys))
+	for _, k := range keys {
+		spis = append(spis, &spi{buildSPI(aIP, rIP, k.tag), buildSPI(rIP, aIP, k.tag)})
+	}
+	return spis
+}
+
+// ipsecInSync tells whether the SPIs recorded for a remote node are the ones
+// of the keys, and whether their Security Associations are in the kernel.
+func ipsecInSync(lIP, aIP, rIP net.IP, spis []*spi, keys []*key) bool {
+	if len(spis) != len(keys) {
+		return false
+	}
+	for i, s := range buildSPIs(aIP, rIP, keys) {
+		if *s != *spis[i] {
+			return false
+		}
+		rSA := &netlink.XfrmState{Src: rIP, Dst: lIP, Proto: netlink.XFRM_PROTO_ESP, Spi: s.reverse, Mode: netlink.XFRM_MODE_TRANSPORT, Reqid: mark}
+		if ok, _ := saExists(rSA); !ok {
+			return false
+		}
+	}
+	fSA := &netlink.XfrmState{Src: lIP, Dst: rIP, Proto: netlink.XFRM_PROTO_ESP, Spi: spis[0].forward, Mode: netlink.XFRM_MODE_TRANSPORT, Reqid: mark}
+	ok, _ := saExists(fSA)
+	return ok
+}
+
+// EncryptionState returns the encryption keys of the driver and the state of
+// the encryption with each remote node.
+func (d *driver) EncryptionState() types.EncryptionState {
+	var (
+		lIP = net.ParseIP(d.bindAddress)
+		aIP = net.ParseIP(d.advertiseAddress)
+		st  types.EncryptionState
+	)
+
+	d.Lock()
+	keys := append([]*key(nil), d.keys...)
+	d.Unlock()
+	for _, k := range keys {
+		st.KeyTags = append(st.KeyTags, k.tag)
+	}
+
+	d.secMapWalk(func(node string, spis []*spi) ([]*spi, bool) {
+		peer := types.EncryptionPeer{
+			Node:    node,
+			Backend: encryptionIPsec,
+			InSync:  ipsecInSync(lIP, aIP, net.ParseIP(node), spis, keys),
+		}
+		for _, s := range spis {
+			peer.SPIs = append(peer.SPIs, types.EncryptionSPI{Forward: uint32(s.forward), Reverse: uint32(s.reverse)})
+		}
+		st.Peers = append(st.Peers, peer)
+		return nil, false
+	})
+
+	d.wgMap.Lock()
+	var wgPeers map[string]bool
+	if d.wgMap.up && len(keys) > 0 {
+		var err error
+		if wgPeers, err = wgDevicePeers(wgLink(keys[0])); err != nil {
+			logrus.Warnf("Failed to read the WireGuard peers: %v", err)
+		}
+	}
+	for node := range d.wgMap.nodes {
+		st.Peers = append(st.Peers, types.EncryptionPeer{
+			Node:    node,
+			Backend: encryptionWireGuard,
+			InSync:  wgInSync(keys, net.ParseIP(node), wgPeers),
+		})
+	}
+	d.wgMap.Unlock()
+
+	sort.Slice(st.Peers, func(i, j int) bool {
+		if st.Peers[i].Node != st.Peers[j].Node {
+			return st.Peers[i].Node < st.Peers[j].Node
+		}
+		return st.Peers[i].Backend < st.Peers[j].Backend
+	})
+	return st
+}
+
+// Rekey removes the encryption state with the remote node, or with all the
+// remote nodes if node is empty, and programs it again from the current keys.
+// It is meant to recover from a failed key rotation without a restart.
+func (d *driver) Rekey(node string) error {
+	var (
+		lIP   = net.ParseIP(d.bindAddress)
+		aIP   = net.ParseIP(d.advertiseAddress)
+		nodes []string
+	)
+
+	d.Lock()
+	defer d.Unlock()
+
+	if len(d.keys) == 0 {
+		return types.ForbiddenErrorf("encryption key is not present")
+	}
+
+	d.secMapWalk(func(n string, _ []*spi) ([]*spi, bool) {
+		if node == "" || n == node {
+			nodes = append(nodes, n)
+		}
+		return nil, false
+	})
+	d.wgMap.Lock()
+	_, wg := d.wgMap.nodes[node]
+	wg = wg || (node == "" && len(d.wgMap.nodes) > 0)
+	d.wgMap.Unlock()
+
+	if len(nodes) == 0 && !wg {
+		if node == "" {
+			return nil
+		}
+		return types.NotFoundErrorf("no encrypted tunnel with node %s", node)
+	}
+
+	for _, n := range nodes {
+		rIP := net.ParseIP(n)
+		logrus.Infof("Reprogramming encryption between %s and %s", lIP, rIP)
+		// Remove the recorded states along with any leftover state with the
+		// indices of the current keys, which would not be replaced otherwise.
+		if err := removeEncryption(lIP, rIP, d.secMap); err != nil {
+			logrus.Warnf("Failed to remove network encryption between %s and %s: %v", lIP, rIP, err)
+		}
+		current := &encrMap{nodes: map[string][]*spi{n: buildSPIs(aIP, rIP, d.keys)}}
+		if err := removeEncryption(lIP, rIP, current); err != nil {
+			logrus.Warnf("Failed to remove network encryption between %s and %s: %v", lIP, rIP, err)
+		}
+		if err := setupEncryption(lIP, aIP, rIP, d.secMap, d.keys); err != nil {
+			return fmt.Errorf("failed to program network encryption between %s and %s: %v", lIP, rIP, err)
+		}
+	}
+
+	if wg {
+		return d.wgMap.rekey(d.keys, aIP, false)
+	}
+	return nil
+}
+
 func (d *driver) setKeys(keys []*key) error {
 	// Remove any stale policy, state
 	clearEncryptionStates()
@@ -501,7 +689,10 @@ func (d *driver) setKeys(keys []*key) error {
 	d.secMap = &encrMap{nodes: map[string][]*spi{}}
 	d.Unlock()
 	logrus.Debugf("Initial encryption keys: %v", keys)
-	return nil
+	if len(keys) == 0 {
+		return nil
+	}
+	return d.wgMap.rekey(keys, net.ParseIP(d.advertiseAddress), true)
 }
 
 // updateKeys allows to add a new key and/or change the primary key and/or prune an existing key
@@ -564,6 +755,10 @@ func (d *driver) updateKeys(newKey, primary, pruneKey *key) error {
 		d.keys = append(d.keys[:delIdx], d.keys[delIdx+1:]...)
 	}
 
+	if err := d.wgMap.updateKeys(d.keys, aIP); err != nil {
+		logrus.Warnf("Failed to update the WireGuard interfaces: %v", err)
+	}
+
 	logrus.Debugf("Updated: %v", d.keys)
 
 	return nil
@@ -605,28 +800,7 @@ func updateNodeKey(lIP, aIP, rIP net.IP, idxs []*spi, curKeys []*key, newIdx, pr
 		fSA2, _, _ := programSA(lIP, rIP, spis[priIdx], curKeys[priIdx], forward, true)
 
 		// +fSP2, -fSP1
-		s := types.GetMinimalIP(fSA2.Src)
-		d := types.GetMinimalIP(fSA2.Dst)
-		fullMask := net.CIDRMask(8*len(s), 8*len(s))
-
-		fSP1 := &netlink.XfrmPolicy{
-			Src:     &net.IPNet{IP: s, Mask: fullMask},
-			Dst:     &net.IPNet{IP: d, Mask: fullMask},
-			Dir:     netlink.XFRM_DIR_OUT,
-			Proto:   17,
-			DstPort: 4789,
-			Mark:    &spMark,
-			Tmpls: []netlink.XfrmPolicyTmpl{
-				{
-					Src:   fSA2.Src,
-					Dst:   fSA2.Dst,
-					Proto: netlink.XFRM_PROTO_ESP,
-					Mode:  netlink.XFRM_MODE_TRANSPORT,
-					Spi:   fSA2.Spi,
-					Reqid: mark,
-				},
-			},
-		}
+		fSP1 := buildSP(fSA2)
 		logrus.Debugf("Updating fSP{%s}", fSP1)
 		if err := ns.NlHandle().XfrmPolicyUpdate(fSP1); err != nil {
 			logrus.Warnf("Failed to update fSP{%s}: %v", fSP1, err)
@@ -661,7 +835,17 @@ func (n *network) maxMTU() int {
 		mtu = n.mtu
 	}
 	mtu -= vxlanEncap
-	if n.secure {
+	ipv6 := n.driver != nil && n.driver.underlayIPv6()
+	if ipv6 {
+		mtu -= ipv6Encap
+	}
+	if n.secure && n.encryption == encryptionWireGuard {
+		// Account for the WireGuard encapsulation of the tunnel datagrams
+		mtu -= wgPktExpansion
+		if ipv6 {
+			mtu -= ipv6Encap
+		}
+	} else if n.secure {
 		// In case of encryption account for the
 		// esp packet expansion and padding
 		mtu -= pktExpansion
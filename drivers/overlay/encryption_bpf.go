@@ -2,15 +2,20 @@ package overlay
 
 import (
 	"strconv"
+
+	"github.com/docker/libnetwork/iptables"
 )
 
 // matchVXLANWithBPF returns an iptables rule fragment which matches VXLAN
 // datagrams with the given destination port and VXLAN Network ID utilizing the
 // xt_bpf netfilter kernel module. The returned slice's backing array is
 // guaranteed not to alias any other slice's.
-func matchVXLANWithBPF(port, vni uint32) []string {
+func matchVXLANWithBPF(ipv iptables.IPVersion, port, vni uint32) []string {
 	dport := strconv.FormatUint(uint64(port), 10)
 	vniMatch := marshalXTBPF(vniMatchBPF(vni))
+	if ipv == iptables.IPv6 {
+		vniMatch = marshalXTBPF(vniMatchBPF6(vni))
+	}
 
 	// https://ipset.netfilter.org/iptables-extensions.man.html#lbAH
 	return []string{"-p", "udp", "--dport", dport, "-m", "bpf", "--bytecode", vniMatch}
@@ -3,13 +3,15 @@ package overlay
 import (
 	"fmt"
 	"strconv"
+
+	"github.com/docker/libnetwork/iptables"
 )
 
 // matchVXLANWithU32 returns an iptables rule fragment which matches VXLAN
 // datagrams with the given destination port and VXLAN Network ID utilizing the
 // xt_u32 netfilter kernel module. The returned slice's backing array is
 // guaranteed not to alias any other slice's.
-func matchVXLANWithU32(port, vni uint32) []string {
+func matchVXLANWithU32(ipv iptables.IPVersion, port, vni uint32) []string {
 	dport := strconv.FormatUint(uint64(port), 10)
 
 	// The u32 expression language is documented in iptables-extensions(8).
@@ -25,6 +27,12 @@ func matchVXLANWithU32(port, vni uint32) []string {
 	// UDP header is four octets into the payload: the VNI field of the
 	// VXLAN header.
 	vniMatch := fmt.Sprintf("0>>22&0x3C@12&0xFFFFFF00=%d", int(vni)<<8)
+	if ipv == iptables.IPv6 {
+		// The IPv6 header has a fixed length of 40 octets. The tunnel
+		// datagrams carry no extension headers, so the VNI field is at
+		// offset 40 + 12.
+		vniMatch = fmt.Sprintf("52&0xFFFFFF00=%d", int(vni)<<8)
+	}
 
 	return []string{"-p", "udp", "--dport", dport, "-m", "u32", "--u32", vniMatch}
 }
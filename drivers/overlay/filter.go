@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/docker/libnetwork/egress"
 	"github.com/docker/libnetwork/iptables"
 	"github.com/sirupsen/logrus"
 )
@@ -148,3 +149,89 @@ func removeFilters(cname, brName string) error {
 
 	return setFilters(cname, brName, true)
 }
+
+func egressChainName(cname string) string {
+	return cname + "-EGRESS"
+}
+
+// setEgressChain programs [removes] the chain of the network enforcing its
+// egress rules
+func setEgressChain(cname string, p *egress.Policy, remove bool) error {
+	// TODO IPv6 support
+	iptable := iptables.GetIptable(iptables.IPv4)
+	echain := egressChainName(cname)
+	exists := chainExists(echain)
+
+	if remove {
+		if !exists {
+			return nil
+		}
+		if err := iptable.RawCombinedOutput("-F", echain); err != nil {
+			return fmt.Errorf("failed to flush overlay egress chain %s rules: %v", echain, err)
+		}
+		if err := iptable.RawCombinedOutput("-X", echain); err != nil {
+			return fmt.Errorf("failed to remove overlay egress chain %s: %v", echain, err)
+		}
+		return nil
+	}
+
+	if !exists {
+		if err := iptable.RawCombinedOutput("-N", echain); err != nil {
+			return fmt.Errorf("failed to create overlay egress chain %s: %v", echain, err)
+		}
+	}
+	tx := iptable.NewTransaction()
+	tx.Queue(iptables.Filter, echain, iptables.Flush)
+	for _, rule := range p.Compile(false) {
+		tx.Queue(iptables.Filter, echain, iptables.Append, rule...)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to program overlay egress chain %s: %v", echain, err)
+	}
+	return nil
+}
+
+// setEgressJump sends [stops sending] the traffic leaving the bridge through
+// the egress chain of the network
+func setEgressJump(cname, brName string, remove bool) error {
+	// TODO IPv6 support
+	iptable := iptables.GetIptable(iptables.IPv4)
+	args := []string{"-i", brName, "!", "-o", brName, "-j", egressChainName(cname)}
+
+	exists := iptable.Exists(iptables.Filter, globalChain, args...)
+	if exists != remove {
+		return nil
+	}
+	opt := "-I"
+	if remove {
+		opt = "-D"
+	}
+	if err := iptable.RawCombinedOutput(append([]string{opt, globalChain}, args...)...); err != nil {
+		return fmt.Errorf("failed to program overlay egress filter rule for bridge %s: %v", brName, err)
+	}
+	return nil
+}
+
+func addEgressFilter(cname string, p *egress.Policy) error {
+	defer filterWait()()
+
+	return setEgressChain(cname, p, false)
+}
+
+func removeEgressFilter(cname string) error {
+	defer filterWait()()
+
+	return setEgressChain(cname, nil, true)
+}
+
+func addEgressJump(cname, brName string) error {
+	defer filterWait()()
+
+	return setEgressJump(cname, brName, false)
+}
+
+func removeEgressJump(cname, brName string) error {
+	defer filterWait()()
+
+	return setEgressJump(cname, brName, true)
+}
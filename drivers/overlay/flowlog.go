@@ -0,0 +1,68 @@
+package overlay
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/docker/libnetwork/flowlog"
+	"github.com/docker/libnetwork/iptables"
+)
+
+// programFlowLog installs [removes] the rule logging the first packet of the
+// connections to the endpoints of the subnet bridge, local or remote. It
+// runs in the network sandbox, where the bridged traffic goes through
+// iptables as the bridge driver loads br_netfilter. The overlay driver drops
+// no traffic; the drops on the way out are logged by the gateway bridge.
+func programFlowLog(nid, brName string, enable bool) error {
+	// TODO IPv6 support
+	iptable := iptables.GetIptable(iptables.IPv4)
+	args := []string{"-o", brName, "-m", "conntrack", "--ctstate", "NEW",
+		"-j", "NFLOG", "--nflog-group", strconv.Itoa(flowlog.Group), "--nflog-prefix", flowlog.Prefix(flowlog.VerdictAccept, nid)}
+
+	if iptable.ExistsNative(iptables.Mangle, "POSTROUTING", args...) == enable {
+		return nil
+	}
+	opt := "-I"
+	if !enable {
+		opt = "-D"
+	}
+	if err := iptable.RawCombinedOutputNative(append([]string{"-t", string(iptables.Mangle), opt, "POSTROUTING"}, args...)...); err != nil {
+		return fmt.Errorf("failed to program the flow log rule of bridge %s: %v", brName, err)
+	}
+	return nil
+}
+
+// invoke runs f in the network sandbox
+func (n *network) invoke(f func()) error {
+	if hostMode {
+		f()
+		return nil
+	}
+	return n.sbox.InvokeFunc(f)
+}
+
+// setFlowLog logs [stops logging] the flows of the subnet bridge
+func (n *network) setFlowLog(brName string, enable bool) error {
+	var err error
+	if ierr := n.invoke(func() { err = programFlowLog(n.id, brName, enable) }); ierr != nil {
+		return ierr
+	}
+	return err
+}
+
+// startFlowLog listens to the flow log group in the network sandbox
+func (n *network) startFlowLog() error {
+	var (
+		l   io.Closer
+		err error
+	)
+	if ierr := n.invoke(func() { l, err = flowlog.Listen() }); ierr != nil {
+		return ierr
+	}
+	if err != nil {
+		return err
+	}
+	n.flowLogListener = l
+	return nil
+}
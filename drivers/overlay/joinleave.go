@@ -34,7 +34,11 @@ func (d *driver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo,
 
 	nlh := ns.NlHandle()
 
-	if n.secure && !nlh.SupportsNetlinkFamily(syscall.NETLINK_XFRM) {
+	if n.secure && n.encryption == encryptionWireGuard {
+		if _, err := nlh.GenlFamilyGet(wgGenlName); err != nil {
+			return fmt.Errorf("cannot join secure network: required wireguard module is missing on host")
+		}
+	} else if n.secure && !nlh.SupportsNetlinkFamily(syscall.NETLINK_XFRM) {
 		return fmt.Errorf("cannot join secure network: required modules to install IPSEC rules are missing on host")
 	}
 
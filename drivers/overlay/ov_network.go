@@ -3,6 +3,7 @@ package overlay
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
@@ -16,6 +17,8 @@ import (
 	"github.com/docker/docker/pkg/reexec"
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/drivers/overlay/overlayutils"
+	"github.com/docker/libnetwork/egress"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/netutils"
 	"github.com/docker/libnetwork/ns"
@@ -47,6 +50,10 @@ type subnet struct {
 	initErr   error
 	subnetIP  *net.IPNet
 	gwIP      *net.IPNet
+	// genevePorts are the names of the geneve ports of the bridge of a
+	// Geneve network, by remote VTEP
+	genevePorts    map[string]string
+	nextGenevePort int
 }
 
 type subnetJSON struct {
@@ -70,6 +77,21 @@ type network struct {
 	subnets   []*subnet
 	secure    bool
 	mtu       int
+	flowLog   bool
+	// encap is the tunnel encapsulation of the network, encapVXLAN or
+	// encapGeneve
+	encap string
+	// vxlanPort is the destination UDP port of the VXLAN tunnels of the
+	// network, the data path port of the process when zero
+	vxlanPort uint32
+	// encryption is the encryption backend of a secure network,
+	// encryptionIPsec or encryptionWireGuard
+	encryption string
+	// egressPolicy restricts the destinations of the traffic leaving
+	// the network
+	egressPolicy *egress.Policy
+	// flowLogListener consumes the flow log of the network sandbox
+	flowLogListener io.Closer
 	sync.Mutex
 }
 
@@ -148,10 +170,12 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, nInfo d
 	}
 
 	n := &network{
-		id:        id,
-		driver:    d,
-		endpoints: endpointTable{},
-		subnets:   []*subnet{},
+		id:         id,
+		driver:     d,
+		endpoints:  endpointTable{},
+		subnets:    []*subnet{},
+		encap:      encapVXLAN,
+		encryption: encryptionIPsec,
 	}
 
 	vnis := make([]uint32, 0, len(ipV4Data))
@@ -169,8 +193,52 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, nInfo d
 				vnis = append(vnis, uint32(vni))
 			}
 		}
-		if _, ok := optMap[secureOption]; ok {
+		if val, ok := optMap[secureOption]; ok {
 			n.secure = true
+			if val == encryptionWireGuard {
+				n.encryption = encryptionWireGuard
+			}
+		}
+		if val, ok := optMap[encapOption]; ok {
+			switch val {
+			case encapVXLAN, encapGeneve:
+				n.encap = val
+			default:
+				return types.BadRequestErrorf("invalid overlay encapsulation %q", val)
+			}
+		}
+		if val, ok := optMap[vxlanPortOption]; ok {
+			port, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return types.BadRequestErrorf("invalid vxlan port %q: %v", val, err)
+			}
+			if err := overlayutils.ValidateVXLANUDPPort(uint32(port)); err != nil {
+				return types.BadRequestErrorf("%v", err)
+			}
+			n.vxlanPort = uint32(port)
+		}
+		if n.vxlanPort != 0 && n.encap != encapVXLAN {
+			return types.BadRequestErrorf("option %s requires the %s encapsulation", vxlanPortOption, encapVXLAN)
+		}
+		for _, label := range []string{netlabel.EgressAllow, netlabel.EgressDeny} {
+			val, ok := optMap[label]
+			if !ok {
+				continue
+			}
+			if err := n.setEgressRules(label, val); err != nil {
+				return fmt.Errorf("failed to parse %v: %v", val, err)
+			}
+		}
+		if !n.egressPolicy.IsZero() {
+			if err := validateEgressPolicy(n.egressPolicy); err != nil {
+				return err
+			}
+		}
+		if val, ok := optMap[netlabel.FlowLog]; ok {
+			var err error
+			if n.flowLog, err = strconv.ParseBool(val); err != nil {
+				return fmt.Errorf("failed to parse %v: %v", val, err)
+			}
 		}
 		if val, ok := optMap[netlabel.DriverMTU]; ok {
 			var err error
@@ -189,6 +257,16 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, nInfo d
 		return fmt.Errorf("insufficient vnis(%d) passed to overlay", len(vnis))
 	}
 
+	// The nodes of static peers must agree on the vnis
+	if d.staticPeers != nil && len(vnis) == 0 {
+		return types.BadRequestErrorf("overlay networks of static peers require the %s option", netlabel.OverlayVxlanIDList)
+	}
+
+	// There is no gossip to distribute the encryption keys to static peers
+	if d.staticPeers != nil && n.secure {
+		return types.BadRequestErrorf("overlay networks of static peers do not support the %s option", secureOption)
+	}
+
 	for i, ipd := range ipV4Data {
 		s := &subnet{
 			subnetIP: ipd.Pool,
@@ -214,9 +292,18 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, nInfo d
 
 	// Make sure no rule is on the way from any stale secure network
 	if !n.secure {
+		ipv := d.underlayIPVersion()
+		ports := tunnelPorts()
+		if n.vxlanPort != 0 {
+			ports = append(ports, n.vxlanPort)
+		}
 		for _, vni := range vnis {
-			programMangle(vni, false)
-			programInput(vni, false)
+			for _, port := range ports {
+				programMangle(ipv, port, vni, false)
+				programInput(ipv, port, vni, false)
+				programWireguardMangle(ipv, port, vni, false)
+				programWireguardInput(ipv, port, vni, false)
+			}
 		}
 	}
 
@@ -229,6 +316,10 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, nInfo d
 
 	d.networks[id] = n
 
+	if d.staticPeers != nil {
+		go d.addStaticPeers(n)
+	}
+
 	return nil
 }
 
@@ -286,9 +377,16 @@ func (d *driver) DeleteNetwork(nid string) error {
 	}
 
 	if n.secure {
+		mangle, input := n.encryptionRules()
+		ipv := d.underlayIPVersion()
 		for _, vni := range vnis {
-			programMangle(vni, false)
-			programInput(vni, false)
+			mangle(ipv, n.tunnelPort(), vni, false)
+			input(ipv, n.tunnelPort(), vni, false)
+		}
+		if n.encryption == encryptionWireGuard {
+			if err := d.removeWireguardNetwork(nid); err != nil {
+				logrus.Warnf("Failed to remove the WireGuard peers of network %.7s: %v", nid, err)
+			}
 		}
 	}
 
@@ -385,6 +483,14 @@ func (n *network) destroySandbox() {
 				if err := removeFilters(n.id[:12], s.brName); err != nil {
 					logrus.Warnf("Could not remove overlay filters: %v", err)
 				}
+				if err := removeEgressJump(n.id[:12], s.brName); err != nil {
+					logrus.Warnf("Could not remove overlay egress filter: %v", err)
+				}
+				if n.flowLog {
+					if err := programFlowLog(n.id, s.brName, false); err != nil {
+						logrus.Warnf("Could not remove overlay flow log rule: %v", err)
+					}
+				}
 			}
 
 			if s.vxlanName != "" {
@@ -393,12 +499,26 @@ func (n *network) destroySandbox() {
 					logrus.Warnf("could not cleanup sandbox properly: %v", err)
 				}
 			}
+			for _, name := range s.genevePorts {
+				if err := deleteInterface(name); err != nil {
+					logrus.Warnf("could not cleanup sandbox properly: %v", err)
+				}
+			}
+			s.genevePorts = nil
 		}
 
 		if hostMode {
 			if err := removeNetworkChain(n.id[:12]); err != nil {
 				logrus.Warnf("could not remove network chain: %v", err)
 			}
+			if err := removeEgressFilter(n.id[:12]); err != nil {
+				logrus.Warnf("could not remove network egress chain: %v", err)
+			}
+		}
+
+		if n.flowLogListener != nil {
+			n.flowLogListener.Close()
+			n.flowLogListener = nil
 		}
 
 		// Close the netlink socket, this will also release the watchMiss goroutine that is using it
@@ -464,7 +584,7 @@ func networkOnceInit() {
 		return
 	}
 
-	err := createVxlan("testvxlan", 1, 0)
+	err := createVxlan("testvxlan", 1, 0, nil, overlayutils.VXLANUDPPort())
 	if err != nil {
 		logrus.Errorf("Failed to create testvxlan interface: %v", err)
 		return
@@ -504,6 +624,18 @@ func (n *network) generateVxlanName(s *subnet) string {
 	return fmt.Sprintf("vx-%06x-%v", s.vni, id)
 }
 
+// genevePortNamePrefix returns the prefix of the names of the geneve ports
+// of a VNI. VNIs are unique across the overlay networks.
+func genevePortNamePrefix(vni uint32) string {
+	return fmt.Sprintf("gn-%06x-", vni)
+}
+
+func (n *network) generateGenevePortName(s *subnet) string {
+	name := fmt.Sprintf("%s%x", genevePortNamePrefix(s.vni), s.nextGenevePort)
+	s.nextGenevePort++
+	return name
+}
+
 func (n *network) generateBridgeName(s *subnet) string {
 	id := n.id
 	if len(n.id) > 5 {
@@ -550,6 +682,16 @@ func (n *network) restoreSubnetSandbox(s *subnet, brName, vxlanName string) erro
 		return err
 	}
 
+	if n.encap == encapGeneve {
+		// The geneve ports are not restored but created again along
+		// with the peers
+		path := ""
+		if !hostMode {
+			path = sbox.Key()
+		}
+		return deleteGenevePorts(path, s.vni)
+	}
+
 	Ifaces = make(map[string][]osl.IfaceOption)
 	vxlanIfaceOption := make([]osl.IfaceOption, 1)
 	vxlanIfaceOption = append(vxlanIfaceOption, sbox.InterfaceOptions().Master(brName))
@@ -566,6 +708,7 @@ func (n *network) setupSubnetSandbox(s *subnet, brName, vxlanName string) error
 		}
 		// Try to delete the vxlan interface by vni if already present
 		deleteVxlanByVNI("", s.vni)
+		deleteGenevePorts("", s.vni)
 
 		if err := checkOverlap(s.subnetIP); err != nil {
 			return err
@@ -604,31 +747,11 @@ func (n *network) setupSubnetSandbox(s *subnet, brName, vxlanName string) error
 		return fmt.Errorf("bridge creation in sandbox failed for subnet %q: %v", s.subnetIP.String(), err)
 	}
 
-	err := createVxlan(vxlanName, s.vni, n.maxMTU())
-	if err != nil {
-		return err
-	}
-
-	if err := sbox.AddInterface(vxlanName, "vxlan",
-		sbox.InterfaceOptions().Master(brName)); err != nil {
-		// If adding vxlan device to the overlay namespace fails, remove the bridge interface we
-		// already added to the namespace. This allows the caller to try the setup again.
-		for _, iface := range sbox.Info().Interfaces() {
-			if iface.SrcName() == brName {
-				if ierr := iface.Remove(); ierr != nil {
-					logrus.Errorf("removing bridge failed from ov ns %v failed, %v", n.sbox.Key(), ierr)
-				}
-			}
-		}
-
-		// Also, delete the vxlan interface. Since a global vni id is associated
-		// with the vxlan interface, an orphaned vxlan interface will result in
-		// failure of vxlan device creation if the vni is assigned to some other
-		// network.
-		if deleteErr := deleteInterface(vxlanName); deleteErr != nil {
-			logrus.Warnf("could not delete vxlan interface, %s, error %v, after config error, %v", vxlanName, deleteErr, err)
+	// The geneve ports are added to the bridge along with the peers
+	if n.encap != encapGeneve {
+		if err := n.addSubnetVxlan(s, brName, vxlanName); err != nil {
+			return err
 		}
-		return fmt.Errorf("vxlan interface creation failed for subnet %q: %v", s.subnetIP.String(), err)
 	}
 
 	if !hostMode {
@@ -654,6 +777,52 @@ func (n *network) setupSubnetSandbox(s *subnet, brName, vxlanName string) error
 		if err := addFilters(n.id[:12], brName); err != nil {
 			return err
 		}
+		if !n.egressPolicy.IsZero() {
+			if err := addEgressJump(n.id[:12], brName); err != nil {
+				return err
+			}
+		}
+	}
+
+	if n.flowLog {
+		if err := n.setFlowLog(brName, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addSubnetVxlan creates the vxlan interface of the subnet and attaches it
+// to the bridge of the subnet.
+func (n *network) addSubnetVxlan(s *subnet, brName, vxlanName string) error {
+	sbox := n.sbox
+
+	err := createVxlan(vxlanName, s.vni, n.maxMTU(), n.driver.vxlanLocalIP(), n.tunnelPort())
+	if err != nil {
+		return err
+	}
+
+	if err := sbox.AddInterface(vxlanName, "vxlan",
+		sbox.InterfaceOptions().Master(brName)); err != nil {
+		// If adding vxlan device to the overlay namespace fails, remove the bridge interface we
+		// already added to the namespace. This allows the caller to try the setup again.
+		for _, iface := range sbox.Info().Interfaces() {
+			if iface.SrcName() == brName {
+				if ierr := iface.Remove(); ierr != nil {
+					logrus.Errorf("removing bridge failed from ov ns %v failed, %v", n.sbox.Key(), ierr)
+				}
+			}
+		}
+
+		// Also, delete the vxlan interface. Since a global vni id is associated
+		// with the vxlan interface, an orphaned vxlan interface will result in
+		// failure of vxlan device creation if the vni is assigned to some other
+		// network.
+		if deleteErr := deleteInterface(vxlanName); deleteErr != nil {
+			logrus.Warnf("could not delete vxlan interface, %s, error %v, after config error, %v", vxlanName, deleteErr, err)
+		}
+		return fmt.Errorf("vxlan interface creation failed for subnet %q: %v", s.subnetIP.String(), err)
 	}
 
 	return nil
@@ -667,12 +836,19 @@ func (n *network) initSubnetSandbox(s *subnet, restore bool) error {
 	// Program iptables rules for mandatory encryption of the secure
 	// network, or clean up leftover rules for a stale secure network which
 	// was previously assigned the same VNI.
-	if err := programMangle(s.vni, n.secure); err != nil {
+	port := n.tunnelPort()
+	ipv := n.driver.underlayIPVersion()
+	mangle, input := n.encryptionRules()
+	if !n.secure {
+		programWireguardMangle(ipv, port, s.vni, false)
+		programWireguardInput(ipv, port, s.vni, false)
+	}
+	if err := mangle(ipv, port, s.vni, n.secure); err != nil {
 		return err
 	}
-	if err := programInput(s.vni, n.secure); err != nil {
+	if err := input(ipv, port, s.vni, n.secure); err != nil {
 		if n.secure {
-			return multierror.Append(err, programMangle(s.vni, false))
+			return multierror.Append(err, mangle(ipv, port, s.vni, false))
 		}
 	}
 
@@ -686,7 +862,9 @@ func (n *network) initSubnetSandbox(s *subnet, restore bool) error {
 		}
 	}
 
-	s.vxlanName = vxlanName
+	if n.encap != encapGeneve {
+		s.vxlanName = vxlanName
+	}
 	s.brName = brName
 
 	return nil
@@ -706,6 +884,7 @@ func (n *network) cleanupStaleSandboxes() {
 			if strings.Contains(n.id, pattern) {
 				// Delete all vnis
 				deleteVxlanByVNI(path, 0)
+				deleteGenevePorts(path, 0)
 				unix.Unmount(path, unix.MNT_DETACH)
 				os.Remove(path)
 
@@ -735,6 +914,13 @@ func (n *network) initSandbox(restore bool) error {
 			if err := addNetworkChain(n.id[:12]); err != nil {
 				return err
 			}
+			if !n.egressPolicy.IsZero() {
+				if err := addEgressFilter(n.id[:12], n.egressPolicy); err != nil {
+					return err
+				}
+			}
+		} else if !n.egressPolicy.IsZero() {
+			logrus.Warnf("egress rules of overlay network %s are not enforced: the traffic leaving the network goes through the gateway bridge", n.id)
 		}
 
 		// If there are any stale sandboxes related to this network
@@ -760,6 +946,12 @@ func (n *network) initSandbox(restore bool) error {
 	// this is needed to let the peerAdd configure the sandbox
 	n.sbox = sbox
 
+	if n.flowLog {
+		if err := n.startFlowLog(); err != nil {
+			logrus.Errorf("failed to listen to the flow log of overlay network %s: %v", n.id, err)
+		}
+	}
+
 	// If we are in swarm mode, we don't need anymore the watchMiss routine.
 	// This will save 1 thread and 1 netlink socket per network
 	if !n.driver.isSerfAlive() {
@@ -879,6 +1071,9 @@ func (d *driver) restoreNetworkFromStore(nid string) *network {
 		n.driver = d
 		n.endpoints = endpointTable{}
 		d.networks[nid] = n
+		if d.staticPeers != nil {
+			go d.addStaticPeers(n)
+		}
 	}
 	return n
 }
@@ -895,12 +1090,13 @@ func (d *driver) network(nid string) *network {
 }
 
 func (d *driver) getNetworkFromStore(nid string) *network {
-	if d.store == nil {
+	store := d.networkStore()
+	if store == nil {
 		return nil
 	}
 
 	n := &network{id: nid}
-	if err := d.store.GetObject(datastore.Key(n.Key()...), n); err != nil {
+	if err := store.GetObject(datastore.Key(n.Key()...), n); err != nil {
 		return nil
 	}
 
@@ -913,6 +1109,73 @@ func (n *network) sandbox() osl.Sandbox {
 	return n.sbox
 }
 
+// tunnelPort returns the destination UDP port of the tunnels of the network
+func (n *network) tunnelPort() uint32 {
+	if n.encap == encapGeneve {
+		return geneveUDPPort
+	}
+	if n.vxlanPort != 0 {
+		return n.vxlanPort
+	}
+	return overlayutils.VXLANUDPPort()
+}
+
+// genevePort returns the name of the geneve port of the subnet bridge which
+// tunnels to the given VTEP, creating it if needed.
+func (n *network) genevePort(s *subnet, vtep net.IP) (string, error) {
+	n.Lock()
+	name, ok := s.genevePorts[vtep.String()]
+	if !ok {
+		name = n.generateGenevePortName(s)
+	}
+	sbox, brName := n.sbox, s.brName
+	n.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	if err := createGenevePort(name, s.vni, vtep, n.maxMTU()); err != nil {
+		return "", err
+	}
+	if err := sbox.AddInterface(name, encapGeneve, sbox.InterfaceOptions().Master(brName)); err != nil {
+		if deleteErr := deleteInterface(name); deleteErr != nil {
+			logrus.Warnf("could not delete geneve interface, %s, error %v, after config error, %v", name, deleteErr, err)
+		}
+		return "", fmt.Errorf("geneve interface creation failed for subnet %q: %v", s.subnetIP.String(), err)
+	}
+
+	n.Lock()
+	if s.genevePorts == nil {
+		s.genevePorts = make(map[string]string)
+	}
+	s.genevePorts[vtep.String()] = name
+	n.Unlock()
+
+	return name, nil
+}
+
+// releaseGenevePort deletes the geneve port of the subnet bridge which
+// tunnels to the given VTEP.
+func (n *network) releaseGenevePort(s *subnet, vtep net.IP) error {
+	n.Lock()
+	name, ok := s.genevePorts[vtep.String()]
+	delete(s.genevePorts, vtep.String())
+	sbox := n.sbox
+	n.Unlock()
+	if !ok || sbox == nil {
+		return nil
+	}
+
+	for _, iface := range sbox.Info().Interfaces() {
+		if iface.SrcName() == name {
+			if err := iface.Remove(); err != nil {
+				return fmt.Errorf("failed to remove geneve interface %s from the sandbox: %v", name, err)
+			}
+		}
+	}
+	return deleteInterface(name)
+}
+
 func (n *network) vxlanID(s *subnet) uint32 {
 	n.Lock()
 	defer n.Unlock()
@@ -947,7 +1210,18 @@ func (n *network) Value() []byte {
 		netJSON = append(netJSON, sj)
 	}
 
+	m["id"] = n.id
 	m["secure"] = n.secure
+	m["encap"] = n.encap
+	if n.vxlanPort != 0 {
+		m["vxlanPort"] = n.vxlanPort
+	}
+	m["encryption"] = n.encryption
+	m["flowLog"] = n.flowLog
+	if !n.egressPolicy.IsZero() {
+		m["egressAllow"] = egress.FormatRules(n.egressPolicy.Allow)
+		m["egressDeny"] = egress.FormatRules(n.egressPolicy.Deny)
+	}
 	m["subnets"] = netJSON
 	m["mtu"] = n.mtu
 	b, err := json.Marshal(m)
@@ -958,6 +1232,40 @@ func (n *network) Value() []byte {
 	return b
 }
 
+// setEgressRules sets the allowed or denied destinations of the network
+func (n *network) setEgressRules(label, value string) error {
+	rules, err := egress.ParseRules(value)
+	if err != nil {
+		return err
+	}
+	if n.egressPolicy == nil {
+		n.egressPolicy = &egress.Policy{}
+	}
+	if label == netlabel.EgressAllow {
+		n.egressPolicy.Allow = rules
+	} else {
+		n.egressPolicy.Deny = rules
+	}
+	return nil
+}
+
+// validateEgressPolicy rejects the egress rules the driver cannot enforce.
+// Out of host mode the traffic leaving the network goes through the gateway
+// bridge, not through the subnet bridge, and the overlay filters only handle
+// IPv4.
+func validateEgressPolicy(p *egress.Policy) error {
+	networkOnce.Do(networkOnceInit)
+	if !hostMode {
+		return types.NotImplementedErrorf("egress rules are not supported on overlay networks: the traffic leaving the network goes through the gateway bridge")
+	}
+	for _, r := range append(p.Allow, p.Deny...) {
+		if r.Network.IP.To4() == nil {
+			return types.NotImplementedErrorf("IPv6 egress rules are not supported on overlay networks: %s", r.Network)
+		}
+	}
+	return nil
+}
+
 func (n *network) Index() uint64 {
 	return n.dbIndex
 }
@@ -996,12 +1304,34 @@ func (n *network) SetValue(value []byte) error {
 	}
 
 	if isMap {
+		if val, ok := m["id"]; ok && n.id == "" {
+			n.id = val.(string)
+		}
 		if val, ok := m["secure"]; ok {
 			n.secure = val.(bool)
 		}
+		if val, ok := m["encap"]; ok {
+			n.encap = val.(string)
+		}
+		if val, ok := m["encryption"]; ok {
+			n.encryption = val.(string)
+		}
+		if val, ok := m["vxlanPort"]; ok {
+			n.vxlanPort = uint32(val.(float64))
+		}
 		if val, ok := m["mtu"]; ok {
 			n.mtu = int(val.(float64))
 		}
+		if val, ok := m["flowLog"]; ok {
+			n.flowLog = val.(bool)
+		}
+		for key, label := range map[string]string{"egressAllow": netlabel.EgressAllow, "egressDeny": netlabel.EgressDeny} {
+			if val, ok := m[key]; ok && val.(string) != "" {
+				if err := n.setEgressRules(label, val.(string)); err != nil {
+					return err
+				}
+			}
+		}
 		bytes, err := json.Marshal(m["subnets"])
 		if err != nil {
 			return err
@@ -1037,15 +1367,35 @@ func (n *network) SetValue(value []byte) error {
 }
 
 func (n *network) DataScope() string {
+	if n.driver != nil && n.driver.staticPeers != nil {
+		return datastore.LocalScope
+	}
 	return datastore.GlobalScope
 }
 
+func (n *network) New() datastore.KVObject {
+	return &network{}
+}
+
+func (n *network) CopyTo(o datastore.KVObject) error {
+	dstN := o.(*network)
+	dstN.id = n.id
+	dstN.subnets = nil
+	if err := dstN.SetValue(n.Value()); err != nil {
+		return err
+	}
+	dstN.dbIndex = n.dbIndex
+	dstN.dbExists = n.dbExists
+	return nil
+}
+
 func (n *network) writeToStore() error {
-	if n.driver.store == nil {
+	store := n.driver.networkStore()
+	if store == nil {
 		return nil
 	}
 
-	return n.driver.store.PutObjectAtomic(n)
+	return store.PutObjectAtomic(n)
 }
 
 func (n *network) releaseVxlanID() ([]uint32, error) {
@@ -1056,8 +1406,8 @@ func (n *network) releaseVxlanID() ([]uint32, error) {
 		return nil, nil
 	}
 
-	if n.driver.store != nil {
-		if err := n.driver.store.DeleteObjectAtomic(n); err != nil {
+	if store := n.driver.networkStore(); store != nil {
+		if err := store.DeleteObjectAtomic(n); err != nil {
 			if err == datastore.ErrKeyModified || err == datastore.ErrKeyNotFound {
 				// In both the above cases we can safely assume that the key has been removed by some other
 				// instance and so simply get out of here
@@ -1100,7 +1450,7 @@ func (n *network) obtainVxlanID(s *subnet) error {
 		}
 
 		if n.vxlanID(s) == 0 {
-			vxlanID, err := n.driver.vxlanIdm.GetID(true)
+			vxlanID, err := n.driver.vxlanIdm.GetIDInRange(uint64(n.driver.vniStart), uint64(n.driver.vniEnd), true)
 			if err != nil {
 				return fmt.Errorf("failed to allocate vxlan id: %v", err)
 			}
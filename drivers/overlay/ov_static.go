@@ -0,0 +1,191 @@
+package overlay
+
+// In static peer mode the overlay networks do not learn the remote endpoints
+// from the cluster: the remote nodes and their endpoints are listed in a
+// file, or set through SetStaticPeers, and fed into the peerDB. The networks
+// are then local scope, and the nodes must agree on the subnets, the VNIs
+// and on the partitioning of the addresses among them.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+// staticEntry is an endpoint of a static peer
+type staticEntry struct {
+	vtep net.IP
+	ip   *net.IPNet
+	mac  net.HardwareAddr
+}
+
+// staticPeerMap holds the static peer entries, by vtep, IP and MAC. The
+// driver has none out of static peer mode.
+type staticPeerMap struct {
+	entries map[string]*staticEntry
+	sync.Mutex
+}
+
+type staticEndpointJSON struct {
+	IP  string `json:"ip"`
+	MAC string `json:"mac"`
+}
+
+type staticPeerJSON struct {
+	VTEP      string               `json:"vtep"`
+	Endpoints []staticEndpointJSON `json:"endpoints"`
+}
+
+// loadStaticPeers reads the static peers from the file at path
+func loadStaticPeers(path string) ([]types.StaticPeer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the static peers: %v", err)
+	}
+	return parseStaticPeers(b)
+}
+
+// parseStaticPeers parses a JSON list of static peers, like
+// [{"vtep": "192.168.1.2", "endpoints": [{"ip": "10.0.0.2/24", "mac": "02:42:0a:00:00:02"}]}]
+// The endpoint addresses carry the prefix length of their network subnet.
+func parseStaticPeers(b []byte) ([]types.StaticPeer, error) {
+	var pj []staticPeerJSON
+	if err := json.Unmarshal(b, &pj); err != nil {
+		return nil, fmt.Errorf("failed to parse the static peers: %v", err)
+	}
+
+	peers := make([]types.StaticPeer, 0, len(pj))
+	for _, p := range pj {
+		vtep := net.ParseIP(p.VTEP)
+		if vtep == nil {
+			return nil, fmt.Errorf("invalid static peer vtep %q", p.VTEP)
+		}
+		peer := types.StaticPeer{VTEP: vtep}
+		for _, e := range p.Endpoints {
+			ip, err := types.ParseCIDR(e.IP)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q of static peer %s: %v", e.IP, p.VTEP, err)
+			}
+			mac, err := net.ParseMAC(e.MAC)
+			if err != nil {
+				return nil, fmt.Errorf("invalid mac %q of static peer %s: %v", e.MAC, p.VTEP, err)
+			}
+			peer.Endpoints = append(peer.Endpoints, types.StaticPeerEndpoint{IP: ip, MAC: mac})
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// staticEntries returns the entries of the peers, leaving out the local node
+// so that the same list can be handed to all the nodes.
+func staticEntries(peers []types.StaticPeer, isLocal func(net.IP) bool) (map[string]*staticEntry, error) {
+	entries := make(map[string]*staticEntry)
+	for _, p := range peers {
+		if p.VTEP == nil {
+			return nil, types.BadRequestErrorf("static peer with no vtep")
+		}
+		if isLocal(p.VTEP) {
+			continue
+		}
+		for _, e := range p.Endpoints {
+			if e.IP == nil || e.MAC == nil {
+				return nil, types.BadRequestErrorf("static peer %s has an endpoint with no address", p.VTEP)
+			}
+			entries[fmt.Sprintf("%s/%s/%s", p.VTEP, e.IP, e.MAC)] = &staticEntry{vtep: p.VTEP, ip: e.IP, mac: e.MAC}
+		}
+	}
+	return entries, nil
+}
+
+// isLocalAddress tells whether ip is the address of a local interface
+func isLocalAddress(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if a, _, err := net.ParseCIDR(addr.String()); err == nil && a.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointID returns the endpoint ID the static entry is known as in
+// the peerDB
+func (e *staticEntry) endpointID() string {
+	return "static-" + e.mac.String()
+}
+
+// programStaticPeers adds [deletes] the entries within the subnets of the
+// network to [from] the peerDB.
+func (d *driver) programStaticPeers(n *network, entries map[string]*staticEntry, add bool) {
+	for _, e := range entries {
+		if n.getSubnetforIP(e.ip) == nil {
+			continue
+		}
+		if add {
+			d.peerAdd(n.id, e.endpointID(), e.ip.IP, e.ip.Mask, e.mac, e.vtep, false, false, false)
+		} else {
+			d.peerDelete(n.id, e.endpointID(), e.ip.IP, e.ip.Mask, e.mac, e.vtep, false)
+		}
+	}
+}
+
+// addStaticPeers adds the current static peers within the subnets of the
+// network to the peerDB.
+func (d *driver) addStaticPeers(n *network) {
+	d.staticPeers.Lock()
+	defer d.staticPeers.Unlock()
+	d.programStaticPeers(n, d.staticPeers.entries, true)
+}
+
+// SetStaticPeers replaces the static peers of the driver, updating the
+// peerDB of the networks with the difference.
+func (d *driver) SetStaticPeers(peers []types.StaticPeer) error {
+	if d.staticPeers == nil {
+		return types.ForbiddenErrorf("the overlay driver is not in static peer mode")
+	}
+
+	entries, err := staticEntries(peers, isLocalAddress)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	networks := make([]*network, 0, len(d.networks))
+	for _, n := range d.networks {
+		networks = append(networks, n)
+	}
+	d.Unlock()
+
+	d.staticPeers.Lock()
+	defer d.staticPeers.Unlock()
+
+	removed := make(map[string]*staticEntry)
+	for k, e := range d.staticPeers.entries {
+		if _, ok := entries[k]; !ok {
+			removed[k] = e
+		}
+	}
+	added := make(map[string]*staticEntry)
+	for k, e := range entries {
+		if _, ok := d.staticPeers.entries[k]; !ok {
+			added[k] = e
+		}
+	}
+	d.staticPeers.entries = entries
+
+	logrus.Infof("Updating the overlay static peers: %d endpoints added, %d removed", len(added), len(removed))
+	for _, n := range networks {
+		d.programStaticPeers(n, removed, false)
+		d.programStaticPeers(n, added, true)
+	}
+	return nil
+}
@@ -1,17 +1,20 @@
 package overlay
 
 import (
+	"encoding/binary"
 	"fmt"
+	"net"
 	"strings"
 	"syscall"
 
-	"github.com/docker/libnetwork/drivers/overlay/overlayutils"
 	"github.com/docker/libnetwork/netutils"
 	"github.com/docker/libnetwork/ns"
 	"github.com/docker/libnetwork/osl"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
 )
 
 var soTimeout = ns.NetlinkSocketsTimeout
@@ -55,14 +58,15 @@ func createVethPair() (string, string, error) {
 	return name1, name2, nil
 }
 
-func createVxlan(name string, vni uint32, mtu int) error {
+func createVxlan(name string, vni uint32, mtu int, local net.IP, port uint32) error {
 	defer osl.InitOSContext()()
 
 	vxlan := &netlink.Vxlan{
 		LinkAttrs: netlink.LinkAttrs{Name: name, MTU: mtu},
 		VxlanId:   int(vni),
+		SrcAddr:   local,
 		Learning:  true,
-		Port:      int(overlayutils.VXLANUDPPort()),
+		Port:      int(port),
 		Proxy:     true,
 		L3miss:    true,
 		L2miss:    true,
@@ -75,6 +79,50 @@ func createVxlan(name string, vni uint32, mtu int) error {
 	return nil
 }
 
+// Attributes of the geneve links, from the kernel's if_link.h
+const (
+	iflaGeneveID      = 1
+	iflaGeneveRemote  = 2
+	iflaGenevePort    = 5
+	iflaGeneveRemote6 = 7
+)
+
+// createGenevePort creates a geneve interface tunneling the given VNI to a
+// single remote VTEP. Unlike VXLAN, the kernel geneve interfaces have no
+// forwarding database of their own, so the overlay bridge of a Geneve
+// network gets one such port per remote VTEP.
+func createGenevePort(name string, vni uint32, remote net.IP, mtu int) error {
+	defer osl.InitOSContext()()
+
+	req := nl.NewNetlinkRequest(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
+	req.AddData(nl.NewIfInfomsg(unix.AF_UNSPEC))
+	req.AddData(nl.NewRtAttr(unix.IFLA_IFNAME, nl.ZeroTerminated(name)))
+	if mtu > 0 {
+		req.AddData(nl.NewRtAttr(unix.IFLA_MTU, nl.Uint32Attr(uint32(mtu))))
+	}
+
+	port := make([]byte, 2)
+	binary.BigEndian.PutUint16(port, geneveUDPPort)
+
+	linkInfo := nl.NewRtAttr(unix.IFLA_LINKINFO, nil)
+	linkInfo.AddRtAttr(nl.IFLA_INFO_KIND, nl.NonZeroTerminated(encapGeneve))
+	data := linkInfo.AddRtAttr(nl.IFLA_INFO_DATA, nil)
+	data.AddRtAttr(iflaGeneveID, nl.Uint32Attr(vni))
+	if ip4 := remote.To4(); ip4 != nil {
+		data.AddRtAttr(iflaGeneveRemote, []byte(ip4))
+	} else {
+		data.AddRtAttr(iflaGeneveRemote6, []byte(remote.To16()))
+	}
+	data.AddRtAttr(iflaGenevePort, port)
+	req.AddData(linkInfo)
+
+	if _, err := req.Execute(unix.NETLINK_ROUTE, 0); err != nil {
+		return fmt.Errorf("error creating geneve interface to %s: %v", remote, err)
+	}
+
+	return nil
+}
+
 func deleteInterfaceBySubnet(brPrefix string, s *subnet) error {
 	defer osl.InitOSContext()()
 
@@ -160,3 +208,44 @@ func deleteVxlanByVNI(path string, vni uint32) error {
 
 	return fmt.Errorf("could not find a vxlan interface to delete with id %d", vni)
 }
+
+// deleteGenevePorts deletes the geneve ports of a VNI from the host namespace,
+// or all the geneve ports of the overlay namespace at path, where they are
+// renamed after the interface prefix.
+func deleteGenevePorts(path string, vni uint32) error {
+	defer osl.InitOSContext()()
+
+	nlh := ns.NlHandle()
+	if path != "" {
+		ns, err := netns.GetFromPath(path)
+		if err != nil {
+			return fmt.Errorf("failed to get ns handle for %s: %v", path, err)
+		}
+		defer ns.Close()
+
+		nlh, err = netlink.NewHandleAt(ns, syscall.NETLINK_ROUTE)
+		if err != nil {
+			return fmt.Errorf("failed to get netlink handle for ns %s: %v", path, err)
+		}
+		defer nlh.Delete()
+	}
+
+	links, err := nlh.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list interfaces while deleting geneve interfaces: %v", err)
+	}
+
+	for _, l := range links {
+		if l.Type() != encapGeneve {
+			continue
+		}
+		if path == "" && !strings.HasPrefix(l.Attrs().Name, genevePortNamePrefix(vni)) {
+			continue
+		}
+		if err := nlh.LinkDel(l); err != nil {
+			return fmt.Errorf("error deleting geneve interface %s: %v", l.Attrs().Name, err)
+		}
+	}
+
+	return nil
+}
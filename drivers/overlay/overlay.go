@@ -11,7 +11,9 @@ import (
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/discoverapi"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/drivers/overlay/overlayutils"
 	"github.com/docker/libnetwork/idm"
+	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/osl"
 	"github.com/docker/libnetwork/types"
@@ -26,7 +28,23 @@ const (
 	vxlanIDStart = 256
 	vxlanIDEnd   = (1 << 24) - 1
 	vxlanEncap   = 50
+	// ipv6Encap is the additional encapsulation overhead of an IPv6
+	// underlay: outer IPv6 header(40) - outer IPv4 header(20)
+	ipv6Encap    = 20
 	secureOption = "encrypted"
+	encapOption  = "encap"
+	// vxlanPortOption sets the destination UDP port of the VXLAN tunnels
+	// of a network, overriding the data path port of the process.
+	vxlanPortOption = "vxlan_port"
+	// encryptionIPsec and encryptionWireGuard are the encryption backends
+	// of the secure networks, selected by the value of secureOption.
+	encryptionIPsec     = "ipsec"
+	encryptionWireGuard = "wireguard"
+	// encapVXLAN and encapGeneve are the tunnel encapsulations of the
+	// overlay networks, VXLAN by default
+	encapVXLAN    = "vxlan"
+	encapGeneve   = "geneve"
+	geneveUDPPort = 6081
 )
 
 var initVxlanIdm = make(chan (bool), 1)
@@ -41,11 +59,15 @@ type driver struct {
 	config           map[string]interface{}
 	peerDb           peerNetworkMap
 	secMap           *encrMap
+	wgMap            *wgMap
+	staticPeers      *staticPeerMap
 	serfInstance     *serf.Serf
 	networks         networkTable
 	store            datastore.DataStore
 	localStore       datastore.DataStore
 	vxlanIdm         *idm.Idm
+	vniStart         uint32
+	vniEnd           uint32
 	initOS           sync.Once
 	joinOnce         sync.Once
 	localJoinOnce    sync.Once
@@ -67,8 +89,22 @@ func Init(dc driverapi.DriverCallback, config map[string]interface{}) error {
 			mp: map[string]*peerMap{},
 		},
 		secMap:   &encrMap{nodes: map[string][]*spi{}},
+		wgMap:    &wgMap{nodes: map[string]map[string]struct{}{}},
 		config:   config,
 		peerOpCh: make(chan *peerOperation),
+		vniStart: vxlanIDStart,
+		vniEnd:   vxlanIDEnd,
+	}
+
+	if val, ok := config[netlabel.OverlayVxlanIDRange]; ok {
+		s, ok := val.(string)
+		if !ok {
+			return types.BadRequestErrorf("invalid vxlan id range: %v", val)
+		}
+		var err error
+		if d.vniStart, d.vniEnd, err = overlayutils.ParseVNIRange(s, vxlanIDStart); err != nil {
+			return types.BadRequestErrorf("%v", err)
+		}
 	}
 
 	// Launch the go routine for processing peer operations
@@ -100,6 +136,25 @@ func Init(dc driverapi.DriverCallback, config map[string]interface{}) error {
 		}
 	}
 
+	if val, ok := config[netlabel.OverlayStaticPeers]; ok {
+		path, ok := val.(string)
+		if !ok {
+			return types.BadRequestErrorf("invalid static peers file: %v", val)
+		}
+		peers, err := loadStaticPeers(path)
+		if err != nil {
+			return err
+		}
+		entries, err := staticEntries(peers, isLocalAddress)
+		if err != nil {
+			return err
+		}
+		d.staticPeers = &staticPeerMap{entries: entries}
+		// The networks of static peers are not shared through a store
+		c.DataScope = datastore.LocalScope
+		logrus.Infof("Overlay driver in static peer mode with %d remote endpoints", len(entries))
+	}
+
 	if err := d.restoreEndpoints(); err != nil {
 		logrus.Warnf("Failure during overlay endpoints restore: %v", err)
 	}
@@ -238,6 +293,35 @@ func validateSelf(node string) error {
 	return fmt.Errorf("Multi-Host overlay networking requires cluster-advertise(%s) to be configured with a local ip-address that is reachable within the cluster", advIP.String())
 }
 
+// underlayIPv6 tells whether the tunnels of the node run over IPv6, which is
+// the case when the node advertises an IPv6 data path address.
+func (d *driver) underlayIPv6() bool {
+	ip := net.ParseIP(d.advertiseAddress)
+	return ip != nil && ip.To4() == nil
+}
+
+// underlayIPVersion returns the version of the iptables rules matching the
+// tunnel datagrams of the node.
+func (d *driver) underlayIPVersion() iptables.IPVersion {
+	if d.underlayIPv6() {
+		return iptables.IPv6
+	}
+	return iptables.IPv4
+}
+
+// vxlanLocalIP returns the local address of the VXLAN interfaces, nil over
+// IPv4. Over IPv6 the local address is needed for the kernel to open an IPv6
+// socket, it is the bind address unless unspecified.
+func (d *driver) vxlanLocalIP() net.IP {
+	if !d.underlayIPv6() {
+		return nil
+	}
+	if ip := net.ParseIP(d.bindAddress); ip != nil && ip.To4() == nil && !ip.IsUnspecified() {
+		return ip
+	}
+	return net.ParseIP(d.advertiseAddress)
+}
+
 func (d *driver) nodeJoin(advertiseAddress, bindAddress string, self bool) {
 	if self && !d.isSerfAlive() {
 		d.Lock()
@@ -389,3 +473,12 @@ func (d *driver) DiscoverNew(dType discoverapi.DiscoveryType, data interface{})
 func (d *driver) DiscoverDelete(dType discoverapi.DiscoveryType, data interface{}) error {
 	return nil
 }
+
+// networkStore returns the store of the networks, the local store in static
+// peer mode.
+func (d *driver) networkStore() datastore.DataStore {
+	if d.staticPeers != nil {
+		return d.localStore
+	}
+	return d.store
+}
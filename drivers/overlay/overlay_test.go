@@ -1,6 +1,7 @@
 package overlay
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net"
@@ -16,8 +17,11 @@ import (
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/discoverapi"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/drivers/overlay/overlayutils"
+	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/netlabel"
 	_ "github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
 	"github.com/vishvananda/netlink/nl"
 )
 
@@ -175,3 +179,254 @@ func TestNetlinkSocket(t *testing.T) {
 		}
 	}
 }
+
+func TestNetworkEncap(t *testing.T) {
+	n := &network{id: "testnetid", encap: encapGeneve, subnets: []*subnet{}}
+	if n.tunnelPort() != geneveUDPPort {
+		t.Fatalf("Expected the geneve port, got %d", n.tunnelPort())
+	}
+
+	restored := &network{id: n.id}
+	if err := restored.SetValue(n.Value()); err != nil {
+		t.Fatal(err)
+	}
+	if restored.encap != encapGeneve {
+		t.Fatalf("Expected the geneve encapsulation to be restored, got %q", restored.encap)
+	}
+
+	// Networks stored before the encapsulation option use VXLAN
+	legacy := &network{id: n.id}
+	if err := legacy.SetValue([]byte(`{"secure":false,"subnets":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if legacy.tunnelPort() != overlayutils.VXLANUDPPort() {
+		t.Fatalf("Expected the vxlan port, got %d", legacy.tunnelPort())
+	}
+
+	port := &network{id: n.id, encap: encapVXLAN, vxlanPort: 4790, subnets: []*subnet{}}
+	if err := restored.SetValue(port.Value()); err != nil {
+		t.Fatal(err)
+	}
+	if restored.tunnelPort() != 4790 {
+		t.Fatalf("Expected the vxlan port of the network, got %d", restored.tunnelPort())
+	}
+
+	s := &subnet{vni: 0x1234}
+	if name := n.generateGenevePortName(s); name != "gn-001234-0" {
+		t.Fatalf("Unexpected geneve port name %q", name)
+	}
+	if name := n.generateGenevePortName(s); name != "gn-001234-1" {
+		t.Fatalf("Unexpected geneve port name %q", name)
+	}
+}
+
+func TestWireguardKeys(t *testing.T) {
+	k := &key{value: []byte("0123456789abcdef"), tag: 1}
+	nodeA := net.ParseIP("10.0.0.1")
+	nodeB := net.ParseIP("10.0.0.2")
+
+	privA, err := wgPrivateKey(k, nodeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubA, err := wgPublicKey(k, nodeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pubA, privA.PublicKey().Bytes()) {
+		t.Fatal("Expected the peers to derive the public key of the node")
+	}
+
+	pubB, err := wgPublicKey(k, nodeB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(pubA, pubB) {
+		t.Fatal("Expected distinct keys for distinct nodes")
+	}
+
+	rotated, err := wgPublicKey(&key{value: []byte("fedcba9876543210"), tag: 2}, nodeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(pubA, rotated) {
+		t.Fatal("Expected distinct keys for distinct encryption keys")
+	}
+
+	keys := wgKeys([]*key{{tag: 18}, {tag: 2}, {tag: 3}})
+	if len(keys) != 2 || keys[0].tag != 18 || keys[1].tag != 3 {
+		t.Fatalf("Expected the keys sharing a slot with the primary key to be skipped, got %v", keys)
+	}
+	if wgLink(keys[0]) != "wg-overlay2" || wgListenPort(keys[0]) != wgPort+2 {
+		t.Fatalf("Unexpected WireGuard interface %s and port %d", wgLink(keys[0]), wgListenPort(keys[0]))
+	}
+
+	d := &driver{
+		networks: networkTable{},
+		wgMap:    &wgMap{nodes: map[string]map[string]struct{}{"10.0.0.2": {"n1": {}, "n2": {}}, "10.0.0.3": {"n1": {}}}},
+		keys:     []*key{k},
+	}
+	if err := d.removeWireguardNetwork("n1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.wgMap.nodes) != 1 || len(d.wgMap.nodes["10.0.0.2"]) != 1 {
+		t.Fatalf("Expected only the peer needed by the other network to be left, got %v", d.wgMap.nodes)
+	}
+
+	n := &network{id: "testnetid", secure: true, encryption: encryptionWireGuard, subnets: []*subnet{}}
+	if n.maxMTU() != 1500-vxlanEncap-wgPktExpansion {
+		t.Fatalf("Unexpected MTU %d", n.maxMTU())
+	}
+	restored := &network{id: n.id}
+	if err := restored.SetValue(n.Value()); err != nil {
+		t.Fatal(err)
+	}
+	if restored.encryption != encryptionWireGuard {
+		t.Fatalf("Expected the wireguard encryption to be restored, got %q", restored.encryption)
+	}
+}
+
+func TestEncryptionState(t *testing.T) {
+	d := &driver{
+		bindAddress:      "10.0.0.1",
+		advertiseAddress: "10.0.0.1",
+		secMap:           &encrMap{nodes: map[string][]*spi{}},
+		wgMap:            &wgMap{nodes: map[string]map[string]struct{}{"10.0.0.3": {"testnetid": {}}}},
+		keys:             []*key{{value: []byte("0123456789abcdef"), tag: 2}, {value: []byte("fedcba9876543210"), tag: 1}},
+	}
+	aIP := net.ParseIP(d.advertiseAddress)
+	rIP := net.ParseIP("10.0.0.2")
+	d.secMap.nodes[rIP.String()] = buildSPIs(aIP, rIP, d.keys[:1])
+
+	st := d.EncryptionState()
+	if len(st.KeyTags) != 2 || st.KeyTags[0] != 2 || st.KeyTags[1] != 1 {
+		t.Fatalf("Unexpected key tags %v", st.KeyTags)
+	}
+	if len(st.Peers) != 2 {
+		t.Fatalf("Expected two peers, got %v", st.Peers)
+	}
+	if p := st.Peers[0]; p.Node != "10.0.0.2" || p.Backend != encryptionIPsec || len(p.SPIs) != 1 || p.InSync {
+		t.Fatalf("Unexpected IPsec peer state %+v", p)
+	}
+	if p := st.Peers[1]; p.Node != "10.0.0.3" || p.Backend != encryptionWireGuard || p.InSync {
+		t.Fatalf("Unexpected WireGuard peer state %+v", p)
+	}
+
+	pub, err := wgPublicKey(d.keys[0], net.ParseIP("10.0.0.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wgInSync(d.keys, net.ParseIP("10.0.0.3"), map[string]bool{string(pub): true}) {
+		t.Fatal("Expected the WireGuard peer derived from the primary key to be in sync")
+	}
+	if wgInSync(d.keys[1:], net.ParseIP("10.0.0.3"), map[string]bool{string(pub): true}) {
+		t.Fatal("Expected the WireGuard peer derived from another key not to be in sync")
+	}
+
+	if err := d.Rekey("10.0.0.4"); err == nil {
+		t.Fatal("Expected an error rekeying an unknown node")
+	} else if _, ok := err.(types.NotFoundError); !ok {
+		t.Fatalf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestIPv6Underlay(t *testing.T) {
+	d := &driver{advertiseAddress: "2001:db8::1", bindAddress: "::"}
+	if !d.underlayIPv6() || d.underlayIPVersion() != iptables.IPv6 {
+		t.Fatal("Expected an IPv6 underlay")
+	}
+	if ip := d.vxlanLocalIP(); !ip.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("Expected the advertise address as VXLAN local address, got %v", ip)
+	}
+	d.bindAddress = "2001:db8::2"
+	if ip := d.vxlanLocalIP(); !ip.Equal(net.ParseIP("2001:db8::2")) {
+		t.Fatalf("Expected the bind address as VXLAN local address, got %v", ip)
+	}
+
+	n := &network{id: "testnetid", driver: d, subnets: []*subnet{}}
+	if mtu := n.maxMTU(); mtu != 1500-vxlanEncap-ipv6Encap {
+		t.Fatalf("Unexpected MTU %d", mtu)
+	}
+
+	if m := matchVXLANWithU32(iptables.IPv6, 4789, 0x1234); m[len(m)-1] != fmt.Sprintf("52&0xFFFFFF00=%d", 0x1234<<8) {
+		t.Fatalf("Unexpected IPv6 u32 match %v", m)
+	}
+
+	d.advertiseAddress = "10.0.0.1"
+	if d.underlayIPv6() || d.vxlanLocalIP() != nil {
+		t.Fatal("Expected an IPv4 underlay")
+	}
+}
+
+func TestStaticPeers(t *testing.T) {
+	peers, err := parseStaticPeers([]byte(`[
+		{"vtep": "203.0.113.1", "endpoints": [{"ip": "10.0.0.2/24", "mac": "02:42:0a:00:00:02"}, {"ip": "10.1.0.2/24", "mac": "02:42:0a:01:00:02"}]},
+		{"vtep": "203.0.113.2", "endpoints": [{"ip": "10.0.0.3/24", "mac": "02:42:0a:00:00:03"}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseStaticPeers([]byte(`[{"vtep": "203.0.113.1", "endpoints": [{"ip": "10.0.0.2", "mac": "02:42:0a:00:00:02"}]}]`)); err == nil {
+		t.Fatal("Expected an error for an endpoint address with no prefix length")
+	}
+
+	// The local node is left out
+	entries, err := staticEntries(peers, func(ip net.IP) bool { return ip.Equal(net.ParseIP("203.0.113.2")) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected the 2 endpoints of the remote node, got %d", len(entries))
+	}
+
+	d := &driver{
+		networks:    networkTable{},
+		peerOpCh:    make(chan *peerOperation, 10),
+		staticPeers: &staticPeerMap{},
+	}
+	n := &network{id: "testnetid", driver: d, subnets: []*subnet{{subnetIP: &net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(24, 32)}}}}
+	d.networks[n.id] = n
+
+	if err := d.SetStaticPeers(peers); err != nil {
+		t.Fatal(err)
+	}
+	// Only the endpoints within the subnets of the network are added
+	added := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		op := <-d.peerOpCh
+		if op.opType != peerOperationADD || op.networkID != n.id {
+			t.Fatalf("Unexpected peer operation %+v", op)
+		}
+		added[op.peerIP.String()] = true
+	}
+	if !added["10.0.0.2"] || !added["10.0.0.3"] {
+		t.Fatalf("Unexpected peers %v", added)
+	}
+	if len(d.peerOpCh) != 0 {
+		t.Fatalf("Expected no more peer operations, got %d", len(d.peerOpCh))
+	}
+
+	if err := d.SetStaticPeers(peers[:1]); err != nil {
+		t.Fatal(err)
+	}
+	op := <-d.peerOpCh
+	if op.opType != peerOperationDELETE || !op.peerIP.Equal(net.ParseIP("10.0.0.3")) || !op.vtepIP.Equal(net.ParseIP("203.0.113.2")) {
+		t.Fatalf("Unexpected peer operation %+v", op)
+	}
+	if len(d.peerOpCh) != 0 {
+		t.Fatalf("Expected no more peer operations, got %d", len(d.peerOpCh))
+	}
+
+	d.staticPeers = nil
+	if err := d.SetStaticPeers(peers); err == nil {
+		t.Fatal("Expected an error out of static peer mode")
+	}
+
+	d.staticPeers = &staticPeerMap{}
+	ipV4Data := []driverapi.IPAMData{{Pool: &net.IPNet{IP: net.ParseIP("10.1.0.0").To4(), Mask: net.CIDRMask(24, 32)}}}
+	option := map[string]interface{}{netlabel.GenericData: map[string]string{netlabel.OverlayVxlanIDList: "4097", secureOption: ""}}
+	if err := d.CreateNetwork("securenetid", option, nil, ipV4Data, nil); err == nil {
+		t.Fatal("Expected an error creating an encrypted network of static peers")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Expected a bad request error, got %v", err)
+	}
+}
@@ -3,6 +3,8 @@ package overlayutils
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -11,7 +13,11 @@ var (
 	vxlanUDPPort uint32
 )
 
-const defaultVXLANUDPPort = 4789
+const (
+	defaultVXLANUDPPort = 4789
+	// maxVNI is the largest VXLAN network identifier (24 bits)
+	maxVNI = (1 << 24) - 1
+)
 
 func init() {
 	vxlanUDPPort = defaultVXLANUDPPort
@@ -24,13 +30,8 @@ func ConfigVXLANUDPPort(vxlanPort uint32) error {
 	if vxlanPort == 0 {
 		vxlanPort = defaultVXLANUDPPort
 	}
-	// IANA procedures for each range in detail
-	// The Well Known Ports, aka the System Ports, from 0-1023
-	// The Registered Ports, aka the User Ports, from 1024-49151
-	// The Dynamic Ports, aka the Private Ports, from 49152-65535
-	// So we can allow range between 1024 to 49151
-	if vxlanPort < 1024 || vxlanPort > 49151 {
-		return fmt.Errorf("VXLAN UDP port number is not in valid range (1024-49151): %d", vxlanPort)
+	if err := ValidateVXLANUDPPort(vxlanPort); err != nil {
+		return err
 	}
 	mutex.Lock()
 	vxlanUDPPort = vxlanPort
@@ -44,3 +45,38 @@ func VXLANUDPPort() uint32 {
 	defer mutex.RUnlock()
 	return vxlanUDPPort
 }
+
+// ValidateVXLANUDPPort returns an error if the VXLAN UDP port number is not
+// between 1024 and 49151.
+func ValidateVXLANUDPPort(vxlanPort uint32) error {
+	// IANA procedures for each range in detail
+	// The Well Known Ports, aka the System Ports, from 0-1023
+	// The Registered Ports, aka the User Ports, from 1024-49151
+	// The Dynamic Ports, aka the Private Ports, from 49152-65535
+	// So we can allow range between 1024 to 49151
+	if vxlanPort < 1024 || vxlanPort > 49151 {
+		return fmt.Errorf("VXLAN UDP port number is not in valid range (1024-49151): %d", vxlanPort)
+	}
+	return nil
+}
+
+// ParseVNIRange parses a VXLAN network identifier range in the "start-end"
+// form. The range must be within min and the largest 24 bits identifier.
+func ParseVNIRange(val string, min uint32) (uint32, uint32, error) {
+	bounds := strings.SplitN(val, "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("invalid VXLAN id range %q: expected start-end", val)
+	}
+	start, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid VXLAN id range %q: %v", val, err)
+	}
+	end, err := strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid VXLAN id range %q: %v", val, err)
+	}
+	if start < uint64(min) || end > maxVNI || start > end {
+		return 0, 0, fmt.Errorf("VXLAN id range %q is not within %d-%d", val, min, maxVNI)
+	}
+	return uint32(start), uint32(end), nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/discoverapi"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/drivers/overlay/overlayutils"
 	"github.com/docker/libnetwork/idm"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/types"
@@ -29,6 +30,9 @@ type driver struct {
 	networks networkTable
 	store    datastore.DataStore
 	vxlanIdm *idm.Idm
+	// vniStart and vniEnd bound the vxlan ids allocated to the networks
+	vniStart uint32
+	vniEnd   uint32
 	sync.Mutex
 }
 
@@ -56,6 +60,18 @@ func Init(dc driverapi.DriverCallback, config map[string]interface{}) error {
 	d := &driver{
 		networks: networkTable{},
 		config:   config,
+		vniStart: vxlanIDStart,
+		vniEnd:   vxlanIDEnd,
+	}
+
+	if val, ok := config[netlabel.OverlayVxlanIDRange]; ok {
+		s, ok := val.(string)
+		if !ok {
+			return types.BadRequestErrorf("invalid vxlan id range: %v", val)
+		}
+		if d.vniStart, d.vniEnd, err = overlayutils.ParseVNIRange(s, vxlanIDStart); err != nil {
+			return types.BadRequestErrorf("%v", err)
+		}
 	}
 
 	d.vxlanIdm, err = idm.New(nil, "vxlan-id", 0, vxlanIDEnd)
@@ -167,7 +183,7 @@ func (n *network) obtainVxlanID(s *subnet) error {
 	n.Unlock()
 
 	if vni == 0 {
-		vni, err = n.driver.vxlanIdm.GetIDInRange(vxlanIDStart, vxlanIDEnd, true)
+		vni, err = n.driver.vxlanIdm.GetIDInRange(uint64(n.driver.vniStart), uint64(n.driver.vniEnd), true)
 		if err != nil {
 			return err
 		}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/drivers/overlay/overlayutils"
 	"github.com/docker/libnetwork/idm"
 	"github.com/docker/libnetwork/netlabel"
 	_ "github.com/docker/libnetwork/testutils"
@@ -18,6 +19,8 @@ import (
 func newDriver(t *testing.T) *driver {
 	d := &driver{
 		networks: networkTable{},
+		vniStart: vxlanIDStart,
+		vniEnd:   vxlanIDEnd,
 	}
 
 	vxlanIdm, err := idm.New(nil, "vxlan-id", vxlanIDStart, vxlanIDEnd)
@@ -86,3 +89,40 @@ func TestNetworkAllocateUserDefinedVNIs(t *testing.T) {
 	err = d.NetworkFree("testnetwork")
 	assert.NilError(t, err)
 }
+
+func TestNetworkAllocateVNIRange(t *testing.T) {
+	d := newDriver(t)
+	d.vniStart, d.vniEnd = 5000, 5001
+
+	ipamData := []driverapi.IPAMData{
+		{
+			Pool: parseCIDR(t, "10.1.1.0/24"),
+		},
+		{
+			Pool: parseCIDR(t, "10.1.2.0/24"),
+		},
+	}
+
+	vals, err := d.NetworkAllocate("testnetwork", nil, ipamData, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("5000,5001", vals[netlabel.OverlayVxlanIDList]))
+
+	// The range is exhausted
+	_, err = d.NetworkAllocate("testnetwork2", nil, ipamData[:1], nil)
+	assert.Check(t, err != nil)
+
+	err = d.NetworkFree("testnetwork")
+	assert.NilError(t, err)
+}
+
+func TestParseVNIRange(t *testing.T) {
+	start, end, err := overlayutils.ParseVNIRange("5000-6000", vxlanIDStart)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(uint32(5000), start))
+	assert.Check(t, is.Equal(uint32(6000), end))
+
+	for _, val := range []string{"5000", "6000-5000", "0-10", "4000-5000", "5000-16777216", "a-10"} {
+		_, _, err := overlayutils.ParseVNIRange(val, vxlanIDStart)
+		assert.Check(t, err != nil, val)
+	}
+}
@@ -393,8 +393,19 @@ func (d *driver) peerAddOp(nid, eid string, peerIP net.IP, peerIPMask net.IPMask
 		logrus.Warn(err)
 	}
 
+	neighLink, fdbLink := s.vxlanName, s.vxlanName
+	geneve := n.encap == encapGeneve
+	if geneve {
+		// The peer MAC is reached through the geneve port to its VTEP
+		port, err := n.genevePort(s, vtep)
+		if err != nil {
+			return fmt.Errorf("could not add geneve port for nid:%s eid:%s into the sandbox:%v", nid, eid, err)
+		}
+		neighLink, fdbLink = s.brName, port
+	}
+
 	// Add neighbor entry for the peer IP
-	if err := sbox.AddNeighbor(peerIP, peerMac, l3Miss, sbox.NeighborOptions().LinkName(s.vxlanName)); err != nil {
+	if err := sbox.AddNeighbor(peerIP, peerMac, l3Miss, sbox.NeighborOptions().LinkName(neighLink)); err != nil {
 		if _, ok := err.(osl.NeighborSearchError); ok && dbEntries > 1 {
 			// We are in the transient case so only the first configuration is programmed into the kernel
 			// Upon deletion if the active configuration is deleted the next one from the database will be restored
@@ -405,8 +416,8 @@ func (d *driver) peerAddOp(nid, eid string, peerIP net.IP, peerIPMask net.IPMask
 	}
 
 	// Add fdb entry to the bridge for the peer mac
-	if err := sbox.AddNeighbor(vtep, peerMac, l2Miss, sbox.NeighborOptions().LinkName(s.vxlanName),
-		sbox.NeighborOptions().Family(syscall.AF_BRIDGE)); err != nil {
+	if err := sbox.AddNeighbor(vtep, peerMac, l2Miss, sbox.NeighborOptions().LinkName(fdbLink),
+		sbox.NeighborOptions().Family(syscall.AF_BRIDGE), sbox.NeighborOptions().MasterFDB(geneve)); err != nil {
 		return fmt.Errorf("could not add fdb entry for nid:%s eid:%s into the sandbox:%v", nid, eid, err)
 	}
 
@@ -471,6 +482,10 @@ func (d *driver) peerDeleteOp(nid, eid string, peerIP net.IP, peerIPMask net.IPM
 		if err := sbox.DeleteNeighbor(peerIP, peerMac, true); err != nil {
 			return fmt.Errorf("could not delete neighbor entry for nid:%s eid:%s into the sandbox:%v", nid, eid, err)
 		}
+
+		if n.encap == encapGeneve {
+			d.releaseGenevePort(n, &net.IPNet{IP: peerIP, Mask: peerIPMask}, vtep)
+		}
 	}
 
 	if dbEntries == 0 {
@@ -488,6 +503,26 @@ func (d *driver) peerDeleteOp(nid, eid string, peerIP net.IP, peerIPMask net.IPM
 	return d.peerAddOp(nid, peerEntry.eid, peerIP, peerEntry.peerIPMask, peerKey.peerMac, peerEntry.vtep, false, false, false, peerEntry.isLocal)
 }
 
+// releaseGenevePort deletes the geneve port to the VTEP of a deleted peer,
+// unless the VTEP has other peers in the subnet.
+func (d *driver) releaseGenevePort(n *network, peerIP *net.IPNet, vtep net.IP) {
+	s := n.getSubnetforIP(peerIP)
+	if s == nil {
+		return
+	}
+	var inUse bool
+	d.peerDbNetworkWalk(n.id, func(pKey *peerKey, pEntry *peerEntry) bool {
+		inUse = !pEntry.isLocal && pEntry.vtep.Equal(vtep) && s.subnetIP.Contains(pKey.peerIP)
+		return inUse
+	})
+	if inUse {
+		return
+	}
+	if err := n.releaseGenevePort(s, vtep); err != nil {
+		logrus.Warnf("Failed to delete the geneve port to %s in network %.7s: %v", vtep, n.id, err)
+	}
+}
+
 func (d *driver) peerFlush(nid string) {
 	d.peerOpCh <- &peerOperation{
 		opType:     peerOperationFLUSH,
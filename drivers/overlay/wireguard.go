@@ -0,0 +1,721 @@
+package overlay
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sync"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/ns"
+	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+/*
+Overlay networks created with the encrypted=wireguard option tunnel their
+VXLAN, or Geneve, datagrams through WireGuard interfaces instead of
+applying IPsec transport mode to them.
+
+The key pairs are not exchanged: the private key of a node is derived from
+an encryption key distributed over gossip and from the advertise address of
+the node, so that every node holding the key can compute the public keys of
+its peers. Every node has one WireGuard interface for each encryption key it
+holds, named after wgLinkName and listening on a port after wgPort, both
+offset by the slot of the key, with one peer for each remote node taking
+part in the networks. The tunnel datagrams are sent through the interface of
+the primary key and accepted from any of them, so that the nodes keep
+reaching each other while a key rotation is propagated: the nodes which have
+not switched to the new primary key yet still hold it, and the ones which
+have still hold the former primary key. A key sharing its slot with a key
+closer to the primary one gets no interface.
+
+The tunnel datagrams of the encrypted VNIs are marked with wgMark in the
+mangle table and routed by policy to the WireGuard interface of the primary
+key, which accepts the datagrams addressed to the advertise address of each
+peer. The datagrams of the encrypted VNIs which were not received through a
+WireGuard interface are dropped.
+*/
+
+const (
+	wgLinkName = "wg-overlay"
+	// wgPort is the UDP port the WireGuard interface of the first slot
+	// listens on, the interfaces of the other slots listen on the next ones.
+	wgPort = 51820
+	// wgSlots is the number of WireGuard interfaces, and ports, the
+	// encryption keys are spread over according to their tag.
+	wgSlots = 16
+	// wgMark marks the outgoing tunnel datagrams to be routed through the
+	// WireGuard interface, by way of the wgTable routing table.
+	wgMark  = 0xD0C4E4
+	wgTable = 0xD0C4
+
+	wgPktExpansion = 60 // IP(20) + UDP(8) + Type/Reserved(4) + Receiver(4) + Counter(8) + Tag(16)
+	wgKeepalive    = 25
+
+	// Generic netlink interface of the wireguard module, see
+	// include/uapi/linux/wireguard.h
+	wgGenlName                 = "wireguard"
+	wgGenlVersion              = 1
+	wgCmdGetDevice             = 0
+	wgCmdSetDevice             = 1
+	wgDeviceAIfname            = 2
+	wgDeviceAPrivateKey        = 3
+	wgDeviceAFlags             = 5
+	wgDeviceAListenPort        = 6
+	wgDeviceAPeers             = 8
+	wgDeviceFReplacePeers      = 1
+	wgPeerAPublicKey           = 1
+	wgPeerAFlags               = 3
+	wgPeerAEndpoint            = 4
+	wgPeerAPersistentKeepalive = 5
+	wgPeerAAllowedIPs          = 9
+	wgPeerFRemoveMe            = 1
+	wgPeerFReplaceAllowedIPs   = 2
+	wgAllowedIPAFamily         = 1
+	wgAllowedIPAIPAddr         = 2
+	wgAllowedIPACidrMask       = 3
+)
+
+// wgMap tracks the WireGuard interfaces, by the tag of their key, and their
+// peers, along with the networks which need each of them.
+type wgMap struct {
+	up    bool
+	mtu   int
+	links map[int]uint32
+	nodes map[string]map[string]struct{}
+	sync.Mutex
+}
+
+type wgPeer struct {
+	publicKey []byte
+	endpoint  net.IP
+	port      int
+	remove    bool
+}
+
+// wgPrivateKey derives the WireGuard private key of the node with the given
+// advertise address from the encryption key.
+func wgPrivateKey(k *key, nodeIP net.IP) (*ecdh.PrivateKey, error) {
+	h := hmac.New(sha256.New, k.value)
+	h.Write([]byte("overlay wireguard "))
+	h.Write(nodeIP.To16())
+	return ecdh.X25519().NewPrivateKey(h.Sum(nil))
+}
+
+func wgPublicKey(k *key, nodeIP net.IP) ([]byte, error) {
+	priv, err := wgPrivateKey(k, nodeIP)
+	if err != nil {
+		return nil, err
+	}
+	return priv.PublicKey().Bytes(), nil
+}
+
+func wgSlot(k *key) int {
+	return int(k.tag % wgSlots)
+}
+
+func wgLink(k *key) string {
+	return fmt.Sprintf("%s%d", wgLinkName, wgSlot(k))
+}
+
+func wgListenPort(k *key) int {
+	return wgPort + wgSlot(k)
+}
+
+// wgKeys returns the keys which get a WireGuard interface, the primary key
+// first.
+func wgKeys(keys []*key) []*key {
+	var (
+		res   []*key
+		slots = map[int]bool{}
+	)
+	for _, k := range keys {
+		if slots[wgSlot(k)] {
+			continue
+		}
+		slots[wgSlot(k)] = true
+		res = append(res, k)
+	}
+	return res
+}
+
+// programWireguardPeer adds, or removes, the WireGuard peer for the remote
+// node rIP on behalf of the network.
+func (d *driver) programWireguardPeer(nid string, aIP, rIP net.IP, mtu int, add bool) error {
+	if len(d.keys) == 0 {
+		return types.ForbiddenErrorf("encryption key is not present")
+	}
+
+	d.wgMap.Lock()
+	defer d.wgMap.Unlock()
+
+	rIPs := rIP.String()
+	nets := d.wgMap.nodes[rIPs]
+	if add {
+		if err := d.wgMap.setup(d.keys, aIP, mtu); err != nil {
+			return err
+		}
+		if nets == nil {
+			logrus.Debugf("Adding WireGuard peer %s", rIP)
+			if err := d.wgMap.setPeers(d.keys, []net.IP{rIP}, false); err != nil {
+				return err
+			}
+			nets = map[string]struct{}{}
+			d.wgMap.nodes[rIPs] = nets
+		}
+		nets[nid] = struct{}{}
+		return nil
+	}
+
+	if nets == nil {
+		return nil
+	}
+	delete(nets, nid)
+	if len(nets) > 0 {
+		return nil
+	}
+	delete(d.wgMap.nodes, rIPs)
+	logrus.Debugf("Removing WireGuard peer %s", rIP)
+	return d.wgMap.setPeers(d.keys, []net.IP{rIP}, true)
+}
+
+// removeWireguardNetwork removes the WireGuard peers which were only needed
+// by the network, and the WireGuard interfaces if no peer and no other
+// WireGuard network is left. Must be called with the driver lock, once the
+// network is removed from the driver.
+func (d *driver) removeWireguardNetwork(nid string) error {
+	d.wgMap.Lock()
+	defer d.wgMap.Unlock()
+
+	var stale []net.IP
+	for node, nets := range d.wgMap.nodes {
+		if _, ok := nets[nid]; !ok {
+			continue
+		}
+		delete(nets, nid)
+		if len(nets) == 0 {
+			delete(d.wgMap.nodes, node)
+			stale = append(stale, net.ParseIP(node))
+		}
+	}
+
+	if len(stale) > 0 && len(d.keys) > 0 {
+		logrus.Debugf("Removing WireGuard peers %s", stale)
+		if err := d.wgMap.setPeers(d.keys, stale, true); err != nil {
+			return err
+		}
+	}
+
+	if len(d.wgMap.nodes) > 0 {
+		return nil
+	}
+	for _, n := range d.networks {
+		if n.secure && n.encryption == encryptionWireGuard {
+			return nil
+		}
+	}
+	return d.wgMap.teardown()
+}
+
+// setPeers adds, or removes, the peers for the remote nodes on the WireGuard
+// interfaces of the keys. Must be called with the map lock.
+func (w *wgMap) setPeers(keys []*key, nodes []net.IP, remove bool) error {
+	for _, k := range wgKeys(keys) {
+		if tag, ok := w.links[wgSlot(k)]; !ok || tag != k.tag {
+			continue
+		}
+		peers, err := wgPeers(k, nodes)
+		if err != nil {
+			return err
+		}
+		for i := range peers {
+			peers[i].remove = remove
+		}
+		if err := wgSetDevice(wgLink(k), nil, 0, peers, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func wgPeers(k *key, nodes []net.IP) ([]wgPeer, error) {
+	peers := make([]wgPeer, 0, len(nodes))
+	for _, rIP := range nodes {
+		pub, err := wgPublicKey(k, rIP)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, wgPeer{publicKey: pub, endpoint: rIP, port: wgListenPort(k)})
+	}
+	return peers, nil
+}
+
+func (w *wgMap) peerIPs() []net.IP {
+	nodes := make([]net.IP, 0, len(w.nodes))
+	for node := range w.nodes {
+		nodes = append(nodes, net.ParseIP(node))
+	}
+	return nodes
+}
+
+// rekey programs the WireGuard interfaces again from the keys, with the peers
+// derived from them. If reset is set the peers are forgotten instead.
+func (w *wgMap) rekey(keys []*key, aIP net.IP, reset bool) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if reset {
+		w.nodes = map[string]map[string]struct{}{}
+	}
+	if !w.up {
+		return nil
+	}
+	logrus.Debugf("Rekeying WireGuard interfaces with %d peers", len(w.nodes))
+	return w.sync(keys, aIP, true)
+}
+
+// updateKeys adds the WireGuard interfaces of the new keys, removes the ones
+// of the pruned keys and routes the tunnel datagrams through the interface of
+// the primary key, leaving the interfaces of the other keys as they are.
+func (w *wgMap) updateKeys(keys []*key, aIP net.IP) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if !w.up {
+		return nil
+	}
+	return w.sync(keys, aIP, false)
+}
+
+// sync makes the WireGuard interfaces match the keys, programming those which
+// are already set up again only if reprogram is set. Must be called with the
+// map lock.
+func (w *wgMap) sync(keys []*key, aIP net.IP, reprogram bool) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if w.links == nil {
+		w.links = map[int]uint32{}
+	}
+
+	defer osl.InitOSContext()()
+
+	held := map[int]*key{}
+	for _, k := range wgKeys(keys) {
+		held[wgSlot(k)] = k
+	}
+	if len(held) < len(keys) {
+		logrus.Warnf("Encryption keys %v share WireGuard slots, only the ones closest to the primary key get an interface", keys)
+	}
+	for slot, tag := range w.links {
+		if k, ok := held[slot]; ok && k.tag == tag {
+			continue
+		}
+		delete(w.links, slot)
+		if err := wgLinkDel(fmt.Sprintf("%s%d", wgLinkName, slot)); err != nil {
+			logrus.Warnf("Failed to remove WireGuard interface of encryption key %d: %v", tag, err)
+		}
+	}
+
+	var (
+		primary netlink.Link
+		err     error
+	)
+	for _, k := range wgKeys(keys) {
+		if tag, ok := w.links[wgSlot(k)]; ok && tag == k.tag && !reprogram {
+			if k == keys[0] {
+				if primary, err = ns.NlHandle().LinkByName(wgLink(k)); err != nil {
+					return fmt.Errorf("could not find WireGuard interface %s: %v", wgLink(k), err)
+				}
+			}
+			continue
+		}
+		link, err := w.addLink(k, aIP)
+		if err != nil {
+			return err
+		}
+		if k == keys[0] {
+			primary = link
+		}
+	}
+
+	dst := &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+	if aIP.To4() == nil {
+		dst = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+	}
+	route := &netlink.Route{
+		LinkIndex: primary.Attrs().Index,
+		Dst:       dst,
+		Scope:     netlink.SCOPE_LINK,
+		Table:     wgTable,
+	}
+	if err := ns.NlHandle().RouteReplace(route); err != nil {
+		return fmt.Errorf("error adding WireGuard route: %v", err)
+	}
+	return nil
+}
+
+// addLink creates, unless present, and programs the WireGuard interface of
+// the key with the peers of the map. Must be called with the map lock.
+func (w *wgMap) addLink(k *key, aIP net.IP) (netlink.Link, error) {
+	defer osl.InitOSContext()()
+
+	name := wgLink(k)
+	nlh := ns.NlHandle()
+	link, err := nlh.LinkByName(name)
+	if err != nil {
+		link = &netlink.GenericLink{
+			LinkAttrs: netlink.LinkAttrs{Name: name, MTU: w.mtu},
+			LinkType:  wgGenlName,
+		}
+		if err := nlh.LinkAdd(link); err != nil {
+			return nil, fmt.Errorf("error creating WireGuard interface %s: %v", name, err)
+		}
+		if link, err = nlh.LinkByName(name); err != nil {
+			return nil, fmt.Errorf("could not find WireGuard interface %s: %v", name, err)
+		}
+	}
+	if link.Attrs().MTU < w.mtu {
+		if err := nlh.LinkSetMTU(link, w.mtu); err != nil {
+			return nil, fmt.Errorf("error setting WireGuard interface %s MTU to %d: %v", name, w.mtu, err)
+		}
+	}
+
+	priv, err := wgPrivateKey(k, aIP)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := wgPeers(k, w.peerIPs())
+	if err != nil {
+		return nil, err
+	}
+	if err := wgSetDevice(name, priv.Bytes(), wgListenPort(k), peers, true); err != nil {
+		return nil, err
+	}
+	if err := nlh.LinkSetUp(link); err != nil {
+		return nil, fmt.Errorf("error bringing up WireGuard interface %s: %v", name, err)
+	}
+
+	// The decrypted datagrams come in through the WireGuard interface while
+	// the route to their source goes through the underlay. There is no
+	// reverse path filtering for IPv6.
+	rpFilter := filepath.Join("/proc/sys/net/ipv4/conf", name, "rp_filter")
+	if err := ioutil.WriteFile(rpFilter, []byte{'2', '\n'}, 0644); err != nil {
+		logrus.Warnf("Failed to set loose reverse path filtering on %s: %v", name, err)
+	}
+
+	w.links[wgSlot(k)] = k.tag
+	return link, nil
+}
+
+// setup brings up the WireGuard interfaces, if they are not up yet, and makes
+// sure they can carry the tunnel datagrams of a network with the given MTU.
+// Must be called with the map lock.
+func (w *wgMap) setup(keys []*key, aIP net.IP, mtu int) error {
+	ipv6 := aIP.To4() == nil
+	if mtu == 0 {
+		mtu = 1500
+	}
+	mtu -= wgPktExpansion
+	if ipv6 {
+		mtu -= ipv6Encap
+	}
+	if w.up && mtu <= w.mtu {
+		return nil
+	}
+
+	defer osl.InitOSContext()()
+
+	nlh := ns.NlHandle()
+	w.mtu = mtu
+	if w.up {
+		for slot := range w.links {
+			name := fmt.Sprintf("%s%d", wgLinkName, slot)
+			link, err := nlh.LinkByName(name)
+			if err != nil {
+				return fmt.Errorf("could not find WireGuard interface %s: %v", name, err)
+			}
+			if err := nlh.LinkSetMTU(link, mtu); err != nil {
+				return fmt.Errorf("error setting WireGuard interface %s MTU to %d: %v", name, mtu, err)
+			}
+		}
+		return nil
+	}
+
+	if err := w.sync(keys, aIP, true); err != nil {
+		return err
+	}
+	family := netlink.FAMILY_V4
+	if ipv6 {
+		family = netlink.FAMILY_V6
+	}
+	if err := programWireguardRule(nlh, family); err != nil {
+		return err
+	}
+
+	w.up = true
+	return nil
+}
+
+// teardown removes the WireGuard interfaces, along with the routes through
+// them, and the routing policy rule. Must be called with the map lock.
+func (w *wgMap) teardown() error {
+	if !w.up {
+		return nil
+	}
+
+	defer osl.InitOSContext()()
+
+	logrus.Debugf("Removing the WireGuard interfaces")
+	for slot := range w.links {
+		if err := wgLinkDel(fmt.Sprintf("%s%d", wgLinkName, slot)); err != nil {
+			return err
+		}
+		delete(w.links, slot)
+	}
+
+	nlh := ns.NlHandle()
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rules, err := nlh.RuleList(family)
+		if err != nil {
+			return fmt.Errorf("could not list routing rules: %v", err)
+		}
+		for _, r := range rules {
+			if r.Mark != wgMark || r.Table != wgTable {
+				continue
+			}
+			r.Family = family
+			if err := nlh.RuleDel(&r); err != nil {
+				return fmt.Errorf("error removing WireGuard routing rule: %v", err)
+			}
+		}
+	}
+
+	w.up = false
+	w.mtu = 0
+	return nil
+}
+
+func wgLinkDel(name string) error {
+	nlh := ns.NlHandle()
+	link, err := nlh.LinkByName(name)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return fmt.Errorf("could not find WireGuard interface %s: %v", name, err)
+	}
+	if err := nlh.LinkDel(link); err != nil {
+		return fmt.Errorf("error removing WireGuard interface %s: %v", name, err)
+	}
+	return nil
+}
+
+// programWireguardRule installs the routing policy rule sending the marked
+// tunnel datagrams to the WireGuard routing table, unless present.
+func programWireguardRule(nlh *netlink.Handle, family int) error {
+	rules, err := nlh.RuleList(family)
+	if err != nil {
+		return fmt.Errorf("could not list routing rules: %v", err)
+	}
+	for _, r := range rules {
+		if r.Mark == wgMark && r.Table == wgTable {
+			return nil
+		}
+	}
+	rule := netlink.NewRule()
+	rule.Family = family
+	rule.Mark = wgMark
+	rule.Mask = 0xffffffff
+	rule.Table = wgTable
+	if err := nlh.RuleAdd(rule); err != nil {
+		return fmt.Errorf("error adding WireGuard routing rule: %v", err)
+	}
+	return nil
+}
+
+// wgSetDevice configures the WireGuard interface. A nil privateKey leaves the
+// key pair and listen port as they are.
+func wgSetDevice(ifName string, privateKey []byte, port int, peers []wgPeer, replacePeers bool) error {
+	defer osl.InitOSContext()()
+
+	family, err := ns.NlHandle().GenlFamilyGet(wgGenlName)
+	if err != nil {
+		return fmt.Errorf("could not find the %s netlink family: %v", wgGenlName, err)
+	}
+
+	req := nl.NewNetlinkRequest(int(family.ID), unix.NLM_F_ACK)
+	req.AddData(&nl.Genlmsg{Command: wgCmdSetDevice, Version: wgGenlVersion})
+	req.AddData(nl.NewRtAttr(wgDeviceAIfname, nl.ZeroTerminated(ifName)))
+	if privateKey != nil {
+		req.AddData(nl.NewRtAttr(wgDeviceAPrivateKey, privateKey))
+		req.AddData(nl.NewRtAttr(wgDeviceAListenPort, nl.Uint16Attr(uint16(port))))
+	}
+	if replacePeers {
+		req.AddData(nl.NewRtAttr(wgDeviceAFlags, nl.Uint32Attr(wgDeviceFReplacePeers)))
+	}
+	if len(peers) > 0 {
+		list := nl.NewRtAttr(unix.NLA_F_NESTED|wgDeviceAPeers, nil)
+		for _, p := range peers {
+			peer := list.AddRtAttr(unix.NLA_F_NESTED, nil)
+			peer.AddRtAttr(wgPeerAPublicKey, p.publicKey)
+			if p.remove {
+				peer.AddRtAttr(wgPeerAFlags, nl.Uint32Attr(wgPeerFRemoveMe))
+				continue
+			}
+			peer.AddRtAttr(wgPeerAFlags, nl.Uint32Attr(wgPeerFReplaceAllowedIPs))
+			peer.AddRtAttr(wgPeerAEndpoint, wgSockaddr(p.endpoint, p.port))
+			peer.AddRtAttr(wgPeerAPersistentKeepalive, nl.Uint16Attr(wgKeepalive))
+			ip := peer.AddRtAttr(unix.NLA_F_NESTED|wgPeerAAllowedIPs, nil).AddRtAttr(unix.NLA_F_NESTED, nil)
+			if ip4 := p.endpoint.To4(); ip4 != nil {
+				ip.AddRtAttr(wgAllowedIPAFamily, nl.Uint16Attr(unix.AF_INET))
+				ip.AddRtAttr(wgAllowedIPAIPAddr, []byte(ip4))
+				ip.AddRtAttr(wgAllowedIPACidrMask, nl.Uint8Attr(32))
+			} else {
+				ip.AddRtAttr(wgAllowedIPAFamily, nl.Uint16Attr(unix.AF_INET6))
+				ip.AddRtAttr(wgAllowedIPAIPAddr, []byte(p.endpoint.To16()))
+				ip.AddRtAttr(wgAllowedIPACidrMask, nl.Uint8Attr(128))
+			}
+		}
+		req.AddData(list)
+	}
+
+	if _, err := req.Execute(unix.NETLINK_GENERIC, 0); err != nil {
+		return fmt.Errorf("error configuring WireGuard interface %s: %v", ifName, err)
+	}
+	return nil
+}
+
+// wgDevicePeers returns the public keys of the peers of the WireGuard
+// interface.
+func wgDevicePeers(ifName string) (map[string]bool, error) {
+	defer osl.InitOSContext()()
+
+	family, err := ns.NlHandle().GenlFamilyGet(wgGenlName)
+	if err != nil {
+		return nil, fmt.Errorf("could not find the %s netlink family: %v", wgGenlName, err)
+	}
+
+	req := nl.NewNetlinkRequest(int(family.ID), unix.NLM_F_DUMP)
+	req.AddData(&nl.Genlmsg{Command: wgCmdGetDevice, Version: wgGenlVersion})
+	req.AddData(nl.NewRtAttr(wgDeviceAIfname, nl.ZeroTerminated(ifName)))
+	msgs, err := req.Execute(unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error reading WireGuard interface %s: %v", ifName, err)
+	}
+
+	// A device with many peers is dumped over several messages, each one
+	// holding some of the peers.
+	peers := map[string]bool{}
+	for _, m := range msgs {
+		attrs, err := nl.ParseRouteAttr(m[nl.SizeofGenlmsg:])
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range attrs {
+			if a.Attr.Type&^unix.NLA_F_NESTED != wgDeviceAPeers {
+				continue
+			}
+			list, err := nl.ParseRouteAttr(a.Value)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range list {
+				pattrs, err := nl.ParseRouteAttr(p.Value)
+				if err != nil {
+					return nil, err
+				}
+				for _, pa := range pattrs {
+					if pa.Attr.Type&^unix.NLA_F_NESTED == wgPeerAPublicKey {
+						peers[string(pa.Value)] = true
+					}
+				}
+			}
+		}
+	}
+	return peers, nil
+}
+
+// wgInSync tells whether the WireGuard interface of the primary key has the
+// peer for the remote node, out of the peers of the interface.
+func wgInSync(keys []*key, rIP net.IP, peers map[string]bool) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	pub, err := wgPublicKey(keys[0], rIP)
+	if err != nil {
+		return false
+	}
+	return peers[string(pub)]
+}
+
+// wgSockaddr returns the sockaddr_in, or sockaddr_in6, of the WireGuard
+// endpoint of the node.
+func wgSockaddr(ip net.IP, port int) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		b := make([]byte, unix.SizeofSockaddrInet4)
+		nl.NativeEndian().PutUint16(b[0:], unix.AF_INET)
+		binary.BigEndian.PutUint16(b[2:], uint16(port))
+		copy(b[4:], ip4)
+		return b
+	}
+	b := make([]byte, unix.SizeofSockaddrInet6)
+	nl.NativeEndian().PutUint16(b[0:], unix.AF_INET6)
+	binary.BigEndian.PutUint16(b[2:], uint16(port))
+	copy(b[8:], ip.To16())
+	return b
+}
+
+// programWireguardMangle marks the tunnel datagrams of a VNI to be routed
+// through the WireGuard interface.
+var programWireguardMangle = programMarkFunc(wgMark)
+
+var programWireguardInput = programVXLANRuleFunc(func(matchVXLAN matchVXLANFunc, ipv iptables.IPVersion, port, vni uint32, add bool) error {
+	var (
+		plainVxlan = matchVXLAN(ipv, port, vni)
+		chain      = "INPUT"
+		msg        = "add"
+	)
+
+	rule := func(iface []string, jump string) []string {
+		args := append(iface, plainVxlan...)
+		return append(args, "-j", jump)
+	}
+
+	iptable := iptables.GetIptable(ipv)
+
+	if !add {
+		msg = "remove"
+	}
+
+	action := func(a iptables.Action) iptables.Action {
+		if !add {
+			return iptables.Delete
+		}
+		return a
+	}
+
+	// Accept incoming datagrams for the VNI which were decrypted by one of
+	// the WireGuard interfaces.
+	if err := iptable.ProgramRule(iptables.Filter, chain, action(iptables.Append), rule([]string{"-i", wgLinkName + "+"}, "ACCEPT")); err != nil {
+		return fmt.Errorf("could not %s input accept rule: %w", msg, err)
+	}
+
+	// Drop incoming datagrams for the VNI which bypassed the WireGuard
+	// interfaces.
+	if err := iptable.ProgramRule(iptables.Filter, chain, action(iptables.Insert), rule([]string{"!", "-i", wgLinkName + "+"}, "DROP")); err != nil {
+		return fmt.Errorf("could not %s input drop rule: %w", msg, err)
+	}
+
+	return nil
+})
@@ -9,8 +9,9 @@ import (
 	"github.com/docker/libnetwork/ipamutils"
 )
 
-func initIPAMDrivers(r *drvregistry.DrvRegistry, lDs, gDs interface{}, addressPool []*ipamutils.NetworkToSplit) error {
+func initIPAMDrivers(r *drvregistry.DrvRegistry, lDs, gDs interface{}, addressPool []*ipamutils.NetworkToSplit, namedPools map[string][]*ipamutils.NetworkToSplit) error {
 	builtinIpam.SetDefaultIPAddressPool(addressPool)
+	builtinIpam.SetNamedAddressPools(namedPools)
 	for _, fn := range [](func(ipamapi.Callback, interface{}, interface{}) error){
 		builtinIpam.Init,
 		remoteIpam.Init,
@@ -0,0 +1,154 @@
+// Package egress filters the destinations the endpoints of a network can
+// reach outside of it.
+package egress
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Rule matches the traffic to a destination network and, optionally, to a
+// port range of a protocol
+type Rule struct {
+	Network  *net.IPNet
+	Protocol string
+	FromPort uint16
+	ToPort   uint16
+}
+
+// Policy holds the destinations the endpoints are denied and allowed to
+// reach. The denied destinations take precedence. Without allowed
+// destinations, anything not denied is allowed, otherwise anything not
+// allowed is denied.
+type Policy struct {
+	Allow []Rule
+	Deny  []Rule
+}
+
+// ParseRules parses a comma separated list of destinations, in the
+// <cidr>[=<port>[-<port>]/<protocol>] format as in "10.0.0.0/8" or
+// "192.0.2.10/32=443/tcp".
+func ParseRules(value string) ([]Rule, error) {
+	var rules []Rule
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		r, err := parseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("empty destination list")
+	}
+	return rules, nil
+}
+
+func parseRule(s string) (Rule, error) {
+	var r Rule
+	parts := strings.SplitN(s, "=", 2)
+	_, nw, err := net.ParseCIDR(parts[0])
+	if err != nil {
+		return r, fmt.Errorf("invalid destination %q: %v", s, err)
+	}
+	r.Network = nw
+	if len(parts) == 1 {
+		return r, nil
+	}
+
+	pp := strings.SplitN(parts[1], "/", 2)
+	if len(pp) != 2 {
+		return r, fmt.Errorf("invalid destination %q: expected <port>[-<port>]/<protocol>", s)
+	}
+	switch pp[1] {
+	case "tcp", "udp", "sctp":
+		r.Protocol = pp[1]
+	default:
+		return r, fmt.Errorf("invalid destination %q: unsupported protocol %q", s, pp[1])
+	}
+	ports := strings.SplitN(pp[0], "-", 2)
+	for i, port := range ports {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || p == 0 {
+			return r, fmt.Errorf("invalid destination %q: invalid port %q", s, port)
+		}
+		if i == 0 {
+			r.FromPort = uint16(p)
+		}
+		r.ToPort = uint16(p)
+	}
+	if r.ToPort < r.FromPort {
+		return r, fmt.Errorf("invalid destination %q: invalid port range", s)
+	}
+	return r, nil
+}
+
+func (r Rule) String() string {
+	if r.Protocol == "" {
+		return r.Network.String()
+	}
+	if r.FromPort == r.ToPort {
+		return fmt.Sprintf("%s=%d/%s", r.Network, r.FromPort, r.Protocol)
+	}
+	return fmt.Sprintf("%s=%d-%d/%s", r.Network, r.FromPort, r.ToPort, r.Protocol)
+}
+
+// FormatRules returns the list representation of the rules ParseRules parses
+func FormatRules(rules []Rule) string {
+	s := make([]string, 0, len(rules))
+	for _, r := range rules {
+		s = append(s, r.String())
+	}
+	return strings.Join(s, ",")
+}
+
+// IsZero returns whether the policy lets any traffic through
+func (p *Policy) IsZero() bool {
+	return p == nil || (len(p.Allow) == 0 && len(p.Deny) == 0)
+}
+
+// args returns the iptables match of the rule
+func (r Rule) args() []string {
+	args := []string{"-d", r.Network.String()}
+	if r.Protocol != "" {
+		port := strconv.Itoa(int(r.FromPort))
+		if r.ToPort != r.FromPort {
+			port += ":" + strconv.Itoa(int(r.ToPort))
+		}
+		args = append(args, "-p", r.Protocol, "--dport", port)
+	}
+	return args
+}
+
+// Compile returns the rules of the iptables chain enforcing the policy for
+// the IPv4, or IPv6, traffic leaving the network. The chain returns the
+// traffic it lets through to the calling chain. The replies of the
+// connections established to the endpoints are let through. When the policy
+// allows destinations of the family, the other ones of the family are dropped.
+func (p *Policy) Compile(ipv6 bool) [][]string {
+	var (
+		compiled = [][]string{{"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "RETURN"}}
+		allowed  bool
+	)
+	for _, l := range []struct {
+		rules  []Rule
+		target string
+	}{{p.Deny, "DROP"}, {p.Allow, "RETURN"}} {
+		for _, r := range l.rules {
+			if (r.Network.IP.To4() == nil) != ipv6 {
+				continue
+			}
+			compiled = append(compiled, append(r.args(), "-j", l.target))
+			allowed = allowed || l.target == "RETURN"
+		}
+	}
+	if allowed {
+		compiled = append(compiled, []string{"-j", "DROP"})
+	}
+	return compiled
+}
@@ -0,0 +1,77 @@
+package egress
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	for _, invalid := range []string{
+		"",
+		"10.0.0.1",
+		"10.0.0.0/8=443",
+		"10.0.0.0/8=443/icmp",
+		"10.0.0.0/8=0/tcp",
+		"10.0.0.0/8=90-80/tcp",
+		"2001:db8::/32=http/tcp",
+	} {
+		if _, err := ParseRules(invalid); err == nil {
+			t.Fatalf("Expected an error parsing %q", invalid)
+		}
+	}
+
+	value := "10.0.0.0/8,192.0.2.10/32=443/tcp, 2001:db8::/32=8000-8080/udp"
+	rules, err := ParseRules(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 || rules[2].FromPort != 8000 || rules[2].ToPort != 8080 || rules[2].Protocol != "udp" {
+		t.Fatalf("Unexpected rules %v", rules)
+	}
+	if s := FormatRules(rules); s != strings.Replace(value, " ", "", -1) {
+		t.Fatalf("Unexpected representation %s", s)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	allow, _ := ParseRules("192.0.2.10/32=443/tcp,2001:db8::/32")
+	deny, _ := ParseRules("169.254.169.254/32")
+	p := &Policy{Allow: allow, Deny: deny}
+
+	compile := func(ipv6 bool) []string {
+		var rules []string
+		for _, r := range p.Compile(ipv6) {
+			rules = append(rules, strings.Join(r, " "))
+		}
+		return rules
+	}
+
+	expected := []string{
+		"-m conntrack --ctstate RELATED,ESTABLISHED -j RETURN",
+		"-d 169.254.169.254/32 -j DROP",
+		"-d 192.0.2.10/32 -p tcp --dport 443 -j RETURN",
+		"-j DROP",
+	}
+	if rules := compile(false); !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("Unexpected IPv4 rules:\n%s", strings.Join(rules, "\n"))
+	}
+
+	expected = []string{
+		"-m conntrack --ctstate RELATED,ESTABLISHED -j RETURN",
+		"-d 2001:db8::/32 -j RETURN",
+		"-j DROP",
+	}
+	if rules := compile(true); !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("Unexpected IPv6 rules:\n%s", strings.Join(rules, "\n"))
+	}
+
+	allow4, _ := ParseRules("192.0.2.10/32")
+	if rules := (&Policy{Allow: allow4}).Compile(true); len(rules) != 1 {
+		t.Fatalf("Expected no default drop rule without allowed IPv6 destinations: %v", rules)
+	}
+
+	if (&Policy{Deny: deny}).Compile(false)[1][0] != "-d" || len((&Policy{Deny: deny}).Compile(false)) != 2 {
+		t.Fatal("Expected no default drop rule without allowed destinations")
+	}
+}
@@ -0,0 +1,140 @@
+package libnetwork
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/docker/libnetwork/diagnostic"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/internal/caller"
+	"github.com/docker/libnetwork/types"
+	"github.com/hashicorp/go-multierror"
+	"github.com/sirupsen/logrus"
+)
+
+var encryptionPaths2Func = map[string]diagnostic.HTTPHandlerFunc{
+	"/encryption":       encryptionState,
+	"/encryption/rekey": encryptionRekey,
+}
+
+func (c *controller) EncryptionState() map[string]types.EncryptionState {
+	states := make(map[string]types.EncryptionState)
+	c.drvRegistry.WalkDrivers(func(name string, driver driverapi.Driver, capability driverapi.Capability) bool {
+		if i, ok := driver.(driverapi.EncryptionInspector); ok {
+			states[name] = i.EncryptionState()
+		}
+		return false
+	})
+	return states
+}
+
+func (c *controller) RekeyEncryption(node string) error {
+	var err error
+	c.drvRegistry.WalkDrivers(func(name string, driver driverapi.Driver, capability driverapi.Capability) bool {
+		if i, ok := driver.(driverapi.EncryptionInspector); ok {
+			logrus.Infof("Reprogramming datapath encryption of driver %s with node %q", name, node)
+			if e := i.Rekey(node); e != nil {
+				err = multierror.Append(err, fmt.Errorf("driver %s: %v", name, e))
+			}
+		}
+		return false
+	})
+	return err
+}
+
+// encryptionResult returns the datapath keys of the key ring, sorted by
+// creation time, along with the encryption state of the drivers.
+func (c *controller) encryptionResult() *diagnostic.EncryptionResult {
+	c.Lock()
+	keys := make([]*types.EncryptionKey, 0, len(c.keys))
+	for _, k := range c.keys {
+		if k.Subsystem == subsysIPSec {
+			keys = append(keys, k)
+		}
+	}
+	c.Unlock()
+	sort.Sort(ByTime(keys))
+
+	rsp := &diagnostic.EncryptionResult{}
+	for i, k := range keys {
+		rsp.Keys = append(rsp.Keys, diagnostic.EncryptionKeyObj{
+			LamportTime: k.LamportTime,
+			Tag:         uint32(k.LamportTime),
+			// Like getPrimaryKeyTag, the second oldest key is the primary
+			Primary: i == 1,
+		})
+	}
+
+	states := c.EncryptionState()
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		st := states[name]
+		d := diagnostic.EncryptionDriverObj{Name: name, KeyTags: st.KeyTags}
+		for _, p := range st.Peers {
+			po := diagnostic.EncryptionPeerObj{Node: p.Node, Backend: p.Backend, InSync: p.InSync}
+			for _, s := range p.SPIs {
+				po.SPIs = append(po.SPIs, fmt.Sprintf("0x%x/0x%x", s.Forward, s.Reverse))
+			}
+			d.Peers = append(d.Peers, po)
+		}
+		rsp.Drivers = append(rsp.Drivers, d)
+	}
+	return rsp
+}
+
+func encryptionState(ctx interface{}, w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	diagnostic.DebugHTTPForm(r)
+	_, json := diagnostic.ParseHTTPFormOptions(r)
+
+	// audit logs
+	log := logrus.WithFields(logrus.Fields{"component": "diagnostic", "remoteIP": r.RemoteAddr, "method": caller.Name(0), "url": r.URL.String()})
+	log.Info("encryption state")
+
+	c, ok := ctx.(*controller)
+	if !ok {
+		diagnostic.HTTPReply(w, diagnostic.FailCommand(fmt.Errorf("network controller not available")), json)
+		return
+	}
+
+	rsp := c.encryptionResult()
+	log.WithField("response", fmt.Sprintf("%+v", rsp)).Info("encryption state done")
+	diagnostic.HTTPReply(w, diagnostic.CommandSucceed(rsp), json)
+}
+
+func encryptionRekey(ctx interface{}, w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	diagnostic.DebugHTTPForm(r)
+	_, json := diagnostic.ParseHTTPFormOptions(r)
+
+	// audit logs
+	log := logrus.WithFields(logrus.Fields{"component": "diagnostic", "remoteIP": r.RemoteAddr, "method": caller.Name(0), "url": r.URL.String()})
+	log.Info("encryption rekey")
+
+	c, ok := ctx.(*controller)
+	if !ok {
+		diagnostic.HTTPReply(w, diagnostic.FailCommand(fmt.Errorf("network controller not available")), json)
+		return
+	}
+
+	node := r.Form.Get("node")
+	if _, all := r.Form["all"]; node == "" && !all {
+		diagnostic.HTTPReply(w, diagnostic.WrongCommand("missing node", fmt.Sprintf("%s?node=<node address> or %s?all", r.URL.Path, r.URL.Path)), json)
+		return
+	}
+
+	if err := c.RekeyEncryption(node); err != nil {
+		log.WithError(err).Error("encryption rekey failed")
+		diagnostic.HTTPReply(w, diagnostic.FailCommand(err), json)
+		return
+	}
+
+	rsp := c.encryptionResult()
+	log.WithField("response", fmt.Sprintf("%+v", rsp)).Info("encryption rekey done")
+	diagnostic.HTTPReply(w, diagnostic.CommandSucceed(rsp), json)
+}
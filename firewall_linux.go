@@ -1,6 +1,7 @@
 package libnetwork
 
 import (
+	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/iptables"
 	"github.com/sirupsen/logrus"
 )
@@ -44,3 +45,63 @@ func arrangeUserFilterRule() {
 		logrus.Warnf("Failed to ensure the jump rule for %s: %v", userChain, err)
 	}
 }
+
+// ruleOwners holds the endpoints of the local-scope networks found in the
+// store, by network, nil when they could not be read.
+type ruleOwners map[string]map[string]bool
+
+// stale returns whether the rules of the owner are stale. The networks which
+// are not in the local store, as the swarm ones restored once the cluster is
+// joined, are unknown: their rules are kept.
+func (r ruleOwners) stale(o iptables.Owner) bool {
+	endpoints := r[o.NetworkID]
+	if endpoints == nil {
+		return false
+	}
+	return o.EndpointID != "" && !endpoints[o.EndpointID]
+}
+
+// sweepStaleRules removes the iptables rules tagged with an endpoint of a
+// local-scope network which no longer exists, as left behind when the daemon
+// is not stopped gracefully.
+func sweepStaleRules(c *controller) {
+	if !c.iptablesEnabled() {
+		return
+	}
+
+	owners := make(ruleOwners)
+	for _, n := range c.getNetworksFromStore() {
+		if n.Scope() != datastore.LocalScope {
+			continue
+		}
+		epl, err := n.getEndpointsFromStore()
+		if err != nil {
+			// Do not judge the endpoint rules of this network
+			continue
+		}
+		endpoints := make(map[string]bool, len(epl))
+		for _, ep := range epl {
+			endpoints[ep.ID()] = true
+		}
+		owners[n.ID()] = endpoints
+	}
+
+	for _, version := range []iptables.IPVersion{iptables.IPv4, iptables.IPv6} {
+		iptable := iptables.GetIptable(version)
+		rules, err := iptable.OwnedRules(iptables.Nat, iptables.Filter, iptables.Mangle)
+		if err != nil {
+			logrus.Debugf("Could not list the %s rules to sweep: %v", version, err)
+			continue
+		}
+		tx := iptable.NewTransaction()
+		for _, r := range rules {
+			if owners.stale(r.Owner) {
+				logrus.Infof("Removing stale %s rule of network %s endpoint %s: %v", version, r.Owner.NetworkID, r.Owner.EndpointID, r.Args)
+				tx.Queue(r.Table, r.Chain, iptables.Delete, r.Args...)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			logrus.Warnf("Failed to remove the stale %s rules: %v", version, err)
+		}
+	}
+}
@@ -5,3 +5,4 @@ package libnetwork
 
 func setupArrangeUserFilterRule(c *controller) {}
 func arrangeUserFilterRule()                   {}
+func sweepStaleRules(c *controller)            {}
@@ -5,9 +5,11 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/docker/libnetwork/config"
 	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/types"
 	"gotest.tools/v3/assert"
 )
 
@@ -101,3 +103,29 @@ func resetIptables(t *testing.T) {
 	assert.NilError(t, err)
 	_ = iptable.RemoveExistingChain(usrChainName, "")
 }
+
+func TestOverlayNftables(t *testing.T) {
+	c := &controller{cfg: &config.Config{Daemon: config.DaemonCfg{DriverCfg: map[string]interface{}{
+		"bridge": map[string]interface{}{netlabel.GenericData: options.Generic{"FirewallBackend": "nftables"}},
+	}}}}
+
+	_, err := c.NewNetwork("overlay", "testovl", "")
+	_, ok := err.(types.NotImplementedError)
+	assert.Check(t, ok, "expected a not implemented error creating an overlay network, got %v", err)
+
+	err = c.agentSetup(nil)
+	_, ok = err.(types.NotImplementedError)
+	assert.Check(t, ok, "expected a not implemented error joining a cluster, got %v", err)
+}
+
+func TestStaleRuleOwners(t *testing.T) {
+	owners := ruleOwners{"n1": {"e1": true}}
+
+	assert.Check(t, !owners.stale(iptables.Owner{NetworkID: "n1"}))
+	assert.Check(t, !owners.stale(iptables.Owner{NetworkID: "n1", EndpointID: "e1"}))
+	assert.Check(t, owners.stale(iptables.Owner{NetworkID: "n1", EndpointID: "e2"}))
+	// The networks which are not in the local store, as the swarm ones, are
+	// unknown
+	assert.Check(t, !owners.stale(iptables.Owner{NetworkID: "n2"}))
+	assert.Check(t, !owners.stale(iptables.Owner{NetworkID: "n2", EndpointID: "e1"}))
+}
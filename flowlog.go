@@ -0,0 +1,123 @@
+package libnetwork
+
+import (
+	"net"
+	"sync"
+
+	"github.com/docker/libnetwork/flowlog"
+)
+
+// flowOwner is the endpoint, and the container, an address of a network
+// belongs to
+type flowOwner struct {
+	endpointID  string
+	containerID string
+}
+
+// flowNetwork holds the owners of the addresses of a network by address
+type flowNetwork struct {
+	id     string
+	owners map[string]flowOwner
+}
+
+// flowIndex holds the addresses of the endpoints joined to the sandboxes, by
+// network short ID, so that the logged packets are attributed without walking
+// the sandboxes.
+type flowIndex struct {
+	sync.RWMutex
+	networks map[string]*flowNetwork
+}
+
+// setupFlowLog routes the flow records of the networks to the configured
+// sink, attributing them to the endpoints of the containers.
+func (c *controller) setupFlowLog() {
+	flowlog.SetSink(c.cfg.Daemon.FlowLogSink)
+	flowlog.SetResolver(c.resolveFlow)
+}
+
+// resolveFlow returns the network, endpoint and container owning the address
+// on the network the short ID of which is nid
+func (c *controller) resolveFlow(nid string, ip net.IP) (string, string, string) {
+	return c.flows.lookup(nid, ip)
+}
+
+// flowAddresses returns the network ID and the addresses of the endpoint
+func flowAddresses(ep *endpoint) (string, []net.IP) {
+	ep.Lock()
+	defer ep.Unlock()
+
+	if ep.network == nil || ep.iface == nil {
+		return "", nil
+	}
+	var ips []net.IP
+	for _, addr := range []*net.IPNet{ep.iface.addr, ep.iface.addrv6} {
+		if addr != nil {
+			ips = append(ips, addr.IP)
+		}
+	}
+	return ep.network.id, ips
+}
+
+// add indexes the addresses of the endpoint joined to the container
+func (fi *flowIndex) add(ep *endpoint, containerID string) {
+	nid, ips := flowAddresses(ep)
+	if len(ips) == 0 {
+		return
+	}
+	short := flowlog.ShortID(nid)
+
+	fi.Lock()
+	defer fi.Unlock()
+
+	if fi.networks == nil {
+		fi.networks = make(map[string]*flowNetwork)
+	}
+	fn, ok := fi.networks[short]
+	if !ok {
+		fn = &flowNetwork{id: nid, owners: make(map[string]flowOwner)}
+		fi.networks[short] = fn
+	}
+	for _, ip := range ips {
+		fn.owners[ip.String()] = flowOwner{endpointID: ep.ID(), containerID: containerID}
+	}
+}
+
+// remove drops the addresses of the endpoint from the index, unless they were
+// taken over by another endpoint meanwhile
+func (fi *flowIndex) remove(ep *endpoint) {
+	nid, ips := flowAddresses(ep)
+	if len(ips) == 0 {
+		return
+	}
+	short := flowlog.ShortID(nid)
+
+	fi.Lock()
+	defer fi.Unlock()
+
+	fn, ok := fi.networks[short]
+	if !ok {
+		return
+	}
+	for _, ip := range ips {
+		if o, ok := fn.owners[ip.String()]; ok && o.endpointID == ep.ID() {
+			delete(fn.owners, ip.String())
+		}
+	}
+	if len(fn.owners) == 0 {
+		delete(fi.networks, short)
+	}
+}
+
+// lookup returns the network, endpoint and container owning the address on
+// the network with the given short ID
+func (fi *flowIndex) lookup(nid string, ip net.IP) (string, string, string) {
+	fi.RLock()
+	defer fi.RUnlock()
+
+	fn, ok := fi.networks[nid]
+	if !ok {
+		return "", "", ""
+	}
+	o := fn.owners[ip.String()]
+	return fn.id, o.endpointID, o.containerID
+}
@@ -0,0 +1,201 @@
+// Package flowlog turns the packets the network drivers log to NFLOG into
+// flow records, and hands them to a pluggable sink.
+package flowlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Group is the NFLOG group the drivers log the flows of the networks to
+const Group = 2048
+
+const (
+	// VerdictAccept is the verdict of the first packet of an accepted connection
+	VerdictAccept = "accept"
+	// VerdictDrop is the verdict of a dropped packet
+	VerdictDrop = "drop"
+)
+
+// Record describes a connection, or a dropped packet, of an endpoint
+type Record struct {
+	Time        time.Time
+	Verdict     string
+	NetworkID   string
+	EndpointID  string
+	ContainerID string
+	Protocol    string
+	SrcIP       net.IP
+	SrcPort     uint16
+	DstIP       net.IP
+	DstPort     uint16
+}
+
+func (r Record) String() string {
+	return fmt.Sprintf("%s %s %s:%d -> %s:%d", r.Verdict, r.Protocol, r.SrcIP, r.SrcPort, r.DstIP, r.DstPort)
+}
+
+// Sink receives the flow records
+type Sink interface {
+	Write(r Record) error
+}
+
+// Resolver returns the network, endpoint and container owning the address
+// on the network the ID of which starts with nid. The IDs are empty when
+// the address is not one of an endpoint of the network.
+type Resolver func(nid string, ip net.IP) (networkID, endpointID, containerID string)
+
+// LogSink writes the flow records to the daemon log
+type LogSink struct{}
+
+// Write logs the record
+func (LogSink) Write(r Record) error {
+	logrus.WithFields(logrus.Fields{
+		"network":   r.NetworkID,
+		"endpoint":  r.EndpointID,
+		"container": r.ContainerID,
+		"verdict":   r.Verdict,
+		"proto":     r.Protocol,
+		"src":       net.JoinHostPort(r.SrcIP.String(), fmt.Sprint(r.SrcPort)),
+		"dst":       net.JoinHostPort(r.DstIP.String(), fmt.Sprint(r.DstPort)),
+	}).Info("flow")
+	return nil
+}
+
+var (
+	mu       sync.RWMutex
+	sink     Sink = LogSink{}
+	resolver Resolver
+)
+
+// SetSink sets the sink of the flow records, nil restores the default one
+func SetSink(s Sink) {
+	if s == nil {
+		s = LogSink{}
+	}
+	mu.Lock()
+	sink = s
+	mu.Unlock()
+}
+
+// SetResolver sets the resolver of the endpoints the flows belong to
+func SetResolver(r Resolver) {
+	mu.Lock()
+	resolver = r
+	mu.Unlock()
+}
+
+// Prefix returns the NFLOG prefix of the rules logging the flows of the
+// network with the given verdict
+func Prefix(verdict, nid string) string {
+	return verdict + ":" + ShortID(nid)
+}
+
+// ShortID returns the network ID as carried by the NFLOG prefix
+func ShortID(nid string) string {
+	if len(nid) > 12 {
+		return nid[:12]
+	}
+	return nid
+}
+
+func parsePrefix(prefix string) (string, string, bool) {
+	parts := strings.SplitN(prefix, ":", 2)
+	if len(parts) != 2 || (parts[0] != VerdictAccept && parts[0] != VerdictDrop) || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// handle emits the record of a logged packet
+func handle(prefix string, payload []byte) {
+	verdict, nid, ok := parsePrefix(prefix)
+	if !ok {
+		return
+	}
+	r, err := parsePacket(payload)
+	if err != nil {
+		logrus.Debugf("flowlog: discarding packet of network %s: %v", nid, err)
+		return
+	}
+	r.Time = time.Now()
+	r.Verdict = verdict
+	r.NetworkID = nid
+
+	mu.RLock()
+	s, resolve := sink, resolver
+	mu.RUnlock()
+
+	if resolve != nil {
+		for _, ip := range []net.IP{r.SrcIP, r.DstIP} {
+			networkID, endpointID, containerID := resolve(nid, ip)
+			if networkID != "" {
+				r.NetworkID = networkID
+			}
+			if endpointID != "" {
+				r.EndpointID, r.ContainerID = endpointID, containerID
+				break
+			}
+		}
+	}
+
+	if err := s.Write(r); err != nil {
+		logrus.Warnf("flowlog: failed to write record %s: %v", r, err)
+	}
+}
+
+// parsePacket returns the record of the 5-tuple of an IPv4 or IPv6 packet.
+// The IPv6 extension headers are not walked.
+func parsePacket(b []byte) (Record, error) {
+	var (
+		r     Record
+		proto byte
+		l4    []byte
+	)
+	if len(b) == 0 {
+		return r, fmt.Errorf("empty packet")
+	}
+	switch b[0] >> 4 {
+	case 4:
+		ihl := int(b[0]&0x0f) * 4
+		if len(b) < 20 || ihl < 20 || len(b) < ihl {
+			return r, fmt.Errorf("short IPv4 packet")
+		}
+		proto = b[9]
+		r.SrcIP = net.IP(append([]byte(nil), b[12:16]...))
+		r.DstIP = net.IP(append([]byte(nil), b[16:20]...))
+		l4 = b[ihl:]
+	case 6:
+		if len(b) < 40 {
+			return r, fmt.Errorf("short IPv6 packet")
+		}
+		proto = b[6]
+		r.SrcIP = net.IP(append([]byte(nil), b[8:24]...))
+		r.DstIP = net.IP(append([]byte(nil), b[24:40]...))
+		l4 = b[40:]
+	default:
+		return r, fmt.Errorf("unknown IP version %d", b[0]>>4)
+	}
+
+	switch proto {
+	case 1:
+		r.Protocol = "icmp"
+	case 58:
+		r.Protocol = "icmpv6"
+	case 6, 17, 132:
+		r.Protocol = map[byte]string{6: "tcp", 17: "udp", 132: "sctp"}[proto]
+		if len(l4) >= 4 {
+			r.SrcPort = binary.BigEndian.Uint16(l4[0:2])
+			r.DstPort = binary.BigEndian.Uint16(l4[2:4])
+		}
+	default:
+		r.Protocol = fmt.Sprint(proto)
+	}
+	return r, nil
+}
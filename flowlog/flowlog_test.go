@@ -0,0 +1,80 @@
+package flowlog
+
+import (
+	"net"
+	"testing"
+)
+
+type recorder []Record
+
+func (r *recorder) Write(rec Record) error {
+	*r = append(*r, rec)
+	return nil
+}
+
+func TestParsePacket(t *testing.T) {
+	// IPv4 TCP 172.18.0.2:40000 -> 8.8.8.8:443
+	v4 := make([]byte, 24)
+	v4[0], v4[9] = 0x45, 6
+	copy(v4[12:], net.ParseIP("172.18.0.2").To4())
+	copy(v4[16:], net.ParseIP("8.8.8.8").To4())
+	v4[20], v4[21], v4[22], v4[23] = 0x9c, 0x40, 0x01, 0xbb
+
+	r, err := parsePacket(v4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Protocol != "tcp" || !r.SrcIP.Equal(net.ParseIP("172.18.0.2")) || r.SrcPort != 40000 ||
+		!r.DstIP.Equal(net.ParseIP("8.8.8.8")) || r.DstPort != 443 {
+		t.Fatalf("Unexpected record %s", r)
+	}
+
+	// IPv6 UDP 2001:db8::2:5353 -> 2001:db8::1:53
+	v6 := make([]byte, 48)
+	v6[0], v6[6] = 0x60, 17
+	copy(v6[8:], net.ParseIP("2001:db8::2"))
+	copy(v6[24:], net.ParseIP("2001:db8::1"))
+	v6[40], v6[41], v6[42], v6[43] = 0x14, 0xe9, 0x00, 0x35
+
+	if r, err = parsePacket(v6); err != nil {
+		t.Fatal(err)
+	}
+	if r.Protocol != "udp" || r.SrcPort != 5353 || r.DstPort != 53 || !r.DstIP.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("Unexpected record %s", r)
+	}
+
+	for _, invalid := range [][]byte{nil, {0x45, 0}, {0x20}, v6[:39]} {
+		if _, err := parsePacket(invalid); err == nil {
+			t.Fatalf("Expected an error parsing %v", invalid)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	var records recorder
+	SetSink(&records)
+	defer SetSink(nil)
+	SetResolver(func(nid string, ip net.IP) (string, string, string) {
+		if nid == "0123456789ab" && ip.Equal(net.ParseIP("8.8.8.8")) {
+			return "0123456789abcdef", "ep1", "c1"
+		}
+		return "", "", ""
+	})
+	defer SetResolver(nil)
+
+	payload := make([]byte, 28)
+	payload[0], payload[9] = 0x45, 17
+	copy(payload[12:], net.ParseIP("1.2.3.4").To4())
+	copy(payload[16:], net.ParseIP("8.8.8.8").To4())
+
+	handle(Prefix(VerdictDrop, "0123456789abcdef"), payload)
+	handle("unrelated prefix", payload)
+
+	if len(records) != 1 {
+		t.Fatalf("Expected one record, got %d", len(records))
+	}
+	r := records[0]
+	if r.Verdict != VerdictDrop || r.NetworkID != "0123456789abcdef" || r.EndpointID != "ep1" || r.ContainerID != "c1" {
+		t.Fatalf("Unexpected record %+v", r)
+	}
+}
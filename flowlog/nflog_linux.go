@@ -0,0 +1,195 @@
+package flowlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	nfulnlMsgPacket = 0
+	nfulnlMsgConfig = 1
+
+	nfulaPayload = 9
+	nfulaPrefix  = 10
+
+	nfulaCfgCmd  = 1
+	nfulaCfgMode = 2
+
+	nfulnlCfgCmdBind    = 1
+	nfulnlCopyPacket    = 2
+	nfulnlCopyRange     = 128
+	nlaTypeMask         = 0x3fff
+	nflogReceiveTimeout = 2 * time.Second
+)
+
+// nfgenmsg is the header of the nfnetlink messages
+type nfgenmsg struct {
+	family uint8
+	resID  uint16
+}
+
+func (m *nfgenmsg) Len() int {
+	return 4
+}
+
+func (m *nfgenmsg) Serialize() []byte {
+	b := []byte{m.family, 0, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], m.resID)
+	return b
+}
+
+type listener struct {
+	sock *nl.NetlinkSocket
+	ns   uint64
+	refs int
+}
+
+// subscription is a reference to the listener of a network namespace
+type subscription struct {
+	l    *listener
+	once sync.Once
+}
+
+var (
+	listenersMu sync.Mutex
+	// listeners by network namespace, as a group can be bound only once
+	listeners = map[uint64]*listener{}
+)
+
+// Listen binds the flow log NFLOG group in the network namespace of the
+// calling thread, and emits the records of the packets logged to it until
+// the returned closer is closed. The listener is shared by the callers in
+// the same network namespace.
+func Listen() (io.Closer, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()), &st); err != nil {
+		return nil, fmt.Errorf("failed to identify the network namespace: %v", err)
+	}
+
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	if l, ok := listeners[st.Ino]; ok {
+		l.refs++
+		return &subscription{l: l}, nil
+	}
+
+	sock, err := nl.Subscribe(unix.NETLINK_NETFILTER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the NFLOG socket: %v", err)
+	}
+	l := &listener{sock: sock, ns: st.Ino, refs: 1}
+
+	mode := make([]byte, 6)
+	binary.BigEndian.PutUint32(mode, nfulnlCopyRange)
+	mode[4] = nfulnlCopyPacket
+	for _, attr := range []*nl.RtAttr{
+		nl.NewRtAttr(nfulaCfgCmd, []byte{nfulnlCfgCmdBind}),
+		nl.NewRtAttr(nfulaCfgMode, mode),
+	} {
+		if err := l.configure(attr); err != nil {
+			sock.Close()
+			return nil, fmt.Errorf("failed to bind NFLOG group %d: %v", Group, err)
+		}
+	}
+
+	tv := unix.NsecToTimeval(nflogReceiveTimeout.Nanoseconds())
+	if err := sock.SetReceiveTimeout(&tv); err != nil {
+		sock.Close()
+		return nil, err
+	}
+
+	listeners[l.ns] = l
+	go l.receive()
+	return &subscription{l: l}, nil
+}
+
+// configure sends a configuration request for the group and waits for its
+// acknowledgement
+func (l *listener) configure(attr *nl.RtAttr) error {
+	req := nl.NewNetlinkRequest(unix.NFNL_SUBSYS_ULOG<<8|nfulnlMsgConfig, unix.NLM_F_ACK)
+	req.AddData(&nfgenmsg{family: unix.AF_UNSPEC, resID: Group})
+	req.AddData(attr)
+	if err := l.sock.Send(req); err != nil {
+		return err
+	}
+	for {
+		msgs, _, err := l.sock.Receive()
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != req.Seq || m.Header.Type != unix.NLMSG_ERROR {
+				continue
+			}
+			if errno := int32(nl.NativeEndian().Uint32(m.Data[0:4])); errno != 0 {
+				return unix.Errno(-errno)
+			}
+			return nil
+		}
+	}
+}
+
+// Close releases the listener, which stops when its last subscription is
+// closed
+func (s *subscription) Close() error {
+	s.once.Do(func() {
+		listenersMu.Lock()
+		defer listenersMu.Unlock()
+		if s.l.refs--; s.l.refs == 0 {
+			delete(listeners, s.l.ns)
+			s.l.sock.Close()
+		}
+	})
+	return nil
+}
+
+func (l *listener) receive() {
+	for {
+		msgs, _, err := l.sock.Receive()
+		if l.sock.GetFd() < 0 {
+			return
+		}
+		if err != nil {
+			switch err {
+			case unix.EAGAIN, unix.EINTR:
+			case unix.ENOBUFS:
+				logrus.Debug("flowlog: NFLOG socket overrun, records were lost")
+			default:
+				logrus.Errorf("flowlog: failed to receive from the NFLOG socket: %v", err)
+				return
+			}
+			continue
+		}
+		for _, m := range msgs {
+			if m.Header.Type != unix.NFNL_SUBSYS_ULOG<<8|nfulnlMsgPacket || len(m.Data) < 4 {
+				continue
+			}
+			var prefix string
+			var payload []byte
+			for b := m.Data[4:]; len(b) >= 4; {
+				alen := int(nl.NativeEndian().Uint16(b[0:2]))
+				if alen < 4 || alen > len(b) {
+					break
+				}
+				switch nl.NativeEndian().Uint16(b[2:4]) & nlaTypeMask {
+				case nfulaPrefix:
+					prefix = nl.BytesToString(append(b[4:alen:alen], 0))
+				case nfulaPayload:
+					payload = b[4:alen]
+				}
+				if alen = (alen + unix.NLA_ALIGNTO - 1) &^ (unix.NLA_ALIGNTO - 1); alen > len(b) {
+					break
+				}
+				b = b[alen:]
+			}
+			handle(prefix, payload)
+		}
+	}
+}
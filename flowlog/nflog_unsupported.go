@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package flowlog
+
+import (
+	"io"
+
+	"github.com/docker/libnetwork/types"
+)
+
+// Listen is not supported on this platform
+func Listen() (io.Closer, error) {
+	return nil, types.NotImplementedErrorf("flow logging is not supported on this platform")
+}
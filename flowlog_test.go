@@ -0,0 +1,51 @@
+package libnetwork
+
+import (
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/flowlog"
+	"gotest.tools/v3/assert"
+)
+
+func TestFlowIndex(t *testing.T) {
+	n := &network{id: "0123456789abcdef0123"}
+	newEndpoint := func(id, addr string) *endpoint {
+		ip := net.ParseIP(addr)
+		return &endpoint{id: id, network: n, iface: &endpointInterface{addr: &net.IPNet{IP: ip, Mask: net.CIDRMask(24, 32)}}}
+	}
+	ep1 := newEndpoint("ep1", "172.20.0.2")
+	ep2 := newEndpoint("ep2", "172.20.0.3")
+
+	c := &controller{}
+	c.flows.add(ep1, "c1")
+	c.flows.add(ep2, "c2")
+
+	short := flowlog.ShortID(n.id)
+	nid, eid, cid := c.resolveFlow(short, net.ParseIP("172.20.0.3"))
+	assert.Equal(t, nid, n.id)
+	assert.Equal(t, eid, "ep2")
+	assert.Equal(t, cid, "c2")
+
+	nid, eid, cid = c.resolveFlow(short, net.ParseIP("172.20.0.9"))
+	assert.Equal(t, nid, n.id)
+	assert.Equal(t, eid, "")
+	assert.Equal(t, cid, "")
+
+	nid, _, _ = c.resolveFlow("fedcba987654", net.ParseIP("172.20.0.3"))
+	assert.Equal(t, nid, "")
+
+	// The address taken over by another endpoint is kept on leave of the
+	// former owner.
+	ep3 := newEndpoint("ep3", "172.20.0.2")
+	c.flows.add(ep3, "c2")
+	c.flows.remove(ep1)
+	_, eid, cid = c.resolveFlow(short, net.ParseIP("172.20.0.2"))
+	assert.Equal(t, eid, "ep3")
+	assert.Equal(t, cid, "c2")
+
+	c.flows.remove(ep2)
+	c.flows.remove(ep3)
+	nid, _, _ = c.resolveFlow(short, net.ParseIP("172.20.0.2"))
+	assert.Equal(t, nid, "")
+}
@@ -32,6 +32,9 @@ type Allocator struct {
 	// Separate from the addrSpace because they should not be serialized
 	predefined             map[string][]*net.IPNet
 	predefinedStartIndices map[string]int
+	// Named predefined pools which networks can select through the
+	// ipamapi.DefaultPoolName option
+	named map[string][]*net.IPNet
 	// The (potentially serialized) address spaces
 	addrSpaces map[string]*addrSpace
 	// stores        []datastore.Datastore
@@ -50,6 +53,7 @@ func NewAllocator(lcDs, glDs datastore.DataStore) (*Allocator, error) {
 		localAddressSpace:  ipamutils.GetLocalScopeDefaultNetworks(),
 		globalAddressSpace: ipamutils.GetGlobalScopeDefaultNetworks(),
 	}
+	a.named = ipamutils.GetNamedDefaultNetworks()
 
 	// Initialize asIndices map
 	a.predefinedStartIndices = make(map[string]int)
@@ -206,6 +210,7 @@ func (a *Allocator) GetDefaultAddressSpaces() (string, string, error) {
 // RequestPool returns an address pool along with its unique id.
 // addressSpace must be a valid address space name and must not be the empty string.
 // If pool is the empty string then the default predefined pool for addressSpace will be used, otherwise pool must be a valid IP address and length in CIDR notation.
+// The ipamapi.DefaultPoolName option selects one of the named predefined pools in place of the address space default one.
 // If subPool is not empty, it must be a valid IP address and length in CIDR notation which is a sub-range of pool.
 // subPool must be empty if pool is empty.
 func (a *Allocator) RequestPool(addressSpace, pool, subPool string, options map[string]string, v6 bool) (string, *net.IPNet, map[string]string, error) {
@@ -220,7 +225,7 @@ func (a *Allocator) RequestPool(addressSpace, pool, subPool string, options map[
 
 retry:
 	if pdf {
-		if nw, err = a.getPredefinedPool(addressSpace, v6); err != nil {
+		if nw, err = a.getPredefinedPool(addressSpace, options[ipamapi.DefaultPoolName], v6); err != nil {
 			return "", nil, nil, err
 		}
 		k = &SubnetKey{AddressSpace: addressSpace, Subnet: nw.String()}
@@ -384,12 +389,30 @@ func (a *Allocator) retrieveBitmask(k SubnetKey, n *net.IPNet) (*bitseq.Handle,
 	return bm, nil
 }
 
-func (a *Allocator) getPredefineds(as string) []*net.IPNet {
+// predefinedKey returns the key identifying the predefined pool list
+// for the address space and, if not empty, the named pool
+func predefinedKey(as, name string) string {
+	if name == "" {
+		return as
+	}
+	return as + "/" + name
+}
+
+// predefinedList returns the predefined pools of the address space or, if name
+// is not empty, of the named pool. It must be called with the allocator locked.
+func (a *Allocator) predefinedList(as, name string) []*net.IPNet {
+	if name != "" {
+		return a.named[name]
+	}
+	return a.predefined[as]
+}
+
+func (a *Allocator) getPredefineds(as, name string) []*net.IPNet {
 	a.Lock()
 	defer a.Unlock()
 
-	p := a.predefined[as]
-	i := a.predefinedStartIndices[as]
+	p := a.predefinedList(as, name)
+	i := a.predefinedStartIndices[predefinedKey(as, name)]
 	// defensive in case the list changed since last update
 	if i >= len(p) {
 		i = 0
@@ -397,17 +420,18 @@ func (a *Allocator) getPredefineds(as string) []*net.IPNet {
 	return append(p[i:], p[:i]...)
 }
 
-func (a *Allocator) updateStartIndex(as string, amt int) {
+func (a *Allocator) updateStartIndex(as, name string, amt int) {
 	a.Lock()
-	i := a.predefinedStartIndices[as] + amt
-	if i < 0 || i >= len(a.predefined[as]) {
+	key := predefinedKey(as, name)
+	i := a.predefinedStartIndices[key] + amt
+	if i < 0 || i >= len(a.predefinedList(as, name)) {
 		i = 0
 	}
-	a.predefinedStartIndices[as] = i
+	a.predefinedStartIndices[key] = i
 	a.Unlock()
 }
 
-func (a *Allocator) getPredefinedPool(as string, ipV6 bool) (*net.IPNet, error) {
+func (a *Allocator) getPredefinedPool(as, name string, ipV6 bool) (*net.IPNet, error) {
 	var v ipVersion
 	v = v4
 	if ipV6 {
@@ -418,12 +442,21 @@ func (a *Allocator) getPredefinedPool(as string, ipV6 bool) (*net.IPNet, error)
 		return nil, types.NotImplementedErrorf("no default pool available for non-default address spaces")
 	}
 
+	if name != "" {
+		a.Lock()
+		_, ok := a.named[name]
+		a.Unlock()
+		if !ok {
+			return nil, types.NotFoundErrorf("default address pool %q is not configured", name)
+		}
+	}
+
 	aSpace, err := a.getAddrSpace(as)
 	if err != nil {
 		return nil, err
 	}
 
-	predefined := a.getPredefineds(as)
+	predefined := a.getPredefineds(as, name)
 
 	aSpace.Lock()
 	for i, nw := range predefined {
@@ -438,12 +471,15 @@ func (a *Allocator) getPredefinedPool(as string, ipV6 bool) (*net.IPNet, error)
 		// predefined pools overlap for any reason.
 		if !aSpace.contains(as, nw) {
 			aSpace.Unlock()
-			a.updateStartIndex(as, i+1)
+			a.updateStartIndex(as, name, i+1)
 			return nw, nil
 		}
 	}
 	aSpace.Unlock()
 
+	if name != "" {
+		return nil, types.NotFoundErrorf("could not find an available, non-overlapping IPv%d address pool in default pool %q to assign to the network", v, name)
+	}
 	return nil, types.NotFoundErrorf("could not find an available, non-overlapping IPv%d address pool among the defaults to assign to the network", v)
 }
 
@@ -562,6 +598,63 @@ func (a *Allocator) ReleaseAddress(poolID string, address net.IP) error {
 	return bm.Unset(ipToUint64(h))
 }
 
+// AllocatedAddresses returns the addresses currently marked as in use in the
+// bitmask backing the passed pool ID. For a sub pool this is the bitmask of the
+// master pool. The network and broadcast addresses are never returned.
+func (a *Allocator) AllocatedAddresses(poolID string) ([]net.IP, error) {
+	k := SubnetKey{}
+	if err := k.FromString(poolID); err != nil {
+		return nil, types.BadRequestErrorf("invalid pool id: %s", poolID)
+	}
+
+	if err := a.refresh(k.AddressSpace); err != nil {
+		return nil, err
+	}
+
+	aSpace, err := a.getAddrSpace(k.AddressSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	aSpace.Lock()
+	p, ok := aSpace.subnets[k]
+	if !ok {
+		aSpace.Unlock()
+		return nil, types.NotFoundErrorf("cannot find address pool for poolID:%s", poolID)
+	}
+
+	c := p
+	for c.Range != nil {
+		k = c.ParentKey
+		c = aSpace.subnets[k]
+	}
+	aSpace.Unlock()
+
+	bm, err := a.retrieveBitmask(k, c.Pool)
+	if err != nil {
+		return nil, types.InternalErrorf("could not find bitmask in datastore for %s on audit of pool %s: %v",
+			k.String(), poolID, err)
+	}
+
+	ordinals, err := bm.Selected()
+	if err != nil {
+		return nil, types.InternalErrorf("failed to read bitmask for %s: %v", k.String(), err)
+	}
+
+	base := types.GetIPNetCopy(c.Pool)
+	last := bm.Bits() - 1
+	ips := make([]net.IP, 0, len(ordinals))
+	for _, o := range ordinals {
+		// Skip the reserved network identifier and broadcast addresses
+		if o == 0 || (o == last && getAddressVersion(base.IP) == v4) {
+			continue
+		}
+		ips = append(ips, generateAddress(o, base))
+	}
+
+	return ips, nil
+}
+
 func (a *Allocator) getAddress(nw *net.IPNet, bitmask *bitseq.Handle, prefAddress net.IP, ipr *AddressRange, serial bool) (net.IP, error) {
 	var (
 		ordinal uint64
@@ -438,7 +438,7 @@ func TestPredefinedPool(t *testing.T) {
 		a, err := getAllocator(store)
 		assert.NilError(t, err)
 
-		if _, err := a.getPredefinedPool("blue", false); err == nil {
+		if _, err := a.getPredefinedPool("blue", "", false); err == nil {
 			t.Fatal("Expected failure for non default addr space")
 		}
 
@@ -447,7 +447,7 @@ func TestPredefinedPool(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		nw2, err := a.getPredefinedPool(localAddressSpace, false)
+		nw2, err := a.getPredefinedPool(localAddressSpace, "", false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -461,6 +461,44 @@ func TestPredefinedPool(t *testing.T) {
 	}
 }
 
+func TestNamedPredefinedPool(t *testing.T) {
+	for _, store := range []bool{false, true} {
+		a, err := getAllocator(store)
+		assert.NilError(t, err)
+
+		a.named = map[string][]*net.IPNet{
+			"dmz": {
+				{IP: net.IP{10, 99, 0, 0}, Mask: net.CIDRMask(24, 32)},
+				{IP: net.IP{10, 99, 1, 0}, Mask: net.CIDRMask(24, 32)},
+			},
+		}
+		opts := map[string]string{ipamapi.DefaultPoolName: "dmz"}
+
+		pid1, nw1, _, err := a.RequestPool(localAddressSpace, "", "", opts, false)
+		assert.NilError(t, err)
+		assert.Check(t, is.Equal(nw1.String(), "10.99.0.0/24"))
+
+		pid2, nw2, _, err := a.RequestPool(localAddressSpace, "", "", opts, false)
+		assert.NilError(t, err)
+		assert.Check(t, is.Equal(nw2.String(), "10.99.1.0/24"))
+
+		_, _, _, err = a.RequestPool(localAddressSpace, "", "", opts, false)
+		assert.Check(t, is.ErrorContains(err, `default pool "dmz"`))
+
+		_, _, _, err = a.RequestPool(localAddressSpace, "", "", map[string]string{ipamapi.DefaultPoolName: "tenant-a"}, false)
+		assert.Check(t, is.ErrorContains(err, `default address pool "tenant-a" is not configured`))
+
+		// The address space default pools are not affected
+		pid3, nw3, _, err := a.RequestPool(localAddressSpace, "", "", nil, false)
+		assert.NilError(t, err)
+		assert.Check(t, !a.named["dmz"][0].Contains(nw3.IP) && !a.named["dmz"][1].Contains(nw3.IP))
+
+		for _, pid := range []string{pid1, pid2, pid3} {
+			assert.NilError(t, a.ReleasePool(pid))
+		}
+	}
+}
+
 func TestRemoveSubnet(t *testing.T) {
 	for _, store := range []bool{false, true} {
 		a, err := getAllocator(store)
@@ -1123,6 +1161,39 @@ func TestRelease(t *testing.T) {
 	}
 }
 
+func TestAllocatedAddresses(t *testing.T) {
+	for _, store := range []bool{false, true} {
+		a, err := getAllocator(store)
+		assert.NilError(t, err)
+
+		pid, _, _, err := a.RequestPool(localAddressSpace, "172.28.0.0/16", "172.28.30.0/24", nil, false)
+		assert.NilError(t, err)
+
+		ips, err := a.AllocatedAddresses(pid)
+		assert.NilError(t, err)
+		assert.Check(t, is.Len(ips, 0))
+
+		_, _, err = a.RequestAddress(pid, net.ParseIP("172.28.0.1"), nil)
+		assert.NilError(t, err)
+		nw, _, err := a.RequestAddress(pid, nil, nil)
+		assert.NilError(t, err)
+
+		ips, err = a.AllocatedAddresses(pid)
+		assert.NilError(t, err)
+		assert.Check(t, is.Len(ips, 2))
+		assert.Check(t, ips[0].Equal(net.ParseIP("172.28.0.1")))
+		assert.Check(t, ips[1].Equal(nw.IP))
+
+		assert.NilError(t, a.ReleaseAddress(pid, net.ParseIP("172.28.0.1")))
+		ips, err = a.AllocatedAddresses(pid)
+		assert.NilError(t, err)
+		assert.Check(t, is.Len(ips, 1))
+
+		_, err = a.AllocatedAddresses("LocalDefault/10.0.0.0/8")
+		assert.Check(t, is.ErrorContains(err, "cannot find address pool"))
+	}
+}
+
 func assertGetAddress(t *testing.T, subnet string) {
 	var (
 		err       error
@@ -0,0 +1,214 @@
+package libnetwork
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/docker/libnetwork/diagnostic"
+	"github.com/docker/libnetwork/internal/caller"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/sirupsen/logrus"
+)
+
+var ipamAuditPaths2Func = map[string]diagnostic.HTTPHandlerFunc{
+	"/ipamaudit": ipamAudit,
+}
+
+// ipamUse maps the addresses in use on a network to their owner
+type ipamUse map[string]string
+
+// auditIPAM compares the addresses marked as allocated by the IPAM drivers
+// with the addresses actually in use by the networks gateways, auxiliary
+// addresses and endpoints, including the endpoints known only through the
+// global datastore. When release is true, addresses allocated but not in use
+// are released and addresses in use but not allocated are reserved again.
+func (c *controller) auditIPAM(release bool) *diagnostic.IPAMAuditResult {
+	res := &diagnostic.IPAMAuditResult{}
+
+	networks := c.getNetworksFromStore()
+
+	// Networks sharing a master pool share the same allocation bitmask,
+	// so an address can only be considered leaked if no network uses it.
+	inUse := make(map[string]ipamUse)
+	for _, n := range networks {
+		if n.ConfigOnly() || n.hasSpecialDriver() {
+			continue
+		}
+		use, err := n.ipamUse()
+		if err != nil {
+			logrus.Warnf("IPAM audit could not retrieve the addresses in use on network %s (%s): %v", n.Name(), n.ID(), err)
+			continue
+		}
+		k := n.ipamAuditKey()
+		if _, ok := inUse[k]; !ok {
+			inUse[k] = make(ipamUse)
+		}
+		for ip, owner := range use {
+			inUse[k][ip] = owner
+		}
+	}
+
+	reported := make(map[string]bool)
+	for _, n := range networks {
+		if n.ConfigOnly() || n.hasSpecialDriver() {
+			continue
+		}
+		if err := c.auditNetworkIPAM(n, inUse[n.ipamAuditKey()], reported, release, res); err != nil {
+			logrus.Warnf("IPAM audit failed for network %s (%s): %v", n.Name(), n.ID(), err)
+		}
+	}
+
+	for _, e := range res.Leaked {
+		logrus.Warnf("IPAM audit: address %s of network %s is allocated in pool %s but not in use (released: %t)",
+			e.Address, e.Network, e.PoolID, e.Repaired)
+	}
+	for _, e := range res.Missing {
+		logrus.Warnf("IPAM audit: address %s of network %s is used by %s but not allocated in pool %s (reserved: %t)",
+			e.Address, e.Network, e.Owner, e.PoolID, e.Repaired)
+	}
+
+	return res
+}
+
+func (c *controller) auditNetworkIPAM(n *network, others ipamUse, reported map[string]bool, release bool, res *diagnostic.IPAMAuditResult) error {
+	ipam, _, err := c.getIPAMDriver(n.ipamType)
+	if err != nil {
+		return err
+	}
+	auditor, ok := ipam.(ipamapi.Auditor)
+	if !ok {
+		return nil
+	}
+
+	// Prevent endpoints from being created while we compare the states
+	c.networkLocker.Lock(n.id)
+	defer c.networkLocker.Unlock(n.id)
+
+	n, err = c.getNetworkFromStore(n.id)
+	if err != nil {
+		return err
+	}
+
+	use, err := n.ipamUse()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range append(n.getIPInfo(4), n.getIPInfo(6)...) {
+		allocated, err := auditor.AllocatedAddresses(d.PoolID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve allocated addresses for pool %s: %v", d.PoolID, err)
+		}
+
+		allocSet := make(map[string]bool, len(allocated))
+		for _, ip := range allocated {
+			allocSet[ip.String()] = true
+			if _, ok := use[ip.String()]; ok {
+				continue
+			}
+			if _, ok := others[ip.String()]; ok {
+				continue
+			}
+			key := n.ipamAuditKey() + "/" + ip.String()
+			if reported[key] {
+				continue
+			}
+			reported[key] = true
+
+			e := diagnostic.IPAMAuditEntryObj{Network: n.ID(), PoolID: d.PoolID, Address: ip.String()}
+			if release {
+				if err := ipam.ReleaseAddress(d.PoolID, ip); err != nil {
+					logrus.Warnf("IPAM audit failed to release leaked address %s from pool %s: %v", ip, d.PoolID, err)
+				} else {
+					e.Repaired = true
+				}
+			}
+			res.Leaked = append(res.Leaked, e)
+		}
+
+		for ip, owner := range use {
+			addr := net.ParseIP(ip)
+			if !d.Pool.Contains(addr) || allocSet[ip] {
+				continue
+			}
+
+			e := diagnostic.IPAMAuditEntryObj{Network: n.ID(), PoolID: d.PoolID, Address: ip, Owner: owner}
+			if release {
+				if _, _, err := ipam.RequestAddress(d.PoolID, addr, nil); err != nil {
+					logrus.Warnf("IPAM audit failed to reserve address %s in pool %s: %v", ip, d.PoolID, err)
+				} else {
+					e.Repaired = true
+				}
+			}
+			res.Missing = append(res.Missing, e)
+		}
+	}
+
+	return nil
+}
+
+// ipamAuditKey identifies the IPAM allocation domain the network belongs to
+func (n *network) ipamAuditKey() string {
+	n.Lock()
+	defer n.Unlock()
+	return n.ipamType + "/" + n.addrSpace
+}
+
+// ipamUse returns the addresses the network and its endpoints are using
+func (n *network) ipamUse() (ipamUse, error) {
+	use := make(ipamUse)
+
+	for _, d := range append(n.getIPInfo(4), n.getIPInfo(6)...) {
+		if d.Gateway != nil {
+			use[d.Gateway.IP.String()] = netlabel.Gateway
+		}
+		for k, aux := range d.AuxAddresses {
+			if aux != nil {
+				use[aux.IP.String()] = "aux-address " + k
+			}
+		}
+	}
+
+	epl, err := n.getEndpointsFromStore()
+	if err != nil {
+		return nil, err
+	}
+	for _, ep := range epl {
+		iface := ep.Iface()
+		if iface == nil {
+			continue
+		}
+		owner := fmt.Sprintf("endpoint %s (%s)", ep.Name(), ep.ID())
+		if addr := iface.Address(); addr != nil {
+			use[addr.IP.String()] = owner
+		}
+		if addr := iface.AddressIPv6(); addr != nil {
+			use[addr.IP.String()] = owner
+		}
+	}
+
+	return use, nil
+}
+
+func ipamAudit(ctx interface{}, w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	diagnostic.DebugHTTPForm(r)
+	_, json := diagnostic.ParseHTTPFormOptions(r)
+
+	// audit logs
+	log := logrus.WithFields(logrus.Fields{"component": "diagnostic", "remoteIP": r.RemoteAddr, "method": caller.Name(0), "url": r.URL.String()})
+	log.Info("ipam audit")
+
+	c, ok := ctx.(*controller)
+	if !ok {
+		diagnostic.HTTPReply(w, diagnostic.FailCommand(fmt.Errorf("network controller not available")), json)
+		return
+	}
+
+	_, release := r.Form["release"]
+	rsp := c.auditIPAM(release)
+	log.WithField("response", fmt.Sprintf("%+v", rsp)).Info("ipam audit done")
+	diagnostic.HTTPReply(w, diagnostic.CommandSucceed(rsp), json)
+}
@@ -85,6 +85,14 @@ type Ipam interface {
 	IsBuiltIn() bool
 }
 
+// Auditor is an optional interface an IPAM driver can implement to let
+// libnetwork compare the driver's allocation state with the addresses in use.
+type Auditor interface {
+	// AllocatedAddresses returns the addresses currently marked as allocated
+	// in the address pool backing the passed pool ID
+	AllocatedAddresses(poolID string) ([]net.IP, error)
+}
+
 // Capability represents the requirements and capabilities of the IPAM driver
 type Capability struct {
 	// Whether on address request, libnetwork must
@@ -7,4 +7,8 @@ const (
 	// AllocSerialPrefix constant marks the reserved label space for libnetwork ipam
 	// allocation ordering.(serial/first available)
 	AllocSerialPrefix = Prefix + ".ipam.serial"
+
+	// DefaultPoolName constant marks the option used to select one of the
+	// named default address pools for the automatic pool allocation
+	DefaultPoolName = Prefix + ".ipam.pool"
 )
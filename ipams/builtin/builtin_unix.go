@@ -15,6 +15,8 @@ import (
 var (
 	// defaultAddressPool Stores user configured subnet list
 	defaultAddressPool []*ipamutils.NetworkToSplit
+	// namedAddressPools Stores user configured named subnet lists
+	namedAddressPools map[string][]*ipamutils.NetworkToSplit
 )
 
 // Init registers the built-in ipam service with libnetwork
@@ -41,6 +43,10 @@ func Init(ic ipamapi.Callback, l, g interface{}) error {
 		return err
 	}
 
+	if err := ipamutils.ConfigNamedDefaultNetworks(GetNamedAddressPools()); err != nil {
+		return err
+	}
+
 	a, err := ipam.NewAllocator(localDs, globalDs)
 	if err != nil {
 		return err
@@ -60,3 +66,13 @@ func SetDefaultIPAddressPool(addressPool []*ipamutils.NetworkToSplit) {
 func GetDefaultIPAddressPool() []*ipamutils.NetworkToSplit {
 	return defaultAddressPool
 }
+
+// SetNamedAddressPools stores the named default address pools.
+func SetNamedAddressPools(addressPools map[string][]*ipamutils.NetworkToSplit) {
+	namedAddressPools = addressPools
+}
+
+// GetNamedAddressPools returns the named default address pools.
+func GetNamedAddressPools() map[string][]*ipamutils.NetworkToSplit {
+	return namedAddressPools
+}
@@ -17,6 +17,8 @@ import (
 var (
 	// defaultAddressPool Stores user configured subnet list
 	defaultAddressPool []*ipamutils.NetworkToSplit
+	// namedAddressPools Stores user configured named subnet lists
+	namedAddressPools map[string][]*ipamutils.NetworkToSplit
 )
 
 // InitDockerDefault registers the built-in ipam service with libnetwork
@@ -40,6 +42,10 @@ func InitDockerDefault(ic ipamapi.Callback, l, g interface{}) error {
 
 	ipamutils.ConfigLocalScopeDefaultNetworks(nil)
 
+	if err := ipamutils.ConfigNamedDefaultNetworks(GetNamedAddressPools()); err != nil {
+		return err
+	}
+
 	a, err := ipam.NewAllocator(localDs, globalDs)
 	if err != nil {
 		return err
@@ -71,3 +77,13 @@ func SetDefaultIPAddressPool(addressPool []*ipamutils.NetworkToSplit) {
 func GetDefaultIPAddressPool() []*ipamutils.NetworkToSplit {
 	return defaultAddressPool
 }
+
+// SetNamedAddressPools stores the named default address pools .
+func SetNamedAddressPools(addressPools map[string][]*ipamutils.NetworkToSplit) {
+	namedAddressPools = addressPools
+}
+
+// GetNamedAddressPools returns the named default address pools .
+func GetNamedAddressPools() map[string][]*ipamutils.NetworkToSplit {
+	return namedAddressPools
+}
@@ -19,6 +19,8 @@ var (
 		{"172.20.0.0/14", 16}, {"172.24.0.0/14", 16}, {"172.28.0.0/14", 16},
 		{"192.168.0.0/16", 20}}
 	globalScopeDefaultNetworks = []*NetworkToSplit{{"10.0.0.0/8", 24}}
+	// namedDefaultNetworks contains the networks of the user configured named default pools
+	namedDefaultNetworks = map[string][]*net.IPNet{}
 )
 
 // NetworkToSplit represent a network that has to be split in chunks with mask length Size.
@@ -88,6 +90,37 @@ func ConfigLocalScopeDefaultNetworks(defaultAddressPool []*NetworkToSplit) error
 	return configDefaultNetworks(defaultAddressPool, &PredefinedLocalScopeDefaultNetworks)
 }
 
+// ConfigNamedDefaultNetworks configures the named default pools. A network
+// can select one of them instead of the scope default pool.
+func ConfigNamedDefaultNetworks(namedPools map[string][]*NetworkToSplit) error {
+	named := make(map[string][]*net.IPNet, len(namedPools))
+	for name, pools := range namedPools {
+		if name == "" {
+			return fmt.Errorf("invalid empty name for default address pool")
+		}
+		networks, err := splitNetworks(pools)
+		if err != nil {
+			return fmt.Errorf("invalid default address pool %q: %v", name, err)
+		}
+		named[name] = networks
+	}
+	mutex.Lock()
+	namedDefaultNetworks = named
+	mutex.Unlock()
+	return nil
+}
+
+// GetNamedDefaultNetworks returns the networks of each named default pool
+func GetNamedDefaultNetworks() map[string][]*net.IPNet {
+	mutex.Lock()
+	defer mutex.Unlock()
+	named := make(map[string][]*net.IPNet, len(namedDefaultNetworks))
+	for name, networks := range namedDefaultNetworks {
+		named[name] = networks
+	}
+	return named
+}
+
 // splitNetworks takes a slice of networks, split them accordingly and returns them
 func splitNetworks(list []*NetworkToSplit) ([]*net.IPNet, error) {
 	localPools := make([]*net.IPNet, 0, len(list))
@@ -116,3 +116,25 @@ func TestInitAddressPools(t *testing.T) {
 	assert.Check(t, is.Equal(PredefinedLocalScopeDefaultNetworks[383].String(), "172.90.127.0/24"))
 	assert.Check(t, is.Equal(PredefinedLocalScopeDefaultNetworks[511].String(), "172.90.255.0/24"))
 }
+
+func TestConfigNamedDefaultNetworks(t *testing.T) {
+	err := ConfigNamedDefaultNetworks(map[string][]*NetworkToSplit{
+		"internal": {{"10.10.0.0/16", 24}},
+		"dmz":      {{"10.20.0.0/16", 20}, {"10.30.0.0/16", 20}},
+	})
+	assert.NilError(t, err)
+
+	named := GetNamedDefaultNetworks()
+	assert.Check(t, is.Len(named, 2))
+	assert.Check(t, is.Len(named["internal"], 256))
+	assert.Check(t, is.Equal(named["internal"][0].String(), "10.10.0.0/24"))
+	assert.Check(t, is.Len(named["dmz"], 32))
+	assert.Check(t, is.Equal(named["dmz"][16].String(), "10.30.0.0/20"))
+
+	err = ConfigNamedDefaultNetworks(map[string][]*NetworkToSplit{"bad": {{"10.40.0.0/16", 8}}})
+	assert.Check(t, is.ErrorContains(err, "invalid default address pool \"bad\""))
+	assert.Check(t, is.Len(GetNamedDefaultNetworks(), 2))
+
+	assert.NilError(t, ConfigNamedDefaultNetworks(nil))
+	assert.Check(t, is.Len(GetNamedDefaultNetworks(), 0))
+}
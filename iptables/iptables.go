@@ -33,6 +33,8 @@ const (
 	Delete Action = "-D"
 	// Insert inserts the rule at the top of the chain.
 	Insert Action = "-I"
+	// Flush deletes all the rules of the chain.
+	Flush Action = "-F"
 	// Nat table is used for nat translation rules.
 	Nat Table = "nat"
 	// Filter table is used for filter rules.
@@ -50,10 +52,13 @@ const (
 )
 
 var (
-	iptablesPath  string
-	ip6tablesPath string
-	supportsXlock = false
-	xLockWaitMsg  = "Another app is currently holding the xtables lock"
+	iptablesPath         string
+	ip6tablesPath        string
+	iptablesRestorePath  string
+	ip6tablesRestorePath string
+	supportsXlock        = false
+	restoreSupportsXlock = false
+	xLockWaitMsg         = "Another app is currently holding the xtables lock"
 	// used to lock iptables commands if xtables lock is not supported
 	bestEffortLock sync.Mutex
 	// ErrIptablesNotFound is returned when the rule is not found.
@@ -106,6 +111,22 @@ func detectIptables() {
 	} else {
 		ip6tablesPath = path
 	}
+
+	// Transactions fall back to one iptables invocation per rule when
+	// iptables-restore is missing.
+	path, err = exec.LookPath("iptables-restore")
+	if err != nil {
+		logrus.WithError(err).Infof("unable to find iptables-restore")
+		return
+	}
+	iptablesRestorePath = path
+	if out, err := exec.Command(path, "--help").CombinedOutput(); err == nil && strings.Contains(string(out), "--wait") {
+		restoreSupportsXlock = true
+	}
+
+	if path, err = exec.LookPath("ip6tables-restore"); err == nil {
+		ip6tablesRestorePath = path
+	}
 }
 
 func initFirewalld() {
@@ -172,6 +193,12 @@ func (iptable IPTable) LoopbackByVersion() string {
 
 // ProgramChain is used to add rules to a chain
 func (iptable IPTable) ProgramChain(c *ChainInfo, bridgeName string, hairpinMode, enable bool) error {
+	return iptable.ProgramChainOwned(Owner{}, c, bridgeName, hairpinMode, enable)
+}
+
+// ProgramChainOwned behaves as ProgramChain, tagging the rules specific to
+// the bridge with the owner.
+func (iptable IPTable) ProgramChainOwned(owner Owner, c *ChainInfo, bridgeName string, hairpinMode, enable bool) error {
 	if c.Name == "" {
 		return errors.New("Could not program chain, missing chain name")
 	}
@@ -225,9 +252,9 @@ func (iptable IPTable) ProgramChain(c *ChainInfo, bridgeName string, hairpinMode
 			return fmt.Errorf("Could not program chain %s/%s, missing bridge name",
 				c.Table, c.Name)
 		}
-		link := []string{
+		link := append([]string{
 			"-o", bridgeName,
-			"-j", c.Name}
+			"-j", c.Name}, owner.Args()...)
 		if !iptable.Exists(Filter, "FORWARD", link...) && enable {
 			insert := append([]string{string(Insert), "FORWARD"}, link...)
 			if output, err := iptable.Raw(insert...); err != nil {
@@ -244,11 +271,11 @@ func (iptable IPTable) ProgramChain(c *ChainInfo, bridgeName string, hairpinMode
 			}
 
 		}
-		establish := []string{
+		establish := append([]string{
 			"-o", bridgeName,
 			"-m", "conntrack",
 			"--ctstate", "RELATED,ESTABLISHED",
-			"-j", "ACCEPT"}
+			"-j", "ACCEPT"}, owner.Args()...)
 		if !iptable.Exists(Filter, "FORWARD", establish...) && enable {
 			insert := append([]string{string(Insert), "FORWARD"}, establish...)
 			if output, err := iptable.Raw(insert...); err != nil {
@@ -283,8 +310,16 @@ func (iptable IPTable) RemoveExistingChain(name string, table Table) error {
 
 // Forward adds forwarding rule to 'filter' table and corresponding nat rule to 'nat' table.
 func (c *ChainInfo) Forward(action Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) error {
+	return c.ForwardOwned(Owner{}, action, ip, port, proto, destAddr, destPort, bridgeName)
+}
 
-	iptable := GetIptable(c.IPTable.Version)
+// ForwardExists checks whether the DNAT rule Forward programs for the port
+// of the owner is present.
+func (c *ChainInfo) ForwardExists(owner Owner, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) bool {
+	return GetIptable(c.IPTable.Version).Exists(Nat, c.Name, c.dnatArgs(owner, ip, port, proto, destAddr, destPort, bridgeName)...)
+}
+
+func (c *ChainInfo) dnatArgs(owner Owner, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) []string {
 	daddr := ip.String()
 	if ip.IsUnspecified() {
 		// iptables interprets "0.0.0.0" as "0.0.0.0/32", whereas we
@@ -303,20 +338,62 @@ func (c *ChainInfo) Forward(action Action, ip net.IP, port int, proto, destAddr
 	if !c.HairpinMode {
 		args = append(args, "!", "-i", bridgeName)
 	}
-	if err := iptable.ProgramRule(Nat, c.Name, action, args); err != nil {
-		return err
-	}
+	return append(args, owner.Args()...)
+}
 
-	args = []string{
+// ForwardOwned behaves as Forward, tagging the rules with the owner.
+func (c *ChainInfo) ForwardOwned(owner Owner, action Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) error {
+	return c.ForwardFrom(owner, action, ip, port, proto, destAddr, destPort, bridgeName, nil)
+}
+
+// ForwardFrom behaves as ForwardOwned. When sources is not empty, only the
+// forwarded traffic of the sources of the IP version of the chain is let
+// through to the container.
+func (c *ChainInfo) ForwardFrom(owner Owner, action Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string, sources []*net.IPNet) error {
+	tx := GetIptable(c.IPTable.Version).NewTransaction()
+	c.QueueForwardFrom(tx, owner, action, ip, port, proto, destAddr, destPort, bridgeName, sources)
+	return tx.Commit()
+}
+
+// QueueForward queues in the transaction the rules Forward programs
+func (c *ChainInfo) QueueForward(tx *Transaction, owner Owner, action Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) {
+	c.QueueForwardFrom(tx, owner, action, ip, port, proto, destAddr, destPort, bridgeName, nil)
+}
+
+// QueueForwardFrom queues in the transaction the rules ForwardFrom programs
+func (c *ChainInfo) QueueForwardFrom(tx *Transaction, owner Owner, action Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string, sources []*net.IPNet) {
+	tx.Queue(Nat, c.Name, action, c.dnatArgs(owner, ip, port, proto, destAddr, destPort, bridgeName)...)
+
+	args := []string{
 		"!", "-i", bridgeName,
 		"-o", bridgeName,
 		"-p", proto,
 		"-d", destAddr,
 		"--dport", strconv.Itoa(destPort),
-		"-j", "ACCEPT",
 	}
-	if err := iptable.ProgramRule(Filter, c.Name, action, args); err != nil {
-		return err
+	if len(sources) == 0 {
+		tx.Queue(Filter, c.Name, action, append(append(args, "-j", "ACCEPT"), owner.Args()...)...)
+	} else {
+		// The rules only match the traffic translated by the DNAT rule of
+		// the mapping, and go on top of the chain so that the rules of the
+		// unrestricted mappings of the same container port do not let the
+		// traffic through first.
+		args = append(args, "-m", "conntrack", "--ctstate", "DNAT", "--ctorigdstport", strconv.Itoa(port))
+		if !ip.IsUnspecified() {
+			args = append(args, "--ctorigdst", ip.String())
+		}
+		filterAction := action
+		if action == Append {
+			filterAction = Insert
+		}
+		tx.Queue(Filter, c.Name, filterAction, append(append(args[:len(args):len(args)], "-j", "DROP"), owner.Args()...)...)
+		for i := len(sources) - 1; i >= 0; i-- {
+			if (sources[i].IP.To4() == nil) != (c.IPTable.Version == IPv6) {
+				continue
+			}
+			rule := append(args[:len(args):len(args)], "-s", sources[i].String(), "-j", "ACCEPT")
+			tx.Queue(Filter, c.Name, filterAction, append(rule, owner.Args()...)...)
+		}
 	}
 
 	args = []string{
@@ -326,10 +403,7 @@ func (c *ChainInfo) Forward(action Action, ip net.IP, port int, proto, destAddr
 		"--dport", strconv.Itoa(destPort),
 		"-j", "MASQUERADE",
 	}
-
-	if err := iptable.ProgramRule(Nat, "POSTROUTING", action, args); err != nil {
-		return err
-	}
+	tx.Queue(Nat, "POSTROUTING", action, append(args, owner.Args()...)...)
 
 	if proto == "sctp" {
 		// Linux kernel v4.9 and below enables NETIF_F_SCTP_CRC for veth by
@@ -345,18 +419,19 @@ func (c *ChainInfo) Forward(action Action, ip net.IP, port int, proto, destAddr
 			"-j", "CHECKSUM",
 			"--checksum-fill",
 		}
-		if err := iptable.ProgramRule(Mangle, "POSTROUTING", action, args); err != nil {
-			return err
-		}
+		tx.Queue(Mangle, "POSTROUTING", action, append(args, owner.Args()...)...)
 	}
-
-	return nil
 }
 
 // Link adds reciprocal ACCEPT rule for two supplied IP addresses.
 // Traffic is allowed from ip1 to ip2 and vice-versa
 func (c *ChainInfo) Link(action Action, ip1, ip2 net.IP, port int, proto string, bridgeName string) error {
-	iptable := GetIptable(c.IPTable.Version)
+	return c.LinkOwned(Owner{}, action, ip1, ip2, port, proto, bridgeName)
+}
+
+// LinkOwned behaves as Link, tagging the rules with the owner.
+func (c *ChainInfo) LinkOwned(owner Owner, action Action, ip1, ip2 net.IP, port int, proto string, bridgeName string) error {
+	tx := GetIptable(c.IPTable.Version).NewTransaction()
 	// forward
 	args := []string{
 		"-i", bridgeName, "-o", bridgeName,
@@ -366,14 +441,14 @@ func (c *ChainInfo) Link(action Action, ip1, ip2 net.IP, port int, proto string,
 		"--dport", strconv.Itoa(port),
 		"-j", "ACCEPT",
 	}
+	tx.Queue(Filter, c.Name, action, append(args, owner.Args()...)...)
 
-	if err := iptable.ProgramRule(Filter, c.Name, action, args); err != nil {
-		return err
-	}
 	// reverse
+	args = append([]string(nil), args...)
 	args[7], args[9] = args[9], args[7]
 	args[10] = "--sport"
-	return iptable.ProgramRule(Filter, c.Name, action, args)
+	tx.Queue(Filter, c.Name, action, append(args, owner.Args()...)...)
+	return tx.Commit()
 }
 
 // ProgramRule adds the rule specified by args only if the
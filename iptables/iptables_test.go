@@ -1,6 +1,7 @@
 package iptables
 
 import (
+	"fmt"
 	"net"
 	"os/exec"
 	"strconv"
@@ -298,3 +299,214 @@ func TestExistsRaw(t *testing.T) {
 		}
 	}
 }
+
+func TestTransactionRestoreInput(t *testing.T) {
+	tx := GetIptable(IPv4).NewTransaction()
+	tx.Queue(Nat, "DOCKER", Append, "-p", "tcp", "--dport", "80", "-j", "DNAT", "--to-destination", "172.17.0.2:80")
+	tx.Queue(Filter, "DOCKER", Insert, "-m", "comment", "--comment", "docker network", "-j", "ACCEPT")
+	tx.Queue(Nat, "POSTROUTING", Delete, "-s", "172.17.0.2", "-j", "MASQUERADE")
+
+	if tx.Len() != 3 {
+		t.Fatalf("expected 3 queued rules, got %d", tx.Len())
+	}
+
+	expected := "*nat\n" +
+		"-A DOCKER -p tcp --dport 80 -j DNAT --to-destination 172.17.0.2:80\n" +
+		"-D POSTROUTING -s 172.17.0.2 -j MASQUERADE\n" +
+		"COMMIT\n" +
+		"*filter\n" +
+		"-I DOCKER -m comment --comment \"docker network\" -j ACCEPT\n" +
+		"COMMIT\n"
+	if input := tx.restoreInput(); input != expected {
+		t.Fatalf("unexpected iptables-restore input:\n%s\nexpected:\n%s", input, expected)
+	}
+
+	rules := tx.Rules()
+	if strings.Join(rules[1], " ") != "-t filter -I DOCKER -m comment --comment docker network -j ACCEPT" {
+		t.Fatalf("unexpected rule arguments: %v", rules[1])
+	}
+}
+
+func TestTransactionPending(t *testing.T) {
+	listed := map[Table]int{}
+	tx := GetIptable(IPv4).NewTransaction()
+	tx.list = func(table Table) ([]byte, error) {
+		listed[table]++
+		if table != Nat {
+			return nil, nil
+		}
+		return []byte("-P POSTROUTING ACCEPT\n-A POSTROUTING -s 172.17.0.2/32 -j MASQUERADE\n"), nil
+	}
+	tx.Queue(Nat, "POSTROUTING", Append, "-s", "172.17.0.2", "-j", "MASQUERADE")
+	tx.Queue(Nat, "DOCKER", Delete, "-p", "tcp", "--dport", "80", "-j", "DNAT", "--to-destination", "172.17.0.2:80")
+	tx.Queue(Filter, "DOCKER", Append, "-d", "172.17.0.2", "-j", "ACCEPT")
+	tx.Queue(Filter, "DOCKER", Append, "-d", "172.17.0.2", "-j", "ACCEPT")
+	tx.Queue(Filter, "DOCKER", Delete, "-d", "172.17.0.2", "-j", "ACCEPT")
+	// The rules of a flushed chain are added back
+	tx.Queue(Nat, "POSTROUTING", Flush)
+	tx.Queue(Nat, "POSTROUTING", Append, "-s", "172.17.0.2", "-j", "MASQUERADE")
+
+	rules, err := tx.pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending []string
+	for _, r := range rules {
+		pending = append(pending, strings.Join(r.args, " "))
+	}
+	expected := []string{
+		"-A DOCKER -d 172.17.0.2 -j ACCEPT",
+		"-D DOCKER -d 172.17.0.2 -j ACCEPT",
+		"-F POSTROUTING",
+		"-A POSTROUTING -s 172.17.0.2 -j MASQUERADE",
+	}
+	if strings.Join(pending, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected pending rules:\n%s\nexpected:\n%s", strings.Join(pending, "\n"), strings.Join(expected, "\n"))
+	}
+	if listed[Nat] != 1 || listed[Filter] != 1 {
+		t.Fatalf("expected each table to be listed once, got %v", listed)
+	}
+}
+
+func TestCanonicalRule(t *testing.T) {
+	for _, tc := range []struct {
+		queued []string
+		listed string
+	}{
+		{
+			queued: strings.Fields("-m state -p tcp --sport 80 --state ESTABLISHED,RELATED -j ACCEPT"),
+			listed: "-p tcp -m state --state RELATED,ESTABLISHED -m tcp --sport 80 -j ACCEPT",
+		},
+		{
+			queued: strings.Fields("-m state -p tcp --sport 80 --state ESTABLISHED,RELATED -j ACCEPT"),
+			listed: "-p tcp -m tcp --sport 80 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT",
+		},
+		{
+			queued: append(strings.Fields("! -i docker0 -p tcp -d 192.168.1.1 --dport 8080 -j DNAT --to-destination 172.17.0.2:80"), Owner{NetworkID: "n1", EndpointID: "e1"}.Args()...),
+			listed: `-d 192.168.1.1/32 ! -i docker0 -p tcp -m tcp --dport 8080 -m comment --comment "libnetwork:nid=n1,eid=e1" -j DNAT --to-destination 172.17.0.2:80`,
+		},
+		{
+			queued: strings.Fields("-d 10.0.0.2 -p udp --dport 4789 -j MARK --set-mark 13681892"),
+			listed: "-d 10.0.0.2/32 -p udp -m udp --dport 4789 -j MARK --set-xmark 0xd0c4e4/0xffffffff",
+		},
+		{
+			queued: strings.Fields("-s fd00::2 --jump MASQUERADE"),
+			listed: "-s fd00::2/128 -j MASQUERADE",
+		},
+	} {
+		if q, l := canonicalRule(tc.queued), canonicalRule(splitRuleArgs(tc.listed)); q != l {
+			t.Errorf("expected %v to match %q:\n%s\n%s", tc.queued, tc.listed, q, l)
+		}
+	}
+
+	if canonicalRule(strings.Fields("-i docker0 -j ACCEPT")) == canonicalRule(strings.Fields("! -i docker0 -j ACCEPT")) {
+		t.Fatal("expected the negated rule not to match")
+	}
+}
+
+func TestParseOwnedRules(t *testing.T) {
+	owner := Owner{NetworkID: "n1", EndpointID: "e1"}
+	if o, ok := ParseOwner(owner.Comment()); !ok || o != owner {
+		t.Fatalf("unexpected owner %+v parsed from %q", o, owner.Comment())
+	}
+	if _, ok := ParseOwner("user comment"); ok {
+		t.Fatal("owner parsed from a foreign comment")
+	}
+
+	output := `-P PREROUTING ACCEPT
+-N DOCKER
+-A DOCKER -d 192.168.1.1/32 ! -i docker0 -p tcp -m tcp --dport 8080 -m comment --comment "libnetwork:nid=n1,eid=e1" -j DNAT --to-destination 172.17.0.2:80
+-A DOCKER -i docker0 -m comment --comment "some user rule" -j RETURN
+-A POSTROUTING -s 172.17.0.0/16 ! -o docker0 -m comment --comment libnetwork:nid=n2 -j MASQUERADE
+`
+	rules := parseOwnedRules(Nat, output)
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 owned rules, got %d: %+v", len(rules), rules)
+	}
+	if rules[0].Chain != "DOCKER" || rules[0].Owner != owner {
+		t.Fatalf("unexpected rule %+v", rules[0])
+	}
+	expected := []string{"-d", "192.168.1.1/32", "!", "-i", "docker0", "-p", "tcp", "-m", "tcp", "--dport", "8080",
+		"-m", "comment", "--comment", "libnetwork:nid=n1,eid=e1", "-j", "DNAT", "--to-destination", "172.17.0.2:80"}
+	if strings.Join(rules[0].Args, " ") != strings.Join(expected, " ") {
+		t.Fatalf("unexpected rule arguments %v", rules[0].Args)
+	}
+	if rules[1].Chain != "POSTROUTING" || rules[1].Owner != (Owner{NetworkID: "n2"}) {
+		t.Fatalf("unexpected rule %+v", rules[1])
+	}
+}
+
+func TestQueueForwardFrom(t *testing.T) {
+	c := &ChainInfo{Name: "DOCKER", Table: Nat, IPTable: IPTable{Version: IPv4}}
+	_, v4, _ := net.ParseCIDR("192.0.2.0/24")
+	_, v6, _ := net.ParseCIDR("2001:db8::/64")
+
+	tx := GetIptable(IPv4).NewTransaction()
+	c.QueueForwardFrom(tx, Owner{}, Append, net.ParseIP("0.0.0.0"), 8080, "tcp", "172.17.0.2", 80, "docker0", []*net.IPNet{v4, v6})
+
+	var filter []string
+	for _, r := range tx.Rules() {
+		if r[1] == string(Filter) {
+			filter = append(filter, strings.Join(r[2:], " "))
+		}
+	}
+	match := "DOCKER ! -i docker0 -o docker0 -p tcp -d 172.17.0.2 --dport 80 -m conntrack --ctstate DNAT --ctorigdstport 8080"
+	expected := []string{
+		"-I " + match + " -j DROP",
+		"-I " + match + " -s 192.0.2.0/24 -j ACCEPT",
+	}
+	if strings.Join(filter, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected filter rules:\n%s\nexpected:\n%s", strings.Join(filter, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+const benchChain = "DOCKER-BENCH"
+
+// benchmarkRules adds, then removes, a batch of rules in a scratch chain
+// with program.
+func benchmarkRules(b *testing.B, program func(iptable *IPTable, action Action, rules [][]string) error) {
+	if err := initCheck(); err != nil {
+		b.Skip(err)
+	}
+	iptable := GetIptable(IPv4)
+	if _, err := iptable.NewChain(benchChain, Filter, false); err != nil {
+		b.Fatal(err)
+	}
+	defer iptable.RemoveExistingChain(benchChain, Filter)
+
+	rules := make([][]string, 50)
+	for i := range rules {
+		rules[i] = []string{"-d", fmt.Sprintf("10.0.0.%d", i+1), "-p", "tcp", "--dport", "80", "-j", "ACCEPT"}
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := program(iptable, Append, rules); err != nil {
+			b.Fatal(err)
+		}
+		if err := program(iptable, Delete, rules); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramRule(b *testing.B) {
+	benchmarkRules(b, func(iptable *IPTable, action Action, rules [][]string) error {
+		for _, r := range rules {
+			if err := iptable.ProgramRule(Filter, benchChain, action, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func BenchmarkTransactionCommit(b *testing.B) {
+	benchmarkRules(b, func(iptable *IPTable, action Action, rules [][]string) error {
+		tx := iptable.NewTransaction()
+		for _, r := range rules {
+			tx.Queue(Filter, benchChain, action, r...)
+		}
+		return tx.Commit()
+	})
+}
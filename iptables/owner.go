@@ -0,0 +1,134 @@
+package iptables
+
+import (
+	"strings"
+)
+
+// ownerCommentPrefix marks the comments of the rules programmed by libnetwork
+const ownerCommentPrefix = "libnetwork:"
+
+// Owner identifies the network, and optionally the endpoint, a rule is
+// programmed for. It is stored in a comment attached to the rule, so that
+// rules left behind by a crash can be told apart and removed.
+type Owner struct {
+	NetworkID  string
+	EndpointID string
+}
+
+// OwnedRule is a rule tagged with its owner
+type OwnedRule struct {
+	Table Table
+	Chain string
+	// Args holds the rule specification, including the owner comment
+	Args  []string
+	Owner Owner
+}
+
+// IsZero returns whether the owner is unset
+func (o Owner) IsZero() bool {
+	return o.NetworkID == "" && o.EndpointID == ""
+}
+
+// Comment returns the comment identifying the owner
+func (o Owner) Comment() string {
+	c := ownerCommentPrefix + "nid=" + o.NetworkID
+	if o.EndpointID != "" {
+		c += ",eid=" + o.EndpointID
+	}
+	return c
+}
+
+// Args returns the arguments tagging a rule with the owner comment,
+// nothing if the owner is unset.
+func (o Owner) Args() []string {
+	if o.IsZero() {
+		return nil
+	}
+	return []string{"-m", "comment", "--comment", o.Comment()}
+}
+
+// ParseOwner returns the owner stored in the comment of a rule
+func ParseOwner(comment string) (Owner, bool) {
+	var o Owner
+	if !strings.HasPrefix(comment, ownerCommentPrefix) {
+		return o, false
+	}
+	for _, kv := range strings.Split(strings.TrimPrefix(comment, ownerCommentPrefix), ",") {
+		switch {
+		case strings.HasPrefix(kv, "nid="):
+			o.NetworkID = strings.TrimPrefix(kv, "nid=")
+		case strings.HasPrefix(kv, "eid="):
+			o.EndpointID = strings.TrimPrefix(kv, "eid=")
+		}
+	}
+	return o, o.NetworkID != ""
+}
+
+// OwnedRules returns the rules of the given tables tagged with an owner
+func (iptable IPTable) OwnedRules(tables ...Table) ([]OwnedRule, error) {
+	var rules []OwnedRule
+	for _, table := range tables {
+		output, err := iptable.Raw("-t", string(table), "-S")
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, parseOwnedRules(table, string(output))...)
+	}
+	return rules, nil
+}
+
+// parseOwnedRules parses the output of iptables -S
+func parseOwnedRules(table Table, output string) []OwnedRule {
+	var rules []OwnedRule
+	for _, line := range strings.Split(output, "\n") {
+		args := splitRuleArgs(line)
+		if len(args) < 2 || args[0] != string(Append) {
+			continue
+		}
+		for i := 2; i < len(args)-1; i++ {
+			if args[i] != "--comment" {
+				continue
+			}
+			if o, ok := ParseOwner(args[i+1]); ok {
+				rules = append(rules, OwnedRule{Table: table, Chain: args[1], Args: args[2:], Owner: o})
+			}
+			break
+		}
+	}
+	return rules
+}
+
+// splitRuleArgs splits a rule as printed by iptables -S into arguments,
+// honoring the double quotes around the arguments containing spaces.
+func splitRuleArgs(line string) []string {
+	var (
+		args    []string
+		cur     strings.Builder
+		inQuote bool
+		inArg   bool
+	)
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '\\' && inQuote && i+1 < len(line):
+			i++
+			cur.WriteByte(line[i])
+		case ch == '"':
+			inQuote = !inQuote
+			inArg = true
+		case (ch == ' ' || ch == '\t') && !inQuote:
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args
+}
@@ -0,0 +1,340 @@
+package iptables
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Transaction accumulates rule changes and applies them with a single
+// iptables-restore invocation, which the kernel commits atomically: either
+// all the changes are applied or none is. As with IPTable.ProgramRule, the
+// rules which already exist are not added again and the missing ones are
+// not deleted: they are looked up in a single listing of each table the
+// transaction changes.
+type Transaction struct {
+	iptable IPTable
+	rules   []txRule
+	// list returns the rules of a table as printed by iptables -S, replaced
+	// in the tests
+	list func(table Table) ([]byte, error)
+}
+
+type txRule struct {
+	table Table
+	args  []string // action, chain and rule specification
+}
+
+// NewTransaction returns an empty transaction for the IP version of the table
+func (iptable IPTable) NewTransaction() *Transaction {
+	return &Transaction{iptable: iptable, list: iptable.listRules}
+}
+
+func (iptable IPTable) listRules(table Table) ([]byte, error) {
+	return iptable.Raw("-t", string(table), "-S")
+}
+
+// Queue adds the rule change to the transaction
+func (tx *Transaction) Queue(table Table, chain string, action Action, args ...string) {
+	if table == "" {
+		table = Filter
+	}
+	tx.rules = append(tx.rules, txRule{
+		table: table,
+		args:  append([]string{string(action), chain}, args...),
+	})
+}
+
+// Len returns the number of rule changes queued in the transaction
+func (tx *Transaction) Len() int {
+	return len(tx.rules)
+}
+
+// Rules returns the queued rule changes as iptables command arguments
+func (tx *Transaction) Rules() [][]string {
+	rules := make([][]string, 0, len(tx.rules))
+	for _, r := range tx.rules {
+		rules = append(rules, append([]string{"-t", string(r.table)}, r.args...))
+	}
+	return rules
+}
+
+// Commit applies all the queued rule changes at once. When iptables-restore
+// is not available, or when the rules must go through firewalld, the
+// changes are applied one by one with ProgramRule and the first failure is
+// returned.
+func (tx *Transaction) Commit() error {
+	if len(tx.rules) == 0 {
+		return nil
+	}
+	if err := initCheck(); err != nil {
+		return err
+	}
+
+	path := iptablesRestorePath
+	if tx.iptable.Version == IPv6 {
+		path = ip6tablesRestorePath
+	}
+
+	rules, err := tx.pending()
+	if err != nil {
+		return err
+	}
+	pending := &Transaction{iptable: tx.iptable, rules: rules}
+	if len(pending.rules) == 0 {
+		return nil
+	}
+
+	if firewalldRunning || path == "" {
+		return pending.programRules()
+	}
+
+	// The rules may have changed since they were listed, which makes
+	// iptables-restore fail without applying anything.
+	if err := pending.restore(path); err != nil {
+		logrus.Warnf("%v, applying the rules one by one", err)
+		return pending.programRules()
+	}
+	return nil
+}
+
+func (tx *Transaction) programRules() error {
+	for _, r := range tx.rules {
+		if err := tx.iptable.ProgramRule(r.table, r.args[1], Action(r.args[0]), r.args[2:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pending returns the queued rule changes which are not applied yet: adding
+// a rule which exists, or deleting one which does not, would make the whole
+// iptables-restore fail or duplicate the rule.
+func (tx *Transaction) pending() ([]txRule, error) {
+	var (
+		pending []txRule
+		// whether the rules changed by the transaction will exist
+		states = make(map[string]bool)
+		// the chains flushed by the transaction
+		flushed = make(map[string]bool)
+		// the rules programmed in each table, by canonical form
+		listed = make(map[Table]map[string]bool)
+	)
+	for _, r := range tx.rules {
+		chain := string(r.table) + " " + r.args[1]
+		action := Action(r.args[0])
+		if action != Append && action != Insert && action != Delete {
+			if action == Flush {
+				flushed[chain] = true
+				for key := range states {
+					if strings.HasPrefix(key, chain+" ") {
+						delete(states, key)
+					}
+				}
+			}
+			pending = append(pending, r)
+			continue
+		}
+		key := chain + " " + canonicalRule(r.args[2:])
+		exists, ok := states[key]
+		if !ok && !flushed[chain] {
+			programmed, ok := listed[r.table]
+			if !ok {
+				output, err := tx.list(r.table)
+				if err != nil {
+					return nil, fmt.Errorf("could not list the rules of table %s: %v", r.table, err)
+				}
+				programmed = parseRules(r.table, string(output))
+				listed[r.table] = programmed
+			}
+			exists = programmed[key]
+		}
+		remove := action == Delete
+		if exists != remove {
+			continue
+		}
+		states[key] = !remove
+		pending = append(pending, r)
+	}
+	return pending, nil
+}
+
+// parseRules returns the canonical forms of the rules printed by iptables -S
+// for the table, prefixed with the table and chain.
+func parseRules(table Table, output string) map[string]bool {
+	rules := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		args := splitRuleArgs(line)
+		if len(args) < 2 || args[0] != string(Append) {
+			continue
+		}
+		rules[string(table)+" "+args[1]+" "+canonicalRule(args[2:])] = true
+	}
+	return rules
+}
+
+// ruleAliases maps the long forms of the options to the short ones iptables
+// prints them with.
+var ruleAliases = map[string]string{
+	"--protocol":      "-p",
+	"--source":        "-s",
+	"--src":           "-s",
+	"--destination":   "-d",
+	"--dst":           "-d",
+	"--in-interface":  "-i",
+	"--out-interface": "-o",
+	"--jump":          "-j",
+	"--goto":          "-g",
+	"--state":         "--ctstate",
+	"--set-mark":      "--set-xmark",
+}
+
+// canonicalRule returns a form of the rule specification which does not
+// depend on how iptables prints it back: the order of the options, the
+// match modules loaded along with their options, the address masks and the
+// notation of the marks and connection states are normalized.
+func canonicalRule(args []string) string {
+	var (
+		opts []string
+		cur  []string
+	)
+	flush := func() {
+		if len(cur) == 0 {
+			return
+		}
+		opt := cur[0]
+		if opt == "!" && len(cur) > 1 {
+			opt = cur[1]
+		}
+		if opt != "-m" && opt != "--match" {
+			opts = append(opts, strings.Join(cur, " "))
+		}
+		cur = nil
+	}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "!" || strings.HasPrefix(a, "-") {
+			if len(cur) == 0 || cur[len(cur)-1] != "!" {
+				flush()
+			}
+			if alias, ok := ruleAliases[a]; ok {
+				a = alias
+			}
+			cur = append(cur, a)
+			continue
+		}
+		opt := ""
+		for _, c := range cur {
+			if c != "!" {
+				opt = c
+				break
+			}
+		}
+		cur = append(cur, canonicalValue(opt, a))
+	}
+	flush()
+	sort.Strings(opts)
+	return strings.Join(opts, " ")
+}
+
+func canonicalValue(opt, val string) string {
+	switch opt {
+	case "-s", "-d":
+		if !strings.Contains(val, "/") {
+			if ip := net.ParseIP(val); ip != nil {
+				if ip.To4() != nil {
+					val += "/32"
+				} else {
+					val += "/128"
+				}
+			}
+		}
+		if _, nw, err := net.ParseCIDR(val); err == nil {
+			return nw.String()
+		}
+	case "-p":
+		return strings.ToLower(val)
+	case "--ctstate":
+		states := strings.Split(val, ",")
+		sort.Strings(states)
+		return strings.Join(states, ",")
+	case "--mark", "--set-xmark":
+		parts := strings.SplitN(val, "/", 2)
+		mark, err := strconv.ParseUint(parts[0], 0, 32)
+		if err != nil {
+			return val
+		}
+		mask := uint64(0xffffffff)
+		if len(parts) == 2 {
+			if mask, err = strconv.ParseUint(parts[1], 0, 32); err != nil {
+				return val
+			}
+		}
+		return fmt.Sprintf("0x%x/0x%x", mark, mask)
+	}
+	return val
+}
+
+// restoreInput returns the rules in the iptables-restore format
+func (tx *Transaction) restoreInput() string {
+	var (
+		b      bytes.Buffer
+		tables []Table
+		rules  = make(map[Table][]string)
+	)
+	for _, r := range tx.rules {
+		if _, ok := rules[r.table]; !ok {
+			tables = append(tables, r.table)
+		}
+		quoted := make([]string, 0, len(r.args))
+		for _, a := range r.args {
+			quoted = append(quoted, quoteRestoreArg(a))
+		}
+		rules[r.table] = append(rules[r.table], strings.Join(quoted, " "))
+	}
+	for _, t := range tables {
+		fmt.Fprintf(&b, "*%s\n", t)
+		for _, r := range rules[t] {
+			fmt.Fprintln(&b, r)
+		}
+		fmt.Fprintln(&b, "COMMIT")
+	}
+	return b.String()
+}
+
+func quoteRestoreArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'") {
+		return arg
+	}
+	return `"` + strings.Replace(arg, `"`, `\"`, -1) + `"`
+}
+
+func (tx *Transaction) restore(path string) error {
+	args := []string{"--noflush"}
+	if restoreSupportsXlock {
+		args = append(args, "--wait")
+	} else {
+		bestEffortLock.Lock()
+		defer bestEffortLock.Unlock()
+	}
+
+	input := tx.restoreInput()
+	logrus.Debugf("%s %v: %s", path, args, input)
+
+	startTime := time.Now()
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("iptables-restore failed: %s %v: %s (%s)", path, strings.Join(args, " "), output, err)
+	}
+	filterOutput(startTime, output, args...)
+	return nil
+}
@@ -345,6 +345,29 @@ func TestAuxAddresses(t *testing.T) {
 	}
 }
 
+func TestPoolRequestOptions(t *testing.T) {
+	n := &network{}
+	if opts := n.poolRequestOptions(); len(opts) != 0 {
+		t.Fatalf("unexpected pool request options: %v", opts)
+	}
+
+	n.labels = map[string]string{ipamapi.DefaultPoolName: "dmz"}
+	n.ipamOptions = map[string]string{ipamapi.AllocSerialPrefix: "true"}
+	opts := n.poolRequestOptions()
+	if opts[ipamapi.DefaultPoolName] != "dmz" || opts[ipamapi.AllocSerialPrefix] != "true" {
+		t.Fatalf("unexpected pool request options: %v", opts)
+	}
+	if _, ok := n.ipamOptions[ipamapi.DefaultPoolName]; ok {
+		t.Fatal("network ipam options must not be modified")
+	}
+
+	// The ipam option takes precedence over the label
+	n.ipamOptions[ipamapi.DefaultPoolName] = "internal"
+	if opts := n.poolRequestOptions(); opts[ipamapi.DefaultPoolName] != "internal" {
+		t.Fatalf("unexpected pool request options: %v", opts)
+	}
+}
+
 func TestSRVServiceQuery(t *testing.T) {
 	c, err := New()
 	if err != nil {
@@ -620,6 +643,71 @@ func TestIpamReleaseOnNetDriverFailures(t *testing.T) {
 	}
 }
 
+func TestIPAMAudit(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	cc := c.(*controller)
+
+	ipamOpt := NetworkOptionIpam(ipamapi.DefaultIPAM, "", []*IpamConf{{PreferredPool: "10.36.0.0/16"}}, nil, nil)
+	n, err := c.NewNetwork("bridge", "auditnet", "", ipamOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Delete()
+
+	ep, err := n.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Delete(false)
+
+	res := cc.auditIPAM(false)
+	if len(res.Leaked) != 0 || len(res.Missing) != 0 {
+		t.Fatalf("unexpected audit result on a consistent state: %s", res)
+	}
+
+	ipam, _, err := cc.getIPAMDriver(ipamapi.DefaultIPAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolID := n.(*network).ipamV4Info[0].PoolID
+	epIP := ep.Info().Iface().Address().IP
+
+	// Simulate a leaked address and an endpoint address released by mistake
+	leaked, _, err := ipam.RequestAddress(poolID, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.ReleaseAddress(poolID, epIP); err != nil {
+		t.Fatal(err)
+	}
+
+	res = cc.auditIPAM(true)
+	if len(res.Leaked) != 1 || res.Leaked[0].Address != leaked.IP.String() || !res.Leaked[0].Repaired {
+		t.Fatalf("unexpected leaked addresses in audit result: %s", res)
+	}
+	if len(res.Missing) != 1 || res.Missing[0].Address != epIP.String() || !res.Missing[0].Repaired {
+		t.Fatalf("unexpected missing addresses in audit result: %s", res)
+	}
+
+	res = cc.auditIPAM(false)
+	if len(res.Leaked) != 0 || len(res.Missing) != 0 {
+		t.Fatalf("unexpected audit result after repair: %s", res)
+	}
+}
+
 var badDriverName = "bad network driver"
 
 type badDriver struct {
@@ -689,3 +777,19 @@ func (b *badDriver) EventNotify(etype driverapi.EventType, nid, tableName, key s
 func (b *badDriver) DecodeTableEntry(tablename string, key string, value []byte) (string, map[string]string) {
 	return "", nil
 }
+
+func TestGossipListenAddr(t *testing.T) {
+	for _, tc := range []struct {
+		listen, advertise, expected string
+	}{
+		{"0.0.0.0", "192.168.1.10", "0.0.0.0"},
+		{"0.0.0.0", "2001:db8::10", "::"},
+		{"", "2001:db8::10", "::"},
+		{"2001:db8::10", "2001:db8::10", "2001:db8::10"},
+		{"192.168.1.10", "2001:db8::10", "192.168.1.10"},
+	} {
+		if addr := gossipListenAddr(tc.listen, tc.advertise); addr != tc.expected {
+			t.Fatalf("Expected %q listening on %q and advertising %q, got %q", tc.expected, tc.listen, tc.advertise, addr)
+		}
+	}
+}
@@ -209,6 +209,68 @@ func TestBridge(t *testing.T) {
 	}
 }
 
+func TestPortLeaseAcrossSandboxes(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	netOption := options.Generic{
+		netlabel.GenericData: options.Generic{
+			"BridgeName": "testportlease",
+		},
+	}
+	ipamV4ConfList := []*libnetwork.IpamConf{{PreferredPool: "192.168.101.0/24", Gateway: "192.168.101.1"}}
+
+	network, err := createTestNetwork(bridgeNetType, "testportlease", netOption, ipamV4ConfList, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := network.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// hostPort publishes port 80 of the container on an ephemeral host port
+	// and deletes its sandbox, as when the container is stopped.
+	hostPort := func() uint16 {
+		ep, err := network.CreateEndpoint("testep")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb, err := controller.NewSandbox(containerID, libnetwork.OptionPortMapping([]types.PortBinding{{Proto: types.TCP, Port: 80}}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ep.Join(sb); err != nil {
+			t.Fatal(err)
+		}
+		epInfo, err := ep.DriverInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm, ok := epInfo[netlabel.PortMap].([]types.PortBinding)
+		if !ok || len(pm) == 0 {
+			t.Fatalf("Unexpected port mapping in endpoint operational data: %v", epInfo[netlabel.PortMap])
+		}
+		if err := sb.Delete(); err != nil {
+			t.Fatal(err)
+		}
+		return pm[0].HostPort
+	}
+
+	port := hostPort()
+	if again := hostPort(); again != port {
+		t.Fatalf("Expected host port %d to be kept across the sandboxes of the container, got %d", port, again)
+	}
+
+	controller.ReleasePortLeases(containerID)
+	if other := hostPort(); other == port {
+		t.Fatalf("Expected host port %d to be released with the container", port)
+	}
+	controller.ReleasePortLeases(containerID)
+}
+
 func TestUnknownDriver(t *testing.T) {
 	if !testutils.IsRunningInContainer() {
 		defer testutils.SetupTestOSContext(t)()
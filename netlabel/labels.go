@@ -27,6 +27,10 @@ const (
 	// ExposedPorts constant represents the container's Exposed Ports
 	ExposedPorts = Prefix + ".endpoint.exposedports"
 
+	// PortOwner identifies the container the published ports are allocated
+	// for, so that it gets the same host ports back across daemon restarts
+	PortOwner = Prefix + ".endpoint.portowner"
+
 	// DNSServers A list of DNS servers associated with the endpoint
 	DNSServers = Prefix + ".endpoint.dnsservers"
 
@@ -45,6 +49,14 @@ const (
 	// OverlayVxlanIDList constant represents a list of VXLAN Ids as csv
 	OverlayVxlanIDList = DriverPrefix + ".overlay.vxlanid_list"
 
+	// OverlayVxlanIDRange constant represents the "start-end" range of the
+	// VXLAN Ids allocated to the overlay networks
+	OverlayVxlanIDRange = DriverPrefix + ".overlay.vxlanid_range"
+
+	// OverlayStaticPeers constant represents the path of the file listing
+	// the static peers of the overlay networks
+	OverlayStaticPeers = DriverPrefix + ".overlay.static_peers"
+
 	// Gateway represents the gateway for the network
 	Gateway = Prefix + ".gateway"
 
@@ -56,6 +68,22 @@ const (
 
 	// HostIP is the Source-IP Address used to SNAT container traffic
 	HostIP = Prefix + ".host_ipv4"
+
+	// HostIPv6 is the Source-IPv6 Address used to SNAT container traffic
+	HostIPv6 = Prefix + ".host_ipv6"
+
+	// FlowLog enables the logging of the connections and of the dropped
+	// packets of the network
+	FlowLog = Prefix + ".flow_log"
+
+	// EgressAllow is the comma separated list of the destinations, as in
+	// "192.0.2.10/32=443/tcp", the endpoints are restricted to outside of
+	// the network
+	EgressAllow = Prefix + ".egress_allow"
+
+	// EgressDeny is the comma separated list of the destinations the
+	// endpoints are denied outside of the network
+	EgressDeny = Prefix + ".egress_deny"
 )
 
 var (
@@ -1190,6 +1190,10 @@ func (n *network) createEndpoint(name string, options ...EndpointOption) (Endpoi
 
 	ep.processOptions(options...)
 
+	if err = portConfigs(ep.ingressPorts).validate(); err != nil {
+		return nil, err
+	}
+
 	for _, llIPNet := range ep.Iface().LinkLocalAddresses() {
 		if !llIPNet.IP.IsLinkLocalUnicast() {
 			return nil, types.BadRequestErrorf("invalid link local IP address: %v", llIPNet.IP)
@@ -1601,6 +1605,25 @@ func (n *network) requestPoolHelper(ipam ipamapi.Ipam, addressSpace, preferredPo
 	}
 }
 
+// poolRequestOptions returns the options to pass to the ipam driver on pool
+// requests. A named default pool selected through the network labels is added
+// unless the ipam options already select one.
+func (n *network) poolRequestOptions() map[string]string {
+	name, ok := n.labels[ipamapi.DefaultPoolName]
+	if !ok {
+		return n.ipamOptions
+	}
+	if _, ok := n.ipamOptions[ipamapi.DefaultPoolName]; ok {
+		return n.ipamOptions
+	}
+	opts := make(map[string]string, len(n.ipamOptions)+1)
+	for k, v := range n.ipamOptions {
+		opts[k] = v
+	}
+	opts[ipamapi.DefaultPoolName] = name
+	return opts
+}
+
 func (n *network) ipamAllocateVersion(ipVer int, ipam ipamapi.Ipam) error {
 	var (
 		cfgList  *[]*IpamConf
@@ -1635,7 +1658,7 @@ func (n *network) ipamAllocateVersion(ipVer int, ipam ipamapi.Ipam) error {
 		(*infoList)[i] = d
 
 		d.AddressSpace = n.addrSpace
-		d.PoolID, d.Pool, d.Meta, err = n.requestPoolHelper(ipam, n.addrSpace, cfg.PreferredPool, cfg.SubPool, n.ipamOptions, ipVer == 6)
+		d.PoolID, d.Pool, d.Meta, err = n.requestPoolHelper(ipam, n.addrSpace, cfg.PreferredPool, cfg.SubPool, n.poolRequestOptions(), ipVer == 6)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,489 @@
+package nftables
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// The rules are described with a subset of the nft syntax, compiled into
+// the nf_tables expressions:
+//
+//	iifname|oifname [!=] "name"
+//	ip|ip6 saddr|daddr [!=] address[/length]
+//	tcp|udp|sctp sport|dport port
+//	fib saddr|daddr type local
+//	ct state established,related
+//	ip|ip6 daddr . meta l4proto . th dport @set
+//	accept|drop|return|jump chain|masquerade|snat to address|dnat to address:port
+const (
+	regVerdict = 0
+	reg1       = 1
+	reg2       = 2
+	// first 32 bits register, used by the concatenations
+	reg32First = 8
+
+	cmpEq  = 0
+	cmpNeq = 1
+
+	payloadNetwork   = 1
+	payloadTransport = 2
+
+	metaIifname = 6
+	metaOifname = 7
+	metaL4proto = 16
+
+	ctState       = 0
+	ctEstablished = 1 << 1
+	ctRelated     = 1 << 2
+
+	fibAddrType  = 3
+	fibFlagSaddr = 1
+	fibFlagDaddr = 2
+
+	natSnat = 0
+	natDnat = 1
+
+	verdictDrop   = 0
+	verdictAccept = 1
+	verdictJump   = -3
+	verdictReturn = -5
+
+	ifNameSize = 16
+
+	// data types of the set keys, as known by nft
+	setKeyTypeBits    = 6
+	setKeyTypeIPv4    = 7
+	setKeyTypeIPv6    = 8
+	setKeyTypeProto   = 12
+	setKeyTypeService = 13
+)
+
+var l4Protos = map[string]byte{
+	"tcp":  unix.IPPROTO_TCP,
+	"udp":  unix.IPPROTO_UDP,
+	"sctp": unix.IPPROTO_SCTP,
+}
+
+// compiler turns a rule spec into the expressions of a rule
+type compiler struct {
+	family Family
+	tokens []string
+	exprs  []*nl.RtAttr
+}
+
+func compile(family Family, spec string) ([]*nl.RtAttr, error) {
+	tokens, err := tokenize(spec)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{family: family, tokens: tokens}
+	for len(c.tokens) > 0 {
+		if err := c.statement(); err != nil {
+			return nil, fmt.Errorf("invalid nftables rule %q: %v", spec, err)
+		}
+	}
+	return c.exprs, nil
+}
+
+// tokenize splits the spec on the spaces, except within quotes
+func tokenize(spec string) ([]string, error) {
+	var tokens []string
+	for spec = strings.TrimSpace(spec); spec != ""; spec = strings.TrimSpace(spec) {
+		if spec[0] == '"' {
+			s, err := strconv.QuotedPrefix(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string in %q", spec)
+			}
+			tokens = append(tokens, s)
+			spec = spec[len(s):]
+			continue
+		}
+		i := strings.IndexByte(spec, ' ')
+		if i < 0 {
+			i = len(spec)
+		}
+		tokens = append(tokens, spec[:i])
+		spec = spec[i:]
+	}
+	return tokens, nil
+}
+
+func (c *compiler) next() (string, error) {
+	if len(c.tokens) == 0 {
+		return "", fmt.Errorf("unexpected end of rule")
+	}
+	t := c.tokens[0]
+	c.tokens = c.tokens[1:]
+	return t, nil
+}
+
+func (c *compiler) peek() string {
+	if len(c.tokens) == 0 {
+		return ""
+	}
+	return c.tokens[0]
+}
+
+// op consumes an optional != and returns the comparison operator
+func (c *compiler) op() uint32 {
+	if c.peek() == "!=" {
+		c.tokens = c.tokens[1:]
+		return cmpNeq
+	}
+	return cmpEq
+}
+
+func (c *compiler) add(name string, attrs ...*nl.RtAttr) {
+	elem := nestedAttr(attrListElem, stringAttr(attrExprName, name))
+	if len(attrs) > 0 {
+		elem.AddChild(nestedAttr(attrExprData, attrs...))
+	}
+	c.exprs = append(c.exprs, elem)
+}
+
+func (c *compiler) statement() error {
+	t, err := c.next()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case "iifname", "oifname":
+		key := uint32(metaIifname)
+		if t == "oifname" {
+			key = metaOifname
+		}
+		op := c.op()
+		v, err := c.next()
+		if err != nil {
+			return err
+		}
+		name, err := strconv.Unquote(v)
+		if err != nil || len(name) >= ifNameSize {
+			return fmt.Errorf("invalid interface name %s", v)
+		}
+		data := make([]byte, ifNameSize)
+		copy(data, name)
+		c.meta(key, reg1)
+		c.cmp(op, reg1, data)
+	case "ip", "ip6":
+		if (t == "ip6") != (c.family == IPv6) {
+			return fmt.Errorf("%s match in a %s table", t, c.family)
+		}
+		dir, err := c.next()
+		if err != nil {
+			return err
+		}
+		if c.peek() == "." {
+			return c.concat(dir)
+		}
+		offset, length, err := c.addrOffset(dir)
+		if err != nil {
+			return err
+		}
+		op := c.op()
+		v, err := c.next()
+		if err != nil {
+			return err
+		}
+		ip, ipNet, err := c.parseAddr(v)
+		if err != nil {
+			return err
+		}
+		c.payload(payloadNetwork, offset, length, reg1)
+		if ipNet == nil {
+			c.cmp(op, reg1, ip)
+			return nil
+		}
+		c.add("bitwise", be32Attr(1, reg1), be32Attr(2, reg1), be32Attr(3, length),
+			nestedAttr(4, nl.NewRtAttr(attrDataValue, ipNet.Mask)),
+			nestedAttr(5, nl.NewRtAttr(attrDataValue, make([]byte, length))))
+		c.cmp(op, reg1, ipNet.IP)
+	case "tcp", "udp", "sctp":
+		dir, err := c.next()
+		if err != nil {
+			return err
+		}
+		v, err := c.next()
+		if err != nil {
+			return err
+		}
+		offset, err := portOffset(dir)
+		if err != nil {
+			return err
+		}
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port %s", v)
+		}
+		c.meta(metaL4proto, reg1)
+		c.cmp(cmpEq, reg1, []byte{l4Protos[t]})
+		c.payload(payloadTransport, offset, 2, reg1)
+		c.cmp(cmpEq, reg1, be16(uint16(port)))
+	case "fib":
+		dir, err := c.next()
+		if err != nil {
+			return err
+		}
+		flags := uint32(fibFlagDaddr)
+		if dir == "saddr" {
+			flags = fibFlagSaddr
+		} else if dir != "daddr" {
+			return fmt.Errorf("invalid fib selector %s", dir)
+		}
+		if typ, err := c.next(); err != nil || typ != "type" {
+			return fmt.Errorf("invalid fib expression")
+		}
+		if v, err := c.next(); err != nil || v != "local" {
+			return fmt.Errorf("only the local fib type is supported")
+		}
+		c.add("fib", be32Attr(1, reg1), be32Attr(2, fibAddrType), be32Attr(3, flags))
+		c.cmp(cmpEq, reg1, nl.Uint32Attr(unix.RTN_LOCAL))
+	case "ct":
+		if key, err := c.next(); err != nil || key != "state" {
+			return fmt.Errorf("only the ct state is supported")
+		}
+		v, err := c.next()
+		if err != nil {
+			return err
+		}
+		var mask uint32
+		for _, s := range strings.Split(v, ",") {
+			switch s {
+			case "established":
+				mask |= ctEstablished
+			case "related":
+				mask |= ctRelated
+			default:
+				return fmt.Errorf("invalid ct state %s", s)
+			}
+		}
+		c.add("ct", be32Attr(1, reg1), be32Attr(2, ctState))
+		c.add("bitwise", be32Attr(1, reg1), be32Attr(2, reg1), be32Attr(3, 4),
+			nestedAttr(4, nl.NewRtAttr(attrDataValue, nl.Uint32Attr(mask))),
+			nestedAttr(5, nl.NewRtAttr(attrDataValue, make([]byte, 4))))
+		c.cmp(cmpNeq, reg1, make([]byte, 4))
+	case "accept":
+		c.verdict(verdictAccept, "")
+	case "drop":
+		c.verdict(verdictDrop, "")
+	case "return":
+		c.verdict(verdictReturn, "")
+	case "jump":
+		chain, err := c.next()
+		if err != nil {
+			return err
+		}
+		c.verdict(verdictJump, chain)
+	case "masquerade":
+		c.add("masq")
+	case "snat", "dnat":
+		if to, err := c.next(); err != nil || to != "to" {
+			return fmt.Errorf("invalid %s statement", t)
+		}
+		v, err := c.next()
+		if err != nil {
+			return err
+		}
+		return c.nat(t, v)
+	default:
+		return fmt.Errorf("unexpected %s", t)
+	}
+	return nil
+}
+
+func (c *compiler) addrOffset(dir string) (uint32, uint32, error) {
+	switch {
+	case c.family == IPv4 && dir == "saddr":
+		return 12, net.IPv4len, nil
+	case c.family == IPv4 && dir == "daddr":
+		return 16, net.IPv4len, nil
+	case c.family == IPv6 && dir == "saddr":
+		return 8, net.IPv6len, nil
+	case c.family == IPv6 && dir == "daddr":
+		return 24, net.IPv6len, nil
+	}
+	return 0, 0, fmt.Errorf("invalid address selector %s", dir)
+}
+
+func portOffset(dir string) (uint32, error) {
+	switch dir {
+	case "sport":
+		return 0, nil
+	case "dport":
+		return 2, nil
+	}
+	return 0, fmt.Errorf("invalid port selector %s", dir)
+}
+
+// parseAddr parses an address or a network of the family of the table
+func (c *compiler) parseAddr(v string) (net.IP, *net.IPNet, error) {
+	if strings.Contains(v, "/") {
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ipNet.IP = c.familyIP(ipNet.IP); ipNet.IP == nil || len(ipNet.Mask) != len(ipNet.IP) {
+			return nil, nil, fmt.Errorf("%s is not a %s network", v, c.family)
+		}
+		return nil, ipNet, nil
+	}
+	ip := c.familyIP(net.ParseIP(v))
+	if ip == nil {
+		return nil, nil, fmt.Errorf("%s is not a %s address", v, c.family)
+	}
+	return ip, nil, nil
+}
+
+func (c *compiler) familyIP(ip net.IP) net.IP {
+	if ip == nil {
+		return nil
+	}
+	if c.family == IPv6 {
+		if ip.To4() != nil {
+			return nil
+		}
+		return ip.To16()
+	}
+	return ip.To4()
+}
+
+// concat matches the concatenation of selectors starting with the address
+// one against a set
+func (c *compiler) concat(dir string) error {
+	offset, length, err := c.addrOffset(dir)
+	if err != nil {
+		return err
+	}
+	reg := uint32(reg32First)
+	c.payload(payloadNetwork, offset, length, reg)
+	reg += length / 4
+	for c.peek() == "." {
+		c.tokens = c.tokens[1:]
+		sel, err := c.next()
+		if err != nil {
+			return err
+		}
+		key, err := c.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case sel == "meta" && key == "l4proto":
+			c.meta(metaL4proto, reg)
+		case sel == "th":
+			offset, err := portOffset(key)
+			if err != nil {
+				return err
+			}
+			c.payload(payloadTransport, offset, 2, reg)
+		default:
+			return fmt.Errorf("unsupported concatenation of %s %s", sel, key)
+		}
+		reg++
+	}
+	set, err := c.next()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(set, "@") {
+		return fmt.Errorf("expected a set lookup, got %s", set)
+	}
+	c.add("lookup", stringAttr(1, set[1:]), be32Attr(2, reg32First))
+	return nil
+}
+
+func (c *compiler) nat(typ, v string) error {
+	natType := uint32(natSnat)
+	if typ == "dnat" {
+		natType = natDnat
+	}
+	host, port := v, ""
+	if h, p, err := net.SplitHostPort(v); err == nil {
+		host, port = h, p
+	}
+	ip := c.familyIP(net.ParseIP(host))
+	if ip == nil {
+		return fmt.Errorf("%s is not a %s address", host, c.family)
+	}
+	attrs := []*nl.RtAttr{be32Attr(1, natType), be32Attr(2, uint32(nfproto(c.family))), be32Attr(3, reg1)}
+	c.immediate(reg1, ip)
+	if port != "" {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port %s", port)
+		}
+		c.immediate(reg2, be16(uint16(p)))
+		attrs = append(attrs, be32Attr(5, reg2))
+	}
+	c.add("nat", attrs...)
+	return nil
+}
+
+func (c *compiler) meta(key, reg uint32) {
+	c.add("meta", be32Attr(1, reg), be32Attr(2, key))
+}
+
+func (c *compiler) payload(base, offset, length, reg uint32) {
+	c.add("payload", be32Attr(1, reg), be32Attr(2, base), be32Attr(3, offset), be32Attr(4, length))
+}
+
+func (c *compiler) cmp(op, reg uint32, data []byte) {
+	c.add("cmp", be32Attr(1, reg), be32Attr(2, op), nestedAttr(3, nl.NewRtAttr(attrDataValue, data)))
+}
+
+func (c *compiler) immediate(reg uint32, data []byte) {
+	c.add("immediate", be32Attr(1, reg), nestedAttr(2, nl.NewRtAttr(attrDataValue, data)))
+}
+
+func (c *compiler) verdict(code int32, chain string) {
+	v := nestedAttr(attrDataVerdict, be32Attr(attrVerdictCode, uint32(code)))
+	if chain != "" {
+		v.AddChild(stringAttr(attrVerdictName, chain))
+	}
+	c.add("immediate", be32Attr(1, regVerdict), nestedAttr(2, v))
+}
+
+func be16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+// setKey returns the key of the published ports set element of the
+// container address, protocol and port
+func setKey(family Family, addr string, proto string, port int) ([]byte, error) {
+	c := &compiler{family: family}
+	ip := c.familyIP(net.ParseIP(addr))
+	if ip == nil {
+		return nil, fmt.Errorf("%s is not a %s address", addr, family)
+	}
+	p, ok := l4Protos[proto]
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol %s", proto)
+	}
+	key := append(append([]byte{}, ip...), p, 0, 0, 0)
+	key = append(key, be16(uint16(port))...)
+	key = append(key, 0, 0)
+	return key, nil
+}
+
+func setKeyType(family Family) uint32 {
+	addrType := uint32(setKeyTypeIPv4)
+	if family == IPv6 {
+		addrType = setKeyTypeIPv6
+	}
+	return (addrType<<setKeyTypeBits|setKeyTypeProto)<<setKeyTypeBits | setKeyTypeService
+}
+
+func setKeyLen(family Family) uint32 {
+	if family == IPv6 {
+		return net.IPv6len + 8
+	}
+	return net.IPv4len + 8
+}
@@ -0,0 +1,251 @@
+package nftables
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// nf_tables netlink API, see include/uapi/linux/netfilter/nf_tables.h
+const (
+	nfnlSubsysNftables = 10
+	nfnlMsgBatchBegin  = 16
+	nfnlMsgBatchEnd    = 17
+
+	msgNewTable   = 0
+	msgNewChain   = 3
+	msgGetChain   = 4
+	msgDelChain   = 5
+	msgNewRule    = 6
+	msgGetRule    = 7
+	msgDelRule    = 8
+	msgNewSet     = 9
+	msgNewSetElem = 12
+	msgDelSetElem = 14
+
+	attrTableName = 1
+
+	attrChainTable  = 1
+	attrChainName   = 3
+	attrChainHook   = 4
+	attrChainPolicy = 5
+	attrChainType   = 7
+
+	attrHookNum      = 1
+	attrHookPriority = 2
+
+	attrRuleTable       = 1
+	attrRuleChain       = 2
+	attrRuleHandle      = 3
+	attrRuleExpressions = 4
+	attrRuleUserdata    = 7
+
+	attrSetTable   = 1
+	attrSetName    = 2
+	attrSetKeyType = 4
+	attrSetKeyLen  = 5
+	attrSetID      = 10
+
+	attrSetElemListTable    = 1
+	attrSetElemListSet      = 2
+	attrSetElemListElements = 3
+	attrSetElemKey          = 1
+
+	attrListElem = 1
+	attrExprName = 1
+	attrExprData = 2
+
+	attrDataValue   = 1
+	attrDataVerdict = 2
+	attrVerdictCode = 1
+	attrVerdictName = 2
+
+	// userdata type of the rule comments, as set by nft
+	udataRuleComment = 0
+
+	hookPrerouting  = 0
+	hookForward     = 2
+	hookOutput      = 3
+	hookPostrouting = 4
+)
+
+// message is a nf_tables request, sent in the family of a table
+type message struct {
+	typ   uint16
+	flags uint16
+	attrs []*nl.RtAttr
+}
+
+// nfgenmsg is the header of the nfnetlink messages
+type nfgenmsg struct {
+	family uint8
+	resID  uint16
+}
+
+func (m *nfgenmsg) Len() int {
+	return 4
+}
+
+func (m *nfgenmsg) Serialize() []byte {
+	b := make([]byte, 4)
+	b[0] = m.family
+	binary.BigEndian.PutUint16(b[2:], m.resID)
+	return b
+}
+
+func nfproto(family Family) uint8 {
+	if family == IPv6 {
+		return unix.NFPROTO_IPV6
+	}
+	return unix.NFPROTO_IPV4
+}
+
+func newRequest(typ, flags uint16, family uint8, resID uint16, attrs ...*nl.RtAttr) *nl.NetlinkRequest {
+	req := nl.NewNetlinkRequest(int(typ), int(flags))
+	req.AddData(&nfgenmsg{family: family, resID: resID})
+	for _, a := range attrs {
+		req.AddData(a)
+	}
+	return req
+}
+
+func nftType(msg uint16) uint16 {
+	return nfnlSubsysNftables<<8 | msg
+}
+
+// sendBatch sends the messages to the kernel in a single batch, which is
+// committed or rejected as a whole. It is replaced in the tests.
+var sendBatch = func(family Family, msgs []message) error {
+	s, err := nl.Subscribe(unix.NETLINK_NETFILTER)
+	if err != nil {
+		return fmt.Errorf("failed to open the netfilter netlink socket: %v", err)
+	}
+	defer s.Close()
+	// The kernel stops answering a batch it cannot parse
+	if err := s.SetReceiveTimeout(&unix.Timeval{Sec: 10}); err != nil {
+		return err
+	}
+
+	var (
+		b    []byte
+		seqs = make(map[uint32]bool)
+	)
+	b = append(b, newRequest(nfnlMsgBatchBegin, 0, unix.AF_UNSPEC, nfnlSubsysNftables).Serialize()...)
+	for _, m := range msgs {
+		req := newRequest(nftType(m.typ), m.flags|unix.NLM_F_ACK, nfproto(family), 0, m.attrs...)
+		b = append(b, req.Serialize()...)
+		seqs[req.Seq] = true
+	}
+	b = append(b, newRequest(nfnlMsgBatchEnd, 0, unix.AF_UNSPEC, nfnlSubsysNftables).Serialize()...)
+
+	if err := unix.Sendto(s.GetFd(), b, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to send the nftables batch: %v", err)
+	}
+
+	// Every message of the batch is acknowledged, the errors abort the
+	// whole batch.
+	var batchErr error
+	for len(seqs) > 0 {
+		replies, _, err := s.Receive()
+		if err != nil {
+			if batchErr != nil {
+				return batchErr
+			}
+			return fmt.Errorf("failed to receive the nftables batch acknowledgements: %v", err)
+		}
+		for _, r := range replies {
+			if r.Header.Type != unix.NLMSG_ERROR || !seqs[r.Header.Seq] {
+				continue
+			}
+			delete(seqs, r.Header.Seq)
+			if errno := int32(nl.NativeEndian().Uint32(r.Data[0:4])); errno != 0 && batchErr == nil {
+				batchErr = syscall.Errno(-errno)
+			}
+		}
+	}
+	return batchErr
+}
+
+// query sends a get request to the kernel and returns the attributes of the
+// replies. It is replaced in the tests.
+var query = func(family Family, typ uint16, dump bool, attrs ...*nl.RtAttr) ([][]syscall.NetlinkRouteAttr, error) {
+	flags := uint16(unix.NLM_F_ACK)
+	if dump {
+		flags = unix.NLM_F_DUMP
+	}
+	replies, err := newRequest(nftType(typ), flags, nfproto(family), 0, attrs...).Execute(unix.NETLINK_NETFILTER, 0)
+	if err != nil {
+		return nil, err
+	}
+	var res [][]syscall.NetlinkRouteAttr
+	for _, r := range replies {
+		if len(r) < 4 {
+			continue
+		}
+		a, err := nl.ParseRouteAttr(r[4:])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, nil
+}
+
+func stringAttr(typ int, s string) *nl.RtAttr {
+	return nl.NewRtAttr(typ, nl.ZeroTerminated(s))
+}
+
+func be32Attr(typ int, v uint32) *nl.RtAttr {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return nl.NewRtAttr(typ, b)
+}
+
+func be64Attr(typ int, v uint64) *nl.RtAttr {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return nl.NewRtAttr(typ, b)
+}
+
+func nestedAttr(typ int, children ...*nl.RtAttr) *nl.RtAttr {
+	a := nl.NewRtAttr(typ|unix.NLA_F_NESTED, nil)
+	for _, c := range children {
+		a.AddChild(c)
+	}
+	return a
+}
+
+// attrString returns the string value of a netlink attribute
+func attrString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// commentUserdata encodes the comment of a rule the way nft does, so that
+// it shows in the nft listings.
+func commentUserdata(comment string) []byte {
+	value := nl.ZeroTerminated(comment)
+	return append([]byte{udataRuleComment, byte(len(value))}, value...)
+}
+
+// userdataComment decodes the comment of a rule
+func userdataComment(b []byte) string {
+	for len(b) >= 2 {
+		typ, l := b[0], int(b[1])
+		if len(b) < 2+l {
+			break
+		}
+		if typ == udataRuleComment {
+			return attrString(b[2 : 2+l])
+		}
+		b = b[2+l:]
+	}
+	return ""
+}
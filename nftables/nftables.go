@@ -0,0 +1,572 @@
+// Package nftables programs the libnetwork firewall rules in a table of its
+// own, as an alternative to the iptables package on hosts which only run
+// nftables. Every operation is sent to the kernel through the nf_tables
+// netlink API as a single batch, which is committed or rejected atomically.
+//
+// The table mirrors the iptables layout used by the drivers. Filter chains
+// keep their iptables names (FORWARD, DOCKER, DOCKER-USER, ...), while nat
+// chains are prefixed with "nat-" because both live in the same table. The
+// base chains hooked into netfilter only jump to those chains: forwarded
+// traffic always traverses DOCKER-USER before any chain managed by docker.
+package nftables
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// Family is the nftables family of a table, v4 or v6
+type Family string
+
+const (
+	// IPv4 is the family of the table holding the IPv4 rules
+	IPv4 Family = "ip"
+	// IPv6 is the family of the table holding the IPv6 rules
+	IPv6 Family = "ip6"
+)
+
+const (
+	// TableName is the name of the table owned by docker in each family
+	TableName = "docker"
+	// UserChain is the chain reserved to the user rules. Docker never
+	// flushes it, and forwarded traffic traverses it first.
+	UserChain = "DOCKER-USER"
+	// PublishedPortsSet holds the container address, protocol and port of
+	// each published port. Forwarded traffic matching it is accepted.
+	PublishedPortsSet = "published-ports"
+
+	natPrefix     = "nat-"
+	commentPrefix = "docker:"
+)
+
+var (
+	// ErrRuleNotFound is returned when deleting a rule which is not programmed.
+	ErrRuleNotFound = errors.New("nftables rule not found")
+	// ErrSourcesNotSupported is returned when restricting the sources of a
+	// port mapping.
+	ErrSourcesNotSupported = errors.New("restricting the sources of published ports is not supported with nftables")
+
+	// serializes the operations which inspect the ruleset before changing it
+	lock sync.Mutex
+	// reference count of the published ports set elements, per family
+	published = map[Family]map[string]int{}
+
+	// baseChains are hooked into netfilter and jump to the chains which
+	// hold the rules. They are rebuilt each time the table is set up.
+	baseChains = []struct {
+		name     string
+		typ      string
+		hook     uint32
+		priority int32
+		target   string
+	}{
+		{"forward", "filter", hookForward, 0, ""},
+		{"prerouting", "nat", hookPrerouting, -100, natPrefix + "PREROUTING"},
+		{"output", "nat", hookOutput, -100, natPrefix + "OUTPUT"},
+		{"postrouting", "nat", hookPostrouting, 100, natPrefix + "POSTROUTING"},
+	}
+)
+
+// Table is the docker table of a family
+type Table struct {
+	Family Family
+}
+
+// ChainInfo defines the nftables chain.
+type ChainInfo struct {
+	Name        string
+	Table       iptables.Table
+	HairpinMode bool
+	NFTable     Table
+}
+
+type rule struct {
+	table iptables.Table
+	chain string
+	spec  string
+}
+
+// GetTable returns the docker table for the given family
+func GetTable(family Family) *Table {
+	return &Table{Family: family}
+}
+
+// chainName returns the name in the docker table of the iptables chain
+func chainName(table iptables.Table, chain string) string {
+	if table == iptables.Nat {
+		return natPrefix + chain
+	}
+	return chain
+}
+
+// ruleID identifies a rule through the comment attached to it
+func ruleID(r rule) string {
+	sum := sha256.Sum256([]byte(chainName(r.table, r.chain) + " " + r.spec))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Loopback returns the loopback network of the table family
+func (t Table) Loopback() string {
+	if t.Family == IPv6 {
+		return "::1/128"
+	}
+	return "127.0.0.0/8"
+}
+
+// Addr formats an address and port as expected by the nat statements
+func (t Table) Addr(ip string, port int) string {
+	if t.Family == IPv6 {
+		return "[" + ip + "]:" + strconv.Itoa(port)
+	}
+	return ip + ":" + strconv.Itoa(port)
+}
+
+// send applies the messages to the docker table in a single batch
+func (t Table) send(msgs ...message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	return sendBatch(t.Family, msgs)
+}
+
+func (t Table) tableMsg() message {
+	return message{typ: msgNewTable, flags: unix.NLM_F_CREATE, attrs: []*nl.RtAttr{stringAttr(attrTableName, TableName)}}
+}
+
+func (t Table) chainMsg(typ uint16, name string) message {
+	return message{typ: typ, flags: unix.NLM_F_CREATE, attrs: []*nl.RtAttr{stringAttr(attrChainTable, TableName), stringAttr(attrChainName, name)}}
+}
+
+// baseChainMsg creates the base chain with the given index, and sets its
+// policy if not empty
+func (t Table) baseChainMsg(i int, policy iptables.Policy) message {
+	c := baseChains[i]
+	m := t.chainMsg(msgNewChain, c.name)
+	m.attrs = append(m.attrs,
+		nestedAttr(attrChainHook, be32Attr(attrHookNum, c.hook), be32Attr(attrHookPriority, uint32(c.priority))),
+		stringAttr(attrChainType, c.typ))
+	switch policy {
+	case iptables.Drop:
+		m.attrs = append(m.attrs, be32Attr(attrChainPolicy, verdictDrop))
+	case iptables.Accept:
+		m.attrs = append(m.attrs, be32Attr(attrChainPolicy, verdictAccept))
+	}
+	return m
+}
+
+// flushChainMsg deletes all the rules of the chain
+func (t Table) flushChainMsg(name string) message {
+	return message{typ: msgDelRule, attrs: []*nl.RtAttr{stringAttr(attrRuleTable, TableName), stringAttr(attrRuleChain, name)}}
+}
+
+func (t Table) setMsg() message {
+	return message{typ: msgNewSet, flags: unix.NLM_F_CREATE, attrs: []*nl.RtAttr{
+		stringAttr(attrSetTable, TableName),
+		stringAttr(attrSetName, PublishedPortsSet),
+		be32Attr(attrSetKeyType, setKeyType(t.Family)),
+		be32Attr(attrSetKeyLen, setKeyLen(t.Family)),
+		be32Attr(attrSetID, 1),
+	}}
+}
+
+// setElemMsg adds or deletes the element of the published ports set. No
+// key flushes the set.
+func (t Table) setElemMsg(typ uint16, key []byte) message {
+	m := message{typ: typ, attrs: []*nl.RtAttr{stringAttr(attrSetElemListTable, TableName), stringAttr(attrSetElemListSet, PublishedPortsSet)}}
+	if typ == msgNewSetElem {
+		m.flags = unix.NLM_F_CREATE
+	}
+	if key != nil {
+		m.attrs = append(m.attrs, nestedAttr(attrSetElemListElements,
+			nestedAttr(attrListElem, nestedAttr(attrSetElemKey, nl.NewRtAttr(attrDataValue, key)))))
+	}
+	return m
+}
+
+// ruleMsg appends or inserts the rule
+func (t Table) ruleMsg(action iptables.Action, r rule) (message, error) {
+	exprs, err := compile(t.Family, r.spec)
+	if err != nil {
+		return message{}, err
+	}
+	flags := uint16(unix.NLM_F_CREATE)
+	if action == iptables.Append {
+		flags |= unix.NLM_F_APPEND
+	}
+	return message{typ: msgNewRule, flags: flags, attrs: []*nl.RtAttr{
+		stringAttr(attrRuleTable, TableName),
+		stringAttr(attrRuleChain, chainName(r.table, r.chain)),
+		nestedAttr(attrRuleExpressions, exprs...),
+		nl.NewRtAttr(attrRuleUserdata, commentUserdata(commentPrefix+ruleID(r))),
+	}}, nil
+}
+
+// Setup creates the docker table, its base chains and the chains and sets
+// shared by the drivers. The rules previously programmed by docker are
+// flushed, the ones in the user chain are preserved.
+func (t Table) Setup() error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	msgs := []message{t.tableMsg()}
+	for i := range baseChains {
+		msgs = append(msgs, t.baseChainMsg(i, ""))
+	}
+	msgs = append(msgs, t.chainMsg(msgNewChain, UserChain))
+	for _, c := range []string{"FORWARD", natPrefix + "PREROUTING", natPrefix + "OUTPUT", natPrefix + "POSTROUTING"} {
+		msgs = append(msgs, t.chainMsg(msgNewChain, c), t.flushChainMsg(c))
+	}
+	msgs = append(msgs, t.setMsg(), t.setElemMsg(msgDelSetElem, nil))
+
+	jumps := []rule{
+		{iptables.Filter, "forward", "jump " + UserChain},
+		{iptables.Filter, "forward", "jump FORWARD"},
+	}
+	for _, c := range baseChains {
+		msgs = append(msgs, t.flushChainMsg(c.name))
+		if c.target != "" {
+			jumps = append(jumps, rule{iptables.Filter, c.name, "jump " + c.target})
+		}
+	}
+	for _, r := range jumps {
+		m, err := t.ruleMsg(iptables.Append, r)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, m)
+	}
+
+	if err := t.send(msgs...); err != nil {
+		return fmt.Errorf("failed to set up nftables table %s %s: %v", t.Family, TableName, err)
+	}
+	published[t.Family] = map[string]int{}
+	return nil
+}
+
+// SetDefaultPolicy sets the policy of the base chain filtering the forwarded traffic
+func (t Table) SetDefaultPolicy(policy iptables.Policy) error {
+	return t.send(t.baseChainMsg(0, policy))
+}
+
+// NewChain adds a new chain to the docker table
+func (t Table) NewChain(name string, table iptables.Table, hairpinMode bool) (*ChainInfo, error) {
+	c := &ChainInfo{
+		Name:        name,
+		Table:       table,
+		HairpinMode: hairpinMode,
+		NFTable:     t,
+	}
+	if err := t.send(t.chainMsg(msgNewChain, chainName(table, name))); err != nil {
+		return nil, fmt.Errorf("failed to create chain %s: %v", chainName(table, name), err)
+	}
+	return c, nil
+}
+
+// ExistChain checks if a chain exists
+func (t Table) ExistChain(chain string, table iptables.Table) bool {
+	_, err := query(t.Family, msgGetChain, false, stringAttr(attrChainTable, TableName), stringAttr(attrChainName, chainName(table, chain)))
+	return err == nil
+}
+
+// RemoveExistingChain removes existing chain from the table.
+func (t Table) RemoveExistingChain(name string, table iptables.Table) error {
+	c := &ChainInfo{
+		Name:    name,
+		Table:   table,
+		NFTable: t,
+	}
+	return c.Remove()
+}
+
+// Remove removes the chain.
+func (c *ChainInfo) Remove() error {
+	if !c.NFTable.ExistChain(c.Name, c.Table) {
+		return nil
+	}
+	name := chainName(c.Table, c.Name)
+	t := c.NFTable
+	del := t.chainMsg(msgDelChain, name)
+	del.flags = 0
+	return t.send(t.flushChainMsg(name), del)
+}
+
+// ProgramChain is used to add rules to a chain
+func (t Table) ProgramChain(c *ChainInfo, bridgeName string, hairpinMode, enable bool) error {
+	if c.Name == "" {
+		return errors.New("Could not program chain, missing chain name")
+	}
+
+	action := iptables.Append
+	if !enable {
+		action = iptables.Delete
+	}
+
+	var rules []rule
+	switch c.Table {
+	case iptables.Nat:
+		output := "fib daddr type local"
+		if !hairpinMode {
+			output += fmt.Sprintf(" %s daddr != %s", t.Family, t.Loopback())
+		}
+		rules = []rule{
+			{iptables.Nat, "PREROUTING", "fib daddr type local jump " + chainName(c.Table, c.Name)},
+			{iptables.Nat, "OUTPUT", output + " jump " + chainName(c.Table, c.Name)},
+		}
+	case iptables.Filter:
+		if bridgeName == "" {
+			return fmt.Errorf("Could not program chain %s/%s, missing bridge name",
+				c.Table, c.Name)
+		}
+		if enable {
+			action = iptables.Insert
+		}
+		// Inserted in reverse order, the conntrack rule ends up first
+		rules = []rule{
+			{iptables.Filter, "FORWARD", fmt.Sprintf("oifname %q jump %s", bridgeName, c.Name)},
+			{iptables.Filter, "FORWARD", fmt.Sprintf("oifname %q ct state related,established accept", bridgeName)},
+			{iptables.Filter, c.Name, fmt.Sprintf("iifname != %[1]q oifname %[1]q %[2]s daddr . meta l4proto . th dport @%[3]s accept",
+				bridgeName, t.Family, PublishedPortsSet)},
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	var pending []rule
+	for _, r := range rules {
+		if exists := t.exists(r); exists != enable {
+			pending = append(pending, r)
+		}
+	}
+	return t.program(action, pending...)
+}
+
+// ProgramRule adds the rule specified by spec to the given chain, or deletes it.
+func (t Table) ProgramRule(table iptables.Table, chain string, action iptables.Action, spec string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	return t.program(action, rule{table: table, chain: chain, spec: spec})
+}
+
+// Exists checks if the rule specified by spec is programmed in the given chain.
+func (t Table) Exists(table iptables.Table, chain string, spec string) bool {
+	lock.Lock()
+	defer lock.Unlock()
+	return t.exists(rule{table: table, chain: chain, spec: spec})
+}
+
+// EnsureJumpRule ensures the jump rule is on top
+func (t Table) EnsureJumpRule(fromChain, toChain string) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	r := rule{table: iptables.Filter, chain: fromChain, spec: "jump " + toChain}
+	if t.exists(r) {
+		if err := t.program(iptables.Delete, r); err != nil {
+			return err
+		}
+	}
+	return t.program(iptables.Insert, r)
+}
+
+func (t Table) exists(r rule) bool {
+	handles, err := t.handles(chainName(r.table, r.chain))
+	if err != nil {
+		return false
+	}
+	_, ok := handles[ruleID(r)]
+	return ok
+}
+
+// handles returns the handles of the rules docker programmed in the chain
+func (t Table) handles(chain string) (map[string]uint64, error) {
+	rules, err := query(t.Family, msgGetRule, true, stringAttr(attrRuleTable, TableName), stringAttr(attrRuleChain, chain))
+	if err != nil {
+		return nil, err
+	}
+	handles := make(map[string]uint64)
+	for _, attrs := range rules {
+		var (
+			ruleChain, comment string
+			handle             uint64
+		)
+		for _, a := range attrs {
+			switch a.Attr.Type &^ unix.NLA_F_NESTED {
+			case attrRuleChain:
+				ruleChain = attrString(a.Value)
+			case attrRuleHandle:
+				if len(a.Value) == 8 {
+					handle = binary.BigEndian.Uint64(a.Value)
+				}
+			case attrRuleUserdata:
+				comment = userdataComment(a.Value)
+			}
+		}
+		if ruleChain == chain && strings.HasPrefix(comment, commentPrefix) {
+			handles[strings.TrimPrefix(comment, commentPrefix)] = handle
+		}
+	}
+	return handles, nil
+}
+
+// program applies the action to all the rules in a single batch
+func (t Table) program(action iptables.Action, rules ...rule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var (
+		msgs    []message
+		handles = make(map[string]map[string]uint64)
+	)
+	for _, r := range rules {
+		chain := chainName(r.table, r.chain)
+		switch action {
+		case iptables.Append, iptables.Insert:
+			m, err := t.ruleMsg(action, r)
+			if err != nil {
+				return err
+			}
+			msgs = append(msgs, m)
+		case iptables.Delete:
+			if _, ok := handles[chain]; !ok {
+				h, err := t.handles(chain)
+				if err != nil {
+					return err
+				}
+				handles[chain] = h
+			}
+			handle, ok := handles[chain][ruleID(r)]
+			if !ok {
+				return fmt.Errorf("%v: %s %s", ErrRuleNotFound, chain, r.spec)
+			}
+			delete(handles[chain], ruleID(r))
+			msgs = append(msgs, message{typ: msgDelRule, attrs: []*nl.RtAttr{
+				stringAttr(attrRuleTable, TableName),
+				stringAttr(attrRuleChain, chain),
+				be64Attr(attrRuleHandle, handle),
+			}})
+		default:
+			return fmt.Errorf("unknown nftables action %q", action)
+		}
+	}
+	return t.send(msgs...)
+}
+
+// ForwardOwned behaves as Forward. The owner is not recorded: unlike the
+// iptables chains, the docker table is entirely rebuilt at startup, so that
+// no rule can outlive its network.
+func (c *ChainInfo) ForwardOwned(owner iptables.Owner, action iptables.Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) error {
+	return c.Forward(action, ip, port, proto, destAddr, destPort, bridgeName)
+}
+
+// ForwardFrom behaves as ForwardOwned. Restricting the sources of the
+// forwarded traffic is not supported by this backend.
+func (c *ChainInfo) ForwardFrom(owner iptables.Owner, action iptables.Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string, sources []*net.IPNet) error {
+	if len(sources) > 0 && action != iptables.Delete {
+		return ErrSourcesNotSupported
+	}
+	return c.Forward(action, ip, port, proto, destAddr, destPort, bridgeName)
+}
+
+// Forward adds or deletes the rules which forward the host port to the container
+func (c *ChainInfo) Forward(action iptables.Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) error {
+	t := c.NFTable
+	f := string(t.Family)
+
+	rules := []rule{
+		{iptables.Nat, c.Name, c.dnatSpec(ip, port, proto, destAddr, destPort, bridgeName)},
+		{iptables.Nat, "POSTROUTING", fmt.Sprintf("%[1]s saddr %[2]s %[1]s daddr %[2]s %[3]s dport %[4]d masquerade", f, destAddr, proto, destPort)},
+	}
+	// The CHECKSUM workaround installed by the iptables backend for sctp is
+	// only needed by kernels older than v4.10, which miss the fib expression
+	// this backend relies on anyway.
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	element := fmt.Sprintf("%s . %s . %d", destAddr, proto, destPort)
+	key, err := setKey(t.Family, destAddr, proto, destPort)
+	if err != nil {
+		return err
+	}
+	refs := published[t.Family]
+	if refs == nil {
+		refs = map[string]int{}
+		published[t.Family] = refs
+	}
+
+	if action == iptables.Delete {
+		if err := t.program(action, rules...); err != nil {
+			return err
+		}
+		if refs[element]--; refs[element] > 0 {
+			return nil
+		}
+		delete(refs, element)
+		return t.send(t.setElemMsg(msgDelSetElem, key))
+	}
+
+	if refs[element] == 0 {
+		if err := t.send(t.setElemMsg(msgNewSetElem, key)); err != nil {
+			return err
+		}
+	}
+	if err := t.program(action, rules...); err != nil {
+		if refs[element] == 0 {
+			t.send(t.setElemMsg(msgDelSetElem, key))
+		}
+		return err
+	}
+	refs[element]++
+	return nil
+}
+
+// ForwardExists checks whether the DNAT rule Forward programs for the port is
+// present, see ForwardOwned about the owner.
+func (c *ChainInfo) ForwardExists(owner iptables.Owner, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) bool {
+	return c.NFTable.Exists(iptables.Nat, c.Name, c.dnatSpec(ip, port, proto, destAddr, destPort, bridgeName))
+}
+
+func (c *ChainInfo) dnatSpec(ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) string {
+	dnat := fmt.Sprintf("%s dport %d", proto, port)
+	if !ip.IsUnspecified() {
+		dnat = fmt.Sprintf("%s daddr %s %s", c.NFTable.Family, ip, dnat)
+	}
+	if !c.HairpinMode {
+		dnat += fmt.Sprintf(" iifname != %q", bridgeName)
+	}
+	return dnat + " dnat to " + c.NFTable.Addr(destAddr, destPort)
+}
+
+// LinkOwned behaves as Link, see ForwardOwned about the owner.
+func (c *ChainInfo) LinkOwned(owner iptables.Owner, action iptables.Action, ip1, ip2 net.IP, port int, proto string, bridgeName string) error {
+	return c.Link(action, ip1, ip2, port, proto, bridgeName)
+}
+
+// Link adds reciprocal ACCEPT rule for two supplied IP addresses.
+// Traffic is allowed from ip1 to ip2 and vice-versa
+func (c *ChainInfo) Link(action iptables.Action, ip1, ip2 net.IP, port int, proto string, bridgeName string) error {
+	f := string(c.NFTable.Family)
+	lock.Lock()
+	defer lock.Unlock()
+	return c.NFTable.program(action,
+		// forward
+		rule{iptables.Filter, c.Name, fmt.Sprintf("iifname %[1]q oifname %[1]q %[2]s saddr %[3]s %[2]s daddr %[4]s %[5]s dport %[6]d accept",
+			bridgeName, f, ip1, ip2, proto, port)},
+		// reverse
+		rule{iptables.Filter, c.Name, fmt.Sprintf("iifname %[1]q oifname %[1]q %[2]s saddr %[3]s %[2]s daddr %[4]s %[5]s sport %[6]d accept",
+			bridgeName, f, ip2, ip1, proto, port)},
+	)
+}
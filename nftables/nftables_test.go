@@ -0,0 +1,165 @@
+package nftables
+
+import (
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/testutils"
+)
+
+func setupTable(t *testing.T, family Family) *Table {
+	table := GetTable(family)
+	if err := table.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func countRules(t *testing.T, table *Table, chain string) int {
+	handles, err := table.handles(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(handles)
+}
+
+func TestForward(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	table := setupTable(t, IPv4)
+	c, err := table.NewChain("DOCKER", iptables.Nat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !table.ExistChain("DOCKER", iptables.Nat) {
+		t.Fatal("nat chain not created")
+	}
+
+	hostIP := net.ParseIP("192.168.1.1")
+	if err := c.Forward(iptables.Append, hostIP, 8080, "tcp", "172.17.0.2", 80, "docker0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Forward(iptables.Append, net.IPv4zero, 8081, "tcp", "172.17.0.2", 80, "docker0"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.ForwardExists(iptables.Owner{}, hostIP, 8080, "tcp", "172.17.0.2", 80, "docker0") {
+		t.Fatal("DNAT rule not found")
+	}
+	if n := countRules(t, table, "nat-DOCKER"); n != 2 {
+		t.Fatalf("expected 2 DNAT rules, got %d", n)
+	}
+
+	// The set element is shared by both mappings: the kernel refuses to
+	// delete it twice.
+	if err := c.Forward(iptables.Delete, hostIP, 8080, "tcp", "172.17.0.2", 80, "docker0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Forward(iptables.Delete, net.IPv4zero, 8081, "tcp", "172.17.0.2", 80, "docker0"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRules(t, table, "nat-DOCKER") + countRules(t, table, "nat-POSTROUTING"); n != 0 {
+		t.Fatalf("expected all the rules to be removed, %d left", n)
+	}
+
+	if err := c.Forward(iptables.Delete, hostIP, 8080, "tcp", "172.17.0.2", 80, "docker0"); err == nil {
+		t.Fatal("expected an error when deleting a missing mapping")
+	}
+}
+
+func TestProgramChain(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	table := setupTable(t, IPv6)
+	user := rule{iptables.Filter, UserChain, `iifname "eth0" drop`}
+	if err := table.program(iptables.Append, user); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := table.NewChain("DOCKER", iptables.Filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := table.ProgramChain(filter, "br0", false, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countRules(t, table, "FORWARD"); n != 2 {
+		t.Fatalf("expected 2 FORWARD rules, got %d", n)
+	}
+	if n := countRules(t, table, "DOCKER"); n != 1 {
+		t.Fatalf("expected 1 DOCKER rule, got %d", n)
+	}
+
+	if err := table.ProgramChain(filter, "br0", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRules(t, table, "FORWARD") + countRules(t, table, "DOCKER"); n != 0 {
+		t.Fatalf("expected all the rules to be removed, %d left", n)
+	}
+
+	// A new setup flushes the docker rules, not the user ones
+	if err := table.ProgramRule(iptables.Filter, "FORWARD", iptables.Append, `oifname "br0" accept`); err != nil {
+		t.Fatal(err)
+	}
+	table = setupTable(t, IPv6)
+	if n := countRules(t, table, "FORWARD"); n != 0 {
+		t.Fatalf("expected the FORWARD chain to be flushed, %d rules left", n)
+	}
+	if !table.exists(user) {
+		t.Fatal("the user chain must not be flushed")
+	}
+	if err := table.RemoveExistingChain("DOCKER", iptables.Filter); err != nil {
+		t.Fatal(err)
+	}
+	if table.ExistChain("DOCKER", iptables.Filter) {
+		t.Fatal("chain not removed")
+	}
+}
+
+func TestProgramRule(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	for _, tc := range []struct {
+		family Family
+		table  iptables.Table
+		chain  string
+		spec   string
+	}{
+		{IPv4, iptables.Nat, "POSTROUTING", `ip saddr 172.17.0.0/16 oifname != "docker0" masquerade`},
+		{IPv4, iptables.Nat, "POSTROUTING", `ip saddr 172.17.0.0/16 oifname != "docker0" snat to 192.168.1.1`},
+		{IPv4, iptables.Nat, "POSTROUTING", `fib saddr type local oifname "docker0" masquerade`},
+		{IPv4, iptables.Nat, "PREROUTING", `fib daddr type local ip daddr != 127.0.0.0/8 jump nat-POSTROUTING`},
+		{IPv4, iptables.Filter, "FORWARD", `oifname "docker0" ct state related,established accept`},
+		{IPv4, iptables.Filter, "FORWARD", `iifname != "docker0" oifname "docker0" ip saddr 10.0.0.0/8 ip daddr 172.17.0.2 udp dport 53 accept`},
+		{IPv4, iptables.Filter, "FORWARD", `iifname "docker0" oifname "docker0" ip daddr . meta l4proto . th dport @published-ports accept`},
+		{IPv6, iptables.Nat, "OUTPUT", `ip6 daddr 2001:db8::1 sctp dport 80 dnat to [2001:db8::2]:8080`},
+		{IPv6, iptables.Filter, "FORWARD", `iifname "docker0" ip6 daddr != 2001:db8::/64 drop`},
+		{IPv6, iptables.Filter, "FORWARD", `ip6 daddr . meta l4proto . th dport @published-ports return`},
+	} {
+		table := setupTable(t, tc.family)
+		if err := table.ProgramRule(tc.table, tc.chain, iptables.Insert, tc.spec); err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		if !table.Exists(tc.table, tc.chain, tc.spec) {
+			t.Fatalf("%s: rule not found", tc.spec)
+		}
+		if err := table.ProgramRule(tc.table, tc.chain, iptables.Delete, tc.spec); err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+	}
+
+	table := GetTable(IPv4)
+	for _, spec := range []string{
+		`ip6 saddr ::1 accept`,
+		`ip saddr 2001:db8::1 accept`,
+		`iifname docker0 accept`,
+		`tcp dport http accept`,
+		`counter accept`,
+	} {
+		if err := table.ProgramRule(iptables.Filter, "FORWARD", iptables.Append, spec); err == nil {
+			t.Fatalf("expected an error for rule %q", spec)
+		}
+	}
+}
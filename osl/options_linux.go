@@ -22,6 +22,12 @@ func (n *networkNamespace) Family(family int) NeighOption {
 	}
 }
 
+func (n *networkNamespace) MasterFDB(master bool) NeighOption {
+	return func(nh *neigh) {
+		nh.master = master
+	}
+}
+
 func (i *nwIface) processInterfaceOptions(options ...IfaceOption) {
 	for _, opt := range options {
 		if opt != nil {
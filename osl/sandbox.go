@@ -98,6 +98,11 @@ type NeighborOptionSetter interface {
 	// Family returns an option setter to set the address family for the neighbor
 	// entry. eg. AF_BRIDGE
 	Family(int) NeighOption
+
+	// MasterFDB returns an option setter to program an AF_BRIDGE entry in
+	// the forwarding database of the bridge the link is attached to,
+	// instead of in the database of the link itself
+	MasterFDB(bool) NeighOption
 }
 
 // IfaceOptionSetter interface defines the option setter methods for interface options.
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
+
+	"github.com/docker/libnetwork/datastore"
 )
 
 var (
@@ -63,12 +66,17 @@ func (e ErrPortAlreadyAllocated) Error() string {
 }
 
 type (
-	// PortAllocator manages the transport ports database
+	// PortAllocator manages the transport ports database. The ports
+	// leased to an owner are preferred when the owner requests a port
+	// again, and the reserved port ranges are never allocated.
 	PortAllocator struct {
-		mutex sync.Mutex
-		ipMap ipMapping
-		Begin int
-		End   int
+		mutex        sync.Mutex
+		ipMap        ipMapping
+		leases       map[string]*portRecord
+		reservations []*portRecord
+		store        datastore.DataStore
+		Begin        int
+		End          int
 	}
 	portRange struct {
 		begin int
@@ -100,9 +108,10 @@ func newInstance() *PortAllocator {
 		start, end = defaultPortRangeStart, defaultPortRangeEnd
 	}
 	return &PortAllocator{
-		ipMap: ipMapping{},
-		Begin: start,
-		End:   end,
+		ipMap:  ipMapping{},
+		leases: map[string]*portRecord{},
+		Begin:  start,
+		End:    end,
 	}
 }
 
@@ -142,20 +151,180 @@ func (p *PortAllocator) RequestPortInRange(ip net.IP, proto string, portStart, p
 	}
 	mapping := protomap[proto]
 	if portStart > 0 && portStart == portEnd {
-		if _, ok := mapping.p[portStart]; !ok {
+		if _, ok := mapping.p[portStart]; !ok && !p.reserved(ipstr, proto, portStart) {
 			mapping.p[portStart] = struct{}{}
 			return portStart, nil
 		}
 		return 0, newErrPortAlreadyAllocated(ipstr, portStart)
 	}
 
-	port, err := mapping.findPort(portStart, portEnd)
+	// Keep the ports leased to their owners, unless there is no other
+	port, err := mapping.findPort(portStart, portEnd, func(port int) bool {
+		_, leased := p.leases[leaseKey(ipstr, proto, port)]
+		return leased || p.reserved(ipstr, proto, port)
+	})
+	if err == ErrAllPortsAllocated {
+		port, err = mapping.findPort(portStart, portEnd, func(port int) bool {
+			return p.reserved(ipstr, proto, port)
+		})
+	}
 	if err != nil {
 		return 0, err
 	}
 	return port, nil
 }
 
+// LeasedPort returns the port of the range last leased to the owner for the
+// specified ip and proto if it is free, otherwise 0. The range is the default
+// ephemeral range if portStart and portEnd are 0.
+func (p *PortAllocator) LeasedPort(owner string, ip net.IP, proto string, portStart, portEnd int) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if ip == nil {
+		ip = defaultIP
+	}
+	if portStart == 0 && portEnd == 0 {
+		portStart, portEnd = p.Begin, p.End
+	}
+	ipstr := ip.String()
+	for _, r := range p.leases {
+		if r.Owner != owner || r.IP != ipstr || r.Proto != proto || r.Begin < portStart || r.Begin > portEnd {
+			continue
+		}
+		if protomap, ok := p.ipMap[ipstr]; ok {
+			if _, allocated := protomap[proto].p[r.Begin]; allocated {
+				continue
+			}
+		}
+		if p.reserved(ipstr, proto, r.Begin) {
+			continue
+		}
+		return r.Begin
+	}
+	return 0
+}
+
+// Lease records the port as the one of the owner, so that the owner gets it
+// back after releasing it, across daemon restarts when the allocator has a
+// store. A port is leased to one owner at a time.
+func (p *PortAllocator) Lease(owner string, ip net.IP, proto string, port int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if ip == nil {
+		ip = defaultIP
+	}
+	key := leaseKey(ip.String(), proto, port)
+	r, ok := p.leases[key]
+	if ok && r.Owner == owner {
+		return
+	}
+	if !ok {
+		r = &portRecord{Kind: kindLease, IP: ip.String(), Proto: proto, Begin: port, End: port}
+		p.leases[key] = r
+	}
+	r.Owner = owner
+	p.storeUpdate(r)
+}
+
+// ReleaseLeases releases the ports leased to the owner, and to the ports of
+// the owner, as in "owner/80": they are allocated again like any other.
+func (p *PortAllocator) ReleaseLeases(owner string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for key, r := range p.leases {
+		if r.Owner != owner && !strings.HasPrefix(r.Owner, owner+"/") {
+			continue
+		}
+		delete(p.leases, key)
+		p.storeDelete(r)
+	}
+}
+
+// ReservePortRange reserves the port range of the specified ip and proto
+// for use outside of the allocator. A range reserved on the unspecified
+// address is reserved on every address.
+func (p *PortAllocator) ReservePortRange(ip net.IP, proto string, portStart, portEnd int) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if proto != "tcp" && proto != "udp" && proto != "sctp" {
+		return ErrUnknownProtocol
+	}
+	if portStart <= 0 || portEnd < portStart || portEnd > 65535 {
+		return fmt.Errorf("invalid port range: %s", getRangeKey(portStart, portEnd))
+	}
+	if ip == nil {
+		ip = defaultIP
+	}
+	ipstr := ip.String()
+	r := &portRecord{Kind: kindReservation, IP: ipstr, Proto: proto, Begin: portStart, End: portEnd}
+
+	for _, o := range p.reservations {
+		if o.contains(ipstr, proto, portStart) || r.contains(o.IP, o.Proto, o.Begin) {
+			return fmt.Errorf("port range %s overlaps with reserved range %s", getRangeKey(portStart, portEnd), getRangeKey(o.Begin, o.End))
+		}
+	}
+	for mapIP, protomap := range p.ipMap {
+		for port := range protomap[proto].p {
+			if r.contains(mapIP, proto, port) {
+				return newErrPortAlreadyAllocated(mapIP, port)
+			}
+		}
+	}
+
+	p.reservations = append(p.reservations, r)
+	p.storeUpdate(r)
+	return nil
+}
+
+// ReleasePortRange releases a port range reserved with ReservePortRange
+func (p *PortAllocator) ReleasePortRange(ip net.IP, proto string, portStart, portEnd int) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if ip == nil {
+		ip = defaultIP
+	}
+	for i, r := range p.reservations {
+		if r.IP == ip.String() && r.Proto == proto && r.Begin == portStart && r.End == portEnd {
+			p.reservations = append(p.reservations[:i], p.reservations[i+1:]...)
+			p.storeDelete(r)
+			return nil
+		}
+	}
+	return fmt.Errorf("port range %s/%s on %s is not reserved", getRangeKey(portStart, portEnd), proto, ip)
+}
+
+// ReservedPortRanges returns the reserved port ranges
+func (p *PortAllocator) ReservedPortRanges() []PortRange {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ranges := make([]PortRange, 0, len(p.reservations))
+	for _, r := range p.reservations {
+		ranges = append(ranges, PortRange{IP: net.ParseIP(r.IP), Proto: r.Proto, Begin: r.Begin, End: r.End})
+	}
+	return ranges
+}
+
+// reserved returns whether the port is in a reserved range, to be called
+// with the mutex held
+func (p *PortAllocator) reserved(ipstr, proto string, port int) bool {
+	for _, r := range p.reservations {
+		if r.contains(ipstr, proto, port) {
+			return true
+		}
+	}
+	return false
+}
+
+func leaseKey(ipstr, proto string, port int) string {
+	return fmt.Sprintf("%s/%s/%d", ipstr, proto, port)
+}
+
 // ReleasePort releases port from global ports pool for specified ip and proto.
 func (p *PortAllocator) ReleasePort(ip net.IP, proto string, port int) error {
 	p.mutex.Lock()
@@ -228,7 +397,9 @@ func (pm *portMap) getPortRange(portStart, portEnd int) (*portRange, error) {
 	return pr, nil
 }
 
-func (pm *portMap) findPort(portStart, portEnd int) (int, error) {
+// findPort returns the first free port of the range after the last one
+// allocated, ignoring the ports to skip
+func (pm *portMap) findPort(portStart, portEnd int, skip func(port int) bool) (int, error) {
 	pr, err := pm.getPortRange(portStart, portEnd)
 	if err != nil {
 		return 0, err
@@ -241,7 +412,7 @@ func (pm *portMap) findPort(portStart, portEnd int) (int, error) {
 			port = pr.begin
 		}
 
-		if _, ok := pm.p[port]; !ok {
+		if _, ok := pm.p[port]; !ok && !skip(port) {
 			pm.p[port] = struct{}{}
 			pr.last = port
 			return port, nil
@@ -1,12 +1,23 @@
 package portallocator
 
 import (
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/docker/libkv/store"
+	"github.com/docker/libkv/store/boltdb"
+	"github.com/docker/libnetwork/datastore"
 	_ "github.com/docker/libnetwork/testutils"
 )
 
+func init() {
+	boltdb.Register()
+}
+
 func resetPortAllocator() {
 	instance = newInstance()
 }
@@ -321,3 +332,151 @@ func TestNoDuplicateBPR(t *testing.T) {
 		t.Fatalf("Acquire(0) allocated the same port twice: %d", port)
 	}
 }
+
+func TestReservePortRange(t *testing.T) {
+	p := Get()
+	defer resetPortAllocator()
+
+	if _, err := p.RequestPort(defaultIP, "tcp", 8080); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ReservePortRange(nil, "tcp", 8000, 8090); err == nil {
+		t.Fatal("Expected an error reserving a range with an allocated port")
+	}
+	if err := p.ReservePortRange(nil, "tcp", 9000, 9010); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ReservePortRange(net.ParseIP("127.0.0.1"), "tcp", 9010, 9020); err == nil {
+		t.Fatal("Expected an error reserving an overlapping range")
+	}
+
+	// The reserved ports are neither requested nor allocated on any address
+	if _, err := p.RequestPort(net.ParseIP("127.0.0.1"), "tcp", 9005); err == nil {
+		t.Fatal("Expected an error requesting a reserved port")
+	}
+	port, err := p.RequestPortInRange(defaultIP, "tcp", 9000, 9011)
+	if err != nil || port != 9011 {
+		t.Fatalf("Expected port 9011, got %d (%v)", port, err)
+	}
+	if _, err := p.RequestPort(defaultIP, "udp", 9005); err != nil {
+		t.Fatalf("Expected the udp port to be free: %v", err)
+	}
+
+	if ranges := p.ReservedPortRanges(); len(ranges) != 1 || ranges[0].Begin != 9000 || ranges[0].End != 9010 {
+		t.Fatalf("Unexpected reserved ranges %v", ranges)
+	}
+	if err := p.ReleasePortRange(nil, "tcp", 9000, 9010); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(defaultIP, "tcp", 9005); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestStore(t *testing.T) (datastore.DataStore, func()) {
+	dir, err := ioutil.TempDir("", "portallocator")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := datastore.NewDataStore(datastore.LocalScope, &datastore.ScopeCfg{
+		Client: datastore.ScopeClientCfg{
+			Provider: "boltdb",
+			Address:  filepath.Join(dir, "local-kv.db"),
+			Config: &store.Config{
+				Bucket:            "libnetwork",
+				ConnectionTimeout: 3 * time.Second,
+			},
+		},
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return ds, func() {
+		ds.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLeasedPortPersistence(t *testing.T) {
+	ds, cleanup := newTestStore(t)
+	defer cleanup()
+
+	p := newInstance()
+	if err := p.SetStore(ds); err != nil {
+		t.Fatal(err)
+	}
+	port, err := p.RequestPort(defaultIP, "tcp", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Lease("c1/80", defaultIP, "tcp", port)
+	if err := p.ReservePortRange(nil, "udp", 5000, 5001); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new allocator, as after a daemon restart, gets the state back
+	p = newInstance()
+	if err := p.SetStore(ds); err != nil {
+		t.Fatal(err)
+	}
+	if leased := p.LeasedPort("c1/80", defaultIP, "tcp", 0, 0); leased != port {
+		t.Fatalf("Expected leased port %d, got %d", port, leased)
+	}
+	if leased := p.LeasedPort("c2/80", defaultIP, "tcp", 0, 0); leased != 0 {
+		t.Fatalf("Expected no port leased to another owner, got %d", leased)
+	}
+	if _, err := p.RequestPort(defaultIP, "udp", 5001); err == nil {
+		t.Fatal("Expected the reservation to be restored")
+	}
+
+	// The leased port is kept for its owner by the ephemeral allocation
+	other, err := p.RequestPort(defaultIP, "tcp", 0)
+	if err != nil || other == port {
+		t.Fatalf("Expected a port other than the leased one, got %d (%v)", other, err)
+	}
+	if _, err := p.RequestPort(defaultIP, "tcp", port); err != nil {
+		t.Fatal(err)
+	}
+	if leased := p.LeasedPort("c1/80", defaultIP, "tcp", 0, 0); leased != 0 {
+		t.Fatalf("Expected no free leased port, got %d", leased)
+	}
+}
+
+func TestReleaseLeases(t *testing.T) {
+	ds, cleanup := newTestStore(t)
+	defer cleanup()
+
+	newAllocator := func() *PortAllocator {
+		p := &PortAllocator{ipMap: ipMapping{}, leases: map[string]*portRecord{}, Begin: 60000, End: 60001}
+		if err := p.SetStore(ds); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	p := newAllocator()
+	port, err := p.RequestPort(defaultIP, "tcp", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Lease("c1/80", defaultIP, "tcp", port)
+	p.Lease("c10/80", defaultIP, "tcp", port+1)
+	p.ReleaseLeases("c1")
+	if err := p.ReleasePort(defaultIP, "tcp", port); err != nil {
+		t.Fatal(err)
+	}
+
+	// The port of the deleted owner is neither restored nor skipped
+	p = newAllocator()
+	if leased := p.LeasedPort("c1/80", defaultIP, "tcp", 0, 0); leased != 0 {
+		t.Fatalf("Expected no port leased to the deleted owner, got %d", leased)
+	}
+	if leased := p.LeasedPort("c10/80", defaultIP, "tcp", 0, 0); leased != port+1 {
+		t.Fatalf("Expected port %d leased to another owner, got %d", port+1, leased)
+	}
+	if other, err := p.RequestPort(defaultIP, "tcp", 0); err != nil || other != port {
+		t.Fatalf("Expected port %d to be allocated again, got %d (%v)", port, other, err)
+	}
+}
@@ -0,0 +1,143 @@
+package portallocator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/docker/libnetwork/datastore"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	portAllocatorPrefix = "portallocator"
+
+	kindLease       = "lease"
+	kindReservation = "reservation"
+)
+
+// PortRange is a range of ports of a protocol, on an address
+type PortRange struct {
+	IP    net.IP
+	Proto string
+	Begin int
+	End   int
+}
+
+// portRecord is the persisted state of a port leased to an owner, or of a
+// reserved port range
+type portRecord struct {
+	Kind     string
+	IP       string
+	Proto    string
+	Begin    int
+	End      int
+	Owner    string
+	dbIndex  uint64
+	dbExists bool
+}
+
+func (r *portRecord) Key() []string {
+	return []string{portAllocatorPrefix, r.Kind, r.IP, r.Proto, fmt.Sprintf("%d-%d", r.Begin, r.End)}
+}
+
+func (r *portRecord) KeyPrefix() []string {
+	return []string{portAllocatorPrefix}
+}
+
+func (r *portRecord) Value() []byte {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (r *portRecord) SetValue(value []byte) error {
+	return json.Unmarshal(value, r)
+}
+
+func (r *portRecord) Index() uint64 {
+	return r.dbIndex
+}
+
+func (r *portRecord) SetIndex(index uint64) {
+	r.dbIndex = index
+	r.dbExists = true
+}
+
+func (r *portRecord) Exists() bool {
+	return r.dbExists
+}
+
+func (r *portRecord) Skip() bool {
+	return false
+}
+
+func (r *portRecord) New() datastore.KVObject {
+	return &portRecord{}
+}
+
+func (r *portRecord) CopyTo(o datastore.KVObject) error {
+	dst := o.(*portRecord)
+	*dst = *r
+	return nil
+}
+
+func (r *portRecord) DataScope() string {
+	return datastore.LocalScope
+}
+
+func (r *portRecord) contains(ipstr, proto string, port int) bool {
+	return r.Proto == proto && port >= r.Begin && port <= r.End &&
+		(r.IP == ipstr || isWildcard(r.IP) || isWildcard(ipstr))
+}
+
+func isWildcard(ipstr string) bool {
+	return ipstr == net.IPv4zero.String() || ipstr == net.IPv6zero.String()
+}
+
+// SetStore persists the port leases and the reserved port ranges of the
+// allocator in the store, and restores the ones held in it.
+func (p *PortAllocator) SetStore(ds datastore.DataStore) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.store = ds
+	if ds == nil {
+		return nil
+	}
+
+	kvol, err := ds.List(datastore.Key(portAllocatorPrefix), &portRecord{})
+	if err != nil && err != datastore.ErrKeyNotFound {
+		return fmt.Errorf("failed to get port allocations from store: %v", err)
+	}
+	for _, kvo := range kvol {
+		r := kvo.(*portRecord)
+		switch r.Kind {
+		case kindLease:
+			p.leases[leaseKey(r.IP, r.Proto, r.Begin)] = r
+		case kindReservation:
+			p.reservations = append(p.reservations, r)
+		}
+	}
+	return nil
+}
+
+func (p *PortAllocator) storeUpdate(r *portRecord) {
+	if p.store == nil {
+		return
+	}
+	if err := p.store.PutObjectAtomic(r); err != nil {
+		logrus.Warnf("Failed to persist port %s %s/%d-%d: %v", r.Kind, r.IP, r.Begin, r.End, err)
+	}
+}
+
+func (p *PortAllocator) storeDelete(r *portRecord) {
+	if p.store == nil || !r.Exists() {
+		return
+	}
+	if err := p.store.DeleteObjectAtomic(r); err != nil {
+		logrus.Warnf("Failed to delete port %s %s/%d-%d from store: %v", r.Kind, r.IP, r.Begin, r.End, err)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/docker/libnetwork/portallocator"
+	"github.com/docker/libnetwork/proxy"
+	"github.com/docker/libnetwork/types"
 	"github.com/ishidawataru/sctp"
 	"github.com/sirupsen/logrus"
 )
@@ -15,9 +18,17 @@ type mapping struct {
 	userlandProxy userlandProxy
 	host          net.Addr
 	container     net.Addr
+	// network and endpoint the mapping was requested for, if known
+	networkID  string
+	endpointID string
+	// sources allowed to reach the container port, any if empty
+	sources []*net.IPNet
+	// proxyOnly is set when the traffic must go through the userland
+	// proxy, which is then the only one to reach the container port
+	proxyOnly bool
 }
 
-var newProxy = newProxyCommand
+var newProxy = newUserlandProxy
 
 var (
 	// ErrUnknownBackendAddressType refers to an unknown container or unsupported address type
@@ -28,8 +39,28 @@ var (
 	ErrPortNotMapped = errors.New("port is not mapped")
 	// ErrSCTPAddrNoIP refers to a SCTP address without IP address.
 	ErrSCTPAddrNoIP = errors.New("sctp address does not contain any IP address")
+	// ErrProxyProtocolNoProxy refers to a PROXY protocol header requested for a mapping without userland proxy
+	ErrProxyProtocolNoProxy = errors.New("PROXY protocol requires the userland proxy")
 )
 
+// MapOptions are the optional settings of a mapping
+type MapOptions struct {
+	// NetworkID and EndpointID identify the endpoint the mapping is
+	// requested for in the forwarding table entries
+	NetworkID  string
+	EndpointID string
+	// ProxyProtocol is the version of the PROXY protocol header the userland
+	// proxy sends to the container ahead of the client stream, none if empty
+	ProxyProtocol string
+	// SourceCIDRs are the sources the forwarding table entries let reach
+	// the container port, any if empty
+	SourceCIDRs []*net.IPNet
+	// MaxConnections and IdleTimeout limit the connections of the userland
+	// proxy, see proxy.Options
+	MaxConnections int
+	IdleTimeout    time.Duration
+}
+
 // New returns a new instance of PortMapper
 func New(proxyPath string) *PortMapper {
 	return NewWithPortAllocator(portallocator.Get(), proxyPath)
@@ -51,9 +82,50 @@ func (pm *PortMapper) Map(container net.Addr, hostIP net.IP, hostPort int, usePr
 
 // MapRange maps the specified container transport address to the host's network address and transport port range
 func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart, hostPortEnd int, useProxy bool) (host net.Addr, err error) {
+	return pm.MapRangeForEndpoint("", "", container, hostIP, hostPortStart, hostPortEnd, useProxy)
+}
+
+// MapRangeForEndpoint behaves as MapRange, recording the network and the
+// endpoint the mapping is requested for in the forwarding table entries.
+func (pm *PortMapper) MapRangeForEndpoint(nid, eid string, container net.Addr, hostIP net.IP, hostPortStart, hostPortEnd int, useProxy bool) (host net.Addr, err error) {
+	return pm.MapRangeWithOptions(container, hostIP, hostPortStart, hostPortEnd, useProxy, MapOptions{NetworkID: nid, EndpointID: eid})
+}
+
+// MapRangeWithOptions behaves as MapRange, applying the given options to the
+// mapping.
+func (pm *PortMapper) MapRangeWithOptions(container net.Addr, hostIP net.IP, hostPortStart, hostPortEnd int, useProxy bool, opts MapOptions) (host net.Addr, err error) {
+	bnd := types.PortBinding{ProxyProtocol: opts.ProxyProtocol}
+	switch container.(type) {
+	case *net.TCPAddr:
+		bnd.Proto = types.TCP
+	case *net.UDPAddr:
+		bnd.Proto = types.UDP
+	case *sctp.SCTPAddr:
+		bnd.Proto = types.SCTP
+	}
+	if err := bnd.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.ProxyProtocol != "" && !useProxy {
+		return nil, ErrProxyProtocolNoProxy
+	}
+	if opts.MaxConnections < 0 {
+		return nil, fmt.Errorf("invalid maximum number of proxied connections %d", opts.MaxConnections)
+	}
+	if opts.IdleTimeout < 0 {
+		return nil, fmt.Errorf("invalid proxied connection idle timeout %v", opts.IdleTimeout)
+	}
+	proxyOpts := proxy.Options{
+		ProxyProtocol:  opts.ProxyProtocol,
+		MaxConnections: opts.MaxConnections,
+		IdleTimeout:    opts.IdleTimeout,
+	}
+
 	pm.lock.Lock()
 	defer pm.lock.Unlock()
 
+	nid, eid := opts.NetworkID, opts.EndpointID
+
 	var (
 		m                 *mapping
 		proto             string
@@ -68,13 +140,16 @@ func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart,
 		}
 
 		m = &mapping{
-			proto:     proto,
-			host:      &net.TCPAddr{IP: hostIP, Port: allocatedHostPort},
-			container: container,
+			proto:      proto,
+			networkID:  nid,
+			endpointID: eid,
+			sources:    opts.SourceCIDRs,
+			host:       &net.TCPAddr{IP: hostIP, Port: allocatedHostPort},
+			container:  container,
 		}
 
 		if useProxy {
-			m.userlandProxy, err = newProxy(proto, hostIP, allocatedHostPort, container.(*net.TCPAddr).IP, container.(*net.TCPAddr).Port, pm.proxyPath)
+			m.userlandProxy, err = newProxy(proto, hostIP, allocatedHostPort, container.(*net.TCPAddr).IP, container.(*net.TCPAddr).Port, pm.proxyPath, proxyOpts)
 			if err != nil {
 				return nil, err
 			}
@@ -91,13 +166,16 @@ func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart,
 		}
 
 		m = &mapping{
-			proto:     proto,
-			host:      &net.UDPAddr{IP: hostIP, Port: allocatedHostPort},
-			container: container,
+			proto:      proto,
+			networkID:  nid,
+			endpointID: eid,
+			sources:    opts.SourceCIDRs,
+			host:       &net.UDPAddr{IP: hostIP, Port: allocatedHostPort},
+			container:  container,
 		}
 
 		if useProxy {
-			m.userlandProxy, err = newProxy(proto, hostIP, allocatedHostPort, container.(*net.UDPAddr).IP, container.(*net.UDPAddr).Port, pm.proxyPath)
+			m.userlandProxy, err = newProxy(proto, hostIP, allocatedHostPort, container.(*net.UDPAddr).IP, container.(*net.UDPAddr).Port, pm.proxyPath, proxyOpts)
 			if err != nil {
 				return nil, err
 			}
@@ -114,9 +192,12 @@ func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart,
 		}
 
 		m = &mapping{
-			proto:     proto,
-			host:      &sctp.SCTPAddr{IPAddrs: []net.IPAddr{{IP: hostIP}}, Port: allocatedHostPort},
-			container: container,
+			proto:      proto,
+			networkID:  nid,
+			endpointID: eid,
+			sources:    opts.SourceCIDRs,
+			host:       &sctp.SCTPAddr{IPAddrs: []net.IPAddr{{IP: hostIP}}, Port: allocatedHostPort},
+			container:  container,
 		}
 
 		if useProxy {
@@ -124,7 +205,7 @@ func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart,
 			if len(sctpAddr.IPAddrs) == 0 {
 				return nil, ErrSCTPAddrNoIP
 			}
-			m.userlandProxy, err = newProxy(proto, hostIP, allocatedHostPort, sctpAddr.IPAddrs[0].IP, sctpAddr.Port, pm.proxyPath)
+			m.userlandProxy, err = newProxy(proto, hostIP, allocatedHostPort, sctpAddr.IPAddrs[0].IP, sctpAddr.Port, pm.proxyPath, proxyOpts)
 			if err != nil {
 				return nil, err
 			}
@@ -145,20 +226,24 @@ func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart,
 		}
 	}()
 
+	// The container gets the client address from the PROXY protocol header,
+	// the traffic must not bypass the proxy through the forwarding table.
+	m.proxyOnly = opts.ProxyProtocol != ""
+
 	key := getKey(m.host)
 	if _, exists := pm.currentMappings[key]; exists {
 		return nil, ErrPortMappedForIP
 	}
 
 	containerIP, containerPort := getIPAndPort(m.container)
-	if err := pm.AppendForwardingTableEntry(m.proto, hostIP, allocatedHostPort, containerIP.String(), containerPort); err != nil {
+	if err := pm.appendMappingEntry(m, hostIP, allocatedHostPort, containerIP.String(), containerPort); err != nil {
 		return nil, err
 	}
 
 	cleanup := func() error {
 		// need to undo the iptables rules before we return
 		m.userlandProxy.Stop()
-		pm.DeleteForwardingTableEntry(m.proto, hostIP, allocatedHostPort, containerIP.String(), containerPort)
+		pm.deleteMappingEntry(m, hostIP, allocatedHostPort, containerIP.String(), containerPort)
 		if err := pm.Allocator.ReleasePort(hostIP, m.proto, allocatedHostPort); err != nil {
 			return err
 		}
@@ -196,7 +281,7 @@ func (pm *PortMapper) Unmap(host net.Addr) error {
 
 	containerIP, containerPort := getIPAndPort(data.container)
 	hostIP, hostPort := getIPAndPort(data.host)
-	if err := pm.DeleteForwardingTableEntry(data.proto, hostIP, hostPort, containerIP.String(), containerPort); err != nil {
+	if err := pm.deleteMappingEntry(data, hostIP, hostPort, containerIP.String(), containerPort); err != nil {
 		logrus.Errorf("Error on iptables delete: %s", err)
 	}
 
@@ -214,6 +299,42 @@ func (pm *PortMapper) Unmap(host net.Addr) error {
 	return ErrUnknownBackendAddressType
 }
 
+// Mappings returns the current port mappings
+func (pm *PortMapper) Mappings() []types.PortMapping {
+	pm.lock.Lock()
+	entries := make([]*mapping, 0, len(pm.currentMappings))
+	mappings := make([]types.PortMapping, 0, len(pm.currentMappings))
+	for _, m := range pm.currentMappings {
+		containerIP, containerPort := getIPAndPort(m.container)
+		hostIP, hostPort := getIPAndPort(m.host)
+		pmap := types.PortMapping{
+			Proto:         types.ParseProtocol(m.proto),
+			HostIP:        hostIP,
+			HostPort:      uint16(hostPort),
+			ContainerIP:   containerIP,
+			ContainerPort: uint16(containerPort),
+			NetworkID:     m.networkID,
+			EndpointID:    m.endpointID,
+		}
+		if p, ok := m.userlandProxy.(interface{ running() bool }); ok {
+			pmap.UserlandProxy = p.running()
+		}
+		if p, ok := m.userlandProxy.(interface{ proxyStats() *types.ProxyStats }); ok && pmap.UserlandProxy {
+			pmap.ProxyStats = p.proxyStats()
+		}
+		entries = append(entries, m)
+		mappings = append(mappings, pmap)
+	}
+	pm.lock.Unlock()
+
+	// Looking up the firewall rules runs a command for each mapping, which
+	// must not hold the mapping and unmapping of the ports up.
+	for i, m := range entries {
+		mappings[i].DNAT = pm.mappingEntryExists(m, mappings[i].HostIP, int(mappings[i].HostPort), mappings[i].ContainerIP.String(), int(mappings[i].ContainerPort))
+	}
+	return mappings
+}
+
 // ReMapAll will re-apply all port mappings
 func (pm *PortMapper) ReMapAll() {
 	pm.lock.Lock()
@@ -222,7 +343,7 @@ func (pm *PortMapper) ReMapAll() {
 	for _, data := range pm.currentMappings {
 		containerIP, containerPort := getIPAndPort(data.container)
 		hostIP, hostPort := getIPAndPort(data.host)
-		if err := pm.AppendForwardingTableEntry(data.proto, hostIP, hostPort, containerIP.String(), containerPort); err != nil {
+		if err := pm.appendMappingEntry(data, hostIP, hostPort, containerIP.String(), containerPort); err != nil {
 			logrus.Errorf("Error on iptables add: %s", err)
 		}
 	}
@@ -19,28 +19,78 @@ type PortMapper struct {
 	proxyPath string
 
 	Allocator *portallocator.PortAllocator
-	chain     *iptables.ChainInfo
+	chain     ForwardingChain
+}
+
+// ForwardingChain is the firewall chain the port mappings are programmed in,
+// either an iptables or an nftables chain
+type ForwardingChain interface {
+	ForwardFrom(owner iptables.Owner, action iptables.Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string, sources []*net.IPNet) error
 }
 
 // SetIptablesChain sets the specified chain into portmapper
 func (pm *PortMapper) SetIptablesChain(c *iptables.ChainInfo, bridgeName string) {
+	if c == nil {
+		pm.SetForwardingChain(nil, bridgeName)
+		return
+	}
+	pm.SetForwardingChain(c, bridgeName)
+}
+
+// SetForwardingChain sets the specified firewall chain into portmapper
+func (pm *PortMapper) SetForwardingChain(c ForwardingChain, bridgeName string) {
 	pm.chain = c
 	pm.bridgeName = bridgeName
 }
 
 // AppendForwardingTableEntry adds a port mapping to the forwarding table
 func (pm *PortMapper) AppendForwardingTableEntry(proto string, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) error {
-	return pm.forward(iptables.Append, proto, sourceIP, sourcePort, containerIP, containerPort)
+	return pm.forward(iptables.Append, iptables.Owner{}, nil, proto, sourceIP, sourcePort, containerIP, containerPort)
 }
 
 // DeleteForwardingTableEntry removes a port mapping from the forwarding table
 func (pm *PortMapper) DeleteForwardingTableEntry(proto string, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) error {
-	return pm.forward(iptables.Delete, proto, sourceIP, sourcePort, containerIP, containerPort)
+	return pm.forward(iptables.Delete, iptables.Owner{}, nil, proto, sourceIP, sourcePort, containerIP, containerPort)
 }
 
-func (pm *PortMapper) forward(action iptables.Action, proto string, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) error {
+func (pm *PortMapper) appendMappingEntry(m *mapping, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) error {
+	if m.proxyOnly {
+		return nil
+	}
+	return pm.forward(iptables.Append, m.owner(), m.sources, m.proto, sourceIP, sourcePort, containerIP, containerPort)
+}
+
+func (pm *PortMapper) deleteMappingEntry(m *mapping, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) error {
+	if m.proxyOnly {
+		return nil
+	}
+	return pm.forward(iptables.Delete, m.owner(), m.sources, m.proto, sourceIP, sourcePort, containerIP, containerPort)
+}
+
+// forwardingChainChecker is implemented by the forwarding chains able to
+// tell whether the rules of a port mapping are programmed
+type forwardingChainChecker interface {
+	ForwardExists(owner iptables.Owner, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) bool
+}
+
+func (pm *PortMapper) mappingEntryExists(m *mapping, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) bool {
+	if m.proxyOnly {
+		return false
+	}
+	c, ok := pm.chain.(forwardingChainChecker)
+	if !ok {
+		return false
+	}
+	return c.ForwardExists(m.owner(), sourceIP, sourcePort, m.proto, containerIP, containerPort, pm.bridgeName)
+}
+
+func (pm *PortMapper) forward(action iptables.Action, owner iptables.Owner, sources []*net.IPNet, proto string, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) error {
 	if pm.chain == nil {
 		return nil
 	}
-	return pm.chain.Forward(action, sourceIP, sourcePort, proto, containerIP, containerPort, pm.bridgeName)
+	return pm.chain.ForwardFrom(owner, action, sourceIP, sourcePort, proto, containerIP, containerPort, pm.bridgeName, sources)
+}
+
+func (m *mapping) owner() iptables.Owner {
+	return iptables.Owner{NetworkID: m.networkID, EndpointID: m.endpointID}
 }
@@ -1,12 +1,20 @@
 package portmapper
 
 import (
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/proxy"
 	_ "github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
 )
 
 func init() {
@@ -268,3 +276,156 @@ func TestMapUDPDummyListen(t *testing.T) {
 		}
 	}
 }
+
+func TestMapProxyProtocol(t *testing.T) {
+	pm := New("")
+	hostIP := net.ParseIP("192.168.0.1")
+
+	udpAddr := &net.UDPAddr{IP: net.ParseIP("172.16.0.1"), Port: 53}
+	if _, err := pm.MapRangeWithOptions(udpAddr, hostIP, 53, 53, true, MapOptions{ProxyProtocol: "v1"}); err == nil {
+		t.Fatal("Expected an error for a PROXY protocol header on a udp mapping")
+	}
+
+	tcpAddr := &net.TCPAddr{IP: net.ParseIP("172.16.0.1"), Port: 80}
+	if _, err := pm.MapRangeWithOptions(tcpAddr, hostIP, 80, 80, true, MapOptions{ProxyProtocol: "v3"}); err == nil {
+		t.Fatal("Expected an error for an invalid PROXY protocol version")
+	}
+	if _, err := pm.MapRangeWithOptions(tcpAddr, hostIP, 80, 80, false, MapOptions{ProxyProtocol: "v1"}); err != ErrProxyProtocolNoProxy {
+		t.Fatalf("Expected %v, got %v", ErrProxyProtocolNoProxy, err)
+	}
+	host, err := pm.MapRangeWithOptions(tcpAddr, hostIP, 80, 80, true, MapOptions{ProxyProtocol: "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := pm.currentMappings[getKey(host)]; !m.proxyOnly {
+		t.Fatal("Expected the mapping to only go through the userland proxy")
+	}
+	if err := pm.Unmap(host); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInProcessProxy(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			io.Copy(conn, conn)
+			conn.Close()
+		}
+	}()
+
+	// Pick a free port for the frontend
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostPort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	loopback := net.ParseIP("127.0.0.1")
+	p, err := newUserlandProxy("tcp", loopback, hostPort, loopback, backend.Addr().(*net.TCPAddr).Port, "", proxy.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*inProcessProxy); !ok {
+		t.Fatalf("Expected an in process proxy, got %T", p)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(10 * time.Second))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("Unexpected echo %q: %v", buf, err)
+	}
+	stats := p.(*inProcessProxy).proxyStats()
+	if stats == nil || stats.ActiveConnections != 1 || stats.TotalConnections != 1 || stats.BytesIn != 4 {
+		t.Fatalf("Unexpected proxy stats %+v", stats)
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	// The client connection is closed along with the proxy
+	if _, err := client.Read(buf); err == nil {
+		t.Fatal("Expected the client connection to be closed")
+	}
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Fatal("Expected the proxy to stop listening")
+	}
+
+	if p, err := newUserlandProxy("tcp", loopback, hostPort, loopback, 80, "/usr/bin/docker-proxy", proxy.Options{}); err != nil {
+		t.Fatal(err)
+	} else if _, ok := p.(*proxyCommand); !ok {
+		t.Fatalf("Expected a proxy command for an explicit proxy path, got %T", p)
+	}
+}
+
+func TestMappings(t *testing.T) {
+	pm := New("")
+	hostIP := net.ParseIP("192.168.0.1")
+	container := &net.TCPAddr{IP: net.ParseIP("172.16.0.2"), Port: 80}
+
+	host, err := pm.MapRangeWithOptions(container, hostIP, 8080, 8080, true, MapOptions{NetworkID: "n1", EndpointID: "e1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Unmap(host)
+
+	mappings := pm.Mappings()
+	if len(mappings) != 1 {
+		t.Fatalf("Expected 1 mapping, got %v", mappings)
+	}
+	m := mappings[0]
+	if m.Proto != types.TCP || !m.HostIP.Equal(hostIP) || m.HostPort != 8080 ||
+		!m.ContainerIP.Equal(container.IP) || m.ContainerPort != 80 ||
+		m.NetworkID != "n1" || m.EndpointID != "e1" || m.UserlandProxy || m.DNAT {
+		t.Fatalf("Unexpected mapping %+v", m)
+	}
+}
+
+func TestProxyCommandStatsFlag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "portmapper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		usage string
+		stats bool
+	}{
+		{"  -proto string", false},
+		{"  -stats-interval duration", true},
+	} {
+		path := filepath.Join(dir, fmt.Sprintf("proxy-%t", tc.stats))
+		if err := ioutil.WriteFile(path, []byte("#!/bin/sh\necho '"+tc.usage+"' >&2\nexit 2\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		p, err := newProxyCommand("tcp", net.IPv4zero, 8080, net.ParseIP("172.16.0.2"), 80, path, proxy.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := strings.Join(p.(*proxyCommand).cmd.Args, " ")
+		if strings.Contains(args, "-stats-interval") != tc.stats {
+			t.Fatalf("Unexpected arguments for a proxy with usage %q: %s", tc.usage, args)
+		}
+	}
+}
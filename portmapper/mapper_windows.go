@@ -30,6 +30,18 @@ func (pm *PortMapper) DeleteForwardingTableEntry(proto string, sourceIP net.IP,
 	return nil
 }
 
+func (pm *PortMapper) appendMappingEntry(m *mapping, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) error {
+	return nil
+}
+
+func (pm *PortMapper) deleteMappingEntry(m *mapping, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) error {
+	return nil
+}
+
+func (pm *PortMapper) mappingEntryExists(m *mapping, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) bool {
+	return false
+}
+
 // checkIP checks if IP is valid and matching to chain version
 func (pm *PortMapper) checkIP(ip net.IP) bool {
 	// no IPv6 for port mapper on windows -> only IPv4 valid
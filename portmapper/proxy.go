@@ -1,14 +1,18 @@
 package portmapper
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/docker/libnetwork/types"
 	"github.com/ishidawataru/sctp"
 )
 
@@ -29,10 +33,18 @@ const (
 	ipv6 ipVersion = "6"
 )
 
+// proxyStatsInterval is the interval at which the proxy processes report
+// their counters
+const proxyStatsInterval = time.Second
+
 // proxyCommand wraps an exec.Cmd to run the userland TCP and UDP
 // proxies as separate processes.
 type proxyCommand struct {
 	cmd *exec.Cmd
+
+	// last counters reported by the process on the stats pipe
+	statsLock sync.Mutex
+	stats     *types.ProxyStats
 }
 
 func (p *proxyCommand) Start() error {
@@ -41,11 +53,21 @@ func (p *proxyCommand) Start() error {
 		return fmt.Errorf("proxy unable to open os.Pipe %s", err)
 	}
 	defer r.Close()
-	p.cmd.ExtraFiles = []*os.File{w}
+	sr, sw, err := os.Pipe()
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("proxy unable to open os.Pipe %s", err)
+	}
+	p.cmd.ExtraFiles = []*os.File{w, sw}
 	if err := p.cmd.Start(); err != nil {
+		w.Close()
+		sr.Close()
+		sw.Close()
 		return err
 	}
 	w.Close()
+	sw.Close()
+	go p.readStats(sr)
 
 	errchan := make(chan error, 1)
 	go func() {
@@ -73,6 +95,36 @@ func (p *proxyCommand) Start() error {
 	}
 }
 
+// readStats records the counters the process writes on the stats pipe,
+// until it exits.
+func (p *proxyCommand) readStats(r io.ReadCloser) {
+	defer r.Close()
+	dec := json.NewDecoder(r)
+	for {
+		var stats types.ProxyStats
+		if err := dec.Decode(&stats); err != nil {
+			return
+		}
+		p.statsLock.Lock()
+		p.stats = &stats
+		p.statsLock.Unlock()
+	}
+}
+
+func (p *proxyCommand) proxyStats() *types.ProxyStats {
+	p.statsLock.Lock()
+	defer p.statsLock.Unlock()
+	if p.stats == nil {
+		return nil
+	}
+	stats := *p.stats
+	return &stats
+}
+
+func (p *proxyCommand) running() bool {
+	return p.cmd.Process != nil && p.cmd.ProcessState == nil && p.cmd.Process.Signal(syscall.Signal(0)) == nil
+}
+
 func (p *proxyCommand) Stop() error {
 	if p.cmd.Process != nil {
 		if err := p.cmd.Process.Signal(os.Interrupt); err != nil {
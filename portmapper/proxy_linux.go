@@ -1,13 +1,44 @@
 package portmapper
 
 import (
+	"bytes"
+	"fmt"
 	"net"
 	"os/exec"
 	"strconv"
+	"sync"
 	"syscall"
+
+	"github.com/docker/libnetwork/proxy"
+	"github.com/docker/libnetwork/types"
+	"github.com/ishidawataru/sctp"
 )
 
-func newProxyCommand(proto string, hostIP net.IP, hostPort int, containerIP net.IP, containerPort int, proxyPath string) (userlandProxy, error) {
+// newUserlandProxy returns the userland proxy of a mapping. It runs in
+// process, unless the path of the proxy binary is set.
+func newUserlandProxy(proto string, hostIP net.IP, hostPort int, containerIP net.IP, containerPort int, proxyPath string, opts proxy.Options) (userlandProxy, error) {
+	if proxyPath != "" {
+		return newProxyCommand(proto, hostIP, hostPort, containerIP, containerPort, proxyPath, opts)
+	}
+
+	p := &inProcessProxy{opts: opts}
+	switch proto {
+	case "tcp":
+		p.frontend = &net.TCPAddr{IP: hostIP, Port: hostPort}
+		p.backend = &net.TCPAddr{IP: containerIP, Port: containerPort}
+	case "udp":
+		p.frontend = &net.UDPAddr{IP: hostIP, Port: hostPort}
+		p.backend = &net.UDPAddr{IP: containerIP, Port: containerPort}
+	case "sctp":
+		p.frontend = &sctp.SCTPAddr{IPAddrs: []net.IPAddr{{IP: hostIP}}, Port: hostPort}
+		p.backend = &sctp.SCTPAddr{IPAddrs: []net.IPAddr{{IP: containerIP}}, Port: containerPort}
+	default:
+		return nil, fmt.Errorf("Unknown addr type: %s", proto)
+	}
+	return p, nil
+}
+
+func newProxyCommand(proto string, hostIP net.IP, hostPort int, containerIP net.IP, containerPort int, proxyPath string, opts proxy.Options) (userlandProxy, error) {
 	path := proxyPath
 	if proxyPath == "" {
 		cmd, err := exec.LookPath(userlandProxyCommandName)
@@ -25,6 +56,18 @@ func newProxyCommand(proto string, hostIP net.IP, hostPort int, containerIP net.
 		"-container-ip", containerIP.String(),
 		"-container-port", strconv.Itoa(containerPort),
 	}
+	if reportsStats(path) {
+		args = append(args, "-stats-interval", proxyStatsInterval.String())
+	}
+	if opts.ProxyProtocol != "" {
+		args = append(args, "-proxy-protocol", opts.ProxyProtocol)
+	}
+	if opts.MaxConnections != 0 {
+		args = append(args, "-max-connections", strconv.Itoa(opts.MaxConnections))
+	}
+	if opts.IdleTimeout != 0 {
+		args = append(args, "-idle-timeout", opts.IdleTimeout.String())
+	}
 
 	return &proxyCommand{
 		cmd: &exec.Cmd{
@@ -36,3 +79,79 @@ func newProxyCommand(proto string, hostIP net.IP, hostPort int, containerIP net.
 		},
 	}, nil
 }
+
+// statsSupport caches whether the proxy binaries report their counters
+var statsSupport sync.Map
+
+// reportsStats tells whether the proxy binary at path reports its counters on
+// the stats pipe, as the one built from cmd/proxy does. A proxy built
+// elsewhere would refuse the flag enabling them.
+func reportsStats(path string) bool {
+	if v, ok := statsSupport.Load(path); ok {
+		return v.(bool)
+	}
+	// The usage of the flag package lists the flags, on error as well
+	out, _ := exec.Command(path, "-h").CombinedOutput()
+	supported := bytes.Contains(out, []byte("-stats-interval"))
+	statsSupport.Store(path, supported)
+	return supported
+}
+
+// inProcessProxy runs the userland proxy of a mapping in a goroutine of the
+// daemon, instead of in a docker-proxy process.
+type inProcessProxy struct {
+	frontend net.Addr
+	backend  net.Addr
+	opts     proxy.Options
+	proxy    proxy.Proxy
+	done     chan struct{}
+}
+
+func (p *inProcessProxy) Start() error {
+	px, err := proxy.NewProxyWithOptions(p.frontend, p.backend, p.opts)
+	if err != nil {
+		return fmt.Errorf("Error starting userland proxy: %v", err)
+	}
+	p.proxy = px
+	p.done = make(chan struct{})
+	go func() {
+		px.Run()
+		close(p.done)
+	}()
+	return nil
+}
+
+func (p *inProcessProxy) running() bool {
+	if p.proxy == nil {
+		return false
+	}
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *inProcessProxy) proxyStats() *types.ProxyStats {
+	if p.proxy == nil {
+		return nil
+	}
+	r, ok := p.proxy.(proxy.StatsReporter)
+	if !ok {
+		return nil
+	}
+	stats := r.Stats()
+	return &stats
+}
+
+func (p *inProcessProxy) Stop() error {
+	if p.proxy == nil {
+		return nil
+	}
+	// Closing the proxy stops its listener and its client connections
+	p.proxy.Close()
+	<-p.done
+	p.proxy = nil
+	return nil
+}
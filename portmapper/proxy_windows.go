@@ -3,8 +3,14 @@ package portmapper
 import (
 	"errors"
 	"net"
+
+	"github.com/docker/libnetwork/proxy"
 )
 
-func newProxyCommand(proto string, hostIP net.IP, hostPort int, containerIP net.IP, containerPort int, proxyPath string) (userlandProxy, error) {
+func newProxyCommand(proto string, hostIP net.IP, hostPort int, containerIP net.IP, containerPort int, proxyPath string, opts proxy.Options) (userlandProxy, error) {
 	return nil, errors.New("proxy is unsupported on windows")
 }
+
+func newUserlandProxy(proto string, hostIP net.IP, hostPort int, containerIP net.IP, containerPort int, proxyPath string, opts proxy.Options) (userlandProxy, error) {
+	return newProxyCommand(proto, hostIP, hostPort, containerIP, containerPort, proxyPath, opts)
+}
@@ -0,0 +1,139 @@
+package libnetwork
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/diagnostic"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/internal/caller"
+	"github.com/docker/libnetwork/portallocator"
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+var portMappingsPaths2Func = map[string]diagnostic.HTTPHandlerFunc{
+	"/portmappings": portMappings,
+}
+
+// initPortAllocator restores the port leases and reservations persisted in
+// the local store. It must run before the drivers restore their endpoints.
+func (c *controller) initPortAllocator() error {
+	ds := c.getStore(datastore.LocalScope)
+	if ds == nil {
+		return nil
+	}
+	return portallocator.Get().SetStore(ds)
+}
+
+func (c *controller) ReleasePortLeases(containerID string) {
+	if containerID != "" {
+		portallocator.Get().ReleaseLeases(containerID)
+	}
+}
+
+func (c *controller) ReservePortRange(ip net.IP, proto string, portStart, portEnd int) error {
+	return portallocator.Get().ReservePortRange(ip, proto, portStart, portEnd)
+}
+
+func (c *controller) ReleasePortRange(ip net.IP, proto string, portStart, portEnd int) error {
+	return portallocator.Get().ReleasePortRange(ip, proto, portStart, portEnd)
+}
+
+func (c *controller) ReservedPortRanges() []portallocator.PortRange {
+	return portallocator.Get().ReservedPortRanges()
+}
+
+func (c *controller) PortMappings() []types.PortMapping {
+	var mappings []types.PortMapping
+	c.drvRegistry.WalkDrivers(func(name string, driver driverapi.Driver, capability driverapi.Capability) bool {
+		if l, ok := driver.(driverapi.PortMappingLister); ok {
+			mappings = append(mappings, l.PortMappings()...)
+		}
+		return false
+	})
+
+	// Attribute the mappings to the sandboxes of their endpoints
+	c.Lock()
+	sandboxes := make([]*sandbox, 0, len(c.sandboxes))
+	for _, sb := range c.sandboxes {
+		sandboxes = append(sandboxes, sb)
+	}
+	c.Unlock()
+
+	owners := make(map[string]string)
+	for _, sb := range sandboxes {
+		for _, ep := range sb.getConnectedEndpoints() {
+			owners[ep.ID()] = sb.ID()
+		}
+	}
+	for i := range mappings {
+		mappings[i].SandboxID = owners[mappings[i].EndpointID]
+	}
+
+	return mappings
+}
+
+func portMappings(ctx interface{}, w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	diagnostic.DebugHTTPForm(r)
+	_, json := diagnostic.ParseHTTPFormOptions(r)
+
+	// audit logs
+	log := logrus.WithFields(logrus.Fields{"component": "diagnostic", "remoteIP": r.RemoteAddr, "method": caller.Name(0), "url": r.URL.String()})
+	log.Info("port mappings")
+
+	c, ok := ctx.(*controller)
+	if !ok {
+		diagnostic.HTTPReply(w, diagnostic.FailCommand(fmt.Errorf("network controller not available")), json)
+		return
+	}
+
+	var port int
+	if v := r.Form.Get("port"); v != "" {
+		var err error
+		if port, err = strconv.Atoi(v); err != nil {
+			diagnostic.HTTPReply(w, diagnostic.WrongCommand("invalid port "+v, fmt.Sprintf("%s?port=<host port>", r.URL.Path)), json)
+			return
+		}
+	}
+
+	rsp := &diagnostic.PortMappingsResult{}
+	for _, m := range c.PortMappings() {
+		if port != 0 && int(m.HostPort) != port {
+			continue
+		}
+		rsp.Mappings = append(rsp.Mappings, diagnostic.PortMappingObj{
+			Proto:         m.Proto.String(),
+			HostIP:        m.HostIP.String(),
+			HostPort:      m.HostPort,
+			ContainerIP:   m.ContainerIP.String(),
+			ContainerPort: m.ContainerPort,
+			Network:       m.NetworkID,
+			Endpoint:      m.EndpointID,
+			Sandbox:       m.SandboxID,
+			UserlandProxy: m.UserlandProxy,
+			DNAT:          m.DNAT,
+			Routed:        m.Routed,
+			ProxyStats:    proxyStatsObj(m.ProxyStats),
+		})
+	}
+	log.WithField("response", fmt.Sprintf("%+v", rsp)).Info("port mappings done")
+	diagnostic.HTTPReply(w, diagnostic.CommandSucceed(rsp), json)
+}
+
+func proxyStatsObj(s *types.ProxyStats) *diagnostic.ProxyStatsObj {
+	if s == nil {
+		return nil
+	}
+	return &diagnostic.ProxyStatsObj{
+		ActiveConnections:   s.ActiveConnections,
+		TotalConnections:    s.TotalConnections,
+		RejectedConnections: s.RejectedConnections,
+		BytesIn:             s.BytesIn,
+		BytesOut:            s.BytesOut,
+	}
+}
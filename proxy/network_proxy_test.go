@@ -1,4 +1,4 @@
-package main
+package proxy
 
 import (
 	"bytes"
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/docker/libnetwork/types"
 	"github.com/ishidawataru/sctp"
 	// this takes care of the incontainer flag
 	_ "github.com/docker/libnetwork/testutils"
@@ -222,6 +223,140 @@ func TestTCPDualStackProxy(t *testing.T) {
 	testProxyAt(t, "tcp", proxy, ipv4ProxyAddr.String(), false)
 }
 
+func TestTCP4ProxyProtocol(t *testing.T) {
+	for _, version := range []string{proxyProtocolV1, proxyProtocolV2} {
+		backend, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer backend.Close()
+
+		frontendAddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
+		proxy, err := NewProxyWithOptions(frontendAddr, backend.Addr(), Options{ProxyProtocol: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		go proxy.Run()
+
+		client, err := net.Dial("tcp", proxy.FrontendAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		if _, err := client.Write(testBuf); err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := backend.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		var expected bytes.Buffer
+		if err := writeProxyHeader(&expected, version, client.LocalAddr().(*net.TCPAddr), client.RemoteAddr().(*net.TCPAddr)); err != nil {
+			t.Fatal(err)
+		}
+		expected.Write(testBuf)
+
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		recvBuf := make([]byte, expected.Len())
+		if _, err := io.ReadFull(conn, recvBuf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(recvBuf, expected.Bytes()) {
+			t.Fatalf("Expected %q for PROXY protocol %s but got %q", expected.Bytes(), version, recvBuf)
+		}
+	}
+
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 443}
+	var header bytes.Buffer
+	if err := writeProxyHeader(&header, proxyProtocolV1, src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if header.String() != "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n" {
+		t.Fatalf("Unexpected v1 header %q", header.String())
+	}
+	header.Reset()
+	if err := writeProxyHeader(&header, proxyProtocolV2, src, dst); err != nil {
+		t.Fatal(err)
+	}
+	expected := append(append([]byte(nil), proxyProtocolV2Signature...), 0x21, 0x11, 0, 12, 192, 0, 2, 1, 192, 0, 2, 2, 0xdc, 0x04, 0x01, 0xbb)
+	if !bytes.Equal(header.Bytes(), expected) {
+		t.Fatalf("Unexpected v2 header %x", header.Bytes())
+	}
+
+	if _, err := NewProxyWithOptions(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, &net.UDPAddr{}, Options{ProxyProtocol: proxyProtocolV1}); err == nil {
+		t.Fatal("Expected an error for PROXY protocol on udp")
+	}
+}
+
+func TestTCP4ProxyLimits(t *testing.T) {
+	backend := NewEchoServer(t, "tcp", "127.0.0.1:0", EchoServerOptions{})
+	defer backend.Close()
+	backend.Run()
+	frontendAddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
+	proxy, err := NewProxyWithOptions(frontendAddr, backend.LocalAddr(), Options{MaxConnections: 1, IdleTimeout: 500 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	go proxy.Run()
+
+	client, err := net.Dial("tcp", proxy.FrontendAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := client.Write(testBuf); err != nil {
+		t.Fatal(err)
+	}
+	recvBuf := make([]byte, testBufSize)
+	if _, err := io.ReadFull(client, recvBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second connection is over the limit and closed by the proxy
+	rejected, err := net.Dial("tcp", proxy.FrontendAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejected.Close()
+	rejected.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := rejected.Read(recvBuf); err == nil {
+		t.Fatal("Expected the connection over the limit to be closed")
+	}
+
+	// The first connection is closed once idle
+	if _, err := client.Read(recvBuf); err == nil {
+		t.Fatal("Expected the idle connection to be closed")
+	}
+
+	var stats types.ProxyStats
+	for i := 0; i < 100; i++ {
+		if stats = proxy.(StatsReporter).Stats(); stats.ActiveConnections == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expected := types.ProxyStats{
+		TotalConnections:    1,
+		RejectedConnections: 1,
+		BytesIn:             uint64(testBufSize),
+		BytesOut:            uint64(testBufSize),
+	}
+	if stats != expected {
+		t.Fatalf("Expected stats %+v but got %+v", expected, stats)
+	}
+
+	if _, err := NewProxyWithOptions(frontendAddr, backend.LocalAddr(), Options{MaxConnections: -1}); err == nil {
+		t.Fatal("Expected an error for a negative connection limit")
+	}
+}
+
 func TestUDP4Proxy(t *testing.T) {
 	backend := NewEchoServer(t, "udp", "127.0.0.1:0", EchoServerOptions{})
 	defer backend.Close()
@@ -0,0 +1,106 @@
+// Package proxy provides a network Proxy interface and implementations for TCP,
+// UDP and SCTP, run by the docker-proxy binary or in process by the portmapper.
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/ishidawataru/sctp"
+)
+
+// ipVersion refers to IP version - v4 or v6
+type ipVersion string
+
+const (
+	// IPv4 is version 4
+	ipv4 ipVersion = "4"
+	// IPv4 is version 6
+	ipv6 ipVersion = "6"
+)
+
+// Proxy defines the behavior of a proxy. It forwards traffic back and forth
+// between two endpoints : the frontend and the backend.
+// It can be used to do software port-mapping between two addresses.
+// e.g. forward all traffic between the frontend (host) 127.0.0.1:3000
+// to the backend (container) at 172.17.42.108:4000.
+type Proxy interface {
+	// Run starts forwarding traffic back and forth between the front
+	// and back-end addresses.
+	Run()
+	// Close stops forwarding traffic and close both ends of the Proxy.
+	Close()
+	// FrontendAddr returns the address on which the proxy is listening.
+	FrontendAddr() net.Addr
+	// BackendAddr returns the proxied address.
+	BackendAddr() net.Addr
+}
+
+// Options are the optional settings of a proxy. The connection limit and
+// the idle timeout do not apply to SCTP proxies.
+type Options struct {
+	// ProxyProtocol is the version of the PROXY protocol header, "v1" or
+	// "v2", sent to the backend ahead of each TCP connection, none if empty
+	ProxyProtocol string
+	// MaxConnections is the maximum number of concurrent TCP connections,
+	// or of tracked UDP clients, unbounded if 0
+	MaxConnections int
+	// IdleTimeout is the duration after which a TCP connection without
+	// traffic is closed, or a UDP client forgotten. TCP connections never
+	// time out and UDP uses UDPConnTrackTimeout if 0
+	IdleTimeout time.Duration
+}
+
+// NewProxy creates a Proxy according to the specified frontendAddr and backendAddr.
+func NewProxy(frontendAddr, backendAddr net.Addr) (Proxy, error) {
+	return NewProxyWithOptions(frontendAddr, backendAddr, Options{})
+}
+
+// NewProxyWithOptions creates a Proxy according to the specified frontendAddr
+// and backendAddr, with the given options.
+func NewProxyWithOptions(frontendAddr, backendAddr net.Addr, opts Options) (Proxy, error) {
+	bnd := types.PortBinding{ProxyProtocol: opts.ProxyProtocol}
+	switch frontendAddr.(type) {
+	case *net.TCPAddr:
+		bnd.Proto = types.TCP
+	case *net.UDPAddr:
+		bnd.Proto = types.UDP
+	case *sctp.SCTPAddr:
+		bnd.Proto = types.SCTP
+	}
+	if err := bnd.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.MaxConnections < 0 {
+		return nil, fmt.Errorf("invalid maximum number of connections %d", opts.MaxConnections)
+	}
+	if opts.IdleTimeout < 0 {
+		return nil, fmt.Errorf("invalid idle timeout %v", opts.IdleTimeout)
+	}
+
+	switch frontendAddr.(type) {
+	case *net.UDPAddr:
+		proxy, err := NewUDPProxy(frontendAddr.(*net.UDPAddr), backendAddr.(*net.UDPAddr))
+		if err != nil {
+			return nil, err
+		}
+		proxy.maxConns = opts.MaxConnections
+		proxy.idleTimeout = opts.IdleTimeout
+		return proxy, nil
+	case *net.TCPAddr:
+		proxy, err := NewTCPProxy(frontendAddr.(*net.TCPAddr), backendAddr.(*net.TCPAddr))
+		if err != nil {
+			return nil, err
+		}
+		proxy.proxyProtocol = opts.ProxyProtocol
+		proxy.maxConns = opts.MaxConnections
+		proxy.idleTimeout = opts.IdleTimeout
+		return proxy, nil
+	case *sctp.SCTPAddr:
+		return NewSCTPProxy(frontendAddr.(*sctp.SCTPAddr), backendAddr.(*sctp.SCTPAddr))
+	default:
+		return nil, fmt.Errorf("unsupported address type %T", frontendAddr)
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/docker/libnetwork/types"
+)
+
+const (
+	proxyProtocolV1 = types.ProxyProtocolV1
+	proxyProtocolV2 = types.ProxyProtocolV2
+)
+
+// proxyProtocolV2Signature starts the binary header of the version 2
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// writeProxyHeader announces the client address and the address it connected
+// to, src and dst, in a PROXY protocol header of the given version.
+func writeProxyHeader(w io.Writer, version string, src, dst *net.TCPAddr) error {
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP == nil || dstIP == nil {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	}
+
+	var header []byte
+	switch version {
+	case proxyProtocolV1:
+		family := "TCP4"
+		if len(srcIP) == net.IPv6len {
+			family = "TCP6"
+		}
+		header = []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, srcIP, dstIP, src.Port, dst.Port))
+	case proxyProtocolV2:
+		// version 2, PROXY command, TCP over IPv4 or IPv6
+		family := byte(0x11)
+		if len(srcIP) == net.IPv6len {
+			family = 0x21
+		}
+		header = append(header, proxyProtocolV2Signature...)
+		header = append(header, 0x21, family, 0, 0)
+		binary.BigEndian.PutUint16(header[len(header)-2:], uint16(2*len(srcIP)+4))
+		header = append(header, srcIP...)
+		header = append(header, dstIP...)
+		header = append(header, 0, 0, 0, 0)
+		binary.BigEndian.PutUint16(header[len(header)-4:], uint16(src.Port))
+		binary.BigEndian.PutUint16(header[len(header)-2:], uint16(dst.Port))
+	default:
+		return fmt.Errorf("invalid PROXY protocol version %q", version)
+	}
+
+	_, err := w.Write(header)
+	return err
+}
@@ -1,12 +1,12 @@
-package main
+package proxy
 
 import (
 	"io"
-	"log"
 	"net"
 	"sync"
 
 	"github.com/ishidawataru/sctp"
+	"github.com/sirupsen/logrus"
 )
 
 // SCTPProxy is a proxy for SCTP connections. It implements the Proxy interface to
@@ -40,7 +40,7 @@ func NewSCTPProxy(frontendAddr, backendAddr *sctp.SCTPAddr) (*SCTPProxy, error)
 func (proxy *SCTPProxy) clientLoop(client *sctp.SCTPConn, quit chan bool) {
 	backend, err := sctp.DialSCTP("sctp", nil, proxy.backendAddr)
 	if err != nil {
-		log.Printf("Can't forward traffic to backend sctp/%v: %s\n", proxy.backendAddr, err)
+		logrus.Warnf("Can't forward traffic to backend sctp/%v: %s", proxy.backendAddr, err)
 		client.Close()
 		return
 	}
@@ -81,7 +81,7 @@ func (proxy *SCTPProxy) Run() {
 	for {
 		client, err := proxy.listener.Accept()
 		if err != nil {
-			log.Printf("Stopping proxy on sctp/%v for sctp/%v (%s)", proxy.frontendAddr, proxy.backendAddr, err)
+			logrus.Debugf("Stopping proxy on sctp/%v for sctp/%v (%s)", proxy.frontendAddr, proxy.backendAddr, err)
 			return
 		}
 		go proxy.clientLoop(client.(*sctp.SCTPConn), quit)
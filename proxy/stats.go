@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"sync/atomic"
+
+	"github.com/docker/libnetwork/types"
+)
+
+// StatsReporter is implemented by the proxies which count the connections
+// and the traffic they forward.
+type StatsReporter interface {
+	// Stats returns a snapshot of the counters of the proxy.
+	Stats() types.ProxyStats
+}
+
+// counters are the connection and traffic counters of a proxy, updated
+// atomically by its client loops.
+type counters struct {
+	active   uint64
+	total    uint64
+	rejected uint64
+	bytesIn  uint64
+	bytesOut uint64
+}
+
+// acquire accounts for a new connection, unless max connections are
+// already active.
+func (c *counters) acquire(max int) bool {
+	for {
+		active := atomic.LoadUint64(&c.active)
+		if max > 0 && active >= uint64(max) {
+			atomic.AddUint64(&c.rejected, 1)
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&c.active, active, active+1) {
+			atomic.AddUint64(&c.total, 1)
+			return true
+		}
+	}
+}
+
+// release accounts for the end of a connection.
+func (c *counters) release() {
+	atomic.AddUint64(&c.active, ^uint64(0))
+}
+
+func (c *counters) stats() types.ProxyStats {
+	return types.ProxyStats{
+		ActiveConnections:   atomic.LoadUint64(&c.active),
+		TotalConnections:    atomic.LoadUint64(&c.total),
+		RejectedConnections: atomic.LoadUint64(&c.rejected),
+		BytesIn:             atomic.LoadUint64(&c.bytesIn),
+		BytesOut:            atomic.LoadUint64(&c.bytesOut),
+	}
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+// TCPProxy is a proxy for TCP connections. It implements the Proxy interface to
+// handle TCP traffic forwarding between the frontend and backend addresses.
+type TCPProxy struct {
+	listener     *net.TCPListener
+	frontendAddr *net.TCPAddr
+	backendAddr  *net.TCPAddr
+	// version of the PROXY protocol header sent to the backend, if any
+	proxyProtocol string
+	// maximum number of concurrent connections, unbounded if 0
+	maxConns int
+	// duration after which a connection without traffic is closed, never
+	// if 0
+	idleTimeout time.Duration
+	counters    *counters
+}
+
+// NewTCPProxy creates a new TCPProxy.
+func NewTCPProxy(frontendAddr, backendAddr *net.TCPAddr) (*TCPProxy, error) {
+	// detect version of hostIP to bind only to correct version
+	ipVersion := ipv4
+	if frontendAddr.IP.To4() == nil {
+		ipVersion = ipv6
+	}
+	listener, err := net.ListenTCP("tcp"+string(ipVersion), frontendAddr)
+	if err != nil {
+		return nil, err
+	}
+	// If the port in frontendAddr was 0 then ListenTCP will have a picked
+	// a port to listen on, hence the call to Addr to get that actual port:
+	return &TCPProxy{
+		listener:     listener,
+		frontendAddr: listener.Addr().(*net.TCPAddr),
+		backendAddr:  backendAddr,
+		counters:     &counters{},
+	}, nil
+}
+
+func (proxy *TCPProxy) clientLoop(client *net.TCPConn, quit chan bool) {
+	defer proxy.counters.release()
+
+	backend, err := net.DialTCP("tcp", nil, proxy.backendAddr)
+	if err != nil {
+		logrus.Warnf("Can't forward traffic to backend tcp/%v: %s", proxy.backendAddr, err)
+		client.Close()
+		return
+	}
+
+	if proxy.proxyProtocol != "" {
+		if err := writeProxyHeader(backend, proxy.proxyProtocol, client.RemoteAddr().(*net.TCPAddr), client.LocalAddr().(*net.TCPAddr)); err != nil {
+			logrus.Warnf("Can't send the PROXY protocol header to backend tcp/%v: %s", proxy.backendAddr, err)
+			client.Close()
+			backend.Close()
+			return
+		}
+	}
+
+	var (
+		wg sync.WaitGroup
+		// time of the last traffic in either direction, in nanoseconds
+		lastActivity = time.Now().UnixNano()
+	)
+	var broker = func(to, from *net.TCPConn, count *uint64) {
+		proxy.copy(to, from, count, &lastActivity)
+		from.CloseRead()
+		to.CloseWrite()
+		wg.Done()
+	}
+
+	wg.Add(2)
+	go broker(client, backend, &proxy.counters.bytesOut)
+	go broker(backend, client, &proxy.counters.bytesIn)
+
+	finish := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finish)
+	}()
+
+	select {
+	case <-quit:
+	case <-finish:
+	}
+	client.Close()
+	backend.Close()
+	<-finish
+}
+
+// copy forwards the stream read from one connection to the other, counting
+// the bytes forwarded, until it ends or both directions of the connection
+// were idle for the idle timeout of the proxy.
+func (proxy *TCPProxy) copy(to, from *net.TCPConn, count *uint64, lastActivity *int64) {
+	buf := make([]byte, 32*1024)
+	for {
+		if proxy.idleTimeout > 0 {
+			from.SetReadDeadline(time.Now().Add(proxy.idleTimeout))
+		}
+		n, err := from.Read(buf)
+		if n > 0 {
+			atomic.StoreInt64(lastActivity, time.Now().UnixNano())
+			atomic.AddUint64(count, uint64(n))
+			if _, werr := to.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				// Traffic in the other direction keeps the connection alive
+				if time.Since(time.Unix(0, atomic.LoadInt64(lastActivity))) < proxy.idleTimeout {
+					continue
+				}
+				logrus.Debugf("Closing idle connection from %v on tcp/%v", from.RemoteAddr(), proxy.frontendAddr)
+				// Unblock the copy in the other direction as well
+				to.Close()
+				from.Close()
+			}
+			return
+		}
+	}
+}
+
+// Run starts forwarding the traffic using TCP.
+func (proxy *TCPProxy) Run() {
+	quit := make(chan bool)
+	defer close(quit)
+	for {
+		client, err := proxy.listener.Accept()
+		if err != nil {
+			logrus.Debugf("Stopping proxy on tcp/%v for tcp/%v (%s)", proxy.frontendAddr, proxy.backendAddr, err)
+			return
+		}
+		if !proxy.counters.acquire(proxy.maxConns) {
+			logrus.Debugf("Rejecting connection from %v on tcp/%v: %d connections are active", client.RemoteAddr(), proxy.frontendAddr, proxy.maxConns)
+			client.Close()
+			continue
+		}
+		go proxy.clientLoop(client.(*net.TCPConn), quit)
+	}
+}
+
+// Close stops forwarding the traffic.
+func (proxy *TCPProxy) Close() { proxy.listener.Close() }
+
+// Stats returns the connection and traffic counters of the proxy.
+func (proxy *TCPProxy) Stats() types.ProxyStats { return proxy.counters.stats() }
+
+// FrontendAddr returns the TCP address on which the proxy is listening.
+func (proxy *TCPProxy) FrontendAddr() net.Addr { return proxy.frontendAddr }
+
+// BackendAddr returns the TCP proxied address.
+func (proxy *TCPProxy) BackendAddr() net.Addr { return proxy.backendAddr }
@@ -1,13 +1,16 @@
-package main
+package proxy
 
 import (
 	"encoding/binary"
-	"log"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -51,6 +54,11 @@ type UDPProxy struct {
 	backendAddr    *net.UDPAddr
 	connTrackTable connTrackMap
 	connTrackLock  sync.Mutex
+	// maximum number of tracked clients, unbounded if 0
+	maxConns int
+	// connection tracking timeout, UDPConnTrackTimeout if 0
+	idleTimeout time.Duration
+	counters    *counters
 }
 
 // NewUDPProxy creates a new UDPProxy.
@@ -69,6 +77,7 @@ func NewUDPProxy(frontendAddr, backendAddr *net.UDPAddr) (*UDPProxy, error) {
 		frontendAddr:   listener.LocalAddr().(*net.UDPAddr),
 		backendAddr:    backendAddr,
 		connTrackTable: make(connTrackMap),
+		counters:       &counters{},
 	}, nil
 }
 
@@ -78,11 +87,16 @@ func (proxy *UDPProxy) replyLoop(proxyConn *net.UDPConn, clientAddr *net.UDPAddr
 		delete(proxy.connTrackTable, *clientKey)
 		proxy.connTrackLock.Unlock()
 		proxyConn.Close()
+		proxy.counters.release()
 	}()
 
+	timeout := proxy.idleTimeout
+	if timeout == 0 {
+		timeout = UDPConnTrackTimeout
+	}
 	readBuf := make([]byte, UDPBufSize)
 	for {
-		proxyConn.SetReadDeadline(time.Now().Add(UDPConnTrackTimeout))
+		proxyConn.SetReadDeadline(time.Now().Add(timeout))
 	again:
 		read, err := proxyConn.Read(readBuf)
 		if err != nil {
@@ -90,8 +104,8 @@ func (proxy *UDPProxy) replyLoop(proxyConn *net.UDPConn, clientAddr *net.UDPAddr
 				// This will happen if the last write failed
 				// (e.g: nothing is actually listening on the
 				// proxied port on the container), ignore it
-				// and continue until UDPConnTrackTimeout
-				// expires:
+				// and continue until the connection tracking
+				// timeout expires:
 				goto again
 			}
 			return
@@ -102,6 +116,7 @@ func (proxy *UDPProxy) replyLoop(proxyConn *net.UDPConn, clientAddr *net.UDPAddr
 				return
 			}
 			i += written
+			atomic.AddUint64(&proxy.counters.bytesOut, uint64(written))
 		}
 	}
 }
@@ -116,7 +131,7 @@ func (proxy *UDPProxy) Run() {
 			// ECONNREFUSED like Read do (see comment in
 			// UDPProxy.replyLoop)
 			if !isClosedError(err) {
-				log.Printf("Stopping proxy on udp/%v for udp/%v (%s)", proxy.frontendAddr, proxy.backendAddr, err)
+				logrus.Debugf("Stopping proxy on udp/%v for udp/%v (%s)", proxy.frontendAddr, proxy.backendAddr, err)
 			}
 			break
 		}
@@ -125,9 +140,15 @@ func (proxy *UDPProxy) Run() {
 		proxy.connTrackLock.Lock()
 		proxyConn, hit := proxy.connTrackTable[*fromKey]
 		if !hit {
+			if !proxy.counters.acquire(proxy.maxConns) {
+				logrus.Debugf("Dropping a datagram from %v on udp/%v: %d clients are tracked", from, proxy.frontendAddr, proxy.maxConns)
+				proxy.connTrackLock.Unlock()
+				continue
+			}
 			proxyConn, err = net.DialUDP("udp", nil, proxy.backendAddr)
 			if err != nil {
-				log.Printf("Can't proxy a datagram to udp/%s: %s\n", proxy.backendAddr, err)
+				logrus.Warnf("Can't proxy a datagram to udp/%s: %s", proxy.backendAddr, err)
+				proxy.counters.release()
 				proxy.connTrackLock.Unlock()
 				continue
 			}
@@ -138,10 +159,11 @@ func (proxy *UDPProxy) Run() {
 		for i := 0; i != read; {
 			written, err := proxyConn.Write(readBuf[i:read])
 			if err != nil {
-				log.Printf("Can't proxy a datagram to udp/%s: %s\n", proxy.backendAddr, err)
+				logrus.Warnf("Can't proxy a datagram to udp/%s: %s", proxy.backendAddr, err)
 				break
 			}
 			i += written
+			atomic.AddUint64(&proxy.counters.bytesIn, uint64(written))
 		}
 	}
 }
@@ -156,6 +178,10 @@ func (proxy *UDPProxy) Close() {
 	}
 }
 
+// Stats returns the connection and traffic counters of the proxy, a
+// connection being a tracked client.
+func (proxy *UDPProxy) Stats() types.ProxyStats { return proxy.counters.stats() }
+
 // FrontendAddr returns the UDP address on which the proxy is listening.
 func (proxy *UDPProxy) FrontendAddr() net.Addr { return proxy.frontendAddr }
 
@@ -161,6 +161,14 @@ func (sb *sandbox) Labels() map[string]interface{} {
 	return opts
 }
 
+// connectivityLabels returns the labels the external connectivity of the
+// endpoints of the sandbox is programmed with
+func (sb *sandbox) connectivityLabels() map[string]interface{} {
+	opts := sb.Labels()
+	opts[netlabel.PortOwner] = sb.ContainerID()
+	return opts
+}
+
 func (sb *sandbox) Statistics() (map[string]*types.InterfaceStatistics, error) {
 	m := make(map[string]*types.InterfaceStatistics)
 
@@ -370,6 +378,7 @@ func (sb *sandbox) addEndpoint(ep *endpoint) {
 	sb.endpoints = append(sb.endpoints, nil)
 	copy(sb.endpoints[i+1:], sb.endpoints[i:])
 	sb.endpoints[i] = ep
+	sb.controller.flows.add(ep, sb.containerID)
 }
 
 func (sb *sandbox) removeEndpoint(ep *endpoint) {
@@ -383,6 +392,7 @@ func (sb *sandbox) removeEndpointRaw(ep *endpoint) {
 	for i, e := range sb.endpoints {
 		if e == ep {
 			sb.endpoints = append(sb.endpoints[:i], sb.endpoints[i+1:]...)
+			sb.controller.flows.remove(ep)
 			return
 		}
 	}
@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/docker/libnetwork/internal/setmatrix"
+	"github.com/docker/libnetwork/types"
 )
 
 var (
@@ -31,6 +32,20 @@ func (p portConfigs) String() string {
 	return str
 }
 
+// validate checks the source CIDRs of the ingress ports: the ingress rules
+// only filter the IPv4 sources.
+func (p portConfigs) validate() error {
+	for _, pc := range p {
+		for _, cidr := range pc.SourceCIDRs {
+			if ip, _, err := net.ParseCIDR(cidr); err != nil || ip.To4() == nil {
+				return types.BadRequestErrorf("invalid source %q of ingress port %d/%s: not an IPv4 CIDR",
+					cidr, pc.PublishedPort, PortConfig_Protocol_name[int32(pc.Protocol)])
+			}
+		}
+	}
+	return nil
+}
+
 type serviceKey struct {
 	id    string
 	ports string
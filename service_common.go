@@ -226,6 +226,10 @@ func makeServiceCleanupFunc(c *controller, s *service, nID, eID string, vip net.
 func (c *controller) addServiceBinding(svcName, svcID, nID, eID, containerName string, vip net.IP, ingressPorts []*PortConfig, serviceAliases, taskAliases []string, ip net.IP, method string) error {
 	var addService bool
 
+	if err := portConfigs(ingressPorts).validate(); err != nil {
+		return err
+	}
+
 	// Failure to lock the network ID on add can result in racing
 	// racing against network deletion resulting in inconsistent
 	// state in the c.serviceBindings map and it's sub-maps. Also,
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/docker/libnetwork/resolvconf"
+	"github.com/docker/libnetwork/types"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 )
@@ -110,3 +111,15 @@ func TestDNSOptions(t *testing.T) {
 	err = sb2.(*sandbox).rebuildDNS()
 	assert.Error(t, err, "invalid number for ndots option: -1")
 }
+
+func TestValidateIngressPorts(t *testing.T) {
+	ports := portConfigs{{Protocol: ProtocolTCP, TargetPort: 80, PublishedPort: 8080, SourceCIDRs: []string{"203.0.113.0/24"}}}
+	assert.Check(t, ports.validate())
+
+	for _, cidr := range []string{"203.0.113.0", "2001:db8::/32"} {
+		ports[0].SourceCIDRs = []string{cidr}
+		err := ports.validate()
+		_, ok := err.(types.BadRequestError)
+		assert.Check(t, ok, "expected a bad request error for source %s, got %v", cidr, err)
+	}
+}
@@ -136,7 +136,7 @@ func (n *network) addLBBackend(ip net.IP, lb *loadBalancer) {
 			if ep := sb.getGatewayEndpoint(); ep != nil {
 				gwIP = ep.Iface().Address().IP
 			}
-			if err := programIngress(gwIP, lb.service.ingressPorts, false); err != nil {
+			if err := programIngress(iptables.Owner{NetworkID: n.ID()}, gwIP, lb.service.ingressPorts, false); err != nil {
 				logrus.Errorf("Failed to add ingress: %v", err)
 				return
 			}
@@ -237,7 +237,7 @@ func (n *network) rmLBBackend(ip net.IP, lb *loadBalancer, rmService bool, fullR
 			if ep := sb.getGatewayEndpoint(); ep != nil {
 				gwIP = ep.Iface().Address().IP
 			}
-			if err := programIngress(gwIP, lb.service.ingressPorts, true); err != nil {
+			if err := programIngress(iptables.Owner{NetworkID: n.ID()}, gwIP, lb.service.ingressPorts, true); err != nil {
 				logrus.Errorf("Failed to delete ingress: %v", err)
 			}
 		}
@@ -266,39 +266,40 @@ var (
 	ingressMu       sync.Mutex // lock for operations on ingress
 	ingressProxyTbl = make(map[string]io.Closer)
 	portConfigMu    sync.Mutex
-	portConfigTbl   = make(map[PortConfig]int)
+	portConfigTbl   = make(map[string]int)
 )
 
 func filterPortConfigs(ingressPorts []*PortConfig, isDelete bool) []*PortConfig {
 	portConfigMu.Lock()
 	iPorts := make([]*PortConfig, 0, len(ingressPorts))
 	for _, pc := range ingressPorts {
+		key := pc.String()
 		if isDelete {
-			if cnt, ok := portConfigTbl[*pc]; ok {
+			if cnt, ok := portConfigTbl[key]; ok {
 				// This is the last reference to this
 				// port config. Delete the port config
 				// and add it to filtered list to be
 				// plumbed.
 				if cnt == 1 {
-					delete(portConfigTbl, *pc)
+					delete(portConfigTbl, key)
 					iPorts = append(iPorts, pc)
 					continue
 				}
 
-				portConfigTbl[*pc] = cnt - 1
+				portConfigTbl[key] = cnt - 1
 			}
 
 			continue
 		}
 
-		if cnt, ok := portConfigTbl[*pc]; ok {
-			portConfigTbl[*pc] = cnt + 1
+		if cnt, ok := portConfigTbl[key]; ok {
+			portConfigTbl[key] = cnt + 1
 			continue
 		}
 
 		// We are adding it for the first time. Add it to the
 		// filter list to be plumbed.
-		portConfigTbl[*pc] = 1
+		portConfigTbl[key] = 1
 		iPorts = append(iPorts, pc)
 	}
 	portConfigMu.Unlock()
@@ -306,15 +307,13 @@ func filterPortConfigs(ingressPorts []*PortConfig, isDelete bool) []*PortConfig
 	return iPorts
 }
 
-func programIngress(gwIP net.IP, ingressPorts []*PortConfig, isDelete bool) error {
+func programIngress(owner iptables.Owner, gwIP net.IP, ingressPorts []*PortConfig, isDelete bool) error {
 	// TODO IPv6 support
 	iptable := iptables.GetIptable(iptables.IPv4)
 
-	addDelOpt := "-I"
-	rollbackAddDelOpt := "-D"
+	action := iptables.Insert
 	if isDelete {
-		addDelOpt = "-D"
-		rollbackAddDelOpt = "-I"
+		action = iptables.Delete
 	}
 
 	ingressMu.Lock()
@@ -397,64 +396,59 @@ func programIngress(gwIP net.IP, ingressPorts []*PortConfig, isDelete bool) erro
 
 	//Filter the ingress ports until port rules start to be added/deleted
 	filteredPorts := filterPortConfigs(ingressPorts, isDelete)
-	rollbackRules := make([][]string, 0, len(filteredPorts)*3)
-	var portErr error
-	defer func() {
-		if portErr != nil && !isDelete {
-			filterPortConfigs(filteredPorts, !isDelete)
-			for _, rule := range rollbackRules {
-				if err := iptable.RawCombinedOutput(rule...); err != nil {
-					logrus.Warnf("roll back rule failed, %v: %v", rule, err)
-				}
-			}
-		}
-	}()
 
+	// Program the rules of all the ports in a single transaction
+	tx := iptable.NewTransaction()
+	natChainExists := iptable.ExistChain(ingressChain, iptables.Nat)
 	for _, iPort := range filteredPorts {
-		if iptable.ExistChain(ingressChain, iptables.Nat) {
-			rule := strings.Fields(fmt.Sprintf("-t nat %s %s -p %s --dport %d -j DNAT --to-destination %s:%d",
-				addDelOpt, ingressChain, strings.ToLower(PortConfig_Protocol_name[int32(iPort.Protocol)]), iPort.PublishedPort, gwIP, iPort.PublishedPort))
-			if portErr = iptable.RawCombinedOutput(rule...); portErr != nil {
-				errStr := fmt.Sprintf("set up rule failed, %v: %v", rule, portErr)
-				if !isDelete {
-					return fmt.Errorf("%s", errStr)
-				}
-				logrus.Infof("%s", errStr)
-			}
-			rollbackRule := strings.Fields(fmt.Sprintf("-t nat %s %s -p %s --dport %d -j DNAT --to-destination %s:%d", rollbackAddDelOpt,
-				ingressChain, strings.ToLower(PortConfig_Protocol_name[int32(iPort.Protocol)]), iPort.PublishedPort, gwIP, iPort.PublishedPort))
-			rollbackRules = append(rollbackRules, rollbackRule)
+		proto := strings.ToLower(PortConfig_Protocol_name[int32(iPort.Protocol)])
+		if natChainExists {
+			tx.Queue(iptables.Nat, ingressChain, action, append(strings.Fields(fmt.Sprintf("-p %s --dport %d -j DNAT --to-destination %s:%d",
+				proto, iPort.PublishedPort, gwIP, iPort.PublishedPort)), owner.Args()...)...)
 		}
 
 		// Filter table rules to allow a published service to be accessible in the local node from..
 		// 1) service tasks attached to other networks
 		// 2) unmanaged containers on bridge networks
-		rule := strings.Fields(fmt.Sprintf("%s %s -m state -p %s --sport %d --state ESTABLISHED,RELATED -j ACCEPT",
-			addDelOpt, ingressChain, strings.ToLower(PortConfig_Protocol_name[int32(iPort.Protocol)]), iPort.PublishedPort))
-		if portErr = iptable.RawCombinedOutput(rule...); portErr != nil {
-			errStr := fmt.Sprintf("set up rule failed, %v: %v", rule, portErr)
-			if !isDelete {
-				return fmt.Errorf("%s", errStr)
+		tx.Queue(iptables.Filter, ingressChain, action, append(strings.Fields(fmt.Sprintf("-m state -p %s --sport %d --state ESTABLISHED,RELATED -j ACCEPT",
+			proto, iPort.PublishedPort)), owner.Args()...)...)
+
+		if len(iPort.SourceCIDRs) == 0 {
+			tx.Queue(iptables.Filter, ingressChain, action, append(strings.Fields(fmt.Sprintf("-p %s --dport %d -j ACCEPT",
+				proto, iPort.PublishedPort)), owner.Args()...)...)
+			continue
+		}
+
+		// Only the allowed sources reach the published port: the rules are
+		// inserted, the drop rule goes first to end up below the accept ones.
+		tx.Queue(iptables.Filter, ingressChain, action, append(strings.Fields(fmt.Sprintf("-d %s -p %s --dport %d -m conntrack --ctstate DNAT -j DROP",
+			gwIP, proto, iPort.PublishedPort)), owner.Args()...)...)
+		for _, cidr := range iPort.SourceCIDRs {
+			ip, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil || ip.To4() == nil {
+				logrus.Warnf("Ignoring source %q of ingress port %d/%s: not an IPv4 CIDR", cidr, iPort.PublishedPort, proto)
+				continue
 			}
-			logrus.Warnf("%s", errStr)
-		}
-		rollbackRule := strings.Fields(fmt.Sprintf("%s %s -m state -p %s --sport %d --state ESTABLISHED,RELATED -j ACCEPT", rollbackAddDelOpt,
-			ingressChain, strings.ToLower(PortConfig_Protocol_name[int32(iPort.Protocol)]), iPort.PublishedPort))
-		rollbackRules = append(rollbackRules, rollbackRule)
-
-		rule = strings.Fields(fmt.Sprintf("%s %s -p %s --dport %d -j ACCEPT",
-			addDelOpt, ingressChain, strings.ToLower(PortConfig_Protocol_name[int32(iPort.Protocol)]), iPort.PublishedPort))
-		if portErr = iptable.RawCombinedOutput(rule...); portErr != nil {
-			errStr := fmt.Sprintf("set up rule failed, %v: %v", rule, portErr)
-			if !isDelete {
-				return fmt.Errorf("%s", errStr)
+			tx.Queue(iptables.Filter, ingressChain, action, append(strings.Fields(fmt.Sprintf("-s %s -p %s --dport %d -j ACCEPT",
+				ipNet, proto, iPort.PublishedPort)), owner.Args()...)...)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		if !isDelete {
+			filterPortConfigs(filteredPorts, !isDelete)
+			return fmt.Errorf("set up ingress port rules failed: %v", err)
+		}
+		// Remove as many rules as possible
+		logrus.Infof("removing ingress port rules failed, removing them one by one: %v", err)
+		for _, rule := range tx.Rules() {
+			if err := iptable.RawCombinedOutput(rule...); err != nil {
+				logrus.Warnf("set up rule failed, %v: %v", rule, err)
 			}
-			logrus.Warnf("%s", errStr)
 		}
-		rollbackRule = strings.Fields(fmt.Sprintf("%s %s -p %s --dport %d -j ACCEPT", rollbackAddDelOpt,
-			ingressChain, strings.ToLower(PortConfig_Protocol_name[int32(iPort.Protocol)]), iPort.PublishedPort))
-		rollbackRules = append(rollbackRules, rollbackRule)
+	}
 
+	for _, iPort := range filteredPorts {
 		if err := plumbProxy(iPort, isDelete); err != nil {
 			logrus.Warnf("failed to create proxy for port %d: %v", iPort.PublishedPort, err)
 		}
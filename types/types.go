@@ -89,6 +89,32 @@ type PortBinding struct {
 	HostIP      net.IP
 	HostPort    uint16
 	HostPortEnd uint16
+	// ProxyProtocol is the version of the PROXY protocol header the userland
+	// proxy announces the client address to the container with, if any
+	ProxyProtocol string `json:",omitempty"`
+	// SourceCIDRs are the sources allowed to reach the host port, any if
+	// empty
+	SourceCIDRs []string `json:",omitempty"`
+}
+
+const (
+	// ProxyProtocolV1 is the human readable version of the PROXY protocol
+	ProxyProtocolV1 = "v1"
+	// ProxyProtocolV2 is the binary version of the PROXY protocol
+	ProxyProtocolV2 = "v2"
+)
+
+// Validate checks the options of the binding against its protocol
+func (p PortBinding) Validate() error {
+	switch p.ProxyProtocol {
+	case "", ProxyProtocolV1, ProxyProtocolV2:
+	default:
+		return BadRequestErrorf("invalid PROXY protocol version %q", p.ProxyProtocol)
+	}
+	if p.ProxyProtocol != "" && p.Proto != TCP {
+		return BadRequestErrorf("PROXY protocol is only supported for tcp, not for %s", p.Proto)
+	}
+	return nil
 }
 
 // HostAddr returns the host side transport address
@@ -122,12 +148,14 @@ func (p PortBinding) ContainerAddr() (net.Addr, error) {
 // GetCopy returns a copy of this PortBinding structure instance
 func (p *PortBinding) GetCopy() PortBinding {
 	return PortBinding{
-		Proto:       p.Proto,
-		IP:          GetIPCopy(p.IP),
-		Port:        p.Port,
-		HostIP:      GetIPCopy(p.HostIP),
-		HostPort:    p.HostPort,
-		HostPortEnd: p.HostPortEnd,
+		Proto:         p.Proto,
+		IP:            GetIPCopy(p.IP),
+		Port:          p.Port,
+		HostIP:        GetIPCopy(p.HostIP),
+		HostPort:      p.HostPort,
+		HostPortEnd:   p.HostPortEnd,
+		ProxyProtocol: p.ProxyProtocol,
+		SourceCIDRs:   append([]string(nil), p.SourceCIDRs...),
 	}
 }
 
@@ -201,10 +229,17 @@ func (p *PortBinding) Equal(o *PortBinding) bool {
 	}
 
 	if p.Proto != o.Proto || p.Port != o.Port ||
-		p.HostPort != o.HostPort || p.HostPortEnd != o.HostPortEnd {
+		p.HostPort != o.HostPort || p.HostPortEnd != o.HostPortEnd ||
+		p.ProxyProtocol != o.ProxyProtocol || len(p.SourceCIDRs) != len(o.SourceCIDRs) {
 		return false
 	}
 
+	for i := range p.SourceCIDRs {
+		if p.SourceCIDRs[i] != o.SourceCIDRs[i] {
+			return false
+		}
+	}
+
 	if p.IP != nil {
 		if !p.IP.Equal(o.IP) {
 			return false
@@ -228,6 +263,94 @@ func (p *PortBinding) Equal(o *PortBinding) bool {
 	return true
 }
 
+// PortMapping describes a host port mapped to a container port
+type PortMapping struct {
+	Proto         Protocol
+	HostIP        net.IP
+	HostPort      uint16
+	ContainerIP   net.IP
+	ContainerPort uint16
+	NetworkID     string
+	EndpointID    string
+	SandboxID     string
+	// UserlandProxy is true when a userland proxy serves the host port
+	UserlandProxy bool
+	// DNAT is true when the rule translating the host port to the
+	// container port is programmed in the firewall
+	DNAT bool
+	// Routed is true when the container port is published without a host
+	// port, to be reached directly on the container address
+	Routed bool
+	// ProxyStats are the counters of the userland proxy, nil when it
+	// does not report any
+	ProxyStats *ProxyStats `json:",omitempty"`
+}
+
+// ProxyStats are the connection and traffic counters of a userland proxy
+type ProxyStats struct {
+	// ActiveConnections is the number of connections, or of tracked
+	// udp clients, currently proxied
+	ActiveConnections uint64
+	// TotalConnections is the number of connections accepted so far
+	TotalConnections uint64
+	// RejectedConnections is the number of connections refused because
+	// of the connection limit
+	RejectedConnections uint64
+	// BytesIn and BytesOut are the bytes proxied from the clients to the
+	// container and back
+	BytesIn  uint64
+	BytesOut uint64
+}
+
+// EncryptionState is the datapath encryption state of a driver
+type EncryptionState struct {
+	// KeyTags identify the datapath keys of the driver, the primary key
+	// first. A tag is the Lamport time of the creation of the key.
+	KeyTags []uint32
+	// Peers are the remote nodes the datapath traffic is encrypted with
+	Peers []EncryptionPeer
+}
+
+// EncryptionPeer is the datapath encryption state between the local node
+// and a remote node
+type EncryptionPeer struct {
+	Node    string
+	Backend string
+	// SPIs are the IPsec Security Parameter Indices of the flows to and
+	// from the node, one pair for each key in the order of the keys
+	SPIs []EncryptionSPI
+	// InSync tells whether the state programmed for the node matches
+	// the current keys
+	InSync bool
+}
+
+// EncryptionSPI is a pair of IPsec Security Parameter Indices
+type EncryptionSPI struct {
+	Forward uint32
+	Reverse uint32
+}
+
+// StaticPeer is a remote node of the networks whose peers are configured
+// statically, along with the endpoints it hosts
+type StaticPeer struct {
+	// VTEP is the tunnel endpoint address of the node
+	VTEP      net.IP
+	Endpoints []StaticPeerEndpoint
+}
+
+// StaticPeerEndpoint is an endpoint hosted by a static peer. The network of
+// the endpoint is the one whose subnet contains the IP address.
+type StaticPeerEndpoint struct {
+	IP  *net.IPNet
+	MAC net.HardwareAddr
+}
+
+func (m PortMapping) String() string {
+	return fmt.Sprintf("%s/%s -> %s",
+		net.JoinHostPort(m.HostIP.String(), fmt.Sprintf("%d", m.HostPort)), m.Proto,
+		net.JoinHostPort(m.ContainerIP.String(), fmt.Sprintf("%d", m.ContainerPort)))
+}
+
 // ErrInvalidProtocolBinding is returned when the port binding protocol is not valid.
 type ErrInvalidProtocolBinding string
 
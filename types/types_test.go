@@ -84,6 +84,32 @@ func TestTransportPortBindingConv(t *testing.T) {
 	}
 }
 
+func TestPortBindingSourceCIDRs(t *testing.T) {
+	pb := PortBinding{Proto: TCP, Port: 22, HostPort: 2222, SourceCIDRs: []string{"192.0.2.0/24"}}
+
+	cp := pb.GetCopy()
+	assert.Check(t, pb.Equal(&cp))
+	cp.SourceCIDRs[0] = "198.51.100.0/24"
+	assert.Check(t, is.Equal(pb.SourceCIDRs[0], "192.0.2.0/24"), "the copy shares the source CIDRs")
+	assert.Check(t, !pb.Equal(&cp))
+
+	cp.SourceCIDRs = nil
+	assert.Check(t, !pb.Equal(&cp))
+}
+
+func TestPortBindingValidate(t *testing.T) {
+	assert.Check(t, PortBinding{Proto: TCP, Port: 80, ProxyProtocol: ProxyProtocolV2}.Validate())
+	assert.Check(t, PortBinding{Proto: UDP, Port: 53}.Validate())
+
+	err := PortBinding{Proto: TCP, Port: 80, ProxyProtocol: "v3"}.Validate()
+	assert.Check(t, is.ErrorContains(err, "invalid PROXY protocol version"))
+	_, ok := err.(BadRequestError)
+	assert.Check(t, ok, "expected a bad request error")
+
+	err = PortBinding{Proto: UDP, Port: 53, ProxyProtocol: ProxyProtocolV1}.Validate()
+	assert.Check(t, is.ErrorContains(err, "only supported for tcp"))
+}
+
 func TestErrorConstructors(t *testing.T) {
 	var err error
 